@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"time"
+
 	"github.com/caarlos0/env/v6"
 	"github.com/maxsnegir/url-shortener/internal/utils"
 )
@@ -14,6 +17,13 @@ const (
 	DatabaseDsn     = ""
 )
 
+const (
+	// IDStrategyHash идентификатор ссылки - хеш исходного URL
+	IDStrategyHash = "hash"
+	// IDStrategyCounter идентификатор ссылки - значение счетчика в base62
+	IDStrategyCounter = "counter"
+)
+
 // Config общие настройки для сервиса
 type Config struct {
 	Server struct {
@@ -23,14 +33,106 @@ type Config struct {
 		LogLevel string
 	}
 	Shortener struct {
-		BaseURL string
+		BaseURL     string
+		IDStrategy  string `env:"ID_STRATEGY" envDefault:"hash"`
+		IDBlockSize uint64 `env:"ID_BLOCK_SIZE" envDefault:"100"`
+		// RedirectCode код ответа новых ссылок, для которых он не задан: 301, 302, 307 или 308
+		RedirectCode int `env:"REDIRECT_CODE" envDefault:"307"`
+		// PrivateLinks разрешить ссылки с длинными случайными идентификаторами
+		PrivateLinks bool `env:"PRIVATE_LINKS" envDefault:"false"`
+	}
+	// Limits ограничения на создание ссылок, ноль отключает ограничение. Частота запросов,
+	// квоты и размер пакета по умолчанию не ограничены и включаются переменными окружения,
+	// например RATE_LIMIT_USER_RPS=5 RATE_LIMIT_IP_RPS=10 QUOTA_DAILY_LINKS=1000 MAX_BATCH_SIZE=1000.
+	Limits struct {
+		// UserRate запросов в секунду на пользователя, UserBurst - сколько можно сделать подряд
+		UserRate  float64 `env:"RATE_LIMIT_USER_RPS" envDefault:"0"`
+		UserBurst int     `env:"RATE_LIMIT_USER_BURST" envDefault:"20"`
+		IPRate    float64 `env:"RATE_LIMIT_IP_RPS" envDefault:"0"`
+		IPBurst   int     `env:"RATE_LIMIT_IP_BURST" envDefault:"50"`
+		// TrustProxyHeaders брать адрес клиента из X-Forwarded-For, только за доверенным прокси
+		TrustProxyHeaders bool  `env:"TRUST_PROXY_HEADERS" envDefault:"false"`
+		MaxBodySize       int64 `env:"MAX_REQUEST_BODY_SIZE" envDefault:"1048576"`
+		// DailyLinks и TotalLinks квоты ссылок на пользователя, дневная сбрасывается в полночь UTC
+		DailyLinks   int64 `env:"QUOTA_DAILY_LINKS" envDefault:"0"`
+		TotalLinks   int64 `env:"QUOTA_TOTAL_LINKS" envDefault:"0"`
+		MaxBatchSize int   `env:"MAX_BATCH_SIZE" envDefault:"0"`
+		// Enumeration защита от перебора ссылок по числу ответов 404 клиенту за окно
+		Enumeration struct {
+			Window     time.Duration `env:"ENUMERATION_WINDOW" envDefault:"1m"`
+			SlowAfter  int           `env:"ENUMERATION_SLOW_AFTER" envDefault:"20"`
+			BaseDelay  time.Duration `env:"ENUMERATION_BASE_DELAY" envDefault:"100ms"`
+			MaxDelay   time.Duration `env:"ENUMERATION_MAX_DELAY" envDefault:"3s"`
+			BlockAfter int           `env:"ENUMERATION_BLOCK_AFTER" envDefault:"100"`
+			BlockFor   time.Duration `env:"ENUMERATION_BLOCK_FOR" envDefault:"15m"`
+		}
 	}
 	Authorization struct {
-		SecretKey string `env:"SECRET_KEY" envDefault:"super_secret"`
+		// SecretKeys ключи через запятую: первым подписываются новые токены, остальные только проверяются
+		SecretKeys []string `env:"SECRET_KEY" envDefault:"super_secret" envSeparator:","`
+		// AcceptLegacyTokens принимать токены старого формата с фиксированным nonce
+		AcceptLegacyTokens bool          `env:"ACCEPT_LEGACY_TOKENS" envDefault:"true"`
+		TokenTTL           time.Duration `env:"AUTH_TOKEN_TTL" envDefault:"720h"`
+		// TokenRefreshBefore за сколько до истечения токен перевыпускается
+		TokenRefreshBefore time.Duration `env:"AUTH_TOKEN_REFRESH_BEFORE" envDefault:"168h"`
+		// TokenExpiredGrace сколько после истечения токен еще обменивается на новый для того же пользователя
+		TokenExpiredGrace time.Duration `env:"AUTH_TOKEN_EXPIRED_GRACE" envDefault:"168h"`
+		// Admins токены пользователей с ролью администратора, через запятую или флагом -admin
+		Admins []string `env:"ADMIN_USER_TOKENS" envSeparator:","`
+		// CSRFTrustedOrigins источники через запятую, с которых кроме BASE_URL принимаются
+		// изменяющие запросы с куками
+		CSRFTrustedOrigins []string `env:"CSRF_TRUSTED_ORIGINS" envSeparator:","`
+		// SessionTTL время жизни сессии учетной записи
+		SessionTTL time.Duration `env:"ACCOUNT_SESSION_TTL" envDefault:"720h"`
+		Cookie     struct {
+			Path     string `env:"AUTH_COOKIE_PATH" envDefault:"/"`
+			Domain   string `env:"AUTH_COOKIE_DOMAIN"`
+			Secure   bool   `env:"AUTH_COOKIE_SECURE" envDefault:"false"`
+			HTTPOnly bool   `env:"AUTH_COOKIE_HTTP_ONLY" envDefault:"true"`
+			// SameSite lax, strict или none
+			SameSite string `env:"AUTH_COOKIE_SAME_SITE" envDefault:"lax"`
+		}
+		// OIDC вход через провайдер OpenID Connect, включается заданием OIDC_ISSUER
+		OIDC struct {
+			Issuer       string   `env:"OIDC_ISSUER"`
+			ClientID     string   `env:"OIDC_CLIENT_ID"`
+			ClientSecret string   `env:"OIDC_CLIENT_SECRET"`
+			RedirectURL  string   `env:"OIDC_REDIRECT_URL"`
+			Scopes       []string `env:"OIDC_SCOPES" envDefault:"openid,profile,email" envSeparator:","`
+			// PostLoginURL куда вернуть пользователя после входа
+			PostLoginURL string `env:"OIDC_POST_LOGIN_URL" envDefault:"/"`
+		}
 	}
 	Storage struct {
 		FileStoragePath string
 		DatabaseDSN     string
+		// DatabaseShards DSN шардов через запятую, новые шарды добавляются в конец
+		DatabaseShards []string `env:"DATABASE_SHARDS" envSeparator:","`
+		Retry          struct {
+			MaxAttempts int           `env:"DB_RETRY_MAX_ATTEMPTS" envDefault:"3"`
+			BaseDelay   time.Duration `env:"DB_RETRY_BASE_DELAY" envDefault:"50ms"`
+			MaxDelay    time.Duration `env:"DB_RETRY_MAX_DELAY" envDefault:"1s"`
+		}
+		CircuitBreaker struct {
+			FailureThreshold int           `env:"DB_BREAKER_FAILURE_THRESHOLD" envDefault:"5"`
+			OpenTimeout      time.Duration `env:"DB_BREAKER_OPEN_TIMEOUT" envDefault:"10s"`
+		}
+		// Snapshot локальная копия ссылок для режима только чтения при недоступности базы
+		Snapshot struct {
+			Path     string        `env:"SNAPSHOT_PATH"`
+			Interval time.Duration `env:"SNAPSHOT_INTERVAL" envDefault:"1m"`
+		}
+		// Cluster узел кластера Raft, хранящего ссылки без внешней базы
+		Cluster struct {
+			NodeID   string `env:"RAFT_NODE_ID"`
+			BindAddr string `env:"RAFT_BIND_ADDR"`
+			// Peers остальные узлы кластера в виде id=host:port через запятую
+			Peers             []string      `env:"RAFT_PEERS" envSeparator:","`
+			DataDir           string        `env:"RAFT_DATA_DIR"`
+			ElectionTimeout   time.Duration `env:"RAFT_ELECTION_TIMEOUT" envDefault:"300ms"`
+			HeartbeatInterval time.Duration `env:"RAFT_HEARTBEAT_INTERVAL" envDefault:"50ms"`
+			SnapshotThreshold uint64        `env:"RAFT_SNAPSHOT_THRESHOLD" envDefault:"1024"`
+		}
 	}
 }
 
@@ -40,15 +142,35 @@ func NewConfig() (Config, error) {
 	if err := env.Parse(&cfg); err != nil {
 		return cfg, err
 	}
+	cfg.Authorization.SecretKeys = nonEmpty(cfg.Authorization.SecretKeys)
+	if len(cfg.Authorization.SecretKeys) == 0 {
+		return cfg, errors.New("SECRET_KEY must contain at least one key")
+	}
 	// Server
 	flag.StringVar(&cfg.Server.ServerAddress, "a", utils.GetEnv("SERVER_ADDRESS", ServerAddress), "server address")
 	// Logger
 	flag.StringVar(&cfg.Logger.LogLevel, "l", utils.GetEnv("LOG_LEVEL", LogLevel), "set log level")
 	// Shortener
 	flag.StringVar(&cfg.Shortener.BaseURL, "b", utils.GetEnv("BASE_URL", BaseURL), "base shortener address")
+	// Authorization
+	flag.Func("admin", "grant admin role to user token (repeatable)", func(userToken string) error {
+		cfg.Authorization.Admins = append(cfg.Authorization.Admins, userToken)
+		return nil
+	})
 	// Storage
 	flag.StringVar(&cfg.Storage.FileStoragePath, "f", utils.GetEnv("FILE_STORAGE_PATH", FileStoragePath), "name of file storage")
 	flag.StringVar(&cfg.Storage.DatabaseDSN, "d", utils.GetEnv("DATABASE_DSN", DatabaseDsn), "db dsn")
 	flag.Parse()
 	return cfg, nil
 }
+
+// nonEmpty значения списка без пустых, например из лишних запятых в SECRET_KEY
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
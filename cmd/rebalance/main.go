@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/logging"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// Переносит ссылки между шардами после изменения DATABASE_SHARDS
+func main() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := logging.NewLogger(cfg.Logger.LogLevel)
+	if len(cfg.Storage.DatabaseShards) == 0 {
+		logger.Fatal("DATABASE_SHARDS is empty")
+	}
+	ctx := context.Background()
+	shardedStorage, err := storage.NewShardedPostgresStorage(ctx, cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func() {
+		if err := shardedStorage.Shutdown(ctx); err != nil {
+			logger.Error(err)
+		}
+	}()
+
+	moved, err := shardedStorage.Rebalance(ctx)
+	if err != nil {
+		logger.Errorf("rebalancing stopped after moving %d urls: %s", moved, err)
+		return
+	}
+	logger.Infof("rebalancing finished, moved %d urls", moved)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/maxsnegir/url-shortener/internal/auth"
 	"github.com/maxsnegir/url-shortener/internal/handlers"
 	"github.com/maxsnegir/url-shortener/internal/logging"
+	"github.com/maxsnegir/url-shortener/internal/ratelimit"
 	"github.com/maxsnegir/url-shortener/internal/server"
 	"github.com/maxsnegir/url-shortener/internal/services"
 	"github.com/maxsnegir/url-shortener/internal/storage"
@@ -29,13 +30,79 @@ func main() {
 		logger.Fatal(err)
 	}
 
-	shortener := services.NewShortener(urlStorage, cfg.Shortener.BaseURL)
-	authorization, err := auth.NewCookieAuthentication(cfg.Authorization.SecretKey)
+	limits := cfg.Limits
+	shortenerOpts := []services.Option{services.WithQuota(services.Quota{
+		DailyLinks:   limits.DailyLinks,
+		TotalLinks:   limits.TotalLinks,
+		MaxBatchSize: limits.MaxBatchSize,
+	})}
+	if !services.IsRedirectCodeValid(cfg.Shortener.RedirectCode) {
+		logger.Fatalf("unsupported REDIRECT_CODE %d", cfg.Shortener.RedirectCode)
+	}
+	shortenerOpts = append(shortenerOpts, services.WithRedirectCode(cfg.Shortener.RedirectCode))
+	if cfg.Shortener.PrivateLinks {
+		shortenerOpts = append(shortenerOpts, services.WithPrivateLinks())
+	}
+	if cfg.Shortener.IDStrategy == config.IDStrategyCounter {
+		idAllocator := services.NewIDAllocator(urlStorage, cfg.Shortener.IDBlockSize)
+		shortenerOpts = append(shortenerOpts, services.WithIDAllocator(idAllocator))
+	}
+	shortener := services.NewShortener(urlStorage, cfg.Shortener.BaseURL, shortenerOpts...)
+	authCfg := cfg.Authorization
+	sameSite, err := auth.ParseSameSite(authCfg.Cookie.SameSite)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	authorization, err := auth.NewCookieAuthentication(
+		authCfg.SecretKeys[0],
+		auth.WithPreviousKeys(authCfg.SecretKeys[1:]...),
+		auth.WithLegacyTokens(authCfg.AcceptLegacyTokens),
+		auth.WithTokenLifetime(auth.TokenLifetime{
+			TTL:           authCfg.TokenTTL,
+			RefreshBefore: authCfg.TokenRefreshBefore,
+			ExpiredGrace:  authCfg.TokenExpiredGrace,
+		}),
+		auth.WithCookieOptions(auth.CookieOptions{
+			Path:     authCfg.Cookie.Path,
+			Domain:   authCfg.Cookie.Domain,
+			Secure:   authCfg.Cookie.Secure,
+			HTTPOnly: authCfg.Cookie.HTTPOnly,
+			SameSite: sameSite,
+		}),
+	)
 	if err != nil {
 		logger.Fatal(err)
 	}
 	urlHandler := handlers.NewURLHandler(shortener, authorization, logger)
-	s := server.NewServer(cfg, logger, urlHandler)
+	apiKeyHandler := handlers.NewAPIKeyHandler(services.NewAPIKeyService(urlStorage), logger)
+	accountService := services.NewAccountService(urlStorage, cfg.Authorization.SessionTTL)
+	accountHandler := handlers.NewAccountHandler(accountService, authorization, cfg.Authorization.SessionTTL, logger)
+	adminHandler := handlers.NewAdminHandler(services.NewAdminService(urlStorage, cfg.Shortener.BaseURL, cfg.Authorization.Admins), logger)
+	workspaceHandler := handlers.NewWorkspaceHandler(services.NewWorkspaceService(urlStorage), logger)
+	trustedOrigins := append([]string{cfg.Shortener.BaseURL}, cfg.Authorization.CSRFTrustedOrigins...)
+	csrfHandler := handlers.NewCSRFHandler(trustedOrigins, logger)
+	rateLimitHandler := handlers.NewRateLimitHandler(handlers.RateLimits{
+		UserRate:          limits.UserRate,
+		UserBurst:         limits.UserBurst,
+		IPRate:            limits.IPRate,
+		IPBurst:           limits.IPBurst,
+		TrustProxyHeaders: limits.TrustProxyHeaders,
+		MaxBodySize:       limits.MaxBodySize,
+		Enumeration:       ratelimit.GuardConfig(limits.Enumeration),
+	}, logger)
+	var oidcHandler *handlers.OIDCHandler
+	if oidcCfg := cfg.Authorization.OIDC; oidcCfg.Issuer != "" {
+		provider := auth.NewOIDCProvider(auth.OIDCConfig{
+			Issuer:       oidcCfg.Issuer,
+			ClientID:     oidcCfg.ClientID,
+			ClientSecret: oidcCfg.ClientSecret,
+			RedirectURL:  oidcCfg.RedirectURL,
+			Scopes:       oidcCfg.Scopes,
+		})
+		handler := handlers.NewOIDCHandler(services.NewSSOService(provider, urlStorage), authorization, oidcCfg.PostLoginURL, logger)
+		oidcHandler = &handler
+	}
+	s := server.NewServer(cfg, logger, urlHandler, apiKeyHandler, accountHandler, adminHandler, workspaceHandler, rateLimitHandler, csrfHandler, oidcHandler)
 	go func() {
 		logger.Fatal(s.Start())
 	}()
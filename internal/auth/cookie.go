@@ -3,52 +3,330 @@ package auth
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 )
 
 const AuthorizationCookieName = "AuthToken"
 
+// SessionCookieName кука с токеном сессии учетной записи
+const SessionCookieName = "SessionToken"
+
+// Первый байт токена - версия формата. Токены старого формата (фиксированный nonce)
+// версии не содержат.
+const (
+	// tokenVersionPlain в шифротексте только идентификатор пользователя
+	tokenVersionPlain byte = 1
+	// tokenVersion в шифротексте время выпуска и истечения, затем идентификатор пользователя
+	tokenVersion byte = 2
+	// sealedDataVersion произвольные данные, зашифрованные через Seal. Отдельная версия
+	// не дает выдать такие данные за токен авторизации.
+	sealedDataVersion byte = 3
+)
+
+// tokenTimesSize время выпуска и истечения в unix-секундах
+const tokenTimesSize = 16
+
+var (
+	InvalidTokenError = errors.New("invalid auth token")
+	TokenExpiredError = errors.New("auth token expired")
+)
+
+// TokenInfo расшифрованный токен
+type TokenInfo struct {
+	UserToken string
+	// IssuedAt и ExpiresAt нулевые у токенов старых форматов
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Outdated токен стоит перевыпустить: он подписан не самым новым ключом,
+	// имеет старый формат, скоро истекает или недавно истек
+	Outdated bool
+}
+
+// TokenLifetime время жизни токенов
+type TokenLifetime struct {
+	TTL time.Duration
+	// RefreshBefore за сколько до истечения токен перевыпускается
+	RefreshBefore time.Duration
+	// ExpiredGrace сколько после истечения токен еще можно обменять на новый
+	// для того же пользователя
+	ExpiredGrace time.Duration
+}
+
+// CookieOptions атрибуты куки авторизации
+type CookieOptions struct {
+	Path     string
+	Domain   string
+	Secure   bool
+	HTTPOnly bool
+	SameSite http.SameSite
+}
+
+// ParseSameSite переводит значение из конфига (lax, strict, none) в http.SameSite
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteDefaultMode, fmt.Errorf("unknown SameSite value %q", value)
+	}
+}
+
+type Option func(a *CookieAuthentication) error
+
+// WithPreviousKeys ключи, которыми токены больше не подписываются, но еще принимаются
+func WithPreviousKeys(secretKeys ...string) Option {
+	return func(a *CookieAuthentication) error {
+		for _, secret := range secretKeys {
+			key, err := newSecretKey(secret)
+			if err != nil {
+				return err
+			}
+			a.keys = append(a.keys, key)
+		}
+		return nil
+	}
+}
+
+// WithLegacyTokens принимать токены старого формата с фиксированным nonce на время миграции
+func WithLegacyTokens(accept bool) Option {
+	return func(a *CookieAuthentication) error {
+		a.acceptLegacy = accept
+		return nil
+	}
+}
+
+// WithTokenLifetime время жизни, обновления и льготный период токенов
+func WithTokenLifetime(lifetime TokenLifetime) Option {
+	return func(a *CookieAuthentication) error {
+		if lifetime.TTL <= 0 {
+			return errors.New("token TTL must be positive")
+		}
+		a.lifetime = lifetime
+		return nil
+	}
+}
+
+func WithCookieOptions(options CookieOptions) Option {
+	return func(a *CookieAuthentication) error {
+		a.cookieOptions = options
+		return nil
+	}
+}
+
+// WithClock источник текущего времени, используется в тестах
+func WithClock(now func() time.Time) Option {
+	return func(a *CookieAuthentication) error {
+		a.now = now
+		return nil
+	}
+}
+
 type CookieAuthentication struct {
-	key    [sha256.Size]byte
+	// keys первый ключ подписывает новые токены, остальные только проверяют
+	keys          []secretKey
+	acceptLegacy  bool
+	lifetime      TokenLifetime
+	cookieOptions CookieOptions
+	now           func() time.Time
+}
+
+type secretKey struct {
 	aesgcm cipher.AEAD
-	nonce  []byte
+	// legacyNonce nonce, который выводился из ключа в старом формате токенов
+	legacyNonce []byte
 }
 
-func (a *CookieAuthentication) CreateToken() (string, string) {
+func (a CookieAuthentication) CreateToken() (string, string) {
 	userToken := uuid.New().String()
-	encodedUserToken := fmt.Sprintf("%x", a.aesgcm.Seal(nil, a.nonce, []byte(userToken), nil))
-	return userToken, encodedUserToken
+	return userToken, a.EncodeToken(userToken)
 }
 
-func (a *CookieAuthentication) ParseToken(token string) (string, error) {
-	decodedToken, err := hex.DecodeString(token)
-	if err != nil {
-		return "", nil
+// EncodeToken шифрует userToken новейшим ключом: версия | случайный nonce | шифротекст
+func (a CookieAuthentication) EncodeToken(userToken string) string {
+	issuedAt := a.now()
+	payload := make([]byte, tokenTimesSize, tokenTimesSize+len(userToken))
+	binary.BigEndian.PutUint64(payload[:8], uint64(issuedAt.Unix()))
+	binary.BigEndian.PutUint64(payload[8:], uint64(issuedAt.Add(a.lifetime.TTL).Unix()))
+	payload = append(payload, userToken...)
+	return a.seal(tokenVersion, payload)
+}
+
+// Seal шифрует произвольные данные для хранения на стороне клиента
+func (a CookieAuthentication) Seal(data []byte) string {
+	return a.seal(sealedDataVersion, data)
+}
+
+// Open расшифровывает данные, зашифрованные через Seal любым из ключей
+func (a CookieAuthentication) Open(sealed string) ([]byte, error) {
+	decoded, err := hex.DecodeString(sealed)
+	if err != nil || len(decoded) == 0 || decoded[0] != sealedDataVersion {
+		return nil, InvalidTokenError
+	}
+	data, _, ok := a.open(decoded)
+	if !ok {
+		return nil, InvalidTokenError
+	}
+	return data, nil
+}
+
+func (a CookieAuthentication) seal(version byte, payload []byte) string {
+	aesgcm := a.keys[0].aesgcm
+	token := make([]byte, 1+aesgcm.NonceSize(), 1+aesgcm.NonceSize()+len(payload)+aesgcm.Overhead())
+	token[0] = version
+	nonce := token[1:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
 	}
-	userToken, err := a.aesgcm.Open(nil, a.nonce, decodedToken, nil)
+	return hex.EncodeToString(aesgcm.Seal(token, nonce, payload, nil))
+}
+
+// open расшифровывает версию | nonce | шифротекст и возвращает номер подошедшего ключа
+func (a CookieAuthentication) open(decoded []byte) ([]byte, int, bool) {
+	for i, key := range a.keys {
+		nonceSize := key.aesgcm.NonceSize()
+		if len(decoded) < 1+nonceSize {
+			break
+		}
+		payload, err := key.aesgcm.Open(nil, decoded[1:1+nonceSize], decoded[1+nonceSize:], nil)
+		if err == nil {
+			return payload, i, true
+		}
+	}
+	return nil, 0, false
+}
+
+// Cookie кука авторизации с токеном
+func (a CookieAuthentication) Cookie(token string) *http.Cookie {
+	return a.NamedCookie(AuthorizationCookieName, token, a.lifetime.TTL)
+}
+
+// NamedCookie кука с теми же атрибутами, что и кука авторизации. Нулевой maxAge удаляет куку.
+func (a CookieAuthentication) NamedCookie(name, value string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     a.cookieOptions.Path,
+		Domain:   a.cookieOptions.Domain,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   a.cookieOptions.Secure,
+		HttpOnly: a.cookieOptions.HTTPOnly,
+		SameSite: a.cookieOptions.SameSite,
+	}
+	if maxAge <= 0 {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// ParseToken в отличие от ParseTokenInfo не принимает истекшие токены
+func (a CookieAuthentication) ParseToken(token string) (string, error) {
+	info, err := a.ParseTokenInfo(token)
 	if err != nil {
 		return "", err
 	}
-	return string(userToken), nil
+	if !info.ExpiresAt.IsZero() && !a.now().Before(info.ExpiresAt) {
+		return "", TokenExpiredError
+	}
+	return info.UserToken, nil
 }
 
-func NewCookieAuthentication(secretKey string) (CookieAuthentication, error) {
-	var cockieAuth CookieAuthentication
-	key := sha256.Sum256([]byte(secretKey))
+// ParseTokenInfo расшифровывает токен. Токен, истекший не более ExpiredGrace назад,
+// возвращается с Outdated, чтобы его можно было перевыпустить тому же пользователю;
+// истекший раньше - TokenExpiredError.
+func (a CookieAuthentication) ParseTokenInfo(token string) (TokenInfo, error) {
+	decodedToken, err := hex.DecodeString(token)
+	if err != nil {
+		return TokenInfo{}, InvalidTokenError
+	}
+	if len(decodedToken) > 0 && (decodedToken[0] == tokenVersion || decodedToken[0] == tokenVersionPlain) {
+		if payload, keyIndex, ok := a.open(decodedToken); ok {
+			if decodedToken[0] == tokenVersionPlain {
+				return TokenInfo{UserToken: string(payload), Outdated: true}, nil
+			}
+			return a.checkLifetime(payload, keyIndex > 0)
+		}
+	}
+	if a.acceptLegacy {
+		for _, key := range a.keys {
+			userToken, err := key.aesgcm.Open(nil, key.legacyNonce, decodedToken, nil)
+			if err == nil {
+				return TokenInfo{UserToken: string(userToken), Outdated: true}, nil
+			}
+		}
+	}
+	return TokenInfo{}, InvalidTokenError
+}
+
+func (a CookieAuthentication) checkLifetime(payload []byte, outdated bool) (TokenInfo, error) {
+	if len(payload) < tokenTimesSize {
+		return TokenInfo{}, InvalidTokenError
+	}
+	info := TokenInfo{
+		UserToken: string(payload[tokenTimesSize:]),
+		IssuedAt:  time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0),
+		ExpiresAt: time.Unix(int64(binary.BigEndian.Uint64(payload[8:tokenTimesSize])), 0),
+		Outdated:  outdated,
+	}
+	now := a.now()
+	if now.After(info.ExpiresAt.Add(a.lifetime.ExpiredGrace)) {
+		return TokenInfo{}, TokenExpiredError
+	}
+	if !now.Before(info.ExpiresAt.Add(-a.lifetime.RefreshBefore)) {
+		info.Outdated = true
+	}
+	return info, nil
+}
+
+func newSecretKey(secret string) (secretKey, error) {
+	key := sha256.Sum256([]byte(secret))
 	aesblock, err := aes.NewCipher(key[:])
 	if err != nil {
-		return cockieAuth, err
+		return secretKey{}, err
 	}
 	aesgcm, err := cipher.NewGCM(aesblock)
 	if err != nil {
-		return cockieAuth, err
+		return secretKey{}, err
+	}
+	return secretKey{aesgcm: aesgcm, legacyNonce: key[len(key)-aesgcm.NonceSize():]}, nil
+}
+
+// NewCookieAuthentication secret ключ для новых токенов, предыдущие ключи передаются через WithPreviousKeys
+func NewCookieAuthentication(secret string, opts ...Option) (CookieAuthentication, error) {
+	cookieAuth := CookieAuthentication{
+		lifetime: TokenLifetime{
+			TTL:           30 * 24 * time.Hour,
+			RefreshBefore: 7 * 24 * time.Hour,
+			ExpiredGrace:  7 * 24 * time.Hour,
+		},
+		cookieOptions: CookieOptions{Path: "/", HTTPOnly: true, SameSite: http.SameSiteLaxMode},
+		now:           time.Now,
+	}
+	key, err := newSecretKey(secret)
+	if err != nil {
+		return cookieAuth, err
+	}
+	cookieAuth.keys = append(cookieAuth.keys, key)
+	for _, opt := range opts {
+		if err := opt(&cookieAuth); err != nil {
+			return cookieAuth, err
+		}
 	}
-	nonce := key[len(key)-aesgcm.NonceSize():]
-	cockieAuth.key = key
-	cockieAuth.aesgcm = aesgcm
-	cockieAuth.nonce = nonce
-	return cockieAuth, nil
+	return cookieAuth, nil
 }
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// legacyToken токен в формате до перехода на случайный nonce
+func legacyToken(t *testing.T, secret, userToken string) string {
+	key, err := newSecretKey(secret)
+	require.NoError(t, err)
+	return fmt.Sprintf("%x", key.aesgcm.Seal(nil, key.legacyNonce, []byte(userToken), nil))
+}
+
+func TestCreateTokenUsesRandomNonce(t *testing.T) {
+	a, err := NewCookieAuthentication("secret")
+	require.NoError(t, err)
+
+	userToken, encodedToken := a.CreateToken()
+	require.NotEqual(t, encodedToken, a.EncodeToken(userToken))
+
+	tokenInfo, err := a.ParseTokenInfo(encodedToken)
+	require.NoError(t, err)
+	require.Equal(t, userToken, tokenInfo.UserToken)
+	require.False(t, tokenInfo.Outdated)
+}
+
+func TestParseTokenKeyRotation(t *testing.T) {
+	oldAuth, err := NewCookieAuthentication("old")
+	require.NoError(t, err)
+	rotatedAuth, err := NewCookieAuthentication("new", WithPreviousKeys("old"))
+	require.NoError(t, err)
+	otherAuth, err := NewCookieAuthentication("other")
+	require.NoError(t, err)
+
+	userToken, encodedToken := oldAuth.CreateToken()
+	tokenInfo, err := rotatedAuth.ParseTokenInfo(encodedToken)
+	require.NoError(t, err)
+	require.Equal(t, userToken, tokenInfo.UserToken)
+	require.True(t, tokenInfo.Outdated)
+
+	_, err = otherAuth.ParseToken(encodedToken)
+	require.ErrorIs(t, err, InvalidTokenError)
+	// Новые токены подписываются новым ключом
+	_, err = oldAuth.ParseToken(rotatedAuth.EncodeToken(userToken))
+	require.ErrorIs(t, err, InvalidTokenError)
+}
+
+func TestParseTokenLegacyFormat(t *testing.T) {
+	const userToken = "8f6b2e5e-7bde-4c40-9d0b-3a2f0e3b1c11"
+	token := legacyToken(t, "secret", userToken)
+
+	tests := []struct {
+		name    string
+		secret  string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "Accepted during migration", secret: "secret", opts: []Option{WithLegacyTokens(true)}},
+		{name: "Accepted with previous key", secret: "new_secret", opts: []Option{WithPreviousKeys("secret"), WithLegacyTokens(true)}},
+		{name: "Rejected after migration", secret: "secret", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewCookieAuthentication(tt.secret, tt.opts...)
+			require.NoError(t, err)
+			tokenInfo, err := a.ParseTokenInfo(token)
+			if tt.wantErr {
+				require.ErrorIs(t, err, InvalidTokenError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, TokenInfo{UserToken: userToken, Outdated: true}, tokenInfo)
+		})
+	}
+}
+
+func TestParseTokenMalformed(t *testing.T) {
+	a, err := NewCookieAuthentication("secret", WithLegacyTokens(true))
+	require.NoError(t, err)
+	for _, token := range []string{"", "not hex", "01", fmt.Sprintf("%x", sha256.Sum256([]byte("garbage")))} {
+		_, err := a.ParseToken(token)
+		require.ErrorIs(t, err, InvalidTokenError, token)
+	}
+}
+
+func TestTokenLifetime(t *testing.T) {
+	lifetime := TokenLifetime{TTL: 10 * time.Hour, RefreshBefore: 2 * time.Hour, ExpiredGrace: time.Hour}
+	issuedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := issuedAt
+	a, err := NewCookieAuthentication("secret", WithTokenLifetime(lifetime), WithClock(func() time.Time { return now }))
+	require.NoError(t, err)
+	userToken, encodedToken := a.CreateToken()
+
+	tests := []struct {
+		name         string
+		elapsed      time.Duration
+		wantOutdated bool
+		wantErr      error
+		// wantParseErr ошибка ParseToken, который истекшие токены не принимает
+		wantParseErr error
+	}{
+		{name: "Fresh", elapsed: time.Hour},
+		{name: "Close to expiry", elapsed: 9 * time.Hour, wantOutdated: true},
+		{name: "Expired within grace", elapsed: 10*time.Hour + 30*time.Minute, wantOutdated: true, wantParseErr: TokenExpiredError},
+		{name: "Expired", elapsed: 12 * time.Hour, wantErr: TokenExpiredError, wantParseErr: TokenExpiredError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = issuedAt.Add(tt.elapsed)
+			tokenInfo, err := a.ParseTokenInfo(encodedToken)
+			require.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				require.Equal(t, userToken, tokenInfo.UserToken)
+				require.Equal(t, tt.wantOutdated, tokenInfo.Outdated)
+				require.True(t, tokenInfo.IssuedAt.Equal(issuedAt))
+				require.True(t, tokenInfo.ExpiresAt.Equal(issuedAt.Add(lifetime.TTL)))
+			}
+			_, err = a.ParseToken(encodedToken)
+			require.ErrorIs(t, err, tt.wantParseErr)
+		})
+	}
+}
+
+func TestCookieAttributes(t *testing.T) {
+	a, err := NewCookieAuthentication("secret",
+		WithTokenLifetime(TokenLifetime{TTL: time.Hour}),
+		WithCookieOptions(CookieOptions{Path: "/", Secure: true, HTTPOnly: true, SameSite: http.SameSiteStrictMode}),
+	)
+	require.NoError(t, err)
+	cookie := a.Cookie("token")
+	require.Equal(t, AuthorizationCookieName, cookie.Name)
+	require.Equal(t, "/", cookie.Path)
+	require.Equal(t, 3600, cookie.MaxAge)
+	require.True(t, cookie.Secure)
+	require.True(t, cookie.HttpOnly)
+	require.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+
+	_, err = ParseSameSite("sometimes")
+	require.Error(t, err)
+}
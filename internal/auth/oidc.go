@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+// clockSkew допустимое расхождение часов с провайдером при проверке exp и iat
+const clockSkew = time.Minute
+
+// oidcNamespace пространство имен UUID v5 для токенов пользователей из OIDC
+var oidcNamespace = uuid.MustParse("5b4b3b4e-3d8c-4b7e-9a55-7f0c1c3a9e21")
+
+var InvalidIDTokenError = errors.New("invalid id_token")
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCIdentity пользователь, подтвержденный провайдером
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+}
+
+// UserToken постоянный токен пользователя: один и тот же для пары issuer и subject
+func (i OIDCIdentity) UserToken() string {
+	return uuid.NewSHA1(oidcNamespace, []byte(i.Issuer+"\n"+i.Subject)).String()
+}
+
+// IsIdentityToken токен выдан пользователю провайдера, а не анонимному: анонимные токены - UUID v4
+func IsIdentityToken(userToken string) bool {
+	id, err := uuid.Parse(userToken)
+	return err == nil && id.Version() == 5
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	IssuedAt  int64           `json:"iat"`
+	Nonce     string          `json:"nonce"`
+	Email     string          `json:"email"`
+	Name      string          `json:"name"`
+}
+
+// OIDCProvider вход через OpenID Connect по authorization code flow с PKCE.
+// Настройки провайдера и его ключи загружаются при первом обращении.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+// AuthCodeURL адрес провайдера, на который отправляется пользователь.
+// verifier - секрет PKCE, провайдеру передается только его хеш.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange обменивает код авторизации на id_token и проверяет его
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (OIDCIdentity, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.doJSON(request, &tokenResponse); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("oidc: token exchange: %w", err)
+	}
+	return p.verifyIDToken(ctx, tokenResponse.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken, nonce string) (OIDCIdentity, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return OIDCIdentity{}, InvalidIDTokenError
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return OIDCIdentity{}, err
+	}
+	if header.Alg != "RS256" {
+		return OIDCIdentity{}, fmt.Errorf("%w: unsupported alg %q", InvalidIDTokenError, header.Alg)
+	}
+	key, err := p.getKey(ctx, header.Kid)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return OIDCIdentity{}, InvalidIDTokenError
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: bad signature", InvalidIDTokenError)
+	}
+
+	var claims idTokenClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return OIDCIdentity{}, err
+	}
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	now := p.now()
+	switch {
+	case claims.Issuer != discovery.Issuer:
+		return OIDCIdentity{}, fmt.Errorf("%w: unexpected issuer", InvalidIDTokenError)
+	case !audienceContains(claims.Audience, p.cfg.ClientID):
+		return OIDCIdentity{}, fmt.Errorf("%w: unexpected audience", InvalidIDTokenError)
+	case !now.Before(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+		return OIDCIdentity{}, fmt.Errorf("%w: expired", InvalidIDTokenError)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return OIDCIdentity{}, fmt.Errorf("%w: nonce mismatch", InvalidIDTokenError)
+	case claims.Subject == "":
+		return OIDCIdentity{}, fmt.Errorf("%w: empty subject", InvalidIDTokenError)
+	}
+	return OIDCIdentity{Issuer: claims.Issuer, Subject: claims.Subject, Email: claims.Email, Name: claims.Name}, nil
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	discovery := &oidcDiscovery{}
+	if err := p.doJSON(request, discovery); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if discovery.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", discovery.Issuer, p.cfg.Issuer)
+	}
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// getKey при неизвестном kid ключи перезагружаются: провайдер мог их сменить
+func (p *OIDCProvider) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if err := p.loadKeys(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", InvalidIDTokenError, kid)
+}
+
+func (p *OIDCProvider) loadKeys(ctx context.Context) error {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return err
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.doJSON(request, &jwks); err != nil {
+		return fmt.Errorf("oidc: jwks: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return err
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	return nil
+}
+
+func (p *OIDCProvider) doJSON(request *http.Request, v interface{}) error {
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", response.StatusCode, body)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// CodeChallenge хеш секрета PKCE по методу S256
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return InvalidIDTokenError
+	}
+	if err := json.Unmarshal(decoded, v); err != nil {
+		return InvalidIDTokenError
+	}
+	return nil
+}
+
+// audienceContains aud бывает строкой или массивом строк
+func audienceContains(audience json.RawMessage, clientID string) bool {
+	var single string
+	if err := json.Unmarshal(audience, &single); err == nil {
+		return single == clientID
+	}
+	var multiple []string
+	if err := json.Unmarshal(audience, &multiple); err != nil {
+		return false
+	}
+	for _, aud := range multiple {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func NewOIDCProvider(cfg OIDCConfig) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid"}
+	}
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/auth/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+// authorize проходит вход у провайдера и возвращает код авторизации
+func authorize(t *testing.T, provider *OIDCProvider, nonce, verifier string) string {
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	require.NoError(t, err)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusFound, response.StatusCode)
+	location, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "state", location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := oidctest.NewProvider("client", "secret")
+	defer idp.Close()
+	idp.Email = "user@example.com"
+
+	provider := NewOIDCProvider(OIDCConfig{
+		Issuer:       idp.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+	})
+	code := authorize(t, provider, "nonce", "verifier")
+	identity, err := provider.Exchange(context.Background(), code, "verifier", "nonce")
+	require.NoError(t, err)
+	require.Equal(t, OIDCIdentity{Issuer: idp.Issuer(), Subject: "user-1", Email: "user@example.com"}, identity)
+	require.Equal(t, identity.UserToken(), OIDCIdentity{Issuer: idp.Issuer(), Subject: "user-1"}.UserToken())
+	require.NotEqual(t, identity.UserToken(), OIDCIdentity{Issuer: idp.Issuer(), Subject: "user-2"}.UserToken())
+
+	// Код одноразовый
+	_, err = provider.Exchange(context.Background(), code, "verifier", "nonce")
+	require.Error(t, err)
+	// Без верного секрета PKCE код не обменять
+	code = authorize(t, provider, "nonce", "verifier")
+	_, err = provider.Exchange(context.Background(), code, "other verifier", "nonce")
+	require.Error(t, err)
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims map[string]interface{})
+		nonce  string
+	}{
+		{name: "Wrong audience", modify: func(claims map[string]interface{}) { claims["aud"] = "other" }, nonce: "nonce"},
+		{name: "Wrong issuer", modify: func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" }, nonce: "nonce"},
+		{name: "Expired", modify: func(claims map[string]interface{}) {
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		}, nonce: "nonce"},
+		{name: "Empty subject", modify: func(claims map[string]interface{}) { claims["sub"] = "" }, nonce: "nonce"},
+		{name: "Nonce mismatch", nonce: "other nonce"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := oidctest.NewProvider("client", "secret")
+			defer idp.Close()
+			idp.ModifyClaims = tt.modify
+
+			provider := NewOIDCProvider(OIDCConfig{Issuer: idp.Issuer(), ClientID: "client", ClientSecret: "secret"})
+			code := authorize(t, provider, "nonce", "verifier")
+			_, err := provider.Exchange(context.Background(), code, "verifier", tt.nonce)
+			require.ErrorIs(t, err, InvalidIDTokenError)
+		})
+	}
+}
+
+func TestOIDCVerifyIDTokenSignature(t *testing.T) {
+	idp := oidctest.NewProvider("client", "secret")
+	defer idp.Close()
+	provider := NewOIDCProvider(OIDCConfig{Issuer: idp.Issuer(), ClientID: "client", ClientSecret: "secret"})
+
+	// Токен, подписанный ключом другого провайдера с тем же kid
+	other := oidctest.NewProvider("client", "secret")
+	defer other.Close()
+	other.ModifyClaims = func(claims map[string]interface{}) { claims["iss"] = idp.Issuer() }
+
+	_, err := provider.verifyIDToken(context.Background(), idp.IDToken("nonce"), "nonce")
+	require.NoError(t, err)
+	_, err = provider.verifyIDToken(context.Background(), other.IDToken("nonce"), "nonce")
+	require.ErrorIs(t, err, InvalidIDTokenError)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+type AccountHandler struct {
+	BaseHandler
+	accounts       services.AccountService
+	authentication auth.CookieAuthentication
+	sessionTTL     time.Duration
+}
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type accountResponse struct {
+	Username string `json:"username"`
+}
+
+// SessionAuthenticationMiddleware определяет пользователя по куке сессии. Недействительная
+// сессия удаляется, и запрос продолжается как анонимный.
+func (h *AccountHandler) SessionAuthenticationMiddleware(next http.Handler) http.Handler {
+	const timeout = 3 * time.Second
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionCookie, err := r.Cookie(auth.SessionCookieName)
+		if getUserToken(r.Context()) != "" || err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		userToken, err := h.accounts.Authenticate(ctx, sessionCookie.Value)
+		var invalidSessionErr services.InvalidSessionError
+		switch {
+		case errors.As(err, &invalidSessionErr):
+			http.SetCookie(w, h.authentication.NamedCookie(auth.SessionCookieName, "", 0))
+			next.ServeHTTP(w, r)
+		case err != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+			// Переходы по ссылкам не должны ломаться, если хранилище сессий недоступно
+			h.logger.Error(err)
+			next.ServeHTTP(w, r)
+		case err != nil:
+			h.ErrorResponse(w, err)
+		default:
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserTokenKey, userToken)))
+		}
+	})
+}
+
+func (h *AccountHandler) Register() http.HandlerFunc {
+	const timeout = 5 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &credentialsRequest{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		account, sessionToken, err := h.accounts.Register(ctx, anonymousUserToken(h.authentication, r), requestData.Username, requestData.Password)
+		var validationErr services.AccountValidationError
+		var usernameTakenErr services.UsernameTakenError
+		switch {
+		case errors.As(err, &validationErr):
+			h.TextResponse(w, http.StatusBadRequest, err.Error())
+		case errors.As(err, &usernameTakenErr):
+			h.TextResponse(w, http.StatusConflict, err.Error())
+		case err != nil:
+			h.ErrorResponse(w, err)
+		default:
+			h.startSession(w, http.StatusCreated, account, sessionToken)
+		}
+	}
+}
+
+func (h *AccountHandler) Login() http.HandlerFunc {
+	const timeout = 5 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &credentialsRequest{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		account, sessionToken, err := h.accounts.Login(ctx, anonymousUserToken(h.authentication, r), requestData.Username, requestData.Password)
+		var invalidCredentialsErr services.InvalidCredentialsError
+		switch {
+		case errors.As(err, &invalidCredentialsErr):
+			h.TextResponse(w, http.StatusUnauthorized, err.Error())
+		case err != nil:
+			h.ErrorResponse(w, err)
+		default:
+			h.startSession(w, http.StatusOK, account, sessionToken)
+		}
+	}
+}
+
+func (h *AccountHandler) Logout() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if sessionCookie, err := r.Cookie(auth.SessionCookieName); err == nil {
+			if err := h.accounts.Logout(ctx, sessionCookie.Value); err != nil {
+				h.ErrorResponse(w, err)
+				return
+			}
+		}
+		http.SetCookie(w, h.authentication.NamedCookie(auth.SessionCookieName, "", 0))
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
+func (h *AccountHandler) startSession(w http.ResponseWriter, code int, account storage.Account, sessionToken string) {
+	http.SetCookie(w, h.authentication.NamedCookie(auth.SessionCookieName, sessionToken, h.sessionTTL))
+	h.JSONResponse(w, code, accountResponse{Username: account.Username})
+}
+
+func NewAccountHandler(accounts services.AccountService, authentication auth.CookieAuthentication, sessionTTL time.Duration, logger *logrus.Logger) AccountHandler {
+	return AccountHandler{
+		BaseHandler:    BaseHandler{logger: logger},
+		accounts:       accounts,
+		authentication: authentication,
+		sessionTTL:     sessionTTL,
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func newAccountTestRouter() *mux.Router {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	accountHandler := NewAccountHandler(services.NewAccountService(urlStorage, time.Hour), authorization, time.Hour, logrus.New())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", urlHandler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/urls", urlHandler.GetUserURLs()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/register", accountHandler.Register()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/login", accountHandler.Login()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/logout", accountHandler.Logout()).Methods(http.MethodPost)
+	router.Use(accountHandler.SessionAuthenticationMiddleware)
+	router.Use(urlHandler.CookieAuthenticationMiddleware)
+	return router
+}
+
+// browser хранит куки между запросами, как браузер на одном устройстве
+type browser struct {
+	router  http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func newBrowser(router http.Handler) *browser {
+	return &browser{router: router, cookies: make(map[string]*http.Cookie)}
+}
+
+func (b *browser) do(method, target, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	for _, cookie := range b.cookies {
+		request.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	b.router.ServeHTTP(w, request)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(b.cookies, cookie.Name)
+			continue
+		}
+		b.cookies[cookie.Name] = cookie
+	}
+	return w
+}
+
+func (b *browser) userURLs(t *testing.T) []storage.URLData {
+	w := b.do(http.MethodGet, "/api/user/urls", "")
+	if w.Code == http.StatusNoContent {
+		return nil
+	}
+	require.Equal(t, http.StatusOK, w.Code)
+	var userURLs []storage.URLData
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&userURLs))
+	return userURLs
+}
+
+// TestAccountWorksAcrossDevices после входа ссылки видны с любого устройства
+func TestAccountWorksAcrossDevices(t *testing.T) {
+	router := newAccountTestRouter()
+	const credentials = `{"username": "alice", "password": "correct horse"}`
+
+	laptop := newBrowser(router)
+	require.Equal(t, http.StatusCreated, laptop.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/1"}`).Code)
+	require.Equal(t, http.StatusCreated, laptop.do(http.MethodPost, "/api/user/register", credentials).Code)
+	require.Contains(t, laptop.cookies, auth.SessionCookieName)
+	require.True(t, laptop.cookies[auth.SessionCookieName].HttpOnly)
+
+	phone := newBrowser(router)
+	require.Equal(t, http.StatusCreated, phone.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/2"}`).Code)
+	require.Equal(t, http.StatusUnauthorized, phone.do(http.MethodPost, "/api/user/login", `{"username": "alice", "password": "wrong password"}`).Code)
+	require.Equal(t, http.StatusOK, phone.do(http.MethodPost, "/api/user/login", credentials).Code)
+
+	require.Len(t, laptop.userURLs(t), 2)
+	require.Len(t, phone.userURLs(t), 2)
+
+	require.Equal(t, http.StatusNoContent, phone.do(http.MethodPost, "/api/user/logout", "").Code)
+	require.NotContains(t, phone.cookies, auth.SessionCookieName)
+	require.Empty(t, phone.userURLs(t))
+	require.Equal(t, http.StatusConflict, phone.do(http.MethodPost, "/api/user/register", credentials).Code)
+}
+
+// TestLoginDoesNotMergeAnotherAccount вход в другую учетную запись из открытой сессии
+// не передает ей ссылки первой учетной записи
+func TestLoginDoesNotMergeAnotherAccount(t *testing.T) {
+	router := newAccountTestRouter()
+	const alice = `{"username": "alice", "password": "correct horse"}`
+	const bob = `{"username": "bob", "password": "battery staple"}`
+
+	other := newBrowser(router)
+	require.Equal(t, http.StatusCreated, other.do(http.MethodPost, "/api/user/register", bob).Code)
+
+	laptop := newBrowser(router)
+	require.Equal(t, http.StatusCreated, laptop.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/1"}`).Code)
+	require.Equal(t, http.StatusCreated, laptop.do(http.MethodPost, "/api/user/register", alice).Code)
+	require.Equal(t, http.StatusCreated, laptop.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/2"}`).Code)
+	require.Len(t, laptop.userURLs(t), 2)
+
+	require.Equal(t, http.StatusOK, laptop.do(http.MethodPost, "/api/user/login", bob).Code)
+	require.Empty(t, laptop.userURLs(t), "alice's links must not move to bob")
+
+	require.Equal(t, http.StatusOK, laptop.do(http.MethodPost, "/api/user/login", alice).Code)
+	require.Len(t, laptop.userURLs(t), 2)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/services"
+)
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+type AdminHandler struct {
+	BaseHandler
+	admin services.AdminService
+}
+
+type currentUserResponse struct {
+	UserToken string        `json:"user_token"`
+	Role      services.Role `json:"role"`
+}
+
+type setURLDisabledRequest struct {
+	Disabled *bool `json:"disabled"`
+}
+
+// RequireRole пропускает только пользователей с ролью role или выше. Должен стоять
+// после middleware, которые определяют пользователя.
+func (h *AdminHandler) RequireRole(role services.Role) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userToken := getUserToken(r.Context())
+			if userToken == "" {
+				h.TextResponse(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			if !h.admin.Role(userToken).Includes(role) {
+				h.TextResponse(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetCurrentUser токен и роль текущего пользователя; по токену администратора назначают в конфиге
+func (h *AdminHandler) GetCurrentUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userToken := getUserToken(r.Context())
+		h.JSONResponse(w, http.StatusOK, currentUserResponse{UserToken: userToken, Role: h.admin.Role(userToken)})
+	}
+}
+
+// SearchURLs ссылки всех пользователей, параметры q, limit и offset
+func (h *AdminHandler) SearchURLs() http.HandlerFunc {
+	const timeout = 10 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		query := r.URL.Query()
+		limit, limitErr := queryInt(query.Get("limit"), defaultSearchLimit)
+		offset, offsetErr := queryInt(query.Get("offset"), 0)
+		if limitErr != nil || offsetErr != nil || limit <= 0 || limit > maxSearchLimit || offset < 0 {
+			h.TextResponse(w, http.StatusBadRequest, "limit must be 1-1000 and offset non-negative")
+			return
+		}
+		adminURLs, err := h.admin.SearchURLs(ctx, query.Get("q"), limit, offset)
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		h.urlsResponse(w, adminURLs)
+	}
+}
+
+func (h *AdminHandler) GetUserURLs() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		adminURLs, err := h.admin.GetUserURLs(ctx, mux.Vars(r)["userToken"])
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		h.urlsResponse(w, adminURLs)
+	}
+}
+
+// SetURLDisabled отключает или включает любую ссылку: {"disabled": true}
+func (h *AdminHandler) SetURLDisabled() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &setURLDisabledRequest{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil || requestData.Disabled == nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		err := h.admin.SetURLDisabled(ctx, mux.Vars(r)["urlID"], *requestData.Disabled)
+		var notFoundErr services.OriginalURLNotFound
+		switch {
+		case errors.As(err, &notFoundErr):
+			h.TextResponse(w, http.StatusNotFound, err.Error())
+		case err != nil:
+			h.ErrorResponse(w, err)
+		default:
+			h.TextResponse(w, http.StatusNoContent, "")
+		}
+	}
+}
+
+func (h *AdminHandler) urlsResponse(w http.ResponseWriter, adminURLs []services.AdminURL) {
+	if len(adminURLs) == 0 {
+		h.JSONResponse(w, http.StatusNoContent, nil)
+		return
+	}
+	h.JSONResponse(w, http.StatusOK, adminURLs)
+}
+
+func queryInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func NewAdminHandler(admin services.AdminService, logger *logrus.Logger) AdminHandler {
+	return AdminHandler{
+		BaseHandler: BaseHandler{logger: logger},
+		admin:       admin,
+	}
+}
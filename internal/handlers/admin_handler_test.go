@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+const adminUserToken = "5f0c9a57-3d41-4c7e-8f4e-6b2f3a9d1e11"
+
+func newAdminTestRouter() (*mux.Router, auth.CookieAuthentication) {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	adminHandler := NewAdminHandler(services.NewAdminService(urlStorage, config.BaseURL, []string{adminUserToken}), logrus.New())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", urlHandler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/me", adminHandler.GetCurrentUser()).Methods(http.MethodGet)
+	adminRouter := router.PathPrefix("/api/admin").Subrouter()
+	adminRouter.HandleFunc("/urls", adminHandler.SearchURLs()).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/urls/{urlID}", adminHandler.SetURLDisabled()).Methods(http.MethodPatch)
+	adminRouter.HandleFunc("/users/{userToken}/urls", adminHandler.GetUserURLs()).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/patterns", urlHandler.CreateLinkPattern()).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/patterns", urlHandler.GetLinkPatterns()).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/patterns/{patternID}", urlHandler.DeleteLinkPattern()).Methods(http.MethodDelete)
+	adminRouter.Use(adminHandler.RequireRole(services.RoleAdmin))
+	router.HandleFunc("/{urlID}/", urlHandler.GetURLByIDHandler()).Methods(http.MethodGet)
+	router.HandleFunc("/{urlID}/{path:.+}", urlHandler.GetURLByIDHandler()).Methods(http.MethodGet)
+	router.Use(urlHandler.CookieAuthenticationMiddleware)
+	return router, authorization
+}
+
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+	router, authorization := newAdminTestRouter()
+	user := newBrowser(router)
+	require.Equal(t, http.StatusCreated, user.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/1"}`).Code)
+	admin := newBrowser(router)
+	admin.cookies[auth.AuthorizationCookieName] = authorization.Cookie(authorization.EncodeToken(adminUserToken))
+
+	var me currentUserResponse
+	require.NoError(t, json.NewDecoder(user.do(http.MethodGet, "/api/user/me", "").Body).Decode(&me))
+	require.Equal(t, services.RoleUser, me.Role)
+	userToken := me.UserToken
+	require.NoError(t, json.NewDecoder(admin.do(http.MethodGet, "/api/user/me", "").Body).Decode(&me))
+	require.Equal(t, currentUserResponse{UserToken: adminUserToken, Role: services.RoleAdmin}, me)
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		wantAdmin int
+	}{
+		{name: "Search", method: http.MethodGet, target: "/api/admin/urls?q=github", wantAdmin: http.StatusOK},
+		{name: "Search bad limit", method: http.MethodGet, target: "/api/admin/urls?limit=0", wantAdmin: http.StatusBadRequest},
+		{name: "User links", method: http.MethodGet, target: "/api/admin/users/" + userToken + "/urls", wantAdmin: http.StatusOK},
+		{name: "Disable missing link", method: http.MethodPatch, target: "/api/admin/urls/missing", body: `{"disabled": true}`, wantAdmin: http.StatusNotFound},
+		{name: "Patterns", method: http.MethodGet, target: "/api/admin/patterns", wantAdmin: http.StatusOK},
+		{name: "Delete missing pattern", method: http.MethodDelete, target: "/api/admin/patterns/missing", wantAdmin: http.StatusNotFound},
+		{name: "Disable without flag", method: http.MethodPatch, target: "/api/admin/urls/missing", body: `{}`, wantAdmin: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, http.StatusForbidden, user.do(tt.method, tt.target, tt.body).Code)
+			require.Equal(t, tt.wantAdmin, admin.do(tt.method, tt.target, tt.body).Code)
+		})
+	}
+}
+
+func TestAdminDisablesAnyLink(t *testing.T) {
+	router, authorization := newAdminTestRouter()
+	user := newBrowser(router)
+	w := user.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/1"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	path := strings.TrimPrefix(created.Result, config.BaseURL)
+	urlID := strings.Trim(path, "/")
+
+	admin := newBrowser(router)
+	admin.cookies[auth.AuthorizationCookieName] = authorization.Cookie(authorization.EncodeToken(adminUserToken))
+	require.Equal(t, http.StatusForbidden, user.do(http.MethodPatch, "/api/admin/urls/"+urlID, `{"disabled": true}`).Code)
+	require.Equal(t, http.StatusNoContent, admin.do(http.MethodPatch, "/api/admin/urls/"+urlID, `{"disabled": true}`).Code)
+	require.Equal(t, http.StatusGone, user.do(http.MethodGet, path, "").Code)
+
+	w = admin.do(http.MethodGet, "/api/admin/urls", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var found []services.AdminURL
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&found))
+	require.Len(t, found, 1)
+	require.True(t, found[0].Disabled)
+
+	require.Equal(t, http.StatusNoContent, admin.do(http.MethodPatch, "/api/admin/urls/"+urlID, `{"disabled": false}`).Code)
+	require.Equal(t, http.StatusTemporaryRedirect, user.do(http.MethodGet, path, "").Code)
+}
+
+func TestLinkPatterns(t *testing.T) {
+	router, authorization := newAdminTestRouter()
+	admin := newBrowser(router)
+	admin.cookies[auth.AuthorizationCookieName] = authorization.Cookie(authorization.EncodeToken(adminUserToken))
+	w := admin.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/1"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = admin.do(http.MethodPost, "/api/admin/patterns", `{"pattern": "/gh/{user}", "url": "https://github.com/{user}"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var pattern storage.LinkPattern
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&pattern))
+	require.Equal(t, "/gh/{user}", pattern.Pattern)
+	require.Equal(t, http.StatusConflict, admin.do(http.MethodPost, "/api/admin/patterns", `{"pattern": "gh/{name}", "url": "https://gitlab.com/{name}"}`).Code)
+	require.Equal(t, http.StatusBadRequest, admin.do(http.MethodPost, "/api/admin/patterns", `{"pattern": "/gh/{user}/x", "url": "https://{user}.example.com"}`).Code)
+
+	w = admin.do(http.MethodGet, "/gh/octo%3Fcat", "")
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	require.Equal(t, "https://github.com/octo%3Fcat", w.Header().Get("Location"))
+	require.Equal(t, http.StatusNotFound, admin.do(http.MethodGet, "/gh/octocat/repo", "").Code)
+
+	var patterns []storage.LinkPattern
+	require.NoError(t, json.NewDecoder(admin.do(http.MethodGet, "/api/admin/patterns", "").Body).Decode(&patterns))
+	require.Equal(t, []storage.LinkPattern{pattern}, patterns)
+	require.Equal(t, http.StatusNoContent, admin.do(http.MethodDelete, "/api/admin/patterns/"+pattern.ID, "").Code)
+	require.Equal(t, http.StatusNotFound, admin.do(http.MethodGet, "/gh/octocat", "").Code)
+}
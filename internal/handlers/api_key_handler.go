@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+const bearerScheme = "Bearer "
+
+type APIKeyHandler struct {
+	BaseHandler
+	apiKeys services.APIKeyService
+}
+
+type apiKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newAPIKeyResponse(apiKey storage.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		CreatedAt: apiKey.CreatedAt,
+		RevokedAt: apiKey.RevokedAt,
+	}
+}
+
+// BearerAuthenticationMiddleware определяет пользователя по заголовку
+// Authorization: Bearer <key>. Без заголовка запрос идет дальше к авторизации по куке,
+// с неверным ключом - отклоняется.
+func (h *APIKeyHandler) BearerAuthenticationMiddleware(next http.Handler) http.Handler {
+	const timeout = 3 * time.Second
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(header) < len(bearerScheme) || !strings.EqualFold(header[:len(bearerScheme)], bearerScheme) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+			h.TextResponse(w, http.StatusUnauthorized, "Authorization header must use the Bearer scheme")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		userToken, err := h.apiKeys.Authenticate(ctx, strings.TrimSpace(header[len(bearerScheme):]))
+		var invalidKeyErr services.InvalidAPIKeyError
+		if errors.As(err, &invalidKeyErr) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			h.TextResponse(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		authCtx := context.WithValue(r.Context(), UserTokenKey, userToken)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(authCtx, apiKeyAuthKey, true)))
+	})
+}
+
+// isAPIKeyRequest пользователь определен по ключу API, а не по куке
+func isAPIKeyRequest(ctx context.Context) bool {
+	authenticated, _ := ctx.Value(apiKeyAuthKey).(bool)
+	return authenticated
+}
+
+func (h *APIKeyHandler) CreateAPIKey() http.HandlerFunc {
+	const timeout = 3 * time.Second
+	type RequestData struct {
+		Name string `json:"name"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &RequestData{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil || requestData.Name == "" {
+			h.TextResponse(w, http.StatusBadRequest, "API key name in body is missing")
+			return
+		}
+		apiKey, key, err := h.apiKeys.CreateAPIKey(ctx, getUserToken(r.Context()), requestData.Name)
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		responseData := newAPIKeyResponse(apiKey)
+		responseData.Key = key
+		h.JSONResponse(w, http.StatusCreated, responseData)
+	}
+}
+
+func (h *APIKeyHandler) GetUserAPIKeys() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		apiKeys, err := h.apiKeys.GetUserAPIKeys(ctx, getUserToken(r.Context()))
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		if len(apiKeys) == 0 {
+			h.JSONResponse(w, http.StatusNoContent, nil)
+			return
+		}
+		responseData := make([]apiKeyResponse, 0, len(apiKeys))
+		for _, apiKey := range apiKeys {
+			responseData = append(responseData, newAPIKeyResponse(apiKey))
+		}
+		h.JSONResponse(w, http.StatusOK, responseData)
+	}
+}
+
+func (h *APIKeyHandler) RevokeAPIKey() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		err := h.apiKeys.RevokeAPIKey(ctx, getUserToken(r.Context()), mux.Vars(r)["keyID"])
+		var notFoundErr services.APIKeyNotFoundError
+		if errors.As(err, &notFoundErr) {
+			h.TextResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
+func NewAPIKeyHandler(apiKeys services.APIKeyService, logger *logrus.Logger) APIKeyHandler {
+	return APIKeyHandler{
+		BaseHandler: BaseHandler{logger: logger},
+		apiKeys:     apiKeys,
+	}
+}
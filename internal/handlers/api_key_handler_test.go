@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func newAPIKeyTestRouter() *mux.Router {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	apiKeyHandler := NewAPIKeyHandler(services.NewAPIKeyService(urlStorage), logrus.New())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", urlHandler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/urls", urlHandler.GetUserURLs()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/keys", apiKeyHandler.CreateAPIKey()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/keys/{keyID}", apiKeyHandler.RevokeAPIKey()).Methods(http.MethodDelete)
+	router.Use(apiKeyHandler.BearerAuthenticationMiddleware)
+	router.Use(urlHandler.CookieAuthenticationMiddleware)
+	return router
+}
+
+func serve(router http.Handler, request *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w
+}
+
+// TestBearerAuthentication запросы с ключом API выполняются от имени владельца ключа без кук
+func TestBearerAuthentication(t *testing.T) {
+	router := newAPIKeyTestRouter()
+
+	w := serve(router, httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(`{"name": "ci"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	require.NotEmpty(t, created.Key)
+
+	bearerRequest := func(method, target, body, key string) *http.Request {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+key)
+		return request
+	}
+	for _, url := range []string{"https://github.com/1", "https://github.com/2"} {
+		w = serve(router, bearerRequest(http.MethodPost, "/api/shorten", `{"url": "`+url+`"}`, created.Key))
+		require.Equal(t, http.StatusCreated, w.Code)
+		for _, cookie := range w.Result().Cookies() {
+			require.NotEqual(t, auth.AuthorizationCookieName, cookie.Name, "cookie is not needed with API key")
+		}
+	}
+	w = serve(router, bearerRequest(http.MethodGet, "/api/user/urls", "", created.Key))
+	require.Equal(t, http.StatusOK, w.Code)
+	var userURLs []storage.URLData
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&userURLs))
+	require.Len(t, userURLs, 2)
+
+	w = serve(router, bearerRequest(http.MethodGet, "/api/user/urls", "", "sk_unknown"))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+
+	w = serve(router, bearerRequest(http.MethodDelete, "/api/user/keys/"+created.ID, "", created.Key))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = serve(router, bearerRequest(http.MethodGet, "/api/user/urls", "", created.Key))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -146,3 +147,85 @@ func TestAuthToken(t *testing.T) {
 		})
 	}
 }
+
+// TestOutdatedTokenReissued токен, подписанный предыдущим ключом, перевыпускается для того же пользователя
+func TestOutdatedTokenReissued(t *testing.T) {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL)
+	oldAuthorization, _ := auth.NewCookieAuthentication("old_secret")
+	authorization, _ := auth.NewCookieAuthentication("secret", auth.WithPreviousKeys("old_secret"))
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+
+	userToken, oldToken := oldAuthorization.CreateToken()
+	w := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	request.AddCookie(&http.Cookie{Name: auth.AuthorizationCookieName, Value: oldToken})
+	router := mux.NewRouter()
+	router.HandleFunc("/api/user/urls", handler.GetUserURLs()).Methods(http.MethodGet)
+	router.Use(handler.CookieAuthenticationMiddleware)
+	router.ServeHTTP(w, request)
+
+	response := w.Result()
+	defer response.Body.Close()
+	var newToken string
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == auth.AuthorizationCookieName {
+			newToken = cookie.Value
+		}
+	}
+	require.NotEmpty(t, newToken)
+	tokenInfo, err := authorization.ParseTokenInfo(newToken)
+	require.NoError(t, err)
+	require.Equal(t, userToken, tokenInfo.UserToken)
+	require.False(t, tokenInfo.Outdated)
+}
+
+// TestExpiredTokenReplaced недавно истекший токен перевыпускается тому же пользователю,
+// давно истекший заменяется токеном нового пользователя
+func TestExpiredTokenReplaced(t *testing.T) {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL)
+	issuedAt := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := issuedAt
+	lifetime := auth.TokenLifetime{TTL: time.Hour, ExpiredGrace: time.Hour}
+	authorization, _ := auth.NewCookieAuthentication("secret", auth.WithTokenLifetime(lifetime), auth.WithClock(func() time.Time { return now }))
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	userToken, encodedToken := authorization.CreateToken()
+
+	tests := []struct {
+		name         string
+		elapsed      time.Duration
+		wantSameUser bool
+	}{
+		{name: "Expired within grace", elapsed: 90 * time.Minute, wantSameUser: true},
+		{name: "Expired", elapsed: 3 * time.Hour, wantSameUser: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = issuedAt.Add(tt.elapsed)
+			var contextToken string
+			router := mux.NewRouter()
+			router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				contextToken = r.Context().Value(UserTokenKey).(string)
+			})
+			router.Use(handler.CookieAuthenticationMiddleware)
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.AddCookie(&http.Cookie{Name: auth.AuthorizationCookieName, Value: encodedToken})
+			router.ServeHTTP(w, request)
+
+			response := w.Result()
+			defer response.Body.Close()
+			var newToken string
+			for _, cookie := range response.Cookies() {
+				if cookie.Name == auth.AuthorizationCookieName {
+					newToken = cookie.Value
+				}
+			}
+			parsedToken, err := authorization.ParseToken(newToken)
+			require.NoError(t, err)
+			require.Equal(t, contextToken, parsedToken)
+			require.Equal(t, tt.wantSameUser, contextToken == userToken)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/auth"
+)
+
+// CSRFHandler защита от подделки запросов: изменяющие запросы с куками принимаются
+// только со страниц доверенных источников
+type CSRFHandler struct {
+	BaseHandler
+	trustedOrigins map[string]bool
+}
+
+// Middleware проверяет Origin, а если его нет - Referer изменяющих запросов. Запрос с куками
+// авторизации без обоих заголовков отклоняется: источник нельзя проверить, а кука могла
+// достаться ему от чужой страницы. Без кук подделывать нечего, а запросы с ключом API
+// куки не используют, поэтому такие запросы не проверяются.
+func (h *CSRFHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) || isAPIKeyRequest(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		source := r.Header.Get("Origin")
+		if source == "" {
+			source = r.Header.Get("Referer")
+		}
+		if source == "" && !hasAuthCookie(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !h.trustedOrigins[normalizeOrigin(source)] {
+			h.logger.WithField("origin", source).Warnf("cross-site %s %s rejected", r.Method, r.URL.Path)
+			h.TextResponse(w, http.StatusForbidden, "Cross-site request rejected")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// hasAuthCookie запрос несет куку анонимного пользователя или сессии учетной записи
+func hasAuthCookie(r *http.Request) bool {
+	for _, name := range []string{auth.AuthorizationCookieName, auth.SessionCookieName} {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeOrigin схема и хост в нижнем регистре; для непонятных значений, в том числе
+// Origin: null, - пустая строка, которая не совпадет ни с одним доверенным источником
+func normalizeOrigin(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// NewCSRFHandler trustedOrigins источники вида https://example.com, с которых принимаются
+// изменяющие запросы, - обычно это адрес самого сервиса
+func NewCSRFHandler(trustedOrigins []string, logger *logrus.Logger) CSRFHandler {
+	origins := make(map[string]bool, len(trustedOrigins))
+	for _, origin := range trustedOrigins {
+		if normalized := normalizeOrigin(origin); normalized != "" {
+			origins[normalized] = true
+		}
+	}
+	return CSRFHandler{
+		BaseHandler:    BaseHandler{logger: logger},
+		trustedOrigins: origins,
+	}
+}
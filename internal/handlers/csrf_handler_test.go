@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestCSRFProtection(t *testing.T) {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	apiKeyHandler := NewAPIKeyHandler(services.NewAPIKeyService(urlStorage), logrus.New())
+	csrfHandler := NewCSRFHandler([]string{config.BaseURL, "https://App.example.com/"}, logrus.New())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", urlHandler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/urls", urlHandler.GetUserURLs()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/keys", apiKeyHandler.CreateAPIKey()).Methods(http.MethodPost)
+	router.Use(apiKeyHandler.BearerAuthenticationMiddleware)
+	router.Use(csrfHandler.Middleware)
+	router.Use(urlHandler.CookieAuthenticationMiddleware)
+
+	shorten := func(url string, header http.Header, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "`+url+`"}`))
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		return serve(router, request)
+	}
+	authCookie := &http.Cookie{Name: auth.AuthorizationCookieName, Value: authorization.EncodeToken("user")}
+	sessionCookie := &http.Cookie{Name: auth.SessionCookieName, Value: "session"}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		cookies []*http.Cookie
+		code    int
+	}{
+		{name: "same origin", header: http.Header{"Origin": {config.BaseURL}}, code: http.StatusCreated},
+		{name: "trusted origin", header: http.Header{"Origin": {"https://app.example.com"}}, code: http.StatusCreated},
+		{name: "trusted referer", header: http.Header{"Referer": {config.BaseURL + "/page?q=1"}}, code: http.StatusCreated},
+		{name: "no origin without cookies", header: http.Header{}, code: http.StatusCreated},
+		{name: "no origin with auth cookie", header: http.Header{}, cookies: []*http.Cookie{authCookie}, code: http.StatusForbidden},
+		{name: "no origin with session cookie", header: http.Header{}, cookies: []*http.Cookie{sessionCookie}, code: http.StatusForbidden},
+		{name: "same origin with auth cookie", header: http.Header{"Origin": {config.BaseURL}}, cookies: []*http.Cookie{authCookie}, code: http.StatusCreated},
+		{name: "foreign origin", header: http.Header{"Origin": {"https://evil.example.com"}}, code: http.StatusForbidden},
+		{name: "foreign referer", header: http.Header{"Referer": {"https://evil.example.com/"}}, code: http.StatusForbidden},
+		{name: "null origin", header: http.Header{"Origin": {"null"}}, code: http.StatusForbidden},
+		// Origin важнее Referer
+		{name: "foreign origin with trusted referer", header: http.Header{
+			"Origin": {"https://evil.example.com"}, "Referer": {config.BaseURL + "/"},
+		}, code: http.StatusForbidden},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := shorten("https://example.com/"+string(rune('a'+i)), tt.header, tt.cookies...)
+			require.Equal(t, tt.code, w.Code)
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	request.Header.Set("Origin", "https://evil.example.com")
+	require.NotEqual(t, http.StatusForbidden, serve(router, request).Code)
+
+	// Запросы с ключом API не зависят от кук и не проверяются
+	w := serve(router, httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(`{"name": "ci"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	w = shorten("https://example.com/key", http.Header{
+		"Origin":        {"https://evil.example.com"},
+		"Authorization": {"Bearer " + created.Key},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = shorten("https://example.com/key-no-origin", http.Header{"Authorization": {"Bearer " + created.Key}}, authCookie)
+	require.Equal(t, http.StatusCreated, w.Code)
+}
@@ -1,11 +1,28 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
 )
 
 const InternalServerError = internalServerError("Internal Server Error")
 
+// defaultRetryAfter Retry-After, когда хранилище недоступно, но не сообщило, когда вернется
+const defaultRetryAfter = 10 * time.Second
+
+// retryAfterSeconds значение заголовка Retry-After для ошибки недоступности хранилища:
+// оставшееся время разомкнутой цепи CircuitBreaker или defaultRetryAfter
+func retryAfterSeconds(err error) string {
+	var retryErr storage.RetryAfterError
+	if errors.As(err, &retryErr) && retryErr.RetryAfter > 0 {
+		return durationSeconds(retryErr.RetryAfter)
+	}
+	return durationSeconds(defaultRetryAfter)
+}
+
 type MethodNotAllowedError struct {
 	Method string
 }
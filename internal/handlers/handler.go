@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
 )
 
 type BaseHandler struct {
@@ -33,3 +36,15 @@ func (h *BaseHandler) JSONResponse(w http.ResponseWriter, code int, data interfa
 		h.logger.Error(err)
 	}
 }
+
+// ErrorResponse ответ на непредвиденную ошибку: 503 с Retry-After, если недоступно хранилище, иначе 500
+func (h *BaseHandler) ErrorResponse(w http.ResponseWriter, err error) {
+	var unavailableErr storage.DBUnavailableError
+	if errors.As(err, &unavailableErr) {
+		w.Header().Set("Retry-After", retryAfterSeconds(err))
+		h.TextResponse(w, http.StatusServiceUnavailable, unavailableErr.Error())
+		return
+	}
+	h.logger.Error(err)
+	h.TextResponse(w, http.StatusInternalServerError, InternalServerError.Error())
+}
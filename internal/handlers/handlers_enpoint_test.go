@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
@@ -267,6 +268,328 @@ func TestGetURLByIDHandler(t *testing.T) {
 	}
 }
 
+func TestRedirectCodes(t *testing.T) {
+	urlDB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlDB, config.BaseURL, services.WithRedirectCode(http.StatusFound))
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", handler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/urls/{urlID}", handler.UpdateURL()).Methods(http.MethodPatch)
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead)
+	router.Use(handler.CookieAuthenticationMiddleware)
+	b := newBrowser(router)
+
+	create := func(body string) (string, int) {
+		w := b.do(http.MethodPost, "/api/shorten", body)
+		var response struct {
+			Result string `json:"result"`
+		}
+		_ = json.NewDecoder(w.Body).Decode(&response)
+		return response.Result, w.Code
+	}
+	follow := func(method, shortURL string) *httptest.ResponseRecorder {
+		return serve(router, httptest.NewRequest(method, shortURL, nil))
+	}
+
+	// Ссылка, созданная до появления настройки, отвечает как раньше
+	legacyURL := config.BaseURL + "/legacy/"
+	require.NoError(t, urlDB.SaveData(context.Background(), "user", storage.URLData{ShortURL: legacyURL, OriginalURL: "https://github.com"}))
+	w := follow(http.MethodGet, legacyURL)
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	defaultURL, code := create(`{"url": "https://go.dev"}`)
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, http.StatusFound, follow(http.MethodGet, defaultURL).Code)
+
+	permanentURL, code := create(`{"url": "https://example.com", "redirect_code": 308}`)
+	require.Equal(t, http.StatusCreated, code)
+	w = follow(http.MethodHead, permanentURL)
+	require.Equal(t, http.StatusPermanentRedirect, w.Code)
+	require.Equal(t, "https://example.com", w.Header().Get("Location"))
+	require.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	require.Empty(t, w.Body.String())
+
+	_, code = create(`{"url": "https://example.org", "redirect_code": 200}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	urlID := strings.Trim(strings.TrimPrefix(permanentURL, config.BaseURL), "/")
+	require.Equal(t, http.StatusNoContent, b.do(http.MethodPatch, "/api/user/urls/"+urlID, `{"redirect_code": 301}`).Code)
+	require.Equal(t, http.StatusMovedPermanently, follow(http.MethodGet, permanentURL).Code)
+	require.Equal(t, http.StatusBadRequest, b.do(http.MethodPatch, "/api/user/urls/"+urlID, `{"redirect_code": 303}`).Code)
+}
+
+func TestURLHistory(t *testing.T) {
+	urlDB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlDB, config.BaseURL, services.WithIDAllocator(services.NewIDAllocator(urlDB, 10)))
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", handler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/urls/{urlID}", handler.UpdateURL()).Methods(http.MethodPatch)
+	router.HandleFunc("/api/user/urls/{urlID}/history", handler.GetURLHistory()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/urls/{urlID}/rollback", handler.RollbackURL()).Methods(http.MethodPost)
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead)
+	router.Use(handler.CookieAuthenticationMiddleware)
+	b := newBrowser(router)
+
+	w := b.do(http.MethodPost, "/api/shorten", `{"url": "https://example.com/v1"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	urlID := strings.Trim(strings.TrimPrefix(created.Result, config.BaseURL), "/")
+
+	require.Equal(t, http.StatusBadRequest, b.do(http.MethodPatch, "/api/user/urls/"+urlID, `{"original_url": "v2"}`).Code)
+	require.Equal(t, http.StatusNoContent, b.do(http.MethodPatch, "/api/user/urls/"+urlID, `{"original_url": "https://example.com/v2"}`).Code)
+	require.Equal(t, "https://example.com/v2", serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil)).Header().Get("Location"))
+
+	w = b.do(http.MethodGet, "/api/user/urls/"+urlID+"/history", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var history []struct {
+		Version     int64      `json:"version"`
+		OriginalURL string     `json:"original_url"`
+		ReplacedAt  *time.Time `json:"replaced_at"`
+		Current     bool       `json:"current"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&history))
+	require.Len(t, history, 2)
+	require.Equal(t, "https://example.com/v1", history[0].OriginalURL)
+	require.NotNil(t, history[0].ReplacedAt)
+	require.True(t, history[1].Current)
+	require.Nil(t, history[1].ReplacedAt)
+
+	w = b.do(http.MethodPost, "/api/user/urls/"+urlID+"/rollback", `{"version": 1}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"original_url": "https://example.com/v1"}`, w.Body.String())
+	require.Equal(t, "https://example.com/v1", serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil)).Header().Get("Location"))
+	require.Equal(t, http.StatusNotFound, b.do(http.MethodPost, "/api/user/urls/"+urlID+"/rollback", `{"version": 9}`).Code)
+
+	// Чужая ссылка не отличается от несуществующей
+	other := newBrowser(router)
+	require.Equal(t, http.StatusNotFound, other.do(http.MethodGet, "/api/user/urls/"+urlID+"/history", "").Code)
+}
+
+func TestCampaigns(t *testing.T) {
+	urlDB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlDB, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", handler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/campaigns", handler.CreateCampaign()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/campaigns", handler.GetCampaigns()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/campaigns/{campaignID}", handler.UpdateCampaign()).Methods(http.MethodPut)
+	router.HandleFunc("/api/user/campaigns/{campaignID}", handler.DeleteCampaign()).Methods(http.MethodDelete)
+	router.HandleFunc("/api/user/campaigns/{campaignID}/urls", handler.GetCampaignURLs()).Methods(http.MethodGet)
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet)
+	router.Use(handler.CookieAuthenticationMiddleware)
+	b := newBrowser(router)
+
+	require.Equal(t, http.StatusBadRequest, b.do(http.MethodPost, "/api/user/campaigns", `{"name": "Empty"}`).Code)
+	w := b.do(http.MethodPost, "/api/user/campaigns", `{"name": "Spring", "utm_source": "newsletter", "utm_campaign": "spring"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var campaign storage.Campaign
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&campaign))
+
+	require.Equal(t, http.StatusNotFound, b.do(http.MethodPost, "/api/shorten", `{"url": "https://example.com", "campaign_id": "missing"}`).Code)
+	w = b.do(http.MethodPost, "/api/shorten", `{"url": "https://example.com/sale", "campaign_id": "`+campaign.ID+`"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	follow := func() string {
+		return serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil)).Header().Get("Location")
+	}
+	require.Equal(t, "https://example.com/sale?utm_source=newsletter&utm_campaign=spring", follow())
+
+	w = b.do(http.MethodPut, "/api/user/campaigns/"+campaign.ID, `{"name": "Spring", "utm_source": "ads", "utm_medium": "cpc"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "https://example.com/sale?utm_source=ads&utm_medium=cpc", follow())
+
+	var campaigns []storage.Campaign
+	require.NoError(t, json.NewDecoder(b.do(http.MethodGet, "/api/user/campaigns", "").Body).Decode(&campaigns))
+	require.Len(t, campaigns, 1)
+	require.Equal(t, "ads", campaigns[0].UTMSource)
+	var urls []storage.URLData
+	require.NoError(t, json.NewDecoder(b.do(http.MethodGet, "/api/user/campaigns/"+campaign.ID+"/urls", "").Body).Decode(&urls))
+	require.Equal(t, []storage.URLData{{ShortURL: created.Result, OriginalURL: "https://example.com/sale"}}, urls)
+
+	// Чужая кампания не отличается от несуществующей
+	other := newBrowser(router)
+	require.Equal(t, http.StatusNotFound, other.do(http.MethodGet, "/api/user/campaigns/"+campaign.ID+"/urls", "").Code)
+	require.Equal(t, http.StatusNotFound, other.do(http.MethodDelete, "/api/user/campaigns/"+campaign.ID, "").Code)
+	require.Equal(t, http.StatusNoContent, b.do(http.MethodDelete, "/api/user/campaigns/"+campaign.ID, "").Code)
+	require.Equal(t, "https://example.com/sale", follow())
+}
+
+func TestRedirectPassThrough(t *testing.T) {
+	urlDB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlDB, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", handler.SetURLJSONHandler()).Methods(http.MethodPost)
+	for _, route := range []string{"/{urlID}", "/{urlID}/", "/{urlID}/{path:.+}"} {
+		router.HandleFunc(route, handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead, http.MethodPost)
+	}
+	router.Use(handler.CookieAuthenticationMiddleware)
+
+	create := func(body string) string {
+		w := serve(router, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created struct {
+			Result string `json:"result"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+		return strings.TrimSuffix(created.Result, "/")
+	}
+	follow := func(target string) *httptest.ResponseRecorder {
+		return serve(router, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	exactURL := create(`{"url": "https://example.com/exact"}`)
+	w := follow(exactURL)
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	require.Equal(t, "https://example.com/exact", w.Header().Get("Location"))
+	require.Equal(t, http.StatusNotFound, follow(exactURL+"/docs/x").Code)
+	require.Equal(t, "https://example.com/exact", follow(exactURL+"/?ref=mail").Header().Get("Location"))
+
+	docsURL := create(`{"url": "https://docs.example.com/v2?lang=en", "forward_path": true, "forward_query": true, "query_conflict": "override"}`)
+	w = follow(docsURL + "/docs/x?lang=de&ref=mail")
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	require.Equal(t, "https://docs.example.com/v2/docs/x?lang=de&ref=mail", w.Header().Get("Location"))
+	require.Equal(t, "https://docs.example.com/v2?lang=en", follow(docsURL).Header().Get("Location"))
+
+	w = serve(router, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com", "query_conflict": "first"}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPasswordProtectedLink(t *testing.T) {
+	urlDB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlDB, config.BaseURL, services.WithRedirectCode(http.StatusMovedPermanently))
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", handler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead, http.MethodPost)
+	router.Use(handler.CookieAuthenticationMiddleware)
+
+	w := serve(router, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://docs.example.com", "password": "secret"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	// Браузер получает форму, клиент API - текст
+	request := httptest.NewRequest(http.MethodGet, created.Result, nil)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w = serve(router, request)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), `<form method="post">`)
+	require.Empty(t, w.Header().Get("Location"))
+	w = serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+	request = httptest.NewRequest(http.MethodGet, created.Result, nil)
+	request.Header.Set(linkPasswordHeader, "wrong")
+	require.Equal(t, http.StatusForbidden, serve(router, request).Code)
+	request = httptest.NewRequest(http.MethodGet, created.Result, nil)
+	request.Header.Set(linkPasswordHeader, "secret")
+	w = serve(router, request)
+	require.Equal(t, http.StatusMovedPermanently, w.Code)
+	require.Equal(t, "https://docs.example.com", w.Header().Get("Location"))
+	// Постоянное перенаправление защищенной ссылки не должно попасть в кеш мимо пароля
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	request = httptest.NewRequest(http.MethodPost, created.Result, strings.NewReader("password=wrong"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = serve(router, request)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "Wrong password")
+	request = httptest.NewRequest(http.MethodPost, created.Result, strings.NewReader("password=secret"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = serve(router, request)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "https://docs.example.com", w.Header().Get("Location"))
+}
+
+func TestOneTimeLink(t *testing.T) {
+	urlDB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlDB, config.BaseURL, services.WithRedirectCode(http.StatusPermanentRedirect))
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", handler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead, http.MethodPost)
+	router.Use(handler.CookieAuthenticationMiddleware)
+
+	w := serve(router, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://secret.example.com", "max_clicks": -1}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(router, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://secret.example.com", "max_clicks": 1}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	// Проверка ссылки запросом HEAD не расходует переход и не раскрывает адрес
+	w = serve(router, httptest.NewRequest(http.MethodHead, created.Result, nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Empty(t, w.Header().Get("Location"))
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil))
+	require.Equal(t, http.StatusPermanentRedirect, w.Code)
+	require.Equal(t, "https://secret.example.com", w.Header().Get("Location"))
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil))
+	require.Equal(t, http.StatusGone, w.Code)
+	require.Empty(t, w.Header().Get("Location"))
+	w = serve(router, httptest.NewRequest(http.MethodHead, created.Result, nil))
+	require.Equal(t, http.StatusGone, w.Code)
+	require.Empty(t, w.Header().Get("Location"))
+}
+
+func TestNotYetActiveLink(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	urlDB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlDB, config.BaseURL, services.WithClock(func() time.Time {
+		return now
+	}))
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", handler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead, http.MethodPost)
+	router.Use(handler.CookieAuthenticationMiddleware)
+
+	body := `{"url": "https://example.com/teaser", "not_before": "2022-03-01T13:00:00Z", "not_active_message": "Starts at 13:00",
+		"schedule": [{"at": "2022-03-02T00:00:00Z", "url": "https://example.com/product"}]}`
+	w := serve(router, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, "Starts at 13:00", w.Body.String())
+	require.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	now = time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC)
+	w = serve(router, httptest.NewRequest(http.MethodGet, created.Result, nil))
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	require.Equal(t, "https://example.com/product", w.Header().Get("Location"))
+}
+
 func TestGetUserURLs(t *testing.T) {
 	shortURLAddress := config.BaseURL
 	urlDB := storage.NewURLStorage(storage.NewMapStorage())
@@ -382,6 +705,11 @@ func TestPing(t *testing.T) {
 			statusCode: http.StatusInternalServerError,
 			err:        errors.New("some error"),
 		},
+		{
+			name:       "Degraded mode",
+			statusCode: http.StatusServiceUnavailable,
+			err:        storage.ReadOnlyModeError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -439,3 +767,37 @@ func TestDuplicateError(t *testing.T) {
 		})
 	}
 }
+
+// TestStorageUnavailable при недоступном хранилище создание ссылок отвечает 503 с Retry-After
+func TestStorageUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s := mocks.NewMockShortenerStorage(ctrl)
+	shortener := services.NewShortener(s, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+
+	s.EXPECT().SaveData(gomock.Any(), gomock.Any(), gomock.Any()).Return(storage.ReadOnlyModeError)
+	// Retry-After берется из оставшегося времени разомкнутой цепи, если оно известно
+	s.EXPECT().GetOriginalURL(gomock.Any(), gomock.Any()).Return("", storage.RetryAfterError{Err: storage.CircuitOpenError, RetryAfter: 41500 * time.Millisecond})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/", handler.SetURLTextHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet)
+
+	for _, tt := range []struct {
+		request    *http.Request
+		retryAfter string
+	}{
+		{request: httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://github.com")), retryAfter: "10"},
+		{request: httptest.NewRequest(http.MethodGet, "/hLfkSqVN/", nil), retryAfter: "42"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, tt.request)
+		response := w.Result()
+		response.Body.Close()
+		require.Equal(t, http.StatusServiceUnavailable, response.StatusCode, "wrong status code")
+		require.Equal(t, tt.retryAfter, response.Header.Get("Retry-After"), "wrong Retry-After")
+	}
+}
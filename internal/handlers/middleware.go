@@ -3,6 +3,7 @@ package handlers
 import (
 	"compress/gzip"
 	"context"
+	"errors"
 	"github.com/maxsnegir/url-shortener/internal/auth"
 	"io"
 	"net/http"
@@ -13,34 +14,71 @@ type UserToken string
 
 const UserTokenKey UserToken = "UserToken"
 
+// apiKeyAuthKey признак того, что пользователь определен по ключу API
+const apiKeyAuthKey UserToken = "APIKeyAuth"
+
 type Middleware func(next http.Handler) http.Handler
 
+// getUserToken токен пользователя, который положил в контекст middleware авторизации
+func getUserToken(ctx context.Context) string {
+	userToken := ctx.Value(UserTokenKey)
+	if userToken == nil {
+		return ""
+	}
+	return userToken.(string)
+}
+
+// anonymousUserToken пользователь из куки авторизации, а не из сессии или API-ключа:
+// при входе передаются только ссылки, созданные анонимно. Кука пользователя провайдера
+// тоже относится к учетной записи, и ее ссылки не передаются.
+func anonymousUserToken(authentication auth.CookieAuthentication, r *http.Request) string {
+	cookie, err := r.Cookie(auth.AuthorizationCookieName)
+	if err != nil {
+		return ""
+	}
+	userToken, err := authentication.ParseToken(cookie.Value)
+	if err != nil || auth.IsIdentityToken(userToken) {
+		return ""
+	}
+	return userToken
+}
+
 func (h *URLHandler) CookieAuthenticationMiddleware(next http.Handler) http.Handler {
 
 	setTokenToCookie := func(w http.ResponseWriter, token string) {
-		http.SetCookie(w, &http.Cookie{
-			Name:  auth.AuthorizationCookieName,
-			Value: token,
-		})
+		http.SetCookie(w, h.authentication.Cookie(token))
 	}
 
-	getTokenFromCookie := func(r *http.Request) string {
+	getTokenFromCookie := func(w http.ResponseWriter, r *http.Request) string {
 		encodedToken, err := r.Cookie(auth.AuthorizationCookieName)
 		if err != nil {
 			return ""
 		}
-		token, err := h.authentication.ParseToken(encodedToken.Value)
+		tokenInfo, err := h.authentication.ParseTokenInfo(encodedToken.Value)
+		if errors.Is(err, auth.TokenExpiredError) {
+			h.logger.Debug("auth token expired, issuing token for a new user")
+			return ""
+		}
 		if err != nil {
 			return ""
 		}
-		return token
+		// Токен старого формата, старого ключа или с истекающим сроком перевыпускаем для того же пользователя
+		if tokenInfo.Outdated {
+			setTokenToCookie(w, h.authentication.EncodeToken(tokenInfo.UserToken))
+		}
+		return tokenInfo.UserToken
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Пользователь уже определен по ключу API, кука не нужна
+		if getUserToken(r.Context()) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
 		var token string
 		var encodedToken string
 
-		token = getTokenFromCookie(r)
+		token = getTokenFromCookie(w, r)
 		if token == "" {
 			token, encodedToken = h.authentication.CreateToken()
 			setTokenToCookie(w, encodedToken)
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+)
+
+// OIDCLoginCookieName кука с зашифрованными секретами входа на время перехода к провайдеру
+const OIDCLoginCookieName = "OIDCLogin"
+
+const oidcLoginTTL = 10 * time.Minute
+
+type OIDCHandler struct {
+	BaseHandler
+	sso            services.SSOService
+	authentication auth.CookieAuthentication
+	postLoginURL   string
+}
+
+// Login отправляет пользователя на страницу входа провайдера
+func (h *OIDCHandler) Login() http.HandlerFunc {
+	const timeout = 5 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		authURL, login, err := h.sso.Start(ctx)
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		data, err := json.Marshal(login)
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		http.SetCookie(w, h.loginCookie(h.authentication.Seal(data), oidcLoginTTL))
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// Callback принимает код от провайдера и выдает куку авторизации с постоянным токеном пользователя
+func (h *OIDCHandler) Callback() http.HandlerFunc {
+	const timeout = 10 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		http.SetCookie(w, h.loginCookie("", 0))
+		login, ok := h.getLogin(r)
+		query := r.URL.Query()
+		if !ok || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+			h.TextResponse(w, http.StatusBadRequest, "invalid login state")
+			return
+		}
+		if providerErr := query.Get("error"); providerErr != "" {
+			h.TextResponse(w, http.StatusUnauthorized, providerErr)
+			return
+		}
+
+		userToken, err := h.sso.Finish(ctx, anonymousUserToken(h.authentication, r), login, query.Get("code"))
+		var loginErr services.SSOLoginError
+		switch {
+		case errors.As(err, &loginErr):
+			h.logger.Warn(err)
+			h.TextResponse(w, http.StatusUnauthorized, "login failed")
+		case err != nil:
+			h.ErrorResponse(w, err)
+		default:
+			// Сессия учетной записи имеет приоритет над кукой авторизации, поэтому сбрасывается
+			http.SetCookie(w, h.authentication.NamedCookie(auth.SessionCookieName, "", 0))
+			http.SetCookie(w, h.authentication.Cookie(h.authentication.EncodeToken(userToken)))
+			http.Redirect(w, r, h.postLoginURL, http.StatusFound)
+		}
+	}
+}
+
+func (h *OIDCHandler) getLogin(r *http.Request) (services.SSOLogin, bool) {
+	var login services.SSOLogin
+	cookie, err := r.Cookie(OIDCLoginCookieName)
+	if err != nil {
+		return login, false
+	}
+	data, err := h.authentication.Open(cookie.Value)
+	if err != nil {
+		return login, false
+	}
+	if err := json.Unmarshal(data, &login); err != nil || login.State == "" {
+		return login, false
+	}
+	return login, true
+}
+
+// loginCookie браузер должен прислать куку при возврате от провайдера с другого сайта,
+// поэтому SameSite всегда Lax
+func (h *OIDCHandler) loginCookie(value string, maxAge time.Duration) *http.Cookie {
+	cookie := h.authentication.NamedCookie(OIDCLoginCookieName, value, maxAge)
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteLaxMode
+	return cookie
+}
+
+func NewOIDCHandler(sso services.SSOService, authentication auth.CookieAuthentication, postLoginURL string, logger *logrus.Logger) OIDCHandler {
+	return OIDCHandler{
+		BaseHandler:    BaseHandler{logger: logger},
+		sso:            sso,
+		authentication: authentication,
+		postLoginURL:   postLoginURL,
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/auth/oidctest"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func newOIDCTestRouter(idp *oidctest.Provider) *mux.Router {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	provider := auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://localhost/api/user/oidc/callback",
+	})
+	oidcHandler := NewOIDCHandler(services.NewSSOService(provider, urlStorage), authorization, "/done", logrus.New())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", urlHandler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/urls", urlHandler.GetUserURLs()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/oidc/login", oidcHandler.Login()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/oidc/callback", oidcHandler.Callback()).Methods(http.MethodGet)
+	router.Use(urlHandler.CookieAuthenticationMiddleware)
+	return router
+}
+
+// signIn проходит вход у провайдера и возвращает адрес обратного вызова с кодом
+func signIn(t *testing.T, b *browser) string {
+	w := b.do(http.MethodGet, "/api/user/oidc/login", "")
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Contains(t, b.cookies, OIDCLoginCookieName)
+	require.Equal(t, http.SameSiteLaxMode, b.cookies[OIDCLoginCookieName].SameSite)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(w.Header().Get("Location"))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusFound, response.StatusCode)
+	callbackURL, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(t, err)
+	return callbackURL.RequestURI()
+}
+
+func userToken(t *testing.T, b *browser) string {
+	authorization, err := auth.NewCookieAuthentication("secretKey")
+	require.NoError(t, err)
+	token, err := authorization.ParseToken(b.cookies[auth.AuthorizationCookieName].Value)
+	require.NoError(t, err)
+	return token
+}
+
+// TestOIDCLogin пользователь провайдера получает один и тот же токен на любом устройстве
+func TestOIDCLogin(t *testing.T) {
+	idp := oidctest.NewProvider("client", "secret")
+	defer idp.Close()
+	router := newOIDCTestRouter(idp)
+
+	laptop := newBrowser(router)
+	require.Equal(t, http.StatusCreated, laptop.do(http.MethodPost, "/api/shorten", `{"url": "https://github.com/1"}`).Code)
+	w := laptop.do(http.MethodGet, signIn(t, laptop), "")
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/done", w.Header().Get("Location"))
+	require.NotContains(t, laptop.cookies, OIDCLoginCookieName)
+
+	phone := newBrowser(router)
+	require.Equal(t, http.StatusFound, phone.do(http.MethodGet, signIn(t, phone), "").Code)
+	require.Equal(t, userToken(t, laptop), userToken(t, phone))
+	require.Len(t, phone.userURLs(t), 1)
+
+	// Другой пользователь провайдера в том же браузере не получает чужие ссылки
+	idp.Subject = "user-2"
+	require.Equal(t, http.StatusFound, phone.do(http.MethodGet, signIn(t, phone), "").Code)
+	require.NotEqual(t, userToken(t, laptop), userToken(t, phone))
+	require.Empty(t, phone.userURLs(t))
+	require.Len(t, laptop.userURLs(t), 1)
+}
+
+func TestOIDCCallbackRejectsForgedState(t *testing.T) {
+	idp := oidctest.NewProvider("client", "secret")
+	defer idp.Close()
+	router := newOIDCTestRouter(idp)
+
+	attacker := newBrowser(router)
+	callbackURL := signIn(t, attacker)
+	// Жертва не начинала вход, поэтому куки с секретами у нее нет
+	victim := newBrowser(router)
+	require.Equal(t, http.StatusBadRequest, victim.do(http.MethodGet, callbackURL, "").Code)
+
+	// Чужой state не подходит к секретам браузера
+	victim.do(http.MethodGet, "/api/user/oidc/login", "")
+	require.Equal(t, http.StatusBadRequest, victim.do(http.MethodGet, callbackURL, "").Code)
+
+	idp.ModifyClaims = func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }
+	require.Equal(t, http.StatusUnauthorized, attacker.do(http.MethodGet, callbackURL, "").Code)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// linkPasswordHeader заголовок с паролем защищенной ссылки для клиентов API
+const linkPasswordHeader = "X-Link-Password"
+
+var passwordFormTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Password required</title></head>
+<body>
+<form method="post">
+{{if .}}<p>{{.}}</p>
+{{end}}<label>Password <input type="password" name="password" autofocus required></label>
+<button type="submit">Open link</button>
+</form>
+</body>
+</html>
+`))
+
+// passwordFormResponse браузеру - форма ввода пароля, остальным клиентам - текст ошибки
+func (h *BaseHandler) passwordFormResponse(w http.ResponseWriter, r *http.Request, code int, message string) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost && !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		if message == "" {
+			message = "Password required"
+		}
+		h.TextResponse(w, code, message)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := passwordFormTemplate.Execute(w, message); err != nil {
+		h.logger.Error(err)
+	}
+}
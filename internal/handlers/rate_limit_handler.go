@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"expvar"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/ratelimit"
+)
+
+// Счетчики защиты от перебора ссылок, доступны администраторам вместе с остальными метриками
+var (
+	enumerationBlockedClients   = expvar.NewInt("enumeration_blocked_clients")
+	enumerationRejectedRequests = expvar.NewInt("enumeration_rejected_requests")
+	enumerationSlowedRequests   = expvar.NewInt("enumeration_slowed_requests")
+)
+
+// RateLimits ограничения на запросы создания ссылок. Нулевая частота отключает лимит.
+type RateLimits struct {
+	// UserRate запросов в секунду на токен пользователя, UserBurst - сколько можно сделать подряд
+	UserRate  float64
+	UserBurst int
+	IPRate    float64
+	IPBurst   int
+	// TrustProxyHeaders брать адрес клиента из X-Forwarded-For. Включается только за
+	// прокси, который этот заголовок перезаписывает, иначе клиент подставит любой адрес.
+	TrustProxyHeaders bool
+	// MaxBodySize предельный размер тела запроса после распаковки, ноль - без ограничения
+	MaxBodySize int64
+	// Enumeration защита от перебора идентификаторов: неудачей считается ответ 404 на переход по ссылке
+	Enumeration ratelimit.GuardConfig
+}
+
+type RateLimitHandler struct {
+	BaseHandler
+	userLimiter       *ratelimit.Limiter
+	ipLimiter         *ratelimit.Limiter
+	trustProxyHeaders bool
+	maxBodySize       int64
+	enumerationGuard  *ratelimit.Guard
+}
+
+// Middleware ограничивает частоту запросов по токену пользователя и по адресу клиента.
+// Токен есть не у всех: новый анонимный пользователь получает его на каждый запрос
+// без куки, поэтому его сдерживает только лимит по адресу.
+func (h *RateLimitHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var results []ratelimit.Result
+		if h.ipLimiter != nil {
+			results = append(results, h.ipLimiter.Allow(h.clientIP(r)))
+		}
+		if userToken := getUserToken(r.Context()); h.userLimiter != nil && userToken != "" {
+			results = append(results, h.userLimiter.Allow(userToken))
+		}
+		if len(results) > 0 {
+			result := strictest(results)
+			setRateLimitHeaders(w, int64(result.Limit), int64(result.Remaining), result.Reset)
+			if !result.Allowed {
+				w.Header().Set("Retry-After", durationSeconds(result.RetryAfter))
+				h.TextResponse(w, http.StatusTooManyRequests, "Too many requests")
+				return
+			}
+		}
+		if h.maxBodySize > 0 {
+			if r.ContentLength > h.maxBodySize {
+				h.TextResponse(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// EnumerationGuard замедляет, а затем блокирует клиентов, которые часто переходят по
+// несуществующим ссылкам: так перебирают идентификаторы в поисках чужих ссылок
+func (h *RateLimitHandler) EnumerationGuard(next http.Handler) http.Handler {
+	if h.enumerationGuard == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := h.clientIP(r)
+		delay, blockedFor := h.enumerationGuard.Check(ip)
+		if blockedFor > 0 {
+			enumerationRejectedRequests.Add(1)
+			w.Header().Set("Retry-After", durationSeconds(blockedFor))
+			h.TextResponse(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+		if delay > 0 {
+			enumerationSlowedRequests.Add(1)
+			timer := time.NewTimer(delay)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == http.StatusNotFound && h.enumerationGuard.Fail(ip) {
+			enumerationBlockedClients.Add(1)
+			h.logger.WithField("client_ip", ip).Warn("client blocked after too many requests to missing links")
+		}
+	})
+}
+
+// statusRecorder запоминает код ответа
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// clientIP адрес клиента: первый адрес из X-Forwarded-For, если ему можно доверять, иначе адрес соединения
+func (h *RateLimitHandler) clientIP(r *http.Request) string {
+	if h.trustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// strictest отклоненный результат с самым долгим ожиданием, а если отклоненных нет - с наименьшим остатком
+func strictest(results []ratelimit.Result) ratelimit.Result {
+	strictest := results[0]
+	for _, result := range results[1:] {
+		switch {
+		case strictest.Allowed && !result.Allowed:
+			strictest = result
+		case strictest.Allowed == result.Allowed && !result.Allowed && result.RetryAfter > strictest.RetryAfter:
+			strictest = result
+		case strictest.Allowed && result.Allowed && result.Remaining < strictest.Remaining:
+			strictest = result
+		}
+	}
+	return strictest
+}
+
+// setRateLimitHeaders заголовки X-RateLimit-*, Reset - через сколько секунд лимит восстановится
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int64, reset time.Duration) {
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", durationSeconds(reset))
+}
+
+// durationSeconds длительность в целых секундах с округлением вверх
+func durationSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+func NewRateLimitHandler(limits RateLimits, logger *logrus.Logger) RateLimitHandler {
+	return RateLimitHandler{
+		BaseHandler:       BaseHandler{logger: logger},
+		userLimiter:       ratelimit.NewLimiter(limits.UserRate, limits.UserBurst),
+		ipLimiter:         ratelimit.NewLimiter(limits.IPRate, limits.IPBurst),
+		trustProxyHeaders: limits.TrustProxyHeaders,
+		maxBodySize:       limits.MaxBodySize,
+		enumerationGuard:  ratelimit.NewGuard(limits.Enumeration),
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/ratelimit"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func newRateLimitTestRouter(limits RateLimits, quota services.Quota) *mux.Router {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL, services.WithQuota(quota))
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	rateLimitHandler := NewRateLimitHandler(limits, logrus.New())
+
+	router := mux.NewRouter()
+	router.Handle("/api/shorten", rateLimitHandler.Middleware(urlHandler.SetURLJSONHandler())).Methods(http.MethodPost)
+	router.Handle("/api/shorten/batch", rateLimitHandler.Middleware(urlHandler.SaveDataBatch())).Methods(http.MethodPost)
+	router.Use(urlHandler.CookieAuthenticationMiddleware)
+	return router
+}
+
+func shortenRequest(url, remoteAddr string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "`+url+`"}`))
+	request.RemoteAddr = remoteAddr
+	return request
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	router := newRateLimitTestRouter(RateLimits{IPRate: 0.001, IPBurst: 2}, services.Quota{})
+
+	w := serve(router, shortenRequest("https://a.example.com", "10.0.0.1:1000"))
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	require.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	require.Equal(t, "1000", w.Header().Get("X-RateLimit-Reset"))
+	// Новый анонимный пользователь на каждый запрос не обходит лимит по адресу
+	require.Equal(t, http.StatusCreated, serve(router, shortenRequest("https://b.example.com", "10.0.0.1:1001")).Code)
+
+	w = serve(router, shortenRequest("https://c.example.com", "10.0.0.1:1002"))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "1000", w.Header().Get("Retry-After"))
+	require.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	require.Equal(t, http.StatusCreated, serve(router, shortenRequest("https://c.example.com", "10.0.0.2:1000")).Code)
+	// X-Forwarded-For без доверенного прокси игнорируется
+	request := shortenRequest("https://d.example.com", "10.0.0.1:1003")
+	request.Header.Set("X-Forwarded-For", "10.0.0.3")
+	require.Equal(t, http.StatusTooManyRequests, serve(router, request).Code)
+}
+
+func TestRateLimitByUser(t *testing.T) {
+	router := newRateLimitTestRouter(RateLimits{UserRate: 0.001, UserBurst: 1}, services.Quota{})
+
+	w := serve(router, shortenRequest("https://a.example.com", "10.0.0.1:1000"))
+	require.Equal(t, http.StatusCreated, w.Code)
+	cookie := w.Result().Cookies()[0]
+
+	request := shortenRequest("https://b.example.com", "10.0.0.2:1000")
+	request.AddCookie(cookie)
+	require.Equal(t, http.StatusTooManyRequests, serve(router, request).Code)
+	require.Equal(t, http.StatusCreated, serve(router, shortenRequest("https://b.example.com", "10.0.0.2:1000")).Code)
+}
+
+func TestQuotaAndBatchLimits(t *testing.T) {
+	router := newRateLimitTestRouter(RateLimits{MaxBodySize: 256}, services.Quota{DailyLinks: 2, MaxBatchSize: 3})
+
+	w := serve(router, shortenRequest("https://a.example.com", "10.0.0.1:1000"))
+	require.Equal(t, http.StatusCreated, w.Code)
+	cookie := w.Result().Cookies()[0]
+
+	batch := `[{"correlation_id": "1", "original_url": "https://b.example.com"}, {"correlation_id": "2", "original_url": "https://c.example.com"}]`
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(batch))
+	request.AddCookie(cookie)
+	w = serve(router, request)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	require.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	batch = strings.Repeat(`{"original_url": "https://b.example.com"},`, 4)
+	request = httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader("["+batch[:len(batch)-1]+"]"))
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve(router, request).Code)
+
+	request = httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(strings.Repeat(" ", 512)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve(router, request).Code)
+}
+
+func TestEnumerationGuard(t *testing.T) {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, "http://example.com")
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	rateLimitHandler := NewRateLimitHandler(RateLimits{Enumeration: ratelimit.GuardConfig{
+		Window:     time.Minute,
+		SlowAfter:  1,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   time.Millisecond,
+		BlockAfter: 3,
+		BlockFor:   time.Minute,
+	}}, logrus.New())
+	router := mux.NewRouter()
+	router.Handle("/{urlID}/", rateLimitHandler.EnumerationGuard(urlHandler.GetURLByIDHandler())).Methods(http.MethodGet)
+	require.NoError(t, urlStorage.SaveData(context.Background(), "user", storage.URLData{
+		ShortURL: "http://example.com/exists/", OriginalURL: "https://github.com",
+	}))
+
+	get := func(urlID, remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/"+urlID+"/", nil)
+		request.RemoteAddr = remoteAddr
+		return serve(router, request)
+	}
+	blocked := enumerationBlockedClients.Value()
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusNotFound, get(fmt.Sprintf("missing%d", i), "10.0.0.1:1000").Code)
+	}
+	require.Equal(t, blocked+1, enumerationBlockedClients.Value())
+
+	// Заблокированный клиент не может перейти и по существующей ссылке
+	w := get("exists", "10.0.0.1:1000")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusTemporaryRedirect, get("exists", "10.0.0.2:1000").Code)
+}
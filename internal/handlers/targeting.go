@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/maxsnegir/url-shortener/internal/services"
+)
+
+// variantCookieName cookie с вариантом A/B-ссылки. Путь cookie - "/<id ссылки>", он подходит
+// для адреса ссылки со слешем и без, но не для других ссылок.
+const (
+	variantCookieName   = "link_variant"
+	variantCookieMaxAge = 30 * 24 * 60 * 60
+)
+
+// countryHeaders заголовки, в которых CDN и прокси передают страну клиента
+var countryHeaders = []string{"CF-IPCountry", "CloudFront-Viewer-Country", "X-Country-Code"}
+
+// redirectRequest данные перехода по ссылке, от которых зависит его адрес
+func redirectRequest(r *http.Request) services.RedirectRequest {
+	request := services.RedirectRequest{
+		Path:     mux.Vars(r)["path"],
+		Query:    r.URL.Query(),
+		Password: r.Header.Get(linkPasswordHeader),
+		Platform: detectPlatform(r.UserAgent()),
+		Language: preferredLanguage(r.Header.Get("Accept-Language")),
+		Head:     r.Method == http.MethodHead,
+	}
+	if r.Method == http.MethodPost {
+		request.Password = r.PostFormValue("password")
+	}
+	if cookie, err := r.Cookie(variantCookieName); err == nil {
+		request.Variant, _ = strconv.Atoi(cookie.Value)
+	}
+	for _, header := range countryHeaders {
+		if country := r.Header.Get(header); country != "" {
+			request.Country = country
+			break
+		}
+	}
+	return request
+}
+
+// setVariantCookie запоминает вариант, чтобы вернувшийся посетитель попал на тот же адрес
+func setVariantCookie(w http.ResponseWriter, r *http.Request, variant int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookieName,
+		Value:    strconv.Itoa(variant),
+		Path:     "/" + mux.Vars(r)["urlID"],
+		MaxAge:   variantCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// detectPlatform платформа устройства по User-Agent. iPad с iPadOS 13 и новее представляется
+// как Mac и определяется как desktop; роботы и неизвестные клиенты получают пустую платформу.
+func detectPlatform(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Windows Phone"):
+		return ""
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return services.PlatformIOS
+	case strings.Contains(userAgent, "Android"):
+		return services.PlatformAndroid
+	case strings.Contains(userAgent, "Windows NT"), strings.Contains(userAgent, "Macintosh"),
+		strings.Contains(userAgent, "X11"), strings.Contains(userAgent, "CrOS"):
+		return services.PlatformDesktop
+	}
+	return ""
+}
+
+// preferredLanguage язык с наибольшим весом q из Accept-Language, при равном весе - первый
+func preferredLanguage(acceptLanguage string) string {
+	var language string
+	bestWeight := 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		weight := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(params[len("q="):], 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if weight > bestWeight {
+			language, bestWeight = tag, weight
+		}
+	}
+	return language
+}
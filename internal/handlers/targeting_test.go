@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		platform  string
+	}{
+		{
+			name:      "iPhone Safari",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			platform:  services.PlatformIOS,
+		},
+		{
+			name:      "iPhone Chrome",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/123.0.6312.52 Mobile/15E148 Safari/604.1",
+			platform:  services.PlatformIOS,
+		},
+		{
+			name:      "iPad iOS 12",
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 12_5_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Mobile/15E148 Safari/604.1",
+			platform:  services.PlatformIOS,
+		},
+		{
+			name:      "Android Chrome",
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.6312.99 Mobile Safari/537.36",
+			platform:  services.PlatformAndroid,
+		},
+		{
+			name:      "Android Samsung Internet",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SAMSUNG SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			platform:  services.PlatformAndroid,
+		},
+		{
+			name:      "Android Firefox",
+			userAgent: "Mozilla/5.0 (Android 14; Mobile; rv:124.0) Gecko/124.0 Firefox/124.0",
+			platform:  services.PlatformAndroid,
+		},
+		{
+			name:      "Windows Chrome",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36",
+			platform:  services.PlatformDesktop,
+		},
+		{
+			name:      "Windows Edge",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36 Edg/123.0.2420.65",
+			platform:  services.PlatformDesktop,
+		},
+		{
+			name:      "macOS Safari",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+			platform:  services.PlatformDesktop,
+		},
+		{
+			name:      "Linux Firefox",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:124.0) Gecko/20100101 Firefox/124.0",
+			platform:  services.PlatformDesktop,
+		},
+		{
+			name:      "ChromeOS",
+			userAgent: "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36",
+			platform:  services.PlatformDesktop,
+		},
+		{
+			name:      "Windows Phone",
+			userAgent: "Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.15063",
+			platform:  "",
+		},
+		{
+			name:      "Googlebot",
+			userAgent: "Googlebot/2.1 (+http://www.google.com/bot.html)",
+			platform:  "",
+		},
+		{
+			name:      "curl",
+			userAgent: "curl/8.4.0",
+			platform:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.platform, detectPlatform(tt.userAgent))
+		})
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		language       string
+	}{
+		{acceptLanguage: "", language: ""},
+		{acceptLanguage: "de-DE,de;q=0.9,en;q=0.8", language: "de-DE"},
+		{acceptLanguage: "en;q=0.5, fr-CH;q=0.9, *;q=1", language: "fr-CH"},
+		{acceptLanguage: "ru, en", language: "ru"},
+		{acceptLanguage: "es;q=0, it;q=0.1", language: "it"},
+		{acceptLanguage: "es;q=oops, pt-BR", language: "pt-BR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			require.Equal(t, tt.language, preferredLanguage(tt.acceptLanguage))
+		})
+	}
+}
+
+func TestTargetedRedirect(t *testing.T) {
+	shortener := services.NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead)
+
+	shortURL, err := shortener.CreateLink(context.Background(), "user", "https://example.com", services.LinkOptions{
+		Targeting: []storage.TargetingRule{
+			{Platform: services.PlatformIOS, URL: "https://apps.apple.com/app/id1"},
+			{Platform: services.PlatformAndroid, URL: "https://play.google.com/store/apps/details?id=app"},
+			{Language: "de", URL: "https://example.com/de"},
+			{Country: "fr", URL: "https://example.com/fr"},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		location string
+	}{
+		{
+			name:     "iOS",
+			headers:  map[string]string{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", "Accept-Language": "de"},
+			location: "https://apps.apple.com/app/id1",
+		},
+		{
+			name:     "Android",
+			headers:  map[string]string{"User-Agent": "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.6312.99 Mobile Safari/537.36"},
+			location: "https://play.google.com/store/apps/details?id=app",
+		},
+		{
+			name:     "German desktop",
+			headers:  map[string]string{"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Gecko/20100101 Firefox/124.0", "Accept-Language": "de-AT,en;q=0.5"},
+			location: "https://example.com/de",
+		},
+		{
+			name:     "Country from CDN",
+			headers:  map[string]string{"Accept-Language": "en", "CF-IPCountry": "FR"},
+			location: "https://example.com/fr",
+		},
+		{
+			name:     "Default",
+			headers:  map[string]string{"User-Agent": "curl/8.4.0", "Accept-Language": "en-US"},
+			location: "https://example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, shortURL, nil)
+			for header, value := range tt.headers {
+				request.Header.Set(header, value)
+			}
+			w := serve(router, request)
+			require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			require.Equal(t, tt.location, w.Header().Get("Location"))
+			require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		})
+	}
+
+	_, err = shortener.CreateLink(context.Background(), "user", "https://example.org", services.LinkOptions{
+		Targeting: []storage.TargetingRule{{Platform: "windows", URL: "https://example.org/win"}},
+	})
+	require.ErrorAs(t, err, &services.LinkValidationError{})
+}
+
+func TestStickyVariant(t *testing.T) {
+	shortener := services.NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	handler := NewURLHandler(shortener, authorization, logrus.New())
+	router := mux.NewRouter()
+	router.HandleFunc("/{urlID}/", handler.GetURLByIDHandler()).Methods(http.MethodGet, http.MethodHead)
+
+	shortURL, err := shortener.CreateLink(context.Background(), "user", "https://example.com", services.LinkOptions{
+		Variants: []storage.LinkVariant{{URL: "https://example.com/a", Weight: 50}, {URL: "https://example.com/b", Weight: 50}},
+	})
+	require.NoError(t, err)
+
+	w := serve(router, httptest.NewRequest(http.MethodGet, shortURL, nil))
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	location := w.Header().Get("Location")
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, variantCookieName, cookies[0].Name)
+	require.Equal(t, strings.TrimSuffix(strings.TrimPrefix(shortURL, config.BaseURL), "/"), cookies[0].Path)
+
+	// С cookie посетитель всегда попадает на тот же вариант
+	for i := 0; i < 20; i++ {
+		request := httptest.NewRequest(http.MethodGet, shortURL, nil)
+		request.AddCookie(cookies[0])
+		require.Equal(t, location, serve(router, request).Header().Get("Location"))
+	}
+}
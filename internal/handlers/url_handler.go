@@ -24,11 +24,7 @@ type URLHandler struct {
 }
 
 func (h *URLHandler) getUserToken(ctx context.Context) string {
-	userToken := ctx.Value(UserTokenKey)
-	if userToken == nil {
-		return ""
-	}
-	return userToken.(string)
+	return getUserToken(ctx)
 }
 
 func (h *URLHandler) SetURLTextHandler() http.HandlerFunc {
@@ -45,8 +41,9 @@ func (h *URLHandler) SetURLTextHandler() http.HandlerFunc {
 		}
 		shortURL, err := h.shortener.SaveData(ctx, userToken, string(url))
 		if err != nil {
-			errMsg, statusCode := h.processSetURLError(err)
+			errMsg, statusCode := h.processSetURLError(w, err)
 			h.TextResponse(w, statusCode, errMsg)
+			return
 		}
 		h.TextResponse(w, http.StatusCreated, shortURL)
 	}
@@ -56,6 +53,34 @@ func (h *URLHandler) SetURLJSONHandler() http.HandlerFunc {
 	const timeout = 3 * time.Second
 	type RequestData struct {
 		URL string `json:"url"`
+		// WorkspaceID ссылка создается в пространстве, а не у пользователя
+		WorkspaceID string `json:"workspace_id"`
+		// Private ссылка с длинным случайным идентификатором
+		Private bool `json:"private"`
+		// RedirectCode 301, 302, 307 или 308, по умолчанию - код из настроек сервиса
+		RedirectCode int `json:"redirect_code"`
+		// Password переход по ссылке только после ввода пароля
+		Password string `json:"password"`
+		// MaxClicks после стольких переходов ссылка отвечает 410, 1 - одноразовая ссылка
+		MaxClicks int64 `json:"max_clicks"`
+		// NotBefore время активации в RFC 3339, до него ссылка отвечает NotActiveMessage
+		NotBefore        *time.Time `json:"not_before"`
+		NotActiveMessage string     `json:"not_active_message"`
+		// Schedule смены исходного URL по расписанию: [{"at": "...", "url": "..."}]
+		Schedule []storage.ScheduledDestination `json:"schedule"`
+		// Targeting правила по порядку: [{"platform": "ios", "language": "de", "country": "DE", "url": "..."}]
+		Targeting []storage.TargetingRule `json:"targeting"`
+		// Variants A/B-тест: [{"url": "...", "weight": 70}, {"url": "...", "weight": 30}]
+		Variants []storage.LinkVariant `json:"variants"`
+		// ForwardPath /abc/docs/x ведет на <url>/docs/x
+		ForwardPath bool `json:"forward_path"`
+		// ForwardQuery параметры перехода добавляются к url; при совпадении ключей
+		// QueryConflict: keep (по умолчанию) оставляет значение url, override - значение
+		// перехода, append - оба
+		ForwardQuery  bool   `json:"forward_query"`
+		QueryConflict string `json:"query_conflict"`
+		// CampaignID переходы получают UTM-метки кампании
+		CampaignID string `json:"campaign_id"`
 	}
 	type ResponseData struct {
 		Result   string `json:"result"`
@@ -76,9 +101,27 @@ func (h *URLHandler) SetURLJSONHandler() http.HandlerFunc {
 			h.JSONResponse(w, http.StatusBadRequest, responseData)
 			return
 		}
-		shortURL, err := h.shortener.SaveData(ctx, userToken, requestData.URL)
+		opts := services.LinkOptions{
+			WorkspaceID:      requestData.WorkspaceID,
+			Private:          requestData.Private,
+			RedirectCode:     requestData.RedirectCode,
+			Password:         requestData.Password,
+			MaxClicks:        requestData.MaxClicks,
+			NotActiveMessage: requestData.NotActiveMessage,
+			Schedule:         requestData.Schedule,
+			Targeting:        requestData.Targeting,
+			Variants:         requestData.Variants,
+			ForwardPath:      requestData.ForwardPath,
+			ForwardQuery:     requestData.ForwardQuery,
+			QueryConflict:    requestData.QueryConflict,
+			CampaignID:       requestData.CampaignID,
+		}
+		if requestData.NotBefore != nil {
+			opts.NotBefore = *requestData.NotBefore
+		}
+		shortURL, err := h.shortener.CreateLink(ctx, userToken, requestData.URL, opts)
 		if err != nil {
-			errMsg, statusCode := h.processSetURLError(err)
+			errMsg, statusCode := h.processSetURLError(w, err)
 			responseData.ErrorMsg = errMsg
 			h.JSONResponse(w, statusCode, responseData)
 			return
@@ -88,6 +131,16 @@ func (h *URLHandler) SetURLJSONHandler() http.HandlerFunc {
 	}
 }
 
+// GetURLByIDHandler переход по ссылке. Пароль защищенной ссылки передается заголовком
+// X-Link-Password или полем password формы, которую получает браузер; после формы
+// перенаправление всегда 303, чтобы браузер не отправил пароль по исходному адресу.
+// HEAD не расходует переход; ссылка с лимитом переходов отвечает на него 204 без Location
+// или 410, если переходы исчерпаны.
+// Правила таргетинга проверяются по User-Agent, Accept-Language и стране из заголовков CDN.
+// Вариант A/B-ссылки запоминается в cookie, чтобы посетитель возвращался на тот же адрес.
+// Ссылка открывается и без завершающего "/", путь после идентификатора и параметры запроса
+// переносятся в адрес, только если это включено у ссылки. Путь из нескольких сегментов сначала
+// сравнивается со ссылками-шаблонами.
 func (h *URLHandler) GetURLByIDHandler() http.HandlerFunc {
 	const timeout = 3 * time.Second
 
@@ -97,21 +150,85 @@ func (h *URLHandler) GetURLByIDHandler() http.HandlerFunc {
 
 		vars := mux.Vars(r)
 		urlID := vars["urlID"]
-		shortURL := fmt.Sprintf("%s/%s/", h.shortener.GetHostURL(), urlID)
-		originalURL, err := h.shortener.GetOriginalURL(ctx, shortURL)
+		// Ссылки-шаблоны проверяются раньше обычных: у шаблона всегда есть путь после первого сегмента
+		var redirect services.Redirect
+		var matched bool
+		var err error
+		if vars["path"] != "" {
+			redirect, matched, err = h.shortener.MatchLinkPattern(ctx, urlID+"/"+vars["path"])
+			// Без шаблонов обычные ссылки с переносом пути должны работать как раньше
+			if err != nil {
+				h.logger.Warn(err)
+				matched, err = false, nil
+			}
+		}
+		if !matched {
+			shortURL := fmt.Sprintf("%s/%s/", h.shortener.GetHostURL(), urlID)
+			redirect, err = h.shortener.GetRedirect(ctx, shortURL, redirectRequest(r))
+		}
 		if err != nil {
-			switch err.(type) {
-			case services.OriginalURLNotFound:
+			var notFoundErr services.OriginalURLNotFound
+			var disabledErr services.LinkDisabledError
+			var exhaustedErr services.LinkExhaustedError
+			var notActiveErr services.LinkNotActiveError
+			var passwordRequiredErr services.LinkPasswordRequiredError
+			var wrongPasswordErr services.WrongLinkPasswordError
+			var lockedErr services.LinkLockedError
+			var unavailableErr storage.DBUnavailableError
+			switch {
+			case errors.As(err, &notFoundErr):
 				h.TextResponse(w, http.StatusNotFound, err.Error())
+			case errors.As(err, &disabledErr):
+				h.TextResponse(w, http.StatusGone, err.Error())
+			case errors.As(err, &exhaustedErr):
+				h.TextResponse(w, http.StatusGone, err.Error())
+			case errors.As(err, &notActiveErr):
+				w.Header().Set("Retry-After", durationSeconds(notActiveErr.RetryAfter))
+				w.Header().Set("Cache-Control", "no-store")
+				h.TextResponse(w, http.StatusForbidden, err.Error())
+			case errors.As(err, &passwordRequiredErr):
+				h.passwordFormResponse(w, r, http.StatusUnauthorized, "")
+			case errors.As(err, &wrongPasswordErr):
+				h.passwordFormResponse(w, r, http.StatusForbidden, err.Error())
+			case errors.As(err, &lockedErr):
+				w.Header().Set("Retry-After", durationSeconds(lockedErr.RetryAfter))
+				h.passwordFormResponse(w, r, http.StatusTooManyRequests, err.Error())
+			case errors.As(err, &unavailableErr):
+				w.Header().Set("Retry-After", retryAfterSeconds(err))
+				h.TextResponse(w, http.StatusServiceUnavailable, unavailableErr.Error())
 			default:
 				h.logger.Error(err)
 				h.TextResponse(w, http.StatusInternalServerError, InternalServerError.Error())
 			}
 			return
 		}
-		w.Header().Add("Location", originalURL)
-		h.TextResponse(w, http.StatusTemporaryRedirect, "")
+		statusCode, cacheControl := redirect.StatusCode, redirectCacheControl(redirect.StatusCode)
+		if redirect.NoStore {
+			cacheControl = "no-store"
+		}
+		if r.Method == http.MethodPost {
+			statusCode = http.StatusSeeOther
+		}
+		if redirect.Variant > 0 {
+			setVariantCookie(w, r, redirect.Variant)
+		}
+		if redirect.URL != "" {
+			w.Header().Add("Location", redirect.URL)
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		h.TextResponse(w, statusCode, "")
+	}
+}
+
+// redirectCacheControl постоянные перенаправления кешируются на пять минут: адрес любой
+// ссылки владелец может изменить, а администратор - отключить ссылку, и браузеры с CDN
+// должны увидеть это почти сразу. Временные не кешируются: каждый переход должен
+// доходить до сервиса.
+func redirectCacheControl(code int) string {
+	if code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect {
+		return "public, max-age=300"
 	}
+	return "no-store"
 }
 
 func (h *URLHandler) GetUserURLs() http.HandlerFunc {
@@ -122,6 +239,19 @@ func (h *URLHandler) GetUserURLs() http.HandlerFunc {
 		defer cancel()
 
 		userToken := h.getUserToken(r.Context())
+		if workspaceID := r.URL.Query().Get("workspace"); workspaceID != "" {
+			workspaceURLs, err := h.shortener.GetWorkspaceURLs(ctx, userToken, workspaceID)
+			if err != nil {
+				h.urlErrorResponse(w, err)
+				return
+			}
+			if len(workspaceURLs) == 0 {
+				h.JSONResponse(w, http.StatusNoContent, nil)
+				return
+			}
+			h.JSONResponse(w, http.StatusOK, workspaceURLs)
+			return
+		}
 		userURLs, err := h.shortener.GetUserURLs(ctx, userToken)
 		if err != nil {
 			h.TextResponse(w, http.StatusInternalServerError, InternalServerError.Error())
@@ -135,6 +265,315 @@ func (h *URLHandler) GetUserURLs() http.HandlerFunc {
 	}
 }
 
+// UpdateURL меняет исходный URL и код перенаправления ссылки; ссылка пространства
+// указывается параметром workspace
+func (h *URLHandler) UpdateURL() http.HandlerFunc {
+	const timeout = 3 * time.Second
+	type RequestData struct {
+		OriginalURL  string `json:"original_url"`
+		RedirectCode int    `json:"redirect_code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &RequestData{}
+		err := json.NewDecoder(r.Body).Decode(requestData)
+		if err != nil || requestData.OriginalURL == "" && requestData.RedirectCode == 0 {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		userToken := h.getUserToken(r.Context())
+		workspaceID, urlID := r.URL.Query().Get("workspace"), mux.Vars(r)["urlID"]
+		if requestData.OriginalURL != "" {
+			if err := h.shortener.UpdateURL(ctx, userToken, workspaceID, urlID, requestData.OriginalURL); err != nil {
+				h.urlErrorResponse(w, err)
+				return
+			}
+		}
+		if requestData.RedirectCode != 0 {
+			if err := h.shortener.SetRedirectCode(ctx, userToken, workspaceID, urlID, requestData.RedirectCode); err != nil {
+				h.urlErrorResponse(w, err)
+				return
+			}
+		}
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
+// GetURLHistory версии исходного URL ссылки от первой к текущей
+func (h *URLHandler) GetURLHistory() http.HandlerFunc {
+	const timeout = 3 * time.Second
+	type URLVersion struct {
+		Version     int64  `json:"version"`
+		OriginalURL string `json:"original_url"`
+		// ReplacedAt когда версию заменили, у текущей версии отсутствует
+		ReplacedAt *time.Time `json:"replaced_at,omitempty"`
+		Current    bool       `json:"current"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userToken := h.getUserToken(r.Context())
+		history, err := h.shortener.GetURLHistory(ctx, userToken, r.URL.Query().Get("workspace"), mux.Vars(r)["urlID"])
+		if err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		responseData := make([]URLVersion, 0, len(history))
+		for i, urlVersion := range history {
+			version := URLVersion{Version: urlVersion.Version, OriginalURL: urlVersion.OriginalURL, Current: i == len(history)-1}
+			if !version.Current {
+				replacedAt := urlVersion.ReplacedAt
+				version.ReplacedAt = &replacedAt
+			}
+			responseData = append(responseData, version)
+		}
+		h.JSONResponse(w, http.StatusOK, responseData)
+	}
+}
+
+// GetLinkStats статистика переходов по ссылке
+func (h *URLHandler) GetLinkStats() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userToken := h.getUserToken(r.Context())
+		stats, err := h.shortener.GetLinkStats(ctx, userToken, r.URL.Query().Get("workspace"), mux.Vars(r)["urlID"])
+		if err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusOK, stats)
+	}
+}
+
+// RollbackURL возвращает ссылке исходный URL одной из прежних версий
+func (h *URLHandler) RollbackURL() http.HandlerFunc {
+	const timeout = 3 * time.Second
+	type RequestData struct {
+		Version int64 `json:"version"`
+	}
+	type ResponseData struct {
+		OriginalURL string `json:"original_url"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &RequestData{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil || requestData.Version == 0 {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		userToken := h.getUserToken(r.Context())
+		workspaceID, urlID := r.URL.Query().Get("workspace"), mux.Vars(r)["urlID"]
+		originalURL, err := h.shortener.RollbackURL(ctx, userToken, workspaceID, urlID, requestData.Version)
+		if err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusOK, ResponseData{OriginalURL: originalURL})
+	}
+}
+
+// campaignRequest поля кампании в запросах на создание и изменение
+type campaignRequest struct {
+	Name        string `json:"name"`
+	UTMSource   string `json:"utm_source"`
+	UTMMedium   string `json:"utm_medium"`
+	UTMCampaign string `json:"utm_campaign"`
+}
+
+func (c campaignRequest) params() services.CampaignParams {
+	return services.CampaignParams{Name: c.Name, UTMSource: c.UTMSource, UTMMedium: c.UTMMedium, UTMCampaign: c.UTMCampaign}
+}
+
+// CreateCampaign создает кампанию: {"name": "...", "utm_source": "...", "utm_medium": "...", "utm_campaign": "..."}
+func (h *URLHandler) CreateCampaign() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &campaignRequest{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		userToken := h.getUserToken(r.Context())
+		campaign, err := h.shortener.CreateCampaign(ctx, userToken, r.URL.Query().Get("workspace"), requestData.params())
+		if err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusCreated, campaign)
+	}
+}
+
+func (h *URLHandler) GetCampaigns() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userToken := h.getUserToken(r.Context())
+		campaigns, err := h.shortener.GetCampaigns(ctx, userToken, r.URL.Query().Get("workspace"))
+		if err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		if campaigns == nil {
+			campaigns = []storage.Campaign{}
+		}
+		h.JSONResponse(w, http.StatusOK, campaigns)
+	}
+}
+
+// UpdateCampaign заменяет название и метки кампании, ссылки кампании получают новые метки сразу
+func (h *URLHandler) UpdateCampaign() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &campaignRequest{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		userToken := h.getUserToken(r.Context())
+		workspaceID, campaignID := r.URL.Query().Get("workspace"), mux.Vars(r)["campaignID"]
+		campaign, err := h.shortener.UpdateCampaign(ctx, userToken, workspaceID, campaignID, requestData.params())
+		if err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusOK, campaign)
+	}
+}
+
+func (h *URLHandler) DeleteCampaign() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userToken := h.getUserToken(r.Context())
+		if err := h.shortener.DeleteCampaign(ctx, userToken, r.URL.Query().Get("workspace"), mux.Vars(r)["campaignID"]); err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
+// GetCampaignURLs ссылки, созданные в кампании
+func (h *URLHandler) GetCampaignURLs() http.HandlerFunc {
+	const timeout = 10 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userToken := h.getUserToken(r.Context())
+		urls, err := h.shortener.GetCampaignURLs(ctx, userToken, r.URL.Query().Get("workspace"), mux.Vars(r)["campaignID"])
+		if err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusOK, urls)
+	}
+}
+
+// CreateLinkPattern создает ссылку-шаблон: {"pattern": "/gh/{user}", "url": "https://github.com/{user}"}
+func (h *URLHandler) CreateLinkPattern() http.HandlerFunc {
+	const timeout = 3 * time.Second
+	type RequestData struct {
+		Pattern string `json:"pattern"`
+		URL     string `json:"url"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &RequestData{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil || requestData.Pattern == "" || requestData.URL == "" {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		userToken := h.getUserToken(r.Context())
+		pattern, err := h.shortener.CreateLinkPattern(ctx, userToken, requestData.Pattern, requestData.URL)
+		if err != nil {
+			h.linkPatternErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusCreated, pattern)
+	}
+}
+
+func (h *URLHandler) GetLinkPatterns() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		patterns, err := h.shortener.GetLinkPatterns(ctx)
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		if patterns == nil {
+			patterns = []storage.LinkPattern{}
+		}
+		h.JSONResponse(w, http.StatusOK, patterns)
+	}
+}
+
+func (h *URLHandler) DeleteLinkPattern() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		if err := h.shortener.DeleteLinkPattern(ctx, mux.Vars(r)["patternID"]); err != nil {
+			h.linkPatternErrorResponse(w, err)
+			return
+		}
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
+func (h *URLHandler) DeleteURL() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userToken := h.getUserToken(r.Context())
+		if err := h.shortener.DeleteURL(ctx, userToken, r.URL.Query().Get("workspace"), mux.Vars(r)["urlID"]); err != nil {
+			h.urlErrorResponse(w, err)
+			return
+		}
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
 func (h *URLHandler) SaveDataBatch() http.HandlerFunc {
 	const timeout = 3 * time.Second
 
@@ -152,8 +591,7 @@ func (h *URLHandler) SaveDataBatch() http.HandlerFunc {
 		}
 		responseData, err := h.shortener.SaveDataBatch(ctx, userToken, requestData)
 		if err != nil {
-			h.processSetURLError(err)
-			errMsg, statusCode := h.processSetURLError(err)
+			errMsg, statusCode := h.processSetURLError(w, err)
 			h.JSONResponse(w, statusCode, errMsg)
 			return
 		}
@@ -168,6 +606,11 @@ func (h *URLHandler) Ping() http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 		if err := h.shortener.Ping(ctx); err != nil {
+			var unavailableErr storage.DBUnavailableError
+			if errors.As(err, &unavailableErr) {
+				h.TextResponse(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
 			h.TextResponse(w, http.StatusInternalServerError, "")
 			return
 		}
@@ -175,7 +618,7 @@ func (h *URLHandler) Ping() http.HandlerFunc {
 	}
 }
 
-func (h *URLHandler) processSetURLError(err error) (string, int) {
+func (h *URLHandler) processSetURLError(w http.ResponseWriter, err error) (string, int) {
 	var errMsg string
 	var statusCode int
 	var duplicateErr *storage.DuplicateURLErr
@@ -184,8 +627,34 @@ func (h *URLHandler) processSetURLError(err error) (string, int) {
 		statusCode = http.StatusConflict
 		return errMsg, statusCode
 	}
+	var unavailableErr storage.DBUnavailableError
+	if errors.As(err, &unavailableErr) {
+		w.Header().Set("Retry-After", retryAfterSeconds(err))
+		return unavailableErr.Error(), http.StatusServiceUnavailable
+	}
+	var workspaceNotFoundErr services.WorkspaceNotFoundError
+	var workspaceForbiddenErr services.WorkspaceForbiddenError
+	var campaignNotFoundErr services.CampaignNotFoundError
+	var quotaErr services.QuotaExceededError
+	var batchErr services.BatchTooLargeError
+	switch {
+	case errors.As(err, &workspaceNotFoundErr), errors.As(err, &campaignNotFoundErr):
+		return err.Error(), http.StatusNotFound
+	case errors.As(err, &workspaceForbiddenErr):
+		return err.Error(), http.StatusForbidden
+	case errors.As(err, &quotaErr):
+		setRateLimitHeaders(w, quotaErr.Limit, quotaErr.Remaining, quotaErr.RetryAfter)
+		// Исчерпанная общая квота не восстанавливается, повторять запрос бесполезно
+		if quotaErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", durationSeconds(quotaErr.RetryAfter))
+		}
+		return err.Error(), http.StatusTooManyRequests
+	case errors.As(err, &batchErr):
+		return err.Error(), http.StatusRequestEntityTooLarge
+	}
 	switch err.(type) {
-	case services.URLIsNotValidError:
+	case services.URLIsNotValidError, services.PrivateLinksDisabledError, services.RedirectCodeNotValidError,
+		services.LinkValidationError:
 		errMsg = err.Error()
 		statusCode = http.StatusBadRequest
 	default:
@@ -196,6 +665,49 @@ func (h *URLHandler) processSetURLError(err error) (string, int) {
 	return errMsg, statusCode
 }
 
+// urlErrorResponse ответ на ошибку операции над существующей ссылкой
+func (h *URLHandler) urlErrorResponse(w http.ResponseWriter, err error) {
+	var notFoundErr services.OriginalURLNotFound
+	var versionNotFoundErr services.URLVersionNotFoundError
+	var notValidErr services.URLIsNotValidError
+	var redirectCodeErr services.RedirectCodeNotValidError
+	var validationErr services.LinkValidationError
+	var workspaceNotFoundErr services.WorkspaceNotFoundError
+	var workspaceForbiddenErr services.WorkspaceForbiddenError
+	var campaignNotFoundErr services.CampaignNotFoundError
+	var notEditableErr services.URLNotEditableError
+	switch {
+	case errors.As(err, &notFoundErr), errors.As(err, &versionNotFoundErr), errors.As(err, &workspaceNotFoundErr),
+		errors.As(err, &campaignNotFoundErr):
+		h.TextResponse(w, http.StatusNotFound, err.Error())
+	case errors.As(err, &notEditableErr):
+		h.TextResponse(w, http.StatusConflict, err.Error())
+	case errors.As(err, &notValidErr), errors.As(err, &redirectCodeErr), errors.As(err, &validationErr):
+		h.TextResponse(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, &workspaceForbiddenErr):
+		h.TextResponse(w, http.StatusForbidden, err.Error())
+	default:
+		h.ErrorResponse(w, err)
+	}
+}
+
+func (h *URLHandler) linkPatternErrorResponse(w http.ResponseWriter, err error) {
+	var validationErr services.LinkValidationError
+	var notValidErr services.URLIsNotValidError
+	var existsErr services.LinkPatternExistsError
+	var notFoundErr services.LinkPatternNotFoundError
+	switch {
+	case errors.As(err, &validationErr), errors.As(err, &notValidErr):
+		h.TextResponse(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, &existsErr):
+		h.TextResponse(w, http.StatusConflict, err.Error())
+	case errors.As(err, &notFoundErr):
+		h.TextResponse(w, http.StatusNotFound, err.Error())
+	default:
+		h.ErrorResponse(w, err)
+	}
+}
+
 func NewURLHandler(shortener services.URLService, auth auth.CookieAuthentication, logger *logrus.Logger) URLHandler {
 	return URLHandler{
 		BaseHandler:    BaseHandler{logger: logger},
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxsnegir/url-shortener/internal/services"
+)
+
+type WorkspaceHandler struct {
+	BaseHandler
+	workspaces services.WorkspaceService
+}
+
+type workspaceMemberResponse struct {
+	UserToken string                 `json:"user_token"`
+	Role      services.WorkspaceRole `json:"role"`
+	JoinedAt  time.Time              `json:"joined_at"`
+}
+
+type workspaceInviteResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type workspaceRoleRequest struct {
+	Role services.WorkspaceRole `json:"role"`
+}
+
+func (h *WorkspaceHandler) CreateWorkspace() http.HandlerFunc {
+	const timeout = 3 * time.Second
+	type RequestData struct {
+		Name string `json:"name"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &RequestData{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		workspace, err := h.workspaces.CreateWorkspace(ctx, getUserToken(r.Context()), requestData.Name)
+		if err != nil {
+			h.workspaceErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusCreated, workspace)
+	}
+}
+
+func (h *WorkspaceHandler) GetUserWorkspaces() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		workspaces, err := h.workspaces.GetUserWorkspaces(ctx, getUserToken(r.Context()))
+		if err != nil {
+			h.ErrorResponse(w, err)
+			return
+		}
+		if len(workspaces) == 0 {
+			h.JSONResponse(w, http.StatusNoContent, nil)
+			return
+		}
+		h.JSONResponse(w, http.StatusOK, workspaces)
+	}
+}
+
+func (h *WorkspaceHandler) GetMembers() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		members, err := h.workspaces.GetMembers(ctx, getUserToken(r.Context()), mux.Vars(r)["workspaceID"])
+		if err != nil {
+			h.workspaceErrorResponse(w, err)
+			return
+		}
+		response := make([]workspaceMemberResponse, 0, len(members))
+		for _, member := range members {
+			response = append(response, workspaceMemberResponse{
+				UserToken: member.UserToken,
+				Role:      services.WorkspaceRole(member.Role),
+				JoinedAt:  member.JoinedAt,
+			})
+		}
+		h.JSONResponse(w, http.StatusOK, response)
+	}
+}
+
+// SetMemberRole меняет роль участника: {"role": "editor"}
+func (h *WorkspaceHandler) SetMemberRole() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &workspaceRoleRequest{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		vars := mux.Vars(r)
+		err := h.workspaces.SetMemberRole(ctx, getUserToken(r.Context()), vars["workspaceID"], vars["userToken"], requestData.Role)
+		if err != nil {
+			h.workspaceErrorResponse(w, err)
+			return
+		}
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
+func (h *WorkspaceHandler) RemoveMember() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		vars := mux.Vars(r)
+		if err := h.workspaces.RemoveMember(ctx, getUserToken(r.Context()), vars["workspaceID"], vars["userToken"]); err != nil {
+			h.workspaceErrorResponse(w, err)
+			return
+		}
+		h.TextResponse(w, http.StatusNoContent, "")
+	}
+}
+
+// CreateInvite приглашение с ролью: {"role": "viewer"}. Токен показывается только один раз.
+func (h *WorkspaceHandler) CreateInvite() http.HandlerFunc {
+	const timeout = 3 * time.Second
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &workspaceRoleRequest{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		token, expiresAt, err := h.workspaces.CreateInvite(ctx, getUserToken(r.Context()), mux.Vars(r)["workspaceID"], requestData.Role)
+		if err != nil {
+			h.workspaceErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusCreated, workspaceInviteResponse{Token: token, ExpiresAt: expiresAt})
+	}
+}
+
+// AcceptInvite вступление в пространство по приглашению: {"token": "..."}
+func (h *WorkspaceHandler) AcceptInvite() http.HandlerFunc {
+	const timeout = 3 * time.Second
+	type RequestData struct {
+		Token string `json:"token"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		requestData := &RequestData{}
+		if err := json.NewDecoder(r.Body).Decode(requestData); err != nil || requestData.Token == "" {
+			h.TextResponse(w, http.StatusBadRequest, "wrong request")
+			return
+		}
+		workspace, err := h.workspaces.AcceptInvite(ctx, getUserToken(r.Context()), requestData.Token)
+		if err != nil {
+			h.workspaceErrorResponse(w, err)
+			return
+		}
+		h.JSONResponse(w, http.StatusOK, workspace)
+	}
+}
+
+func (h *WorkspaceHandler) workspaceErrorResponse(w http.ResponseWriter, err error) {
+	var notFoundErr services.WorkspaceNotFoundError
+	var memberNotFoundErr services.WorkspaceMemberNotFoundError
+	var forbiddenErr services.WorkspaceForbiddenError
+	var validationErr services.WorkspaceValidationError
+	var invalidInviteErr services.InvalidInviteError
+	var lastOwnerErr services.LastWorkspaceOwnerError
+	switch {
+	case errors.As(err, &notFoundErr), errors.As(err, &memberNotFoundErr), errors.As(err, &invalidInviteErr):
+		h.TextResponse(w, http.StatusNotFound, err.Error())
+	case errors.As(err, &forbiddenErr):
+		h.TextResponse(w, http.StatusForbidden, err.Error())
+	case errors.As(err, &validationErr):
+		h.TextResponse(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, &lastOwnerErr):
+		h.TextResponse(w, http.StatusConflict, err.Error())
+	default:
+		h.ErrorResponse(w, err)
+	}
+}
+
+func NewWorkspaceHandler(workspaces services.WorkspaceService, logger *logrus.Logger) WorkspaceHandler {
+	return WorkspaceHandler{
+		BaseHandler: BaseHandler{logger: logger},
+		workspaces:  workspaces,
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/services"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func newWorkspaceTestRouter() *mux.Router {
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := services.NewShortener(urlStorage, config.BaseURL, services.WithIDAllocator(services.NewIDAllocator(urlStorage, 10)))
+	authorization, _ := auth.NewCookieAuthentication("secretKey")
+	urlHandler := NewURLHandler(shortener, authorization, logrus.New())
+	workspaceHandler := NewWorkspaceHandler(services.NewWorkspaceService(urlStorage), logrus.New())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/shorten", urlHandler.SetURLJSONHandler()).Methods(http.MethodPost)
+	router.HandleFunc("/api/user/urls", urlHandler.GetUserURLs()).Methods(http.MethodGet)
+	router.HandleFunc("/api/user/urls/{urlID}", urlHandler.UpdateURL()).Methods(http.MethodPatch)
+	router.HandleFunc("/api/user/urls/{urlID}", urlHandler.DeleteURL()).Methods(http.MethodDelete)
+	router.HandleFunc("/api/workspaces", workspaceHandler.CreateWorkspace()).Methods(http.MethodPost)
+	router.HandleFunc("/api/workspaces", workspaceHandler.GetUserWorkspaces()).Methods(http.MethodGet)
+	router.HandleFunc("/api/workspaces/join", workspaceHandler.AcceptInvite()).Methods(http.MethodPost)
+	router.HandleFunc("/api/workspaces/{workspaceID}/members", workspaceHandler.GetMembers()).Methods(http.MethodGet)
+	router.HandleFunc("/api/workspaces/{workspaceID}/members/{userToken}", workspaceHandler.SetMemberRole()).Methods(http.MethodPut)
+	router.HandleFunc("/api/workspaces/{workspaceID}/members/{userToken}", workspaceHandler.RemoveMember()).Methods(http.MethodDelete)
+	router.HandleFunc("/api/workspaces/{workspaceID}/invites", workspaceHandler.CreateInvite()).Methods(http.MethodPost)
+	router.Use(urlHandler.CookieAuthenticationMiddleware)
+	return router
+}
+
+// TestWorkspaceSharedLinks участники пространства работают с общими ссылками по своим ролям
+func TestWorkspaceSharedLinks(t *testing.T) {
+	router := newWorkspaceTestRouter()
+	alice, bob, mallory := newBrowser(router), newBrowser(router), newBrowser(router)
+
+	w := alice.do(http.MethodPost, "/api/workspaces", `{"name": "Marketing"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var workspace services.WorkspaceInfo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&workspace))
+	workspaceURLs := "/api/user/urls?workspace=" + workspace.ID
+
+	w = alice.do(http.MethodPost, "/api/workspaces/"+workspace.ID+"/invites", `{"role": "editor"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var invite workspaceInviteResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&invite))
+	require.Equal(t, http.StatusOK, bob.do(http.MethodPost, "/api/workspaces/join", fmt.Sprintf(`{"token": %q}`, invite.Token)).Code)
+	require.Equal(t, http.StatusNotFound, mallory.do(http.MethodPost, "/api/workspaces/join", fmt.Sprintf(`{"token": %q}`, invite.Token)).Code)
+
+	w = bob.do(http.MethodPost, "/api/shorten", fmt.Sprintf(`{"url": "https://github.com/1", "workspace_id": %q}`, workspace.ID))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	urlID := strings.Trim(strings.TrimPrefix(created.Result, config.BaseURL), "/")
+	require.Equal(t, http.StatusNotFound, mallory.do(http.MethodPost, "/api/shorten", fmt.Sprintf(`{"url": "https://github.com/2", "workspace_id": %q}`, workspace.ID)).Code)
+
+	require.Equal(t, http.StatusOK, alice.do(http.MethodGet, workspaceURLs, "").Code)
+	require.Equal(t, http.StatusNoContent, alice.do(http.MethodGet, "/api/user/urls", "").Code)
+	require.Equal(t, http.StatusNotFound, mallory.do(http.MethodGet, workspaceURLs, "").Code)
+
+	target := "/api/user/urls/" + urlID + "?workspace=" + workspace.ID
+	require.Equal(t, http.StatusNotFound, mallory.do(http.MethodPatch, target, `{"original_url": "https://evil.com"}`).Code)
+	require.Equal(t, http.StatusNoContent, alice.do(http.MethodPatch, target, `{"original_url": "https://github.com/3"}`).Code)
+
+	// Понижение до viewer забирает право удалять ссылки
+	w = bob.do(http.MethodGet, "/api/workspaces/"+workspace.ID+"/members", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var members []workspaceMemberResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&members))
+	require.Len(t, members, 2)
+	var bobToken string
+	for _, member := range members {
+		if member.Role == services.WorkspaceEditor {
+			bobToken = member.UserToken
+		}
+	}
+	require.Equal(t, http.StatusNoContent, alice.do(http.MethodPut, "/api/workspaces/"+workspace.ID+"/members/"+bobToken, `{"role": "viewer"}`).Code)
+	require.Equal(t, http.StatusForbidden, bob.do(http.MethodDelete, target, "").Code)
+	require.Equal(t, http.StatusNoContent, alice.do(http.MethodDelete, target, "").Code)
+	require.Equal(t, http.StatusNoContent, bob.do(http.MethodGet, workspaceURLs, "").Code)
+
+	require.Equal(t, http.StatusNoContent, bob.do(http.MethodDelete, "/api/workspaces/"+workspace.ID+"/members/"+bobToken, "").Code)
+	require.Equal(t, http.StatusNoContent, bob.do(http.MethodGet, "/api/workspaces", "").Code)
+}
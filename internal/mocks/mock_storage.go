@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	storage "github.com/maxsnegir/url-shortener/internal/storage"
@@ -35,6 +36,315 @@ func (m *MockShortenerStorage) EXPECT() *MockShortenerStorageMockRecorder {
 	return m.recorder
 }
 
+// AddVariantClick mocks base method.
+func (m *MockShortenerStorage) AddVariantClick(arg0 context.Context, arg1 string, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddVariantClick", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddVariantClick indicates an expected call of AddVariantClick.
+func (mr *MockShortenerStorageMockRecorder) AddVariantClick(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddVariantClick", reflect.TypeOf((*MockShortenerStorage)(nil).AddVariantClick), arg0, arg1, arg2)
+}
+
+// ConsumeClick mocks base method.
+func (m *MockShortenerStorage) ConsumeClick(arg0 context.Context, arg1 string, arg2 int64) (int64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeClick", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ConsumeClick indicates an expected call of ConsumeClick.
+func (mr *MockShortenerStorageMockRecorder) ConsumeClick(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeClick", reflect.TypeOf((*MockShortenerStorage)(nil).ConsumeClick), arg0, arg1, arg2)
+}
+
+// ConsumeQuota mocks base method.
+func (m *MockShortenerStorage) ConsumeQuota(arg0 context.Context, arg1, arg2 string, arg3 int64, arg4 storage.QuotaLimits) (storage.QuotaUsage, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeQuota", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(storage.QuotaUsage)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ConsumeQuota indicates an expected call of ConsumeQuota.
+func (mr *MockShortenerStorageMockRecorder) ConsumeQuota(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeQuota", reflect.TypeOf((*MockShortenerStorage)(nil).ConsumeQuota), arg0, arg1, arg2, arg3, arg4)
+}
+
+// CreateAccount mocks base method.
+func (m *MockShortenerStorage) CreateAccount(arg0 context.Context, arg1 storage.Account) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAccount", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAccount indicates an expected call of CreateAccount.
+func (mr *MockShortenerStorageMockRecorder) CreateAccount(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockShortenerStorage)(nil).CreateAccount), arg0, arg1)
+}
+
+// CreateWorkspace mocks base method.
+func (m *MockShortenerStorage) CreateWorkspace(arg0 context.Context, arg1 storage.Workspace, arg2 storage.WorkspaceMember) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWorkspace", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWorkspace indicates an expected call of CreateWorkspace.
+func (mr *MockShortenerStorageMockRecorder) CreateWorkspace(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWorkspace", reflect.TypeOf((*MockShortenerStorage)(nil).CreateWorkspace), arg0, arg1, arg2)
+}
+
+// DeleteCampaign mocks base method.
+func (m *MockShortenerStorage) DeleteCampaign(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCampaign", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCampaign indicates an expected call of DeleteCampaign.
+func (mr *MockShortenerStorageMockRecorder) DeleteCampaign(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCampaign", reflect.TypeOf((*MockShortenerStorage)(nil).DeleteCampaign), arg0, arg1)
+}
+
+// DeleteLinkPattern mocks base method.
+func (m *MockShortenerStorage) DeleteLinkPattern(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLinkPattern", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLinkPattern indicates an expected call of DeleteLinkPattern.
+func (mr *MockShortenerStorageMockRecorder) DeleteLinkPattern(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLinkPattern", reflect.TypeOf((*MockShortenerStorage)(nil).DeleteLinkPattern), arg0, arg1)
+}
+
+// DeleteSession mocks base method.
+func (m *MockShortenerStorage) DeleteSession(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSession indicates an expected call of DeleteSession.
+func (mr *MockShortenerStorageMockRecorder) DeleteSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockShortenerStorage)(nil).DeleteSession), arg0, arg1)
+}
+
+// DeleteURLData mocks base method.
+func (m *MockShortenerStorage) DeleteURLData(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteURLData", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteURLData indicates an expected call of DeleteURLData.
+func (mr *MockShortenerStorageMockRecorder) DeleteURLData(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteURLData", reflect.TypeOf((*MockShortenerStorage)(nil).DeleteURLData), arg0, arg1)
+}
+
+// DeleteWorkspaceMember mocks base method.
+func (m *MockShortenerStorage) DeleteWorkspaceMember(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWorkspaceMember", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWorkspaceMember indicates an expected call of DeleteWorkspaceMember.
+func (mr *MockShortenerStorageMockRecorder) DeleteWorkspaceMember(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWorkspaceMember", reflect.TypeOf((*MockShortenerStorage)(nil).DeleteWorkspaceMember), arg0, arg1, arg2)
+}
+
+// ExportLink mocks base method.
+func (m *MockShortenerStorage) ExportLink(arg0 context.Context, arg1 string) (storage.LinkRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportLink", arg0, arg1)
+	ret0, _ := ret[0].(storage.LinkRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportLink indicates an expected call of ExportLink.
+func (mr *MockShortenerStorageMockRecorder) ExportLink(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportLink", reflect.TypeOf((*MockShortenerStorage)(nil).ExportLink), arg0, arg1)
+}
+
+// GetAPIKeyByHash mocks base method.
+func (m *MockShortenerStorage) GetAPIKeyByHash(arg0 context.Context, arg1 string) (storage.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeyByHash", arg0, arg1)
+	ret0, _ := ret[0].(storage.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeyByHash indicates an expected call of GetAPIKeyByHash.
+func (mr *MockShortenerStorageMockRecorder) GetAPIKeyByHash(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeyByHash", reflect.TypeOf((*MockShortenerStorage)(nil).GetAPIKeyByHash), arg0, arg1)
+}
+
+// GetAccount mocks base method.
+func (m *MockShortenerStorage) GetAccount(arg0 context.Context, arg1 string) (storage.Account, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccount", arg0, arg1)
+	ret0, _ := ret[0].(storage.Account)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccount indicates an expected call of GetAccount.
+func (mr *MockShortenerStorageMockRecorder) GetAccount(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockShortenerStorage)(nil).GetAccount), arg0, arg1)
+}
+
+// GetAllLinkSettings mocks base method.
+func (m *MockShortenerStorage) GetAllLinkSettings(arg0 context.Context) ([]storage.LinkSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllLinkSettings", arg0)
+	ret0, _ := ret[0].([]storage.LinkSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllLinkSettings indicates an expected call of GetAllLinkSettings.
+func (mr *MockShortenerStorageMockRecorder) GetAllLinkSettings(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllLinkSettings", reflect.TypeOf((*MockShortenerStorage)(nil).GetAllLinkSettings), arg0)
+}
+
+// GetAllURLs mocks base method.
+func (m *MockShortenerStorage) GetAllURLs(arg0 context.Context) ([]storage.URLData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllURLs", arg0)
+	ret0, _ := ret[0].([]storage.URLData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllURLs indicates an expected call of GetAllURLs.
+func (mr *MockShortenerStorageMockRecorder) GetAllURLs(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllURLs", reflect.TypeOf((*MockShortenerStorage)(nil).GetAllURLs), arg0)
+}
+
+// GetAllUserURLs mocks base method.
+func (m *MockShortenerStorage) GetAllUserURLs(arg0 context.Context) ([]storage.UserURLData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllUserURLs", arg0)
+	ret0, _ := ret[0].([]storage.UserURLData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllUserURLs indicates an expected call of GetAllUserURLs.
+func (mr *MockShortenerStorageMockRecorder) GetAllUserURLs(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllUserURLs", reflect.TypeOf((*MockShortenerStorage)(nil).GetAllUserURLs), arg0)
+}
+
+// GetCampaign mocks base method.
+func (m *MockShortenerStorage) GetCampaign(arg0 context.Context, arg1 string) (storage.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaign", arg0, arg1)
+	ret0, _ := ret[0].(storage.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaign indicates an expected call of GetCampaign.
+func (mr *MockShortenerStorageMockRecorder) GetCampaign(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaign", reflect.TypeOf((*MockShortenerStorage)(nil).GetCampaign), arg0, arg1)
+}
+
+// GetCampaigns mocks base method.
+func (m *MockShortenerStorage) GetCampaigns(arg0 context.Context, arg1 string) ([]storage.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaigns", arg0, arg1)
+	ret0, _ := ret[0].([]storage.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaigns indicates an expected call of GetCampaigns.
+func (mr *MockShortenerStorageMockRecorder) GetCampaigns(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaigns", reflect.TypeOf((*MockShortenerStorage)(nil).GetCampaigns), arg0, arg1)
+}
+
+// GetClicks mocks base method.
+func (m *MockShortenerStorage) GetClicks(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClicks", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClicks indicates an expected call of GetClicks.
+func (mr *MockShortenerStorageMockRecorder) GetClicks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClicks", reflect.TypeOf((*MockShortenerStorage)(nil).GetClicks), arg0, arg1)
+}
+
+// GetLinkPatterns mocks base method.
+func (m *MockShortenerStorage) GetLinkPatterns(arg0 context.Context) ([]storage.LinkPattern, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLinkPatterns", arg0)
+	ret0, _ := ret[0].([]storage.LinkPattern)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLinkPatterns indicates an expected call of GetLinkPatterns.
+func (mr *MockShortenerStorageMockRecorder) GetLinkPatterns(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinkPatterns", reflect.TypeOf((*MockShortenerStorage)(nil).GetLinkPatterns), arg0)
+}
+
+// GetLinkSettings mocks base method.
+func (m *MockShortenerStorage) GetLinkSettings(arg0 context.Context, arg1 string) (storage.LinkSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLinkSettings", arg0, arg1)
+	ret0, _ := ret[0].(storage.LinkSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLinkSettings indicates an expected call of GetLinkSettings.
+func (mr *MockShortenerStorageMockRecorder) GetLinkSettings(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinkSettings", reflect.TypeOf((*MockShortenerStorage)(nil).GetLinkSettings), arg0, arg1)
+}
+
 // GetOriginalURL mocks base method.
 func (m *MockShortenerStorage) GetOriginalURL(arg0 context.Context, arg1 string) (string, error) {
 	m.ctrl.T.Helper()
@@ -50,6 +360,51 @@ func (mr *MockShortenerStorageMockRecorder) GetOriginalURL(arg0, arg1 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOriginalURL", reflect.TypeOf((*MockShortenerStorage)(nil).GetOriginalURL), arg0, arg1)
 }
 
+// GetSession mocks base method.
+func (m *MockShortenerStorage) GetSession(arg0 context.Context, arg1 string) (storage.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", arg0, arg1)
+	ret0, _ := ret[0].(storage.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession.
+func (mr *MockShortenerStorageMockRecorder) GetSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockShortenerStorage)(nil).GetSession), arg0, arg1)
+}
+
+// GetURLHistory mocks base method.
+func (m *MockShortenerStorage) GetURLHistory(arg0 context.Context, arg1 string) ([]storage.URLVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetURLHistory", arg0, arg1)
+	ret0, _ := ret[0].([]storage.URLVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetURLHistory indicates an expected call of GetURLHistory.
+func (mr *MockShortenerStorageMockRecorder) GetURLHistory(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetURLHistory", reflect.TypeOf((*MockShortenerStorage)(nil).GetURLHistory), arg0, arg1)
+}
+
+// GetUserAPIKeys mocks base method.
+func (m *MockShortenerStorage) GetUserAPIKeys(arg0 context.Context, arg1 string) ([]storage.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAPIKeys", arg0, arg1)
+	ret0, _ := ret[0].([]storage.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAPIKeys indicates an expected call of GetUserAPIKeys.
+func (mr *MockShortenerStorageMockRecorder) GetUserAPIKeys(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAPIKeys", reflect.TypeOf((*MockShortenerStorage)(nil).GetUserAPIKeys), arg0, arg1)
+}
+
 // GetUserURLs mocks base method.
 func (m *MockShortenerStorage) GetUserURLs(arg0 context.Context, arg1 string) ([]storage.URLData, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +420,124 @@ func (mr *MockShortenerStorageMockRecorder) GetUserURLs(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURLs", reflect.TypeOf((*MockShortenerStorage)(nil).GetUserURLs), arg0, arg1)
 }
 
+// GetUserWorkspaces mocks base method.
+func (m *MockShortenerStorage) GetUserWorkspaces(arg0 context.Context, arg1 string) ([]storage.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserWorkspaces", arg0, arg1)
+	ret0, _ := ret[0].([]storage.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserWorkspaces indicates an expected call of GetUserWorkspaces.
+func (mr *MockShortenerStorageMockRecorder) GetUserWorkspaces(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserWorkspaces", reflect.TypeOf((*MockShortenerStorage)(nil).GetUserWorkspaces), arg0, arg1)
+}
+
+// GetVariantClicks mocks base method.
+func (m *MockShortenerStorage) GetVariantClicks(arg0 context.Context, arg1 string) (map[int]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVariantClicks", arg0, arg1)
+	ret0, _ := ret[0].(map[int]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVariantClicks indicates an expected call of GetVariantClicks.
+func (mr *MockShortenerStorageMockRecorder) GetVariantClicks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVariantClicks", reflect.TypeOf((*MockShortenerStorage)(nil).GetVariantClicks), arg0, arg1)
+}
+
+// GetWorkspace mocks base method.
+func (m *MockShortenerStorage) GetWorkspace(arg0 context.Context, arg1 string) (storage.Workspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspace", arg0, arg1)
+	ret0, _ := ret[0].(storage.Workspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspace indicates an expected call of GetWorkspace.
+func (mr *MockShortenerStorageMockRecorder) GetWorkspace(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspace", reflect.TypeOf((*MockShortenerStorage)(nil).GetWorkspace), arg0, arg1)
+}
+
+// GetWorkspaceMember mocks base method.
+func (m *MockShortenerStorage) GetWorkspaceMember(arg0 context.Context, arg1, arg2 string) (storage.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceMember", arg0, arg1, arg2)
+	ret0, _ := ret[0].(storage.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceMember indicates an expected call of GetWorkspaceMember.
+func (mr *MockShortenerStorageMockRecorder) GetWorkspaceMember(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceMember", reflect.TypeOf((*MockShortenerStorage)(nil).GetWorkspaceMember), arg0, arg1, arg2)
+}
+
+// GetWorkspaceMembers mocks base method.
+func (m *MockShortenerStorage) GetWorkspaceMembers(arg0 context.Context, arg1 string) ([]storage.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceMembers", arg0, arg1)
+	ret0, _ := ret[0].([]storage.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceMembers indicates an expected call of GetWorkspaceMembers.
+func (mr *MockShortenerStorageMockRecorder) GetWorkspaceMembers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceMembers", reflect.TypeOf((*MockShortenerStorage)(nil).GetWorkspaceMembers), arg0, arg1)
+}
+
+// ImportLink mocks base method.
+func (m *MockShortenerStorage) ImportLink(arg0 context.Context, arg1 storage.LinkRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportLink", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ImportLink indicates an expected call of ImportLink.
+func (mr *MockShortenerStorageMockRecorder) ImportLink(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportLink", reflect.TypeOf((*MockShortenerStorage)(nil).ImportLink), arg0, arg1)
+}
+
+// LeaseRange mocks base method.
+func (m *MockShortenerStorage) LeaseRange(arg0 context.Context, arg1 uint64) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseRange", arg0, arg1)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseRange indicates an expected call of LeaseRange.
+func (mr *MockShortenerStorageMockRecorder) LeaseRange(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseRange", reflect.TypeOf((*MockShortenerStorage)(nil).LeaseRange), arg0, arg1)
+}
+
+// MergeUserURLs mocks base method.
+func (m *MockShortenerStorage) MergeUserURLs(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeUserURLs", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MergeUserURLs indicates an expected call of MergeUserURLs.
+func (mr *MockShortenerStorageMockRecorder) MergeUserURLs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeUserURLs", reflect.TypeOf((*MockShortenerStorage)(nil).MergeUserURLs), arg0, arg1, arg2)
+}
+
 // Ping mocks base method.
 func (m *MockShortenerStorage) Ping(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -79,6 +552,48 @@ func (mr *MockShortenerStorageMockRecorder) Ping(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockShortenerStorage)(nil).Ping), arg0)
 }
 
+// RevokeAPIKey mocks base method.
+func (m *MockShortenerStorage) RevokeAPIKey(arg0 context.Context, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockShortenerStorageMockRecorder) RevokeAPIKey(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockShortenerStorage)(nil).RevokeAPIKey), arg0, arg1, arg2, arg3)
+}
+
+// SaveAPIKey mocks base method.
+func (m *MockShortenerStorage) SaveAPIKey(arg0 context.Context, arg1 storage.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAPIKey indicates an expected call of SaveAPIKey.
+func (mr *MockShortenerStorageMockRecorder) SaveAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAPIKey", reflect.TypeOf((*MockShortenerStorage)(nil).SaveAPIKey), arg0, arg1)
+}
+
+// SaveCampaign mocks base method.
+func (m *MockShortenerStorage) SaveCampaign(arg0 context.Context, arg1 storage.Campaign) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCampaign", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCampaign indicates an expected call of SaveCampaign.
+func (mr *MockShortenerStorageMockRecorder) SaveCampaign(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCampaign", reflect.TypeOf((*MockShortenerStorage)(nil).SaveCampaign), arg0, arg1)
+}
+
 // SaveData mocks base method.
 func (m *MockShortenerStorage) SaveData(arg0 context.Context, arg1 string, arg2 storage.URLData) error {
 	m.ctrl.T.Helper()
@@ -107,32 +622,74 @@ func (mr *MockShortenerStorageMockRecorder) SaveDataBatch(arg0, arg1, arg2 inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDataBatch", reflect.TypeOf((*MockShortenerStorage)(nil).SaveDataBatch), arg0, arg1, arg2)
 }
 
-// SetShortURL mocks base method.
-func (m *MockShortenerStorage) SetShortURL(arg0 storage.URLData) error {
+// SaveLinkPattern mocks base method.
+func (m *MockShortenerStorage) SaveLinkPattern(arg0 context.Context, arg1 storage.LinkPattern) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetShortURL", arg0)
+	ret := m.ctrl.Call(m, "SaveLinkPattern", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// SetShortURL indicates an expected call of SetShortURL.
-func (mr *MockShortenerStorageMockRecorder) SetShortURL(arg0 interface{}) *gomock.Call {
+// SaveLinkPattern indicates an expected call of SaveLinkPattern.
+func (mr *MockShortenerStorageMockRecorder) SaveLinkPattern(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetShortURL", reflect.TypeOf((*MockShortenerStorage)(nil).SetShortURL), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveLinkPattern", reflect.TypeOf((*MockShortenerStorage)(nil).SaveLinkPattern), arg0, arg1)
 }
 
-// SetUserURL mocks base method.
-func (m *MockShortenerStorage) SetUserURL(arg0, arg1 string) error {
+// SaveLinkSettings mocks base method.
+func (m *MockShortenerStorage) SaveLinkSettings(arg0 context.Context, arg1 storage.LinkSettings) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetUserURL", arg0, arg1)
+	ret := m.ctrl.Call(m, "SaveLinkSettings", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// SetUserURL indicates an expected call of SetUserURL.
-func (mr *MockShortenerStorageMockRecorder) SetUserURL(arg0, arg1 interface{}) *gomock.Call {
+// SaveLinkSettings indicates an expected call of SaveLinkSettings.
+func (mr *MockShortenerStorageMockRecorder) SaveLinkSettings(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserURL", reflect.TypeOf((*MockShortenerStorage)(nil).SetUserURL), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveLinkSettings", reflect.TypeOf((*MockShortenerStorage)(nil).SaveLinkSettings), arg0, arg1)
+}
+
+// SaveSession mocks base method.
+func (m *MockShortenerStorage) SaveSession(arg0 context.Context, arg1 storage.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSession indicates an expected call of SaveSession.
+func (mr *MockShortenerStorageMockRecorder) SaveSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSession", reflect.TypeOf((*MockShortenerStorage)(nil).SaveSession), arg0, arg1)
+}
+
+// SaveWorkspaceInvite mocks base method.
+func (m *MockShortenerStorage) SaveWorkspaceInvite(arg0 context.Context, arg1 storage.WorkspaceInvite) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveWorkspaceInvite", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveWorkspaceInvite indicates an expected call of SaveWorkspaceInvite.
+func (mr *MockShortenerStorageMockRecorder) SaveWorkspaceInvite(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWorkspaceInvite", reflect.TypeOf((*MockShortenerStorage)(nil).SaveWorkspaceInvite), arg0, arg1)
+}
+
+// SaveWorkspaceMember mocks base method.
+func (m *MockShortenerStorage) SaveWorkspaceMember(arg0 context.Context, arg1 storage.WorkspaceMember) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveWorkspaceMember", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveWorkspaceMember indicates an expected call of SaveWorkspaceMember.
+func (mr *MockShortenerStorageMockRecorder) SaveWorkspaceMember(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWorkspaceMember", reflect.TypeOf((*MockShortenerStorage)(nil).SaveWorkspaceMember), arg0, arg1)
 }
 
 // Shutdown mocks base method.
@@ -148,3 +705,32 @@ func (mr *MockShortenerStorageMockRecorder) Shutdown(arg0 interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockShortenerStorage)(nil).Shutdown), arg0)
 }
+
+// TakeWorkspaceInvite mocks base method.
+func (m *MockShortenerStorage) TakeWorkspaceInvite(arg0 context.Context, arg1 string) (storage.WorkspaceInvite, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakeWorkspaceInvite", arg0, arg1)
+	ret0, _ := ret[0].(storage.WorkspaceInvite)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakeWorkspaceInvite indicates an expected call of TakeWorkspaceInvite.
+func (mr *MockShortenerStorageMockRecorder) TakeWorkspaceInvite(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakeWorkspaceInvite", reflect.TypeOf((*MockShortenerStorage)(nil).TakeWorkspaceInvite), arg0, arg1)
+}
+
+// UpdateOriginalURL mocks base method.
+func (m *MockShortenerStorage) UpdateOriginalURL(arg0 context.Context, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOriginalURL", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOriginalURL indicates an expected call of UpdateOriginalURL.
+func (mr *MockShortenerStorageMockRecorder) UpdateOriginalURL(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOriginalURL", reflect.TypeOf((*MockShortenerStorage)(nil).UpdateOriginalURL), arg0, arg1, arg2, arg3)
+}
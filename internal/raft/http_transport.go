@@ -0,0 +1,145 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	requestVotePath     = "/raft/vote"
+	appendEntriesPath   = "/raft/append"
+	installSnapshotPath = "/raft/snapshot"
+	forwardPath         = "/raft/forward"
+)
+
+// HTTPTransport передает RPC между узлами в JSON поверх HTTP
+type HTTPTransport struct {
+	// peers адреса узлов по их идентификаторам
+	peers  map[string]string
+	client *http.Client
+}
+
+func (t *HTTPTransport) RequestVote(ctx context.Context, target string, req *RequestVoteRequest) (*RequestVoteResponse, error) {
+	resp := &RequestVoteResponse{}
+	return resp, t.call(ctx, target, requestVotePath, req, resp)
+}
+
+func (t *HTTPTransport) AppendEntries(ctx context.Context, target string, req *AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	resp := &AppendEntriesResponse{}
+	return resp, t.call(ctx, target, appendEntriesPath, req, resp)
+}
+
+func (t *HTTPTransport) InstallSnapshot(ctx context.Context, target string, req *InstallSnapshotRequest) (*InstallSnapshotResponse, error) {
+	resp := &InstallSnapshotResponse{}
+	return resp, t.call(ctx, target, installSnapshotPath, req, resp)
+}
+
+func (t *HTTPTransport) Forward(ctx context.Context, target string, payload []byte) ([]byte, error) {
+	return t.post(ctx, target, forwardPath, payload)
+}
+
+func (t *HTTPTransport) call(ctx context.Context, target, path string, req, resp interface{}) error {
+	encodedReq, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	encodedResp, err := t.post(ctx, target, path, encodedReq)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encodedResp, resp)
+}
+
+func (t *HTTPTransport) post(ctx context.Context, target, path string, body []byte) ([]byte, error) {
+	address, ok := t.peers[target]
+	if !ok {
+		return nil, ErrPeerUnreachable
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPeerUnreachable, err)
+	}
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK:
+		return responseBody, nil
+	case http.StatusMisdirectedRequest:
+		return nil, ErrNotLeader
+	default:
+		return nil, fmt.Errorf("raft: peer %s responded %d: %s", target, response.StatusCode, responseBody)
+	}
+}
+
+func NewHTTPTransport(peers map[string]string) *HTTPTransport {
+	return &HTTPTransport{
+		peers:  peers,
+		client: &http.Client{},
+	}
+}
+
+// NewHTTPHandler принимает RPC от других узлов
+func NewHTTPHandler(node *Node) http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc(requestVotePath, func(w http.ResponseWriter, r *http.Request) {
+		req := &RequestVoteRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, node.HandleRequestVote(req))
+	}).Methods(http.MethodPost)
+	router.HandleFunc(appendEntriesPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &AppendEntriesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, node.HandleAppendEntries(req))
+	}).Methods(http.MethodPost)
+	router.HandleFunc(installSnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		req := &InstallSnapshotRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, node.HandleInstallSnapshot(req))
+	}).Methods(http.MethodPost)
+	router.HandleFunc(forwardPath, func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := node.HandleForward(r.Context(), payload)
+		if errors.Is(err, ErrNotLeader) {
+			http.Error(w, err.Error(), http.StatusMisdirectedRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(result)
+	}).Methods(http.MethodPost)
+	return router
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"context"
+	"sync"
+)
+
+// InmemNetwork соединяет узлы внутри одного процесса. Используется в тестах:
+// узел можно отключить от сети, чтобы смоделировать его падение или разделение сети.
+type InmemNetwork struct {
+	mu           sync.RWMutex
+	nodes        map[string]*Node
+	disconnected map[string]bool
+}
+
+// Register подключает узел к сети
+func (net *InmemNetwork) Register(node *Node) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.nodes[node.ID()] = node
+}
+
+// Disconnect узел перестает получать и отправлять сообщения
+func (net *InmemNetwork) Disconnect(id string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.disconnected[id] = true
+}
+
+func (net *InmemNetwork) Reconnect(id string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	delete(net.disconnected, id)
+}
+
+// Transport транспорт узла from
+func (net *InmemNetwork) Transport(from string) Transport {
+	return &inmemTransport{network: net, from: from}
+}
+
+func (net *InmemNetwork) route(from, to string) (*Node, error) {
+	net.mu.RLock()
+	defer net.mu.RUnlock()
+	node, ok := net.nodes[to]
+	if !ok || net.disconnected[from] || net.disconnected[to] {
+		return nil, ErrPeerUnreachable
+	}
+	return node, nil
+}
+
+type inmemTransport struct {
+	network *InmemNetwork
+	from    string
+}
+
+func (t *inmemTransport) RequestVote(ctx context.Context, target string, req *RequestVoteRequest) (*RequestVoteResponse, error) {
+	node, err := t.network.route(t.from, target)
+	if err != nil {
+		return nil, err
+	}
+	return node.HandleRequestVote(req), nil
+}
+
+func (t *inmemTransport) AppendEntries(ctx context.Context, target string, req *AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	node, err := t.network.route(t.from, target)
+	if err != nil {
+		return nil, err
+	}
+	return node.HandleAppendEntries(req), nil
+}
+
+func (t *inmemTransport) InstallSnapshot(ctx context.Context, target string, req *InstallSnapshotRequest) (*InstallSnapshotResponse, error) {
+	node, err := t.network.route(t.from, target)
+	if err != nil {
+		return nil, err
+	}
+	return node.HandleInstallSnapshot(req), nil
+}
+
+func (t *inmemTransport) Forward(ctx context.Context, target string, payload []byte) ([]byte, error) {
+	node, err := t.network.route(t.from, target)
+	if err != nil {
+		return nil, err
+	}
+	return node.HandleForward(ctx, payload)
+}
+
+func NewInmemNetwork() *InmemNetwork {
+	return &InmemNetwork{
+		nodes:        make(map[string]*Node),
+		disconnected: make(map[string]bool),
+	}
+}
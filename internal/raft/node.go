@@ -0,0 +1,786 @@
+package raft
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// maxEntriesPerAppend сколько записей журнала отправлять в одном AppendEntries
+const maxEntriesPerAppend = 256
+
+type Config struct {
+	ID string
+	// Peers идентификаторы остальных узлов кластера
+	Peers []string
+	// ElectionTimeout минимальный таймаут выборов, реальный выбирается случайно из [t, 2t)
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	// SnapshotThreshold после скольких примененных записей журнал сжимается в снимок
+	SnapshotThreshold uint64
+	// DataDir каталог для журнала и снимков, пустой - состояние только в памяти
+	DataDir string
+}
+
+type waiter struct {
+	term uint64
+	done chan error
+}
+
+// Node узел Raft: выбирает лидера, реплицирует журнал команд и применяет
+// закоммиченные команды к FSM в одинаковом порядке на всех узлах.
+type Node struct {
+	cfg       Config
+	transport Transport
+	fsm       FSM
+	persister *persister
+
+	mu          sync.Mutex
+	role        Role
+	currentTerm uint64
+	votedFor    string
+	leaderID    string
+	// log[0] - граница снимка: индекс и срок последней записи, вошедшей в снимок
+	log          []Entry
+	snapshot     []byte
+	commitIndex  uint64
+	lastApplied  uint64
+	leaderIndex  uint64
+	nextIndex    map[string]uint64
+	matchIndex   map[string]uint64
+	waiters      map[uint64]waiter
+	electionTime time.Time
+	replicate    map[string]chan struct{}
+	forward      ForwardHandler
+	rand         *rand.Rand
+
+	// fsmMu упорядочивает применение записей и установку снимков
+	fsmMu   sync.Mutex
+	applyCh chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Propose добавляет команду в журнал и ждет, пока она будет закоммичена
+// и применена к FSM этого узла. Работает только на лидере.
+func (n *Node) Propose(ctx context.Context, command []byte) error {
+	n.mu.Lock()
+	if n.role != Leader {
+		n.mu.Unlock()
+		return ErrNotLeader
+	}
+	entry := Entry{Index: n.lastIndex() + 1, Term: n.currentTerm, Command: command}
+	if err := n.appendLocked([]Entry{entry}); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	w := waiter{term: entry.Term, done: make(chan error, 1)}
+	n.waiters[entry.Index] = w
+	n.advanceCommitLocked()
+	n.notifyReplicatorsLocked()
+	n.mu.Unlock()
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.done:
+		return ErrNodeStopped
+	}
+}
+
+// Barrier ждет, пока лидер применит все записи, закоммиченные до начала его срока
+func (n *Node) Barrier(ctx context.Context) error {
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval / 4)
+	defer ticker.Stop()
+	for {
+		n.mu.Lock()
+		role, ready := n.role, n.lastApplied >= n.leaderIndex
+		n.mu.Unlock()
+		if role != Leader {
+			return ErrNotLeader
+		}
+		if ready {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-n.done:
+			return ErrNodeStopped
+		}
+	}
+}
+
+// Forward выполняет команду на лидере: локально или через транспорт
+func (n *Node) Forward(ctx context.Context, payload []byte) ([]byte, error) {
+	n.mu.Lock()
+	role, leaderID, handler := n.role, n.leaderID, n.forward
+	n.mu.Unlock()
+
+	if role == Leader {
+		if handler == nil {
+			return nil, ErrNotLeader
+		}
+		return handler(ctx, payload)
+	}
+	if leaderID == "" {
+		return nil, ErrNoLeader
+	}
+	return n.transport.Forward(ctx, leaderID, payload)
+}
+
+// SetForwardHandler обработчик команд, пересланных на этот узел
+func (n *Node) SetForwardHandler(handler ForwardHandler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.forward = handler
+}
+
+// HandleForward вызывается транспортом, когда другой узел пересылает команду
+func (n *Node) HandleForward(ctx context.Context, payload []byte) ([]byte, error) {
+	n.mu.Lock()
+	role, handler := n.role, n.forward
+	n.mu.Unlock()
+	if role != Leader || handler == nil {
+		return nil, ErrNotLeader
+	}
+	return handler(ctx, payload)
+}
+
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role == Leader
+}
+
+// Leader идентификатор известного узлу лидера
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leaderID
+}
+
+func (n *Node) ID() string {
+	return n.cfg.ID
+}
+
+func (n *Node) HandleRequestVote(req *RequestVoteRequest) *RequestVoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.currentTerm {
+		return &RequestVoteResponse{Term: n.currentTerm}
+	}
+	if req.Term > n.currentTerm {
+		n.becomeFollowerLocked(req.Term, "")
+	}
+	lastIndex, lastTerm := n.lastIndex(), n.lastTerm()
+	upToDate := req.LastLogTerm > lastTerm || (req.LastLogTerm == lastTerm && req.LastLogIndex >= lastIndex)
+	if (n.votedFor == "" || n.votedFor == req.CandidateID) && upToDate {
+		n.votedFor = req.CandidateID
+		n.persistStateLocked()
+		n.resetElectionTimerLocked()
+		return &RequestVoteResponse{Term: n.currentTerm, VoteGranted: true}
+	}
+	return &RequestVoteResponse{Term: n.currentTerm}
+}
+
+func (n *Node) HandleAppendEntries(req *AppendEntriesRequest) *AppendEntriesResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.currentTerm {
+		return &AppendEntriesResponse{Term: n.currentTerm}
+	}
+	if req.Term > n.currentTerm || n.role != Follower {
+		n.becomeFollowerLocked(req.Term, req.LeaderID)
+	}
+	n.leaderID = req.LeaderID
+	n.resetElectionTimerLocked()
+
+	if req.PrevLogIndex > n.lastIndex() {
+		return &AppendEntriesResponse{Term: n.currentTerm, ConflictIndex: n.lastIndex() + 1}
+	}
+	entries := req.Entries
+	prevIndex, prevTerm := req.PrevLogIndex, req.PrevLogTerm
+	if prevIndex < n.snapshotIndex() {
+		// Все, что вошло в снимок, уже закоммичено и совпадает с журналом лидера
+		skip := n.snapshotIndex() - prevIndex
+		if uint64(len(entries)) <= skip {
+			entries = nil
+		} else {
+			entries = entries[skip:]
+		}
+		prevIndex, prevTerm = n.snapshotIndex(), n.snapshotTerm()
+	}
+	if n.termAt(prevIndex) != prevTerm {
+		conflictTerm := n.termAt(prevIndex)
+		conflictIndex := prevIndex
+		for conflictIndex > n.snapshotIndex()+1 && n.termAt(conflictIndex-1) == conflictTerm {
+			conflictIndex--
+		}
+		return &AppendEntriesResponse{Term: n.currentTerm, ConflictIndex: conflictIndex}
+	}
+
+	for i, entry := range entries {
+		if entry.Index <= n.lastIndex() {
+			if n.termAt(entry.Index) == entry.Term {
+				continue
+			}
+			n.truncateLocked(entry.Index)
+		}
+		if err := n.appendLocked(entries[i:]); err != nil {
+			return &AppendEntriesResponse{Term: n.currentTerm, ConflictIndex: n.lastIndex() + 1}
+		}
+		break
+	}
+
+	if req.LeaderCommit > n.commitIndex {
+		lastNewIndex := prevIndex + uint64(len(entries))
+		if req.LeaderCommit < lastNewIndex {
+			lastNewIndex = req.LeaderCommit
+		}
+		if lastNewIndex > n.commitIndex {
+			n.commitIndex = lastNewIndex
+			n.signalApply()
+		}
+	}
+	return &AppendEntriesResponse{Term: n.currentTerm, Success: true}
+}
+
+func (n *Node) HandleInstallSnapshot(req *InstallSnapshotRequest) *InstallSnapshotResponse {
+	n.fsmMu.Lock()
+	defer n.fsmMu.Unlock()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term < n.currentTerm {
+		return &InstallSnapshotResponse{Term: n.currentTerm}
+	}
+	if req.Term > n.currentTerm || n.role != Follower {
+		n.becomeFollowerLocked(req.Term, req.LeaderID)
+	}
+	n.leaderID = req.LeaderID
+	n.resetElectionTimerLocked()
+
+	if req.LastIncludedIndex <= n.snapshotIndex() || req.LastIncludedIndex <= n.lastApplied {
+		return &InstallSnapshotResponse{Term: n.currentTerm}
+	}
+	if err := n.fsm.Restore(req.Data); err != nil {
+		return &InstallSnapshotResponse{Term: n.currentTerm}
+	}
+	boundary := Entry{Index: req.LastIncludedIndex, Term: req.LastIncludedTerm}
+	if req.LastIncludedIndex < n.lastIndex() && n.termAt(req.LastIncludedIndex) == req.LastIncludedTerm {
+		n.log = append([]Entry{boundary}, n.log[req.LastIncludedIndex-n.snapshotIndex()+1:]...)
+	} else {
+		n.log = []Entry{boundary}
+	}
+	for waiterIndex, w := range n.waiters {
+		if waiterIndex <= req.LastIncludedIndex {
+			w.done <- ErrLeadershipLost
+			delete(n.waiters, waiterIndex)
+		}
+	}
+	n.snapshot = req.Data
+	n.lastApplied = req.LastIncludedIndex
+	if n.commitIndex < req.LastIncludedIndex {
+		n.commitIndex = req.LastIncludedIndex
+	}
+	n.persistSnapshotLocked()
+	return &InstallSnapshotResponse{Term: n.currentTerm}
+}
+
+// Stop останавливает фоновые процессы узла
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	select {
+	case <-n.done:
+		n.mu.Unlock()
+		return nil
+	default:
+	}
+	close(n.done)
+	n.mu.Unlock()
+	n.wg.Wait()
+	if n.persister != nil {
+		return n.persister.Close()
+	}
+	return nil
+}
+
+func (n *Node) snapshotIndex() uint64 {
+	return n.log[0].Index
+}
+
+func (n *Node) snapshotTerm() uint64 {
+	return n.log[0].Term
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.log[len(n.log)-1].Index
+}
+
+func (n *Node) lastTerm() uint64 {
+	return n.log[len(n.log)-1].Term
+}
+
+func (n *Node) termAt(index uint64) uint64 {
+	if index < n.snapshotIndex() || index > n.lastIndex() {
+		return 0
+	}
+	return n.log[index-n.snapshotIndex()].Term
+}
+
+func (n *Node) appendLocked(entries []Entry) error {
+	if n.persister != nil {
+		if err := n.persister.AppendEntries(entries); err != nil {
+			return err
+		}
+	}
+	n.log = append(n.log, entries...)
+	return nil
+}
+
+// truncateLocked удаляет записи журнала, начиная с index
+func (n *Node) truncateLocked(index uint64) {
+	n.log = n.log[:index-n.snapshotIndex()]
+	for waiterIndex, w := range n.waiters {
+		if waiterIndex >= index {
+			w.done <- ErrLeadershipLost
+			delete(n.waiters, waiterIndex)
+		}
+	}
+	if n.persister != nil {
+		_ = n.persister.RewriteLog(n.log[1:])
+	}
+}
+
+func (n *Node) persistStateLocked() {
+	if n.persister == nil {
+		return
+	}
+	_ = n.persister.SaveState(persistentState{
+		Term:          n.currentTerm,
+		VotedFor:      n.votedFor,
+		SnapshotIndex: n.snapshotIndex(),
+		SnapshotTerm:  n.snapshotTerm(),
+	})
+}
+
+func (n *Node) persistSnapshotLocked() {
+	if n.persister == nil {
+		return
+	}
+	if err := n.persister.SaveSnapshot(n.snapshot); err != nil {
+		return
+	}
+	n.persistStateLocked()
+	_ = n.persister.RewriteLog(n.log[1:])
+}
+
+func (n *Node) resetElectionTimerLocked() {
+	timeout := n.cfg.ElectionTimeout + time.Duration(n.rand.Int63n(int64(n.cfg.ElectionTimeout)))
+	n.electionTime = time.Now().Add(timeout)
+}
+
+func (n *Node) becomeFollowerLocked(term uint64, leaderID string) {
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+		n.persistStateLocked()
+	}
+	if n.role == Leader {
+		n.resetElectionTimerLocked()
+	}
+	n.role = Follower
+	n.leaderID = leaderID
+	n.replicate = nil
+}
+
+func (n *Node) becomeLeaderLocked() {
+	select {
+	case <-n.done:
+		return
+	default:
+	}
+	n.role = Leader
+	n.leaderID = n.cfg.ID
+	n.nextIndex = make(map[string]uint64, len(n.cfg.Peers))
+	n.matchIndex = make(map[string]uint64, len(n.cfg.Peers))
+	for _, peer := range n.cfg.Peers {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+	}
+	// Пустая запись текущего срока позволяет закоммитить записи прошлых сроков
+	n.leaderIndex = n.lastIndex() + 1
+	_ = n.appendLocked([]Entry{{Index: n.leaderIndex, Term: n.currentTerm}})
+
+	n.replicate = make(map[string]chan struct{}, len(n.cfg.Peers))
+	for _, peer := range n.cfg.Peers {
+		notify := make(chan struct{}, 1)
+		n.replicate[peer] = notify
+		n.wg.Add(1)
+		go n.replicator(peer, n.currentTerm, notify)
+	}
+	n.advanceCommitLocked()
+	n.notifyReplicatorsLocked()
+}
+
+func (n *Node) notifyReplicatorsLocked() {
+	for _, notify := range n.replicate {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *Node) signalApply() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+// advanceCommitLocked коммитит записи текущего срока, которые есть у большинства
+func (n *Node) advanceCommitLocked() {
+	quorum := (len(n.cfg.Peers)+1)/2 + 1
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.termAt(index) != n.currentTerm {
+			break
+		}
+		replicas := 1
+		for _, match := range n.matchIndex {
+			if match >= index {
+				replicas++
+			}
+		}
+		if replicas >= quorum {
+			n.commitIndex = index
+			n.signalApply()
+			return
+		}
+	}
+}
+
+func (n *Node) ticker() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+			n.mu.Lock()
+			expired := n.role != Leader && time.Now().After(n.electionTime)
+			n.mu.Unlock()
+			if expired {
+				n.startElection()
+			}
+		}
+	}
+}
+
+func (n *Node) startElection() {
+	n.mu.Lock()
+	n.role = Candidate
+	n.currentTerm++
+	n.votedFor = n.cfg.ID
+	n.leaderID = ""
+	n.persistStateLocked()
+	n.resetElectionTimerLocked()
+	term := n.currentTerm
+	req := &RequestVoteRequest{
+		Term:         term,
+		CandidateID:  n.cfg.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	votes := 1
+	if votes >= (len(n.cfg.Peers)+1)/2+1 {
+		n.becomeLeaderLocked()
+	}
+	n.mu.Unlock()
+
+	for _, peer := range n.cfg.Peers {
+		go func(peer string) {
+			ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ElectionTimeout)
+			defer cancel()
+			resp, err := n.transport.RequestVote(ctx, peer, req)
+			if err != nil {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if resp.Term > n.currentTerm {
+				n.becomeFollowerLocked(resp.Term, "")
+				n.resetElectionTimerLocked()
+				return
+			}
+			if n.role != Candidate || n.currentTerm != term || !resp.VoteGranted {
+				return
+			}
+			votes++
+			if votes >= (len(n.cfg.Peers)+1)/2+1 {
+				n.becomeLeaderLocked()
+			}
+		}(peer)
+	}
+}
+
+// replicator отправляет записи журнала одному узлу, пока этот узел остается лидером в срок term
+func (n *Node) replicator(peer string, term uint64, notify chan struct{}) {
+	defer n.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-notify:
+		case <-timer.C:
+		}
+		if !n.replicateTo(peer, term) {
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(n.cfg.HeartbeatInterval)
+	}
+}
+
+// replicateTo возвращает false, если узел больше не лидер в срок term
+func (n *Node) replicateTo(peer string, term uint64) bool {
+	n.mu.Lock()
+	if n.role != Leader || n.currentTerm != term {
+		n.mu.Unlock()
+		return false
+	}
+	next := n.nextIndex[peer]
+	if next > n.lastIndex()+1 {
+		next = n.lastIndex() + 1
+	}
+	if next <= n.snapshotIndex() {
+		req := &InstallSnapshotRequest{
+			Term:              term,
+			LeaderID:          n.cfg.ID,
+			LastIncludedIndex: n.snapshotIndex(),
+			LastIncludedTerm:  n.snapshotTerm(),
+			Data:              n.snapshot,
+		}
+		n.mu.Unlock()
+		return n.sendSnapshot(peer, term, req)
+	}
+	entries := n.log[next-n.snapshotIndex():]
+	if len(entries) > maxEntriesPerAppend {
+		entries = entries[:maxEntriesPerAppend]
+	}
+	req := &AppendEntriesRequest{
+		Term:         term,
+		LeaderID:     n.cfg.ID,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.termAt(next - 1),
+		Entries:      append([]Entry(nil), entries...),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ElectionTimeout)
+	defer cancel()
+	resp, err := n.transport.AppendEntries(ctx, peer, req)
+	if err != nil {
+		return true
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.currentTerm {
+		n.becomeFollowerLocked(resp.Term, "")
+		n.resetElectionTimerLocked()
+		return false
+	}
+	if n.role != Leader || n.currentTerm != term {
+		return false
+	}
+	if resp.Success {
+		match := req.PrevLogIndex + uint64(len(req.Entries))
+		if match > n.matchIndex[peer] {
+			n.matchIndex[peer] = match
+		}
+		n.nextIndex[peer] = n.matchIndex[peer] + 1
+		n.advanceCommitLocked()
+	} else if resp.ConflictIndex > 0 {
+		n.nextIndex[peer] = resp.ConflictIndex
+	} else if n.nextIndex[peer] > 1 {
+		n.nextIndex[peer]--
+	}
+	if n.nextIndex[peer] <= n.lastIndex() {
+		// Узел отстает: продолжаем без ожидания heartbeat
+		select {
+		case n.replicate[peer] <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+func (n *Node) sendSnapshot(peer string, term uint64, req *InstallSnapshotRequest) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.ElectionTimeout)
+	defer cancel()
+	resp, err := n.transport.InstallSnapshot(ctx, peer, req)
+	if err != nil {
+		return true
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.currentTerm {
+		n.becomeFollowerLocked(resp.Term, "")
+		n.resetElectionTimerLocked()
+		return false
+	}
+	if n.role != Leader || n.currentTerm != term {
+		return false
+	}
+	if req.LastIncludedIndex > n.matchIndex[peer] {
+		n.matchIndex[peer] = req.LastIncludedIndex
+	}
+	n.nextIndex[peer] = n.matchIndex[peer] + 1
+	select {
+	case n.replicate[peer] <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// applier применяет закоммиченные записи к FSM и сжимает журнал
+func (n *Node) applier() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-n.applyCh:
+		}
+		n.applyCommitted()
+	}
+}
+
+func (n *Node) applyCommitted() {
+	n.fsmMu.Lock()
+	defer n.fsmMu.Unlock()
+
+	n.mu.Lock()
+	if n.commitIndex <= n.lastApplied {
+		n.mu.Unlock()
+		return
+	}
+	from := n.lastApplied + 1 - n.snapshotIndex()
+	to := n.commitIndex - n.snapshotIndex()
+	entries := append([]Entry(nil), n.log[from:to+1]...)
+	n.mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.Command != nil {
+			n.fsm.Apply(entry.Command)
+		}
+	}
+
+	var snapshot []byte
+	lastApplied := entries[len(entries)-1].Index
+	if n.cfg.SnapshotThreshold > 0 && lastApplied-n.snapshotIndexSafe() >= n.cfg.SnapshotThreshold {
+		snapshot, _ = n.fsm.Snapshot()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lastApplied = lastApplied
+	for _, entry := range entries {
+		w, ok := n.waiters[entry.Index]
+		if !ok {
+			continue
+		}
+		if entry.Term == w.term {
+			w.done <- nil
+		} else {
+			w.done <- ErrLeadershipLost
+		}
+		delete(n.waiters, entry.Index)
+	}
+	if snapshot != nil {
+		boundary := Entry{Index: lastApplied, Term: n.termAt(lastApplied)}
+		n.log = append([]Entry{boundary}, n.log[lastApplied-n.snapshotIndex()+1:]...)
+		n.snapshot = snapshot
+		n.persistSnapshotLocked()
+	}
+	if n.commitIndex > n.lastApplied {
+		n.signalApply()
+	}
+}
+
+func (n *Node) snapshotIndexSafe() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.snapshotIndex()
+}
+
+// restore поднимает состояние узла с диска
+func (n *Node) restore() error {
+	state, snapshot, entries, err := n.persister.Load()
+	if err != nil {
+		return err
+	}
+	if snapshot != nil {
+		if err := n.fsm.Restore(snapshot); err != nil {
+			return err
+		}
+	}
+	n.currentTerm = state.Term
+	n.votedFor = state.VotedFor
+	n.snapshot = snapshot
+	n.log = append([]Entry{{Index: state.SnapshotIndex, Term: state.SnapshotTerm}}, entries...)
+	n.commitIndex = state.SnapshotIndex
+	n.lastApplied = state.SnapshotIndex
+	return nil
+}
+
+// NewNode создает узел и запускает его фоновые процессы
+func NewNode(cfg Config, transport Transport, fsm FSM) (*Node, error) {
+	n := &Node{
+		cfg:       cfg,
+		transport: transport,
+		fsm:       fsm,
+		log:       []Entry{{}},
+		waiters:   make(map[uint64]waiter),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		applyCh:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	if cfg.DataDir != "" {
+		p, err := newPersister(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		n.persister = p
+		if err := n.restore(); err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+	}
+	n.mu.Lock()
+	n.resetElectionTimerLocked()
+	n.mu.Unlock()
+
+	n.wg.Add(2)
+	go n.ticker()
+	go n.applier()
+	return n, nil
+}
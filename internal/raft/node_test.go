@@ -0,0 +1,132 @@
+package raft
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// listFSM запоминает примененные команды по порядку
+type listFSM struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (f *listFSM) Apply(command []byte) {
+	if command == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, string(command))
+}
+
+func (f *listFSM) Snapshot() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return []byte(strings.Join(f.commands, "\n")), nil
+}
+
+func (f *listFSM) Restore(snapshot []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = nil
+	if len(snapshot) > 0 {
+		f.commands = strings.Split(string(snapshot), "\n")
+	}
+	return nil
+}
+
+func (f *listFSM) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+func testConfig(dataDir string, snapshotThreshold uint64) Config {
+	return Config{
+		ID:                "node",
+		ElectionTimeout:   50 * time.Millisecond,
+		HeartbeatInterval: 10 * time.Millisecond,
+		SnapshotThreshold: snapshotThreshold,
+		DataDir:           dataDir,
+	}
+}
+
+func waitLeader(t *testing.T, node *Node) {
+	require.Eventually(t, node.IsLeader, 5*time.Second, 10*time.Millisecond)
+}
+
+// TestNodeRestoresStateAfterRestart журнал и снимок переживают перезапуск узла
+func TestNodeRestoresStateAfterRestart(t *testing.T) {
+	tests := []struct {
+		name              string
+		snapshotThreshold uint64
+	}{
+		{name: "Log only", snapshotThreshold: 0},
+		{name: "Snapshot and log", snapshotThreshold: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dataDir := t.TempDir()
+			expected := []string{"a", "b", "c", "d", "e"}
+
+			fsm := &listFSM{}
+			node, err := NewNode(testConfig(dataDir, tt.snapshotThreshold), NewInmemNetwork().Transport("node"), fsm)
+			require.NoError(t, err)
+			waitLeader(t, node)
+			for _, command := range expected {
+				require.NoError(t, node.Propose(ctx, []byte(command)))
+			}
+			require.Equal(t, expected, fsm.Commands())
+			require.NoError(t, node.Stop())
+
+			restoredFSM := &listFSM{}
+			restored, err := NewNode(testConfig(dataDir, tt.snapshotThreshold), NewInmemNetwork().Transport("node"), restoredFSM)
+			require.NoError(t, err)
+			defer restored.Stop()
+			waitLeader(t, restored)
+			require.NoError(t, restored.Barrier(ctx))
+			require.Equal(t, expected, restoredFSM.Commands())
+		})
+	}
+}
+
+func TestNodeProposeOnFollower(t *testing.T) {
+	network := NewInmemNetwork()
+	nodes := make([]*Node, 0, 3)
+	ids := []string{"a", "b", "c"}
+	for _, id := range ids {
+		cfg := testConfig("", 0)
+		cfg.ID = id
+		for _, peer := range ids {
+			if peer != id {
+				cfg.Peers = append(cfg.Peers, peer)
+			}
+		}
+		node, err := NewNode(cfg, network.Transport(id), &listFSM{})
+		require.NoError(t, err)
+		network.Register(node)
+		nodes = append(nodes, node)
+		defer node.Stop()
+	}
+
+	var follower *Node
+	require.Eventually(t, func() bool {
+		leaders := 0
+		for _, node := range nodes {
+			if node.IsLeader() {
+				leaders++
+			} else {
+				follower = node
+			}
+		}
+		return leaders == 1 && follower.Leader() != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, follower.Propose(context.Background(), []byte("a")), ErrNotLeader)
+}
@@ -0,0 +1,159 @@
+package raft
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/maxsnegir/url-shortener/internal/utils"
+)
+
+const (
+	stateFileName    = "state.json"
+	logFileName      = "log"
+	snapshotFileName = "snapshot"
+)
+
+// persistentState то, что узел обязан помнить после перезапуска
+type persistentState struct {
+	Term          uint64
+	VotedFor      string
+	SnapshotIndex uint64
+	SnapshotTerm  uint64
+}
+
+// persister хранит состояние узла в каталоге: журнал дописывается построчно
+// в формате JSON, как и файловое хранилище ссылок, и переписывается целиком
+// только при усечении или сжатии
+type persister struct {
+	dir       string
+	logWriter *utils.FileWriter
+}
+
+func (p *persister) SaveState(state persistentState) error {
+	encodedState, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(p.dir, stateFileName), encodedState)
+}
+
+func (p *persister) AppendEntries(entries []Entry) error {
+	for _, entry := range entries {
+		encodedEntry, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := p.logWriter.Write(encodedEntry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RewriteLog заменяет журнал на диске записями entries
+func (p *persister) RewriteLog(entries []Entry) error {
+	logPath := filepath.Join(p.dir, logFileName)
+	tmpPath := logPath + ".tmp"
+	_ = os.Remove(tmpPath)
+	writer, err := utils.NewFileWriter(tmpPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		encodedEntry, err := json.Marshal(entry)
+		if err != nil {
+			_ = writer.Close()
+			return err
+		}
+		if err := writer.Write(encodedEntry); err != nil {
+			_ = writer.Close()
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := p.logWriter.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, logPath); err != nil {
+		return err
+	}
+	p.logWriter, err = utils.NewFileWriter(logPath)
+	return err
+}
+
+func (p *persister) SaveSnapshot(snapshot []byte) error {
+	return writeFileAtomic(filepath.Join(p.dir, snapshotFileName), snapshot)
+}
+
+// Load читает состояние, снимок и записи журнала после снимка
+func (p *persister) Load() (persistentState, []byte, []Entry, error) {
+	var state persistentState
+	encodedState, err := os.ReadFile(filepath.Join(p.dir, stateFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return state, nil, nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(encodedState, &state); err != nil {
+			return state, nil, nil, err
+		}
+	}
+	snapshot, err := os.ReadFile(filepath.Join(p.dir, snapshotFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return state, nil, nil, err
+	}
+
+	reader, err := utils.NewFileReader(filepath.Join(p.dir, logFileName))
+	if err != nil {
+		return state, nil, nil, err
+	}
+	defer reader.Close()
+	var entries []Entry
+	for {
+		encodedEntry, err := reader.Read()
+		if err != nil {
+			return state, nil, nil, err
+		}
+		if encodedEntry == nil {
+			break
+		}
+		var entry Entry
+		if err := json.Unmarshal(encodedEntry, &entry); err != nil {
+			return state, nil, nil, err
+		}
+		if entry.Index <= state.SnapshotIndex {
+			continue
+		}
+		// После усечения хвоста на диске могли остаться записи старых сроков
+		for len(entries) > 0 && entries[len(entries)-1].Index >= entry.Index {
+			entries = entries[:len(entries)-1]
+		}
+		entries = append(entries, entry)
+	}
+	return state, snapshot, entries, nil
+}
+
+func (p *persister) Close() error {
+	return p.logWriter.Close()
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, utils.AllFilePermissions); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func newPersister(dir string) (*persister, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	logWriter, err := utils.NewFileWriter(filepath.Join(dir, logFileName))
+	if err != nil {
+		return nil, err
+	}
+	return &persister{dir: dir, logWriter: logWriter}, nil
+}
@@ -0,0 +1,87 @@
+package raft
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNotLeader       = errors.New("raft: node is not the leader")
+	ErrNoLeader        = errors.New("raft: cluster has no leader")
+	ErrLeadershipLost  = errors.New("raft: leadership lost before the command was committed")
+	ErrNodeStopped     = errors.New("raft: node is stopped")
+	ErrPeerUnreachable = errors.New("raft: peer is unreachable")
+)
+
+type Role int
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+// Entry запись журнала. Пустая команда - служебная запись нового лидера.
+type Entry struct {
+	Index   uint64
+	Term    uint64
+	Command []byte `json:",omitempty"`
+}
+
+// FSM конечный автомат, который реплицирует журнал
+type FSM interface {
+	Apply(command []byte)
+	Snapshot() ([]byte, error)
+	Restore(snapshot []byte) error
+}
+
+// ForwardHandler обрабатывает на лидере команду, пересланную с другого узла
+type ForwardHandler func(ctx context.Context, payload []byte) ([]byte, error)
+
+type RequestVoteRequest struct {
+	Term         uint64
+	CandidateID  string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+type RequestVoteResponse struct {
+	Term        uint64
+	VoteGranted bool
+}
+
+type AppendEntriesRequest struct {
+	Term         uint64
+	LeaderID     string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []Entry
+	LeaderCommit uint64
+}
+
+type AppendEntriesResponse struct {
+	Term    uint64
+	Success bool
+	// ConflictIndex с какого индекса лидеру продолжать, если записи не совпали
+	ConflictIndex uint64
+}
+
+type InstallSnapshotRequest struct {
+	Term              uint64
+	LeaderID          string
+	LastIncludedIndex uint64
+	LastIncludedTerm  uint64
+	Data              []byte
+}
+
+type InstallSnapshotResponse struct {
+	Term uint64
+}
+
+// Transport доставляет RPC до других узлов кластера по их идентификатору
+type Transport interface {
+	RequestVote(ctx context.Context, target string, req *RequestVoteRequest) (*RequestVoteResponse, error)
+	AppendEntries(ctx context.Context, target string, req *AppendEntriesRequest) (*AppendEntriesResponse, error)
+	InstallSnapshot(ctx context.Context, target string, req *InstallSnapshotRequest) (*InstallSnapshotResponse, error)
+	Forward(ctx context.Context, target string, payload []byte) ([]byte, error)
+}
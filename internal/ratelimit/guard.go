@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// GuardConfig настройки Guard. Нулевое значение порога отключает соответствующую меру.
+type GuardConfig struct {
+	// Window окно, в котором считаются неудачи клиента
+	Window time.Duration
+	// SlowAfter после стольких неудач в окне ответы клиенту задерживаются на BaseDelay,
+	// каждая следующая неудача удваивает задержку, но не больше MaxDelay
+	SlowAfter int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// BlockAfter после стольких неудач в окне клиент блокируется на BlockFor
+	BlockAfter int
+	BlockFor   time.Duration
+}
+
+type guardEntry struct {
+	windowStart  time.Time
+	failures     int
+	blockedUntil time.Time
+}
+
+// Guard сдерживает клиентов, которые часто получают неудачные ответы, например
+// перебирают идентификаторы ссылок: сначала замедляет, затем блокирует
+type Guard struct {
+	cfg GuardConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	entries     map[string]*guardEntry
+	lastCleanup time.Time
+}
+
+// Check задержка перед ответом клиенту key и оставшееся время блокировки
+func (g *Guard) Check(key string) (delay time.Duration, blockedFor time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	entry, ok := g.entries[key]
+	if !ok {
+		return 0, 0
+	}
+	if now.Before(entry.blockedUntil) {
+		return 0, entry.blockedUntil.Sub(now)
+	}
+	if now.Sub(entry.windowStart) >= g.cfg.Window || g.cfg.SlowAfter <= 0 || entry.failures < g.cfg.SlowAfter {
+		return 0, 0
+	}
+	delay = g.cfg.BaseDelay
+	for i := g.cfg.SlowAfter; i < entry.failures && delay < g.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.cfg.MaxDelay {
+		delay = g.cfg.MaxDelay
+	}
+	return delay, 0
+}
+
+// Fail учитывает неудачу клиента key. Возвращает true, если клиент только что заблокирован.
+func (g *Guard) Fail(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.cleanupLocked(now)
+	entry, ok := g.entries[key]
+	if !ok || now.Sub(entry.windowStart) >= g.cfg.Window {
+		entry = &guardEntry{windowStart: now}
+		g.entries[key] = entry
+	}
+	entry.failures++
+	if g.cfg.BlockAfter > 0 && entry.failures >= g.cfg.BlockAfter && !now.Before(entry.blockedUntil) {
+		entry.blockedUntil = now.Add(g.cfg.BlockFor)
+		// Заблокированный клиент начинает новое окно после разблокировки
+		entry.windowStart, entry.failures = entry.blockedUntil, 0
+		return true
+	}
+	return false
+}
+
+func (g *Guard) cleanupLocked(now time.Time) {
+	if now.Sub(g.lastCleanup) < cleanupInterval {
+		return
+	}
+	g.lastCleanup = now
+	for key, entry := range g.entries {
+		if now.Sub(entry.windowStart) >= g.cfg.Window && !now.Before(entry.blockedUntil) {
+			delete(g.entries, key)
+		}
+	}
+}
+
+// NewGuard возвращает nil, если окно не задано: такая защита отключена
+func NewGuard(cfg GuardConfig) *Guard {
+	if cfg.Window <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return &Guard{
+		cfg:         cfg,
+		now:         time.Now,
+		entries:     make(map[string]*guardEntry),
+		lastCleanup: now,
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuard(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := NewGuard(GuardConfig{
+		Window:     time.Minute,
+		SlowAfter:  2,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   300 * time.Millisecond,
+		BlockAfter: 5,
+		BlockFor:   time.Hour,
+	})
+	g.now = func() time.Time { return now }
+
+	require.False(t, g.Fail("client"))
+	delay, blockedFor := g.Check("client")
+	require.Zero(t, delay)
+	require.Zero(t, blockedFor)
+
+	g.Fail("client")
+	delay, _ = g.Check("client")
+	require.Equal(t, 100*time.Millisecond, delay)
+	g.Fail("client")
+	delay, _ = g.Check("client")
+	require.Equal(t, 200*time.Millisecond, delay)
+	g.Fail("client")
+	delay, _ = g.Check("client")
+	require.Equal(t, 300*time.Millisecond, delay)
+	delay, _ = g.Check("other")
+	require.Zero(t, delay)
+
+	require.True(t, g.Fail("client"))
+	_, blockedFor = g.Check("client")
+	require.Equal(t, time.Hour, blockedFor)
+
+	// После блокировки неудачи считаются заново
+	now = now.Add(time.Hour)
+	delay, blockedFor = g.Check("client")
+	require.Zero(t, delay)
+	require.Zero(t, blockedFor)
+}
+
+func TestGuardWindow(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := NewGuard(GuardConfig{Window: time.Minute, BlockAfter: 2, BlockFor: time.Hour})
+	g.now = func() time.Time { return now }
+
+	require.False(t, g.Fail("client"))
+	now = now.Add(time.Minute)
+	require.False(t, g.Fail("client"))
+	require.True(t, g.Fail("client"))
+	require.Nil(t, NewGuard(GuardConfig{}))
+}
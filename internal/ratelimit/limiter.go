@@ -0,0 +1,113 @@
+// Package ratelimit ограничение частоты запросов по алгоритму token bucket.
+// Состояние хранится в памяти процесса.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// cleanupInterval как часто удаляются корзины, которые успели заполниться: они
+// ничем не отличаются от новых
+const cleanupInterval = time.Minute
+
+// Result решение по одному запросу
+type Result struct {
+	Allowed bool
+	// Limit размер корзины - сколько запросов можно сделать подряд
+	Limit int
+	// Remaining сколько запросов осталось прямо сейчас
+	Remaining int
+	// RetryAfter когда появится следующий токен, если запрос отклонен
+	RetryAfter time.Duration
+	// Reset когда корзина заполнится полностью
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter корзина на каждый ключ: rate токенов в секунду, не больше burst
+type Limiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+}
+
+// Allow списывает токен с корзины key, если он есть
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanupLocked(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	result := Result{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.timeFor(1 - b.tokens)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = l.timeFor(float64(l.burst) - b.tokens)
+	return result
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(l.burst), b.tokens+elapsed*l.rate)
+		b.updated = now
+	}
+}
+
+// timeFor за сколько накопится tokens токенов
+func (l *Limiter) timeFor(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / l.rate * float64(time.Second)))
+}
+
+func (l *Limiter) cleanupLocked(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// NewLimiter rate - токенов в секунду, burst - размер корзины. Возвращает nil, если rate
+// или burst не положительны: такой лимит отключен.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 || burst <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return &Limiter{
+		rate:        rate,
+		burst:       burst,
+		now:         time.Now,
+		buckets:     make(map[string]*bucket),
+		lastCleanup: now,
+	}
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		result := l.Allow("user")
+		require.True(t, result.Allowed)
+		require.Equal(t, i, result.Remaining)
+		require.Equal(t, 3, result.Limit)
+	}
+	result := l.Allow("user")
+	require.False(t, result.Allowed)
+	require.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	require.Equal(t, 1500*time.Millisecond, result.Reset)
+	// Ключи не влияют друг на друга
+	require.True(t, l.Allow("other").Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	require.True(t, l.Allow("user").Allowed)
+	require.False(t, l.Allow("user").Allowed)
+
+	// Корзина не копит больше burst
+	now = now.Add(time.Hour)
+	require.Equal(t, 2, l.Allow("user").Remaining)
+}
+
+func TestLimiterCleanup(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(1, 1)
+	l.now = func() time.Time { return now }
+	l.lastCleanup = now
+
+	l.Allow("user")
+	now = now.Add(cleanupInterval)
+	l.Allow("other")
+	require.NotContains(t, l.buckets, "user")
+	require.Contains(t, l.buckets, "other")
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	require.Nil(t, NewLimiter(0, 10))
+	require.Nil(t, NewLimiter(1, 0))
+}
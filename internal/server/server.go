@@ -1,20 +1,31 @@
 package server
 
 import (
+	"expvar"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 
 	"github.com/maxsnegir/url-shortener/cmd/config"
 	"github.com/maxsnegir/url-shortener/internal/handlers"
+	"github.com/maxsnegir/url-shortener/internal/services"
 )
 
 type server struct {
-	config     config.Config
-	logger     *logrus.Logger
-	router     *mux.Router
-	urlHandler handlers.URLHandler
+	config           config.Config
+	logger           *logrus.Logger
+	router           *mux.Router
+	urlHandler       handlers.URLHandler
+	apiKeyHandler    handlers.APIKeyHandler
+	accountHandler   handlers.AccountHandler
+	adminHandler     handlers.AdminHandler
+	workspaceHandler handlers.WorkspaceHandler
+	rateLimitHandler handlers.RateLimitHandler
+	csrfHandler      handlers.CSRFHandler
+	// oidcHandler nil, если вход через OIDC не настроен
+	oidcHandler *handlers.OIDCHandler
 }
 
 func (s *server) Start() error {
@@ -25,24 +36,90 @@ func (s *server) Start() error {
 
 func (s *server) configureRouter() {
 	// Routes
-	s.router.HandleFunc("/", s.urlHandler.SetURLTextHandler()).Methods(http.MethodPost)
-	s.router.HandleFunc("/api/shorten", s.urlHandler.SetURLJSONHandler()).Methods(http.MethodPost)
-	s.router.HandleFunc("/{urlID}/", s.urlHandler.GetURLByIDHandler()).Methods(http.MethodGet)
+	// Создание ссылок ограничено по частоте; лимит применяется после авторизации, чтобы знать пользователя
+	limit := s.rateLimitHandler.Middleware
+	s.router.Handle("/", limit(s.urlHandler.SetURLTextHandler())).Methods(http.MethodPost)
+	s.router.Handle("/api/shorten", limit(s.urlHandler.SetURLJSONHandler())).Methods(http.MethodPost)
 	s.router.HandleFunc("/api/user/urls", s.urlHandler.GetUserURLs()).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/user/urls/{urlID}", s.urlHandler.UpdateURL()).Methods(http.MethodPatch)
+	s.router.HandleFunc("/api/user/urls/{urlID}", s.urlHandler.DeleteURL()).Methods(http.MethodDelete)
+	s.router.HandleFunc("/api/user/urls/{urlID}/history", s.urlHandler.GetURLHistory()).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/user/urls/{urlID}/rollback", s.urlHandler.RollbackURL()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/user/urls/{urlID}/stats", s.urlHandler.GetLinkStats()).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/user/campaigns", s.urlHandler.CreateCampaign()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/user/campaigns", s.urlHandler.GetCampaigns()).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/user/campaigns/{campaignID}", s.urlHandler.UpdateCampaign()).Methods(http.MethodPut)
+	s.router.HandleFunc("/api/user/campaigns/{campaignID}", s.urlHandler.DeleteCampaign()).Methods(http.MethodDelete)
+	s.router.HandleFunc("/api/user/campaigns/{campaignID}/urls", s.urlHandler.GetCampaignURLs()).Methods(http.MethodGet)
 	s.router.HandleFunc("/ping", s.urlHandler.Ping()).Methods(http.MethodGet)
-	s.router.HandleFunc("/api/shorten/batch", s.urlHandler.SaveDataBatch()).Methods(http.MethodPost)
+	s.router.Handle("/api/shorten/batch", limit(s.urlHandler.SaveDataBatch())).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/user/keys", s.apiKeyHandler.CreateAPIKey()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/user/keys", s.apiKeyHandler.GetUserAPIKeys()).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/user/keys/{keyID}", s.apiKeyHandler.RevokeAPIKey()).Methods(http.MethodDelete)
+	s.router.HandleFunc("/api/user/register", s.accountHandler.Register()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/user/login", s.accountHandler.Login()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/user/logout", s.accountHandler.Logout()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/user/me", s.adminHandler.GetCurrentUser()).Methods(http.MethodGet)
+	if s.oidcHandler != nil {
+		s.router.HandleFunc("/api/user/oidc/login", s.oidcHandler.Login()).Methods(http.MethodGet)
+		s.router.HandleFunc("/api/user/oidc/callback", s.oidcHandler.Callback()).Methods(http.MethodGet)
+	}
+	s.router.HandleFunc("/api/workspaces", s.workspaceHandler.CreateWorkspace()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/workspaces", s.workspaceHandler.GetUserWorkspaces()).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/workspaces/join", s.workspaceHandler.AcceptInvite()).Methods(http.MethodPost)
+	s.router.HandleFunc("/api/workspaces/{workspaceID}/members", s.workspaceHandler.GetMembers()).Methods(http.MethodGet)
+	s.router.HandleFunc("/api/workspaces/{workspaceID}/members/{userToken}", s.workspaceHandler.SetMemberRole()).Methods(http.MethodPut)
+	s.router.HandleFunc("/api/workspaces/{workspaceID}/members/{userToken}", s.workspaceHandler.RemoveMember()).Methods(http.MethodDelete)
+	s.router.HandleFunc("/api/workspaces/{workspaceID}/invites", s.workspaceHandler.CreateInvite()).Methods(http.MethodPost)
+	// Admin routes
+	adminRouter := s.router.PathPrefix("/api/admin").Subrouter()
+	adminRouter.HandleFunc("/urls", s.adminHandler.SearchURLs()).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/urls/{urlID}", s.adminHandler.SetURLDisabled()).Methods(http.MethodPatch)
+	adminRouter.HandleFunc("/users/{userToken}/urls", s.adminHandler.GetUserURLs()).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/patterns", s.urlHandler.CreateLinkPattern()).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/patterns", s.urlHandler.GetLinkPatterns()).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/patterns/{patternID}", s.urlHandler.DeleteLinkPattern()).Methods(http.MethodDelete)
+	adminRouter.Handle("/metrics", expvar.Handler()).Methods(http.MethodGet)
+	adminRouter.Use(s.adminHandler.RequireRole(services.RoleAdmin))
+	// Переход по ссылке регистрируется последним: шаблоны без завершающего "/" и с путем
+	// после идентификатора совпали бы с маршрутами API
+	handleRedirects(s.router, s.rateLimitHandler.EnumerationGuard(s.urlHandler.GetURLByIDHandler()))
 	// Middlewares
+	s.router.Use(s.apiKeyHandler.BearerAuthenticationMiddleware)
+	s.router.Use(s.csrfHandler.Middleware)
+	s.router.Use(s.accountHandler.SessionAuthenticationMiddleware)
 	s.router.Use(s.urlHandler.CookieAuthenticationMiddleware)
 	s.router.Use(s.urlHandler.LoggingMiddleware)
 	s.router.Use(s.urlHandler.GzipMiddleware)
 	s.router.Use(s.urlHandler.UnzipMiddleware)
 }
 
-func NewServer(cfg config.Config, logger *logrus.Logger, urlHandler handlers.URLHandler) *server {
+// handleRedirects маршруты перехода по ссылке. Пути API и /ping в них не попадают: запрос
+// к ним с неверным методом должен получить 405, а не 404 от перехода, который к тому же
+// засчитал бы его как попытку перебора ссылок.
+func handleRedirects(router *mux.Router, redirect http.Handler) {
+	redirectMethods := []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	for _, path := range []string{"/{urlID}", "/{urlID}/", "/{urlID}/{path:.+}"} {
+		router.Handle(path, redirect).Methods(redirectMethods...).MatcherFunc(notServiceRoute)
+	}
+}
+
+func notServiceRoute(r *http.Request, _ *mux.RouteMatch) bool {
+	return r.URL.Path != "/ping" && !strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func NewServer(cfg config.Config, logger *logrus.Logger, urlHandler handlers.URLHandler, apiKeyHandler handlers.APIKeyHandler, accountHandler handlers.AccountHandler, adminHandler handlers.AdminHandler, workspaceHandler handlers.WorkspaceHandler, rateLimitHandler handlers.RateLimitHandler, csrfHandler handlers.CSRFHandler, oidcHandler *handlers.OIDCHandler) *server {
 	return &server{
-		router:     mux.NewRouter(),
-		config:     cfg,
-		logger:     logger,
-		urlHandler: urlHandler,
+		router:           mux.NewRouter(),
+		config:           cfg,
+		logger:           logger,
+		urlHandler:       urlHandler,
+		apiKeyHandler:    apiKeyHandler,
+		accountHandler:   accountHandler,
+		adminHandler:     adminHandler,
+		workspaceHandler: workspaceHandler,
+		rateLimitHandler: rateLimitHandler,
+		csrfHandler:      csrfHandler,
+		oidcHandler:      oidcHandler,
 	}
 }
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRedirectRoutesSkipServiceRoutes запрос к маршруту сервиса с неверным методом
+// получает 405 и не доходит до перехода по ссылке
+func TestRedirectRoutesSkipServiceRoutes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	redirects := 0
+	router := mux.NewRouter()
+	router.Handle("/api/shorten", ok).Methods(http.MethodPost)
+	router.Handle("/ping", ok).Methods(http.MethodGet)
+	handleRedirects(router, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirects++
+	}))
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{method: http.MethodGet, target: "/api/shorten", want: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, target: "/ping", want: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, target: "/api/missing", want: http.StatusNotFound},
+		{method: http.MethodGet, target: "/abc", want: http.StatusOK},
+		{method: http.MethodGet, target: "/abc/docs", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		require.Equal(t, tt.want, w.Code, tt.method+" "+tt.target)
+	}
+	require.Equal(t, 2, redirects)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+const (
+	minPasswordLength = 8
+	// maxPasswordLength bcrypt учитывает только первые 72 байта
+	maxPasswordLength = 72
+	sessionTokenSize  = 32
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.-]{3,64}$`)
+
+type AccountService interface {
+	// Register создает учетную запись, передает ей ссылки anonymousUserToken и открывает сессию
+	Register(ctx context.Context, anonymousUserToken, username, password string) (storage.Account, string, error)
+	// Login открывает сессию и передает учетной записи ссылки anonymousUserToken
+	Login(ctx context.Context, anonymousUserToken, username, password string) (storage.Account, string, error)
+	Logout(ctx context.Context, sessionToken string) error
+	// Authenticate возвращает токен пользователя учетной записи, к которой относится сессия
+	Authenticate(ctx context.Context, sessionToken string) (string, error)
+}
+
+type accountService struct {
+	storage    storage.AccountStorage
+	sessionTTL time.Duration
+	bcryptCost int
+	// dummyHash сравнивается с паролем, когда пользователя нет, чтобы время ответа не выдавало существующие имена
+	dummyHash []byte
+	now       func() time.Time
+}
+
+func (s *accountService) Register(ctx context.Context, anonymousUserToken, username, password string) (storage.Account, string, error) {
+	username = normalizeUsername(username)
+	if !usernamePattern.MatchString(username) {
+		return storage.Account{}, "", AccountValidationError{Reason: "Username must be 3-64 characters: letters, digits, '_', '.', '-'"}
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return storage.Account{}, "", AccountValidationError{Reason: "Password must be 8-72 characters long"}
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	if err != nil {
+		return storage.Account{}, "", err
+	}
+	account := storage.Account{
+		UserToken:    uuid.New().String(),
+		Username:     username,
+		PasswordHash: string(passwordHash),
+		CreatedAt:    s.now().UTC(),
+	}
+	err = s.storage.CreateAccount(ctx, account)
+	if errors.Is(err, storage.ExistsError) {
+		return storage.Account{}, "", UsernameTakenError{Username: username}
+	}
+	if err != nil {
+		return storage.Account{}, "", err
+	}
+	return s.startSession(ctx, anonymousUserToken, account)
+}
+
+func (s *accountService) Login(ctx context.Context, anonymousUserToken, username, password string) (storage.Account, string, error) {
+	account, err := s.storage.GetAccount(ctx, normalizeUsername(username))
+	if errors.Is(err, storage.KeyError) {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return storage.Account{}, "", InvalidCredentialsError{}
+	}
+	if err != nil {
+		return storage.Account{}, "", err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return storage.Account{}, "", InvalidCredentialsError{}
+	}
+	return s.startSession(ctx, anonymousUserToken, account)
+}
+
+func (s *accountService) startSession(ctx context.Context, anonymousUserToken string, account storage.Account) (storage.Account, string, error) {
+	// Ссылки пользователя провайдера принадлежат его учетной записи и не передаются
+	if anonymousUserToken != "" && !auth.IsIdentityToken(anonymousUserToken) {
+		if err := s.storage.MergeUserURLs(ctx, anonymousUserToken, account.UserToken); err != nil {
+			return storage.Account{}, "", err
+		}
+	}
+	sessionToken, err := randomString(sessionTokenSize)
+	if err != nil {
+		return storage.Account{}, "", err
+	}
+	now := s.now().UTC()
+	session := storage.Session{
+		TokenHash: hashToken(sessionToken),
+		UserToken: account.UserToken,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.sessionTTL),
+	}
+	if err := s.storage.SaveSession(ctx, session); err != nil {
+		return storage.Account{}, "", err
+	}
+	return account, sessionToken, nil
+}
+
+func (s *accountService) Logout(ctx context.Context, sessionToken string) error {
+	return s.storage.DeleteSession(ctx, hashToken(sessionToken))
+}
+
+func (s *accountService) Authenticate(ctx context.Context, sessionToken string) (string, error) {
+	session, err := s.storage.GetSession(ctx, hashToken(sessionToken))
+	if errors.Is(err, storage.KeyError) {
+		return "", InvalidSessionError{}
+	}
+	if err != nil {
+		return "", err
+	}
+	if !s.now().Before(session.ExpiresAt) {
+		_ = s.storage.DeleteSession(ctx, session.TokenHash)
+		return "", InvalidSessionError{}
+	}
+	return session.UserToken, nil
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func NewAccountService(accountStorage storage.AccountStorage, sessionTTL time.Duration) AccountService {
+	return newAccountService(accountStorage, sessionTTL, bcrypt.DefaultCost)
+}
+
+func newAccountService(accountStorage storage.AccountStorage, sessionTTL time.Duration, bcryptCost int) *accountService {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+	return &accountService{
+		storage:    accountStorage,
+		sessionTTL: sessionTTL,
+		bcryptCost: bcryptCost,
+		dummyHash:  dummyHash,
+		now:        time.Now,
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// TestAccountClaimsAnonymousLinks ссылки анонимных пользователей переходят в учетную
+// запись при регистрации и при входе с другого устройства
+func TestAccountClaimsAnonymousLinks(t *testing.T) {
+	ctx := context.Background()
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(urlStorage, config.BaseURL)
+	accounts := newAccountService(urlStorage, time.Hour, bcrypt.MinCost)
+
+	_, err := shortener.SaveData(ctx, "laptop", "https://github.com/1")
+	require.NoError(t, err)
+	_, err = shortener.SaveData(ctx, "phone", "https://github.com/2")
+	require.NoError(t, err)
+
+	account, laptopSession, err := accounts.Register(ctx, "laptop", "Alice", "correct horse")
+	require.NoError(t, err)
+	require.Equal(t, "alice", account.Username)
+	require.NotEqual(t, "correct horse", account.PasswordHash)
+
+	_, phoneSession, err := accounts.Login(ctx, "phone", "alice", "correct horse")
+	require.NoError(t, err)
+	for _, sessionToken := range []string{laptopSession, phoneSession} {
+		userToken, err := accounts.Authenticate(ctx, sessionToken)
+		require.NoError(t, err)
+		require.Equal(t, account.UserToken, userToken)
+	}
+
+	userURLs, err := shortener.GetUserURLs(ctx, account.UserToken)
+	require.NoError(t, err)
+	require.Len(t, userURLs, 2)
+	anonymousURLs, err := shortener.GetUserURLs(ctx, "phone")
+	require.NoError(t, err)
+	require.Empty(t, anonymousURLs)
+
+	require.NoError(t, accounts.Logout(ctx, phoneSession))
+	_, err = accounts.Authenticate(ctx, phoneSession)
+	require.ErrorAs(t, err, &InvalidSessionError{})
+}
+
+func TestAccountErrors(t *testing.T) {
+	ctx := context.Background()
+	accounts := newAccountService(storage.NewURLStorage(storage.NewMapStorage()), time.Hour, bcrypt.MinCost)
+	_, _, err := accounts.Register(ctx, "", "alice", "correct horse")
+	require.NoError(t, err)
+
+	_, _, err = accounts.Register(ctx, "", "ALICE", "another password")
+	require.ErrorAs(t, err, &UsernameTakenError{})
+	_, _, err = accounts.Register(ctx, "", "bob", "short")
+	require.ErrorAs(t, err, &AccountValidationError{})
+	_, _, err = accounts.Register(ctx, "", "b o b", "long enough")
+	require.ErrorAs(t, err, &AccountValidationError{})
+
+	_, _, err = accounts.Login(ctx, "", "alice", "wrong password")
+	require.ErrorAs(t, err, &InvalidCredentialsError{})
+	_, _, err = accounts.Login(ctx, "", "nobody", "correct horse")
+	require.ErrorAs(t, err, &InvalidCredentialsError{})
+}
+
+func TestSessionExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	accounts := newAccountService(storage.NewURLStorage(storage.NewMapStorage()), time.Hour, bcrypt.MinCost)
+	accounts.now = func() time.Time { return now }
+
+	_, sessionToken, err := accounts.Register(ctx, "", "alice", "correct horse")
+	require.NoError(t, err)
+	now = now.Add(59 * time.Minute)
+	_, err = accounts.Authenticate(ctx, sessionToken)
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	_, err = accounts.Authenticate(ctx, sessionToken)
+	require.ErrorAs(t, err, &InvalidSessionError{})
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// Role роль пользователя. Роли упорядочены: каждая следующая включает права предыдущих.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+var roleLevels = map[Role]int{RoleUser: 1, RoleAdmin: 2}
+
+// Includes роль дает права роли other
+func (r Role) Includes(other Role) bool {
+	return roleLevels[r] >= roleLevels[other]
+}
+
+// AdminURL ссылка вместе с владельцем и настройками
+type AdminURL struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	UserToken   string `json:"user_token,omitempty"`
+	Disabled    bool   `json:"disabled"`
+}
+
+type AdminService interface {
+	// Role роль пользователя; администраторы задаются в конфиге
+	Role(userToken string) Role
+	// SearchURLs ссылки всех пользователей, у которых короткий или исходный URL содержит query
+	SearchURLs(ctx context.Context, query string, limit, offset int) ([]AdminURL, error)
+	GetUserURLs(ctx context.Context, userToken string) ([]AdminURL, error)
+	// SetURLDisabled отключает или снова включает ссылку с идентификатором urlID
+	SetURLDisabled(ctx context.Context, urlID string, disabled bool) error
+}
+
+// AdminStorage ссылки и их настройки, с которыми работает администратор
+type AdminStorage interface {
+	storage.URLDataStorage
+	storage.LinkSettingsStorage
+}
+
+type adminService struct {
+	storage AdminStorage
+	hostURL string
+	admins  map[string]bool
+}
+
+func (s *adminService) Role(userToken string) Role {
+	if userToken != "" && s.admins[userToken] {
+		return RoleAdmin
+	}
+	return RoleUser
+}
+
+func (s *adminService) SearchURLs(ctx context.Context, query string, limit, offset int) ([]AdminURL, error) {
+	userURLs, err := s.storage.GetAllUserURLs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	var found []storage.UserURLData
+	for _, userURL := range userURLs {
+		if strings.Contains(strings.ToLower(userURL.ShortURL), query) || strings.Contains(strings.ToLower(userURL.OriginalURL), query) {
+			found = append(found, userURL)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].ShortURL != found[j].ShortURL {
+			return found[i].ShortURL < found[j].ShortURL
+		}
+		return found[i].UserToken < found[j].UserToken
+	})
+	if offset >= len(found) {
+		return nil, nil
+	}
+	found = found[offset:]
+	if limit > 0 && limit < len(found) {
+		found = found[:limit]
+	}
+	adminURLs := make([]AdminURL, 0, len(found))
+	for _, userURL := range found {
+		adminURL, err := s.withSettings(ctx, userURL.UserToken, userURL.URLData)
+		if err != nil {
+			return nil, err
+		}
+		adminURLs = append(adminURLs, adminURL)
+	}
+	return adminURLs, nil
+}
+
+func (s *adminService) GetUserURLs(ctx context.Context, userToken string) ([]AdminURL, error) {
+	userURLs, err := s.storage.GetUserURLs(ctx, userToken)
+	if err != nil {
+		return nil, err
+	}
+	adminURLs := make([]AdminURL, 0, len(userURLs))
+	for _, urlData := range userURLs {
+		adminURL, err := s.withSettings(ctx, userToken, urlData)
+		if err != nil {
+			return nil, err
+		}
+		adminURLs = append(adminURLs, adminURL)
+	}
+	return adminURLs, nil
+}
+
+func (s *adminService) SetURLDisabled(ctx context.Context, urlID string, disabled bool) error {
+	shortURL := fmt.Sprintf("%s/%s/", s.hostURL, urlID)
+	if _, err := s.storage.GetOriginalURL(ctx, shortURL); errors.Is(err, storage.KeyError) {
+		return OriginalURLNotFound{URLID: shortURL}
+	} else if err != nil {
+		return err
+	}
+	settings, err := s.storage.GetLinkSettings(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	settings.Disabled = disabled
+	return s.storage.SaveLinkSettings(ctx, settings)
+}
+
+func (s *adminService) withSettings(ctx context.Context, userToken string, urlData storage.URLData) (AdminURL, error) {
+	settings, err := s.storage.GetLinkSettings(ctx, urlData.ShortURL)
+	if err != nil {
+		return AdminURL{}, err
+	}
+	return AdminURL{
+		ShortURL:    urlData.ShortURL,
+		OriginalURL: urlData.OriginalURL,
+		UserToken:   userToken,
+		Disabled:    settings.Disabled,
+	}, nil
+}
+
+// NewAdminService admins токены пользователей с ролью администратора
+func NewAdminService(urlStorage AdminStorage, hostURL string, admins []string) AdminService {
+	s := &adminService{storage: urlStorage, hostURL: hostURL, admins: make(map[string]bool, len(admins))}
+	for _, userToken := range admins {
+		if userToken = strings.TrimSpace(userToken); userToken != "" {
+			s.admins[userToken] = true
+		}
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestRoles(t *testing.T) {
+	admin := NewAdminService(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL, []string{"admin", " "})
+	require.Equal(t, RoleAdmin, admin.Role("admin"))
+	require.Equal(t, RoleUser, admin.Role("user"))
+	require.Equal(t, RoleUser, admin.Role(""))
+	require.True(t, RoleAdmin.Includes(RoleUser))
+	require.False(t, RoleUser.Includes(RoleAdmin))
+}
+
+func TestAdminSearchAndDisable(t *testing.T) {
+	ctx := context.Background()
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(urlStorage, config.BaseURL)
+	admin := NewAdminService(urlStorage, config.BaseURL, nil)
+
+	githubURL, err := shortener.SaveData(ctx, "alice", "https://github.com/maxsnegir")
+	require.NoError(t, err)
+	_, err = shortener.SaveData(ctx, "bob", "https://example.com/GitHub-mirror")
+	require.NoError(t, err)
+	_, err = shortener.SaveData(ctx, "bob", "https://example.com/other")
+	require.NoError(t, err)
+
+	found, err := admin.SearchURLs(ctx, "github", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	page, err := admin.SearchURLs(ctx, "github", 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, found[1:], page)
+	page, err = admin.SearchURLs(ctx, "github", 10, 5)
+	require.NoError(t, err)
+	require.Empty(t, page)
+
+	urlID := githubURL[len(config.BaseURL)+1 : len(githubURL)-1]
+	require.ErrorAs(t, admin.SetURLDisabled(ctx, "missing", true), &OriginalURLNotFound{})
+	require.NoError(t, admin.SetURLDisabled(ctx, urlID, true))
+	_, err = shortener.GetOriginalURL(ctx, githubURL)
+	require.ErrorAs(t, err, &LinkDisabledError{})
+
+	aliceURLs, err := admin.GetUserURLs(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, []AdminURL{{ShortURL: githubURL, OriginalURL: "https://github.com/maxsnegir", UserToken: "alice", Disabled: true}}, aliceURLs)
+
+	require.NoError(t, admin.SetURLDisabled(ctx, urlID, false))
+	originalURL, err := shortener.GetOriginalURL(ctx, githubURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com/maxsnegir", originalURL)
+}
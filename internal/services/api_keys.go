@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// apiKeyPrefix помогает узнать ключ в логах и сканерах секретов
+const apiKeyPrefix = "sk_"
+
+const (
+	apiKeySecretSize = 32
+	apiKeyIDSize     = 8
+)
+
+type APIKeyService interface {
+	// CreateAPIKey возвращает ключ целиком; сохраняется только его хеш, поэтому показать ключ повторно нельзя
+	CreateAPIKey(ctx context.Context, userToken, name string) (storage.APIKey, string, error)
+	GetUserAPIKeys(ctx context.Context, userToken string) ([]storage.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userToken, id string) error
+	// Authenticate возвращает токен пользователя, которому принадлежит ключ
+	Authenticate(ctx context.Context, key string) (string, error)
+}
+
+type apiKeyService struct {
+	storage storage.APIKeyStorage
+	now     func() time.Time
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, userToken, name string) (storage.APIKey, string, error) {
+	secret, err := randomString(apiKeySecretSize)
+	if err != nil {
+		return storage.APIKey{}, "", err
+	}
+	id, err := randomHex(apiKeyIDSize)
+	if err != nil {
+		return storage.APIKey{}, "", err
+	}
+	key := apiKeyPrefix + secret
+	apiKey := storage.APIKey{
+		ID:        id,
+		UserToken: userToken,
+		Name:      name,
+		KeyHash:   hashToken(key),
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.storage.SaveAPIKey(ctx, apiKey); err != nil {
+		return storage.APIKey{}, "", err
+	}
+	return apiKey, key, nil
+}
+
+func (s *apiKeyService) GetUserAPIKeys(ctx context.Context, userToken string) ([]storage.APIKey, error) {
+	return s.storage.GetUserAPIKeys(ctx, userToken)
+}
+
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, userToken, id string) error {
+	err := s.storage.RevokeAPIKey(ctx, userToken, id, s.now().UTC())
+	if errors.Is(err, storage.KeyError) {
+		return APIKeyNotFoundError{ID: id}
+	}
+	return err
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (string, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", InvalidAPIKeyError{}
+	}
+	apiKey, err := s.storage.GetAPIKeyByHash(ctx, hashToken(key))
+	if errors.Is(err, storage.KeyError) {
+		return "", InvalidAPIKeyError{}
+	}
+	if err != nil {
+		return "", err
+	}
+	if apiKey.RevokedAt != nil {
+		return "", InvalidAPIKeyError{}
+	}
+	return apiKey.UserToken, nil
+}
+
+// hashToken ключи API и токены сессий случайные и длинные, поэтому медленный хеш для паролей не нужен
+func hashToken(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomBytes(size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func randomString(size int) (string, error) {
+	b, err := randomBytes(size)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomHex(size int) (string, error) {
+	b, err := randomBytes(size)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func NewAPIKeyService(apiKeyStorage storage.APIKeyStorage) APIKeyService {
+	return &apiKeyService{storage: apiKeyStorage, now: time.Now}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	apiKeys := NewAPIKeyService(urlStorage)
+
+	apiKey, key, err := apiKeys.CreateAPIKey(ctx, "user", "ci")
+	require.NoError(t, err)
+	require.NotContains(t, apiKey.KeyHash, key)
+	storedKeys, err := urlStorage.GetUserAPIKeys(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, storedKeys, 1)
+	require.Equal(t, hashToken(key), storedKeys[0].KeyHash)
+
+	userToken, err := apiKeys.Authenticate(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "user", userToken)
+
+	_, err = apiKeys.Authenticate(ctx, key+"x")
+	require.ErrorAs(t, err, &InvalidAPIKeyError{})
+
+	require.ErrorAs(t, apiKeys.RevokeAPIKey(ctx, "other_user", apiKey.ID), &APIKeyNotFoundError{})
+	require.NoError(t, apiKeys.RevokeAPIKey(ctx, "user", apiKey.ID))
+	_, err = apiKeys.Authenticate(ctx, key)
+	require.ErrorAs(t, err, &InvalidAPIKeyError{})
+
+	userKeys, err := apiKeys.GetUserAPIKeys(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, userKeys, 1)
+	require.NotNil(t, userKeys[0].RevokedAt)
+}
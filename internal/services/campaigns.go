@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// maxUTMValueLength ограничение на длину одной UTM-метки
+const maxUTMValueLength = 255
+
+// CampaignParams изменяемые поля кампании
+type CampaignParams struct {
+	Name        string
+	UTMSource   string
+	UTMMedium   string
+	UTMCampaign string
+}
+
+func validateCampaign(params CampaignParams) error {
+	if strings.TrimSpace(params.Name) == "" || len(params.Name) > 100 {
+		return LinkValidationError{Reason: "Campaign name must be from 1 to 100 characters long"}
+	}
+	if params.UTMSource == "" && params.UTMMedium == "" && params.UTMCampaign == "" {
+		return LinkValidationError{Reason: "Campaign must have utm_source, utm_medium or utm_campaign"}
+	}
+	for _, value := range []string{params.UTMSource, params.UTMMedium, params.UTMCampaign} {
+		if len(value) > maxUTMValueLength {
+			return LinkValidationError{Reason: "UTM values must be at most 255 characters long"}
+		}
+	}
+	return nil
+}
+
+// CreateCampaign создает кампанию пользователя или, если задан workspaceID, пространства
+func (s *shortener) CreateCampaign(ctx context.Context, userToken, workspaceID string, params CampaignParams) (storage.Campaign, error) {
+	if err := validateCampaign(params); err != nil {
+		return storage.Campaign{}, err
+	}
+	owner, err := s.owner(ctx, userToken, workspaceID, WorkspaceEditor)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	campaign := storage.Campaign{ID: id, Owner: owner, CreatedAt: s.now().UTC()}
+	setCampaignParams(&campaign, params)
+	return campaign, s.storage.SaveCampaign(ctx, campaign)
+}
+
+func (s *shortener) GetCampaigns(ctx context.Context, userToken, workspaceID string) ([]storage.Campaign, error) {
+	owner, err := s.owner(ctx, userToken, workspaceID, WorkspaceViewer)
+	if err != nil {
+		return nil, err
+	}
+	return s.storage.GetCampaigns(ctx, owner)
+}
+
+// UpdateCampaign меняет метки кампании, новые метки получают и уже созданные ссылки
+func (s *shortener) UpdateCampaign(ctx context.Context, userToken, workspaceID, id string, params CampaignParams) (storage.Campaign, error) {
+	if err := validateCampaign(params); err != nil {
+		return storage.Campaign{}, err
+	}
+	owner, err := s.owner(ctx, userToken, workspaceID, WorkspaceEditor)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	campaign, err := s.ownedCampaign(ctx, owner, id)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	setCampaignParams(&campaign, params)
+	return campaign, s.storage.SaveCampaign(ctx, campaign)
+}
+
+// DeleteCampaign удаляет кампанию; ее ссылки продолжают работать, но без UTM-меток
+func (s *shortener) DeleteCampaign(ctx context.Context, userToken, workspaceID, id string) error {
+	owner, err := s.owner(ctx, userToken, workspaceID, WorkspaceEditor)
+	if err != nil {
+		return err
+	}
+	if _, err := s.ownedCampaign(ctx, owner, id); err != nil {
+		return err
+	}
+	return s.storage.DeleteCampaign(ctx, id)
+}
+
+// GetCampaignURLs ссылки владельца, созданные в кампании
+func (s *shortener) GetCampaignURLs(ctx context.Context, userToken, workspaceID, id string) ([]storage.URLData, error) {
+	owner, err := s.owner(ctx, userToken, workspaceID, WorkspaceViewer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.ownedCampaign(ctx, owner, id); err != nil {
+		return nil, err
+	}
+	ownerURLs, err := s.storage.GetUserURLs(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	campaignURLs := make([]storage.URLData, 0)
+	for _, urlData := range ownerURLs {
+		settings, err := s.storage.GetLinkSettings(ctx, urlData.ShortURL)
+		if err != nil {
+			return nil, err
+		}
+		if settings.CampaignID == id {
+			campaignURLs = append(campaignURLs, urlData)
+		}
+	}
+	return campaignURLs, nil
+}
+
+// ownedCampaign кампания id, если она принадлежит owner. Чужие кампании не отличаются
+// от несуществующих.
+func (s *shortener) ownedCampaign(ctx context.Context, owner, id string) (storage.Campaign, error) {
+	campaign, err := s.storage.GetCampaign(ctx, id)
+	if errors.Is(err, storage.KeyError) || (err == nil && campaign.Owner != owner) {
+		return storage.Campaign{}, CampaignNotFoundError{ID: id}
+	}
+	return campaign, err
+}
+
+func setCampaignParams(campaign *storage.Campaign, params CampaignParams) {
+	campaign.Name = strings.TrimSpace(params.Name)
+	campaign.UTMSource = params.UTMSource
+	campaign.UTMMedium = params.UTMMedium
+	campaign.UTMCampaign = params.UTMCampaign
+}
+
+// tagDestination добавляет к адресу UTM-метки кампании ссылки. Метки берутся в момент
+// перехода, поэтому изменение кампании сразу действует на все ее ссылки. Метки, которые
+// уже есть в адресе, не заменяются; удаленная кампания меток не добавляет.
+func (s *shortener) tagDestination(ctx context.Context, destination string, settings storage.LinkSettings) (string, error) {
+	if settings.CampaignID == "" {
+		return destination, nil
+	}
+	campaign, err := s.storage.GetCampaign(ctx, settings.CampaignID)
+	if errors.Is(err, storage.KeyError) {
+		return destination, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	// Исходный запрос не перекодируется, чтобы не менять порядок и запись параметров адреса
+	query := u.Query()
+	rawQuery := []string{u.RawQuery}
+	for _, tag := range [][2]string{
+		{"utm_source", campaign.UTMSource},
+		{"utm_medium", campaign.UTMMedium},
+		{"utm_campaign", campaign.UTMCampaign},
+	} {
+		if _, exists := query[tag[0]]; exists || tag[1] == "" {
+			continue
+		}
+		rawQuery = append(rawQuery, tag[0]+"="+url.QueryEscape(tag[1]))
+	}
+	if rawQuery[0] == "" {
+		rawQuery = rawQuery[1:]
+	}
+	u.RawQuery = strings.Join(rawQuery, "&")
+	return u.String(), nil
+}
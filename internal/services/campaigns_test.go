@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestCampaignTagging(t *testing.T) {
+	ctx := context.Background()
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	campaign, err := shortener.CreateCampaign(ctx, "user", "", CampaignParams{Name: "Spring", UTMSource: "newsletter", UTMMedium: "email"})
+	require.NoError(t, err)
+
+	_, err = shortener.CreateLink(ctx, "other", "https://example.com", LinkOptions{CampaignID: campaign.ID})
+	require.ErrorAs(t, err, new(CampaignNotFoundError))
+	plainURL, err := shortener.CreateLink(ctx, "user", "https://example.com/plain", LinkOptions{})
+	require.NoError(t, err)
+	shortURL, err := shortener.CreateLink(ctx, "user", "https://example.com/sale?b=2&a=1&utm_medium=banner", LinkOptions{CampaignID: campaign.ID})
+	require.NoError(t, err)
+
+	redirect, err := shortener.GetRedirect(ctx, shortURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/sale?b=2&a=1&utm_medium=banner&utm_source=newsletter", redirect.URL)
+	require.True(t, redirect.NoStore)
+
+	// Метки берутся при переходе, поэтому изменение кампании действует на созданные ссылки
+	_, err = shortener.UpdateCampaign(ctx, "user", "", campaign.ID, CampaignParams{Name: "Spring", UTMSource: "news letter", UTMCampaign: "spring&sale"})
+	require.NoError(t, err)
+	redirect, err = shortener.GetRedirect(ctx, shortURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/sale?b=2&a=1&utm_medium=banner&utm_source=news+letter&utm_campaign=spring%26sale", redirect.URL)
+
+	urls, err := shortener.GetCampaignURLs(ctx, "user", "", campaign.ID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.URLData{{ShortURL: shortURL, OriginalURL: "https://example.com/sale?b=2&a=1&utm_medium=banner"}}, urls)
+	_, err = shortener.GetCampaignURLs(ctx, "other", "", campaign.ID)
+	require.ErrorAs(t, err, new(CampaignNotFoundError))
+
+	require.NoError(t, shortener.DeleteCampaign(ctx, "user", "", campaign.ID))
+	redirect, err = shortener.GetRedirect(ctx, shortURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/sale?b=2&a=1&utm_medium=banner", redirect.URL)
+	redirect, err = shortener.GetRedirect(ctx, plainURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/plain", redirect.URL)
+}
+
+// TestCampaignTaggingInDegradedMode пока база недоступна, метки кампании берутся из снимка
+func TestCampaignTaggingInDegradedMode(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(DB, config.BaseURL)
+	campaign, err := shortener.CreateCampaign(ctx, "user", "", CampaignParams{Name: "Spring", UTMSource: "newsletter"})
+	require.NoError(t, err)
+	shortURL, err := shortener.CreateLink(ctx, "user", "https://example.com/sale", LinkOptions{CampaignID: campaign.ID})
+	require.NoError(t, err)
+
+	fallback, err := storage.NewFallbackStorage(unavailableStorage{DB}, DB, filepath.Join(t.TempDir(), "snapshot"), time.Hour)
+	require.NoError(t, err)
+	defer fallback.Shutdown(ctx)
+	redirect, err := NewShortener(fallback, config.BaseURL).GetRedirect(ctx, shortURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/sale?utm_source=newsletter", redirect.URL)
+}
+
+func TestCampaignValidation(t *testing.T) {
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	for _, params := range []CampaignParams{
+		{UTMSource: "newsletter"},
+		{Name: "No tags"},
+		{Name: "Long", UTMSource: string(make([]byte, maxUTMValueLength+1))},
+	} {
+		_, err := shortener.CreateCampaign(context.Background(), "user", "", params)
+		require.ErrorAs(t, err, new(LinkValidationError))
+	}
+}
@@ -1,6 +1,9 @@
 package services
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type OriginalURLNotFound struct {
 	URLID string
@@ -10,6 +13,59 @@ func (e OriginalURLNotFound) Error() string {
 	return fmt.Sprintf("Original url for '%s' not found", e.URLID)
 }
 
+// LinkDisabledError ссылка отключена администратором
+type LinkDisabledError struct {
+	URLID string
+}
+
+func (e LinkDisabledError) Error() string {
+	return fmt.Sprintf("Link '%s' is disabled", e.URLID)
+}
+
+// LinkExhaustedError по ссылке уже выполнено разрешенное число переходов
+type LinkExhaustedError struct {
+	URLID     string
+	MaxClicks int64
+}
+
+func (e LinkExhaustedError) Error() string {
+	return fmt.Sprintf("Link '%s' has reached its limit of %d clicks", e.URLID, e.MaxClicks)
+}
+
+// LinkNotActiveError время активации ссылки еще не наступило
+type LinkNotActiveError struct {
+	URLID string
+	// Message текст, заданный при создании ссылки
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e LinkNotActiveError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("Link '%s' is not active yet", e.URLID)
+}
+
+// URLVersionNotFoundError у ссылки нет такой версии исходного URL
+type URLVersionNotFoundError struct {
+	Version int64
+}
+
+func (e URLVersionNotFoundError) Error() string {
+	return fmt.Sprintf("Version %d not found", e.Version)
+}
+
+// URLNotEditableError идентификатор ссылки - хеш ее URL, такую же ссылку получает
+// каждый, кто сокращает этот URL, поэтому менять ее адрес нельзя
+type URLNotEditableError struct {
+	URLID string
+}
+
+func (e URLNotEditableError) Error() string {
+	return fmt.Sprintf("Link '%s' is shared by everyone who shortens its URL and cannot be edited", e.URLID)
+}
+
 type URLIsNotValidError struct {
 	URL string
 }
@@ -17,3 +73,201 @@ type URLIsNotValidError struct {
 func (e URLIsNotValidError) Error() string {
 	return fmt.Sprintf("URL %s is not valid", e.URL)
 }
+
+// InvalidAPIKeyError ключа нет или он отозван
+type InvalidAPIKeyError struct{}
+
+func (e InvalidAPIKeyError) Error() string {
+	return "API key is invalid or revoked"
+}
+
+type APIKeyNotFoundError struct {
+	ID string
+}
+
+func (e APIKeyNotFoundError) Error() string {
+	return fmt.Sprintf("API key '%s' not found", e.ID)
+}
+
+type UsernameTakenError struct {
+	Username string
+}
+
+func (e UsernameTakenError) Error() string {
+	return fmt.Sprintf("Username '%s' is already taken", e.Username)
+}
+
+// InvalidCredentialsError неверное имя пользователя или пароль; что именно - не сообщаем
+type InvalidCredentialsError struct{}
+
+func (e InvalidCredentialsError) Error() string {
+	return "Invalid username or password"
+}
+
+type InvalidSessionError struct{}
+
+func (e InvalidSessionError) Error() string {
+	return "Session is invalid or expired"
+}
+
+type AccountValidationError struct {
+	Reason string
+}
+
+func (e AccountValidationError) Error() string {
+	return e.Reason
+}
+
+// SSOLoginError провайдер не подтвердил вход
+type SSOLoginError struct {
+	Reason string
+}
+
+func (e SSOLoginError) Error() string {
+	return fmt.Sprintf("SSO login failed: %s", e.Reason)
+}
+
+// WorkspaceNotFoundError пространства нет или пользователь в нем не состоит
+type WorkspaceNotFoundError struct {
+	ID string
+}
+
+func (e WorkspaceNotFoundError) Error() string {
+	return fmt.Sprintf("Workspace '%s' not found", e.ID)
+}
+
+type WorkspaceForbiddenError struct {
+	Role WorkspaceRole
+}
+
+func (e WorkspaceForbiddenError) Error() string {
+	return fmt.Sprintf("Workspace role '%s' required", e.Role)
+}
+
+type WorkspaceMemberNotFoundError struct {
+	UserToken string
+}
+
+func (e WorkspaceMemberNotFoundError) Error() string {
+	return fmt.Sprintf("Workspace member '%s' not found", e.UserToken)
+}
+
+type WorkspaceValidationError struct {
+	Reason string
+}
+
+func (e WorkspaceValidationError) Error() string {
+	return e.Reason
+}
+
+// InvalidInviteError приглашения нет, оно уже использовано или истекло
+type InvalidInviteError struct{}
+
+func (e InvalidInviteError) Error() string {
+	return "Invite is invalid or expired"
+}
+
+type LastWorkspaceOwnerError struct{}
+
+func (e LastWorkspaceOwnerError) Error() string {
+	return "Workspace must have at least one owner"
+}
+
+// QuotaExceededError пользователь исчерпал квоту на создание ссылок
+type QuotaExceededError struct {
+	Limit int64
+	// Remaining сколько ссылок еще можно создать
+	Remaining int64
+	// RetryAfter когда восстановится квота; ноль - исчерпана общая квота, ждать бесполезно
+	RetryAfter time.Duration
+}
+
+func (e QuotaExceededError) Error() string {
+	if e.RetryAfter == 0 {
+		return fmt.Sprintf("Link quota of %d exceeded", e.Limit)
+	}
+	return fmt.Sprintf("Daily link quota of %d exceeded", e.Limit)
+}
+
+type BatchTooLargeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e BatchTooLargeError) Error() string {
+	return fmt.Sprintf("Batch of %d URLs exceeds the limit of %d", e.Size, e.MaxSize)
+}
+
+type PrivateLinksDisabledError struct{}
+
+func (e PrivateLinksDisabledError) Error() string {
+	return "Private links are disabled"
+}
+
+type RedirectCodeNotValidError struct {
+	Code int
+}
+
+func (e RedirectCodeNotValidError) Error() string {
+	return fmt.Sprintf("Redirect code %d is not supported, use 301, 302, 307 or 308", e.Code)
+}
+
+// LinkValidationError недопустимые параметры ссылки
+type LinkValidationError struct {
+	Reason string
+}
+
+func (e LinkValidationError) Error() string {
+	return e.Reason
+}
+
+// LinkPasswordRequiredError ссылка защищена паролем, а он не передан
+type LinkPasswordRequiredError struct {
+	URLID string
+}
+
+func (e LinkPasswordRequiredError) Error() string {
+	return "Password required"
+}
+
+type WrongLinkPasswordError struct {
+	URLID string
+}
+
+func (e WrongLinkPasswordError) Error() string {
+	return "Wrong password"
+}
+
+// LinkLockedError слишком много неверных паролей к ссылке
+type LinkLockedError struct {
+	URLID      string
+	RetryAfter time.Duration
+}
+
+func (e LinkLockedError) Error() string {
+	return "Too many wrong passwords, try again later"
+}
+
+type CampaignNotFoundError struct {
+	ID string
+}
+
+func (e CampaignNotFoundError) Error() string {
+	return fmt.Sprintf("Campaign '%s' not found", e.ID)
+}
+
+type LinkPatternExistsError struct {
+	Pattern string
+}
+
+func (e LinkPatternExistsError) Error() string {
+	return fmt.Sprintf("Pattern matching the same paths as %s already exists", e.Pattern)
+}
+
+type LinkPatternNotFoundError struct {
+	ID string
+}
+
+func (e LinkPatternNotFoundError) Error() string {
+	return fmt.Sprintf("Pattern %s not found", e.ID)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// IDAllocator раздает последовательные идентификаторы из блока, арендованного
+// у хранилища, и ходит за новым блоком, только когда текущий закончился.
+// Несколько экземпляров сервиса арендуют разные блоки, поэтому идентификаторы
+// не пересекаются. Неиспользованный остаток блока при перезапуске теряется.
+type IDAllocator struct {
+	leaser    storage.RangeLeaser
+	blockSize uint64
+
+	mu   sync.Mutex
+	next uint64
+	end  uint64
+}
+
+func (a *IDAllocator) NextID(ctx context.Context) (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.next == a.end {
+		start, err := a.leaser.LeaseRange(ctx, a.blockSize)
+		if err != nil {
+			return 0, err
+		}
+		a.next = start
+		a.end = start + a.blockSize
+	}
+	id := a.next
+	a.next++
+	return id, nil
+}
+
+func NewIDAllocator(leaser storage.RangeLeaser, blockSize uint64) *IDAllocator {
+	if blockSize == 0 {
+		blockSize = 1
+	}
+	return &IDAllocator{
+		leaser:    leaser,
+		blockSize: blockSize,
+	}
+}
+
+func encodeBase62(n uint64) string {
+	if n == 0 {
+		return base62Alphabet[:1]
+	}
+	var sb strings.Builder
+	for n > 0 {
+		sb.WriteByte(base62Alphabet[n%62])
+		n /= 62
+	}
+	encoded := []byte(sb.String())
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
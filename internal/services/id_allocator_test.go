@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// TestConcurrentAllocatorsNoDuplicates несколько экземпляров с общим хранилищем
+// никогда не выдают одинаковые идентификаторы
+func TestConcurrentAllocatorsNoDuplicates(t *testing.T) {
+	const (
+		instances     = 4
+		workers       = 8
+		idsPerWorker  = 250
+		leaseBlockLen = 7
+	)
+	fileStorage, err := storage.NewURLFileStorage(filepath.Join(t.TempDir(), "storage"))
+	require.NoError(t, err)
+	db := storage.NewURLStorage(fileStorage)
+
+	var mu sync.Mutex
+	seen := make(map[uint64]struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < instances; i++ {
+		allocator := NewIDAllocator(db, leaseBlockLen)
+		for j := 0; j < workers; j++ {
+			wg.Add(1)
+			go func(allocator *IDAllocator) {
+				defer wg.Done()
+				for k := 0; k < idsPerWorker; k++ {
+					id, err := allocator.NextID(context.Background())
+					require.NoError(t, err)
+					mu.Lock()
+					_, duplicate := seen[id]
+					seen[id] = struct{}{}
+					mu.Unlock()
+					require.False(t, duplicate, "duplicate id %d", id)
+				}
+			}(allocator)
+		}
+	}
+	wg.Wait()
+	require.Len(t, seen, instances*workers*idsPerWorker)
+}
+
+// TestAllocatorDoesNotReuseRangeAfterRestart остаток блока после перезапуска не переиспользуется
+func TestAllocatorDoesNotReuseRangeAfterRestart(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "storage")
+	fileStorage, err := storage.NewURLFileStorage(filePath)
+	require.NoError(t, err)
+	allocator := NewIDAllocator(storage.NewURLStorage(fileStorage), 100)
+
+	var lastID uint64
+	for i := 0; i < 3; i++ {
+		lastID, err = allocator.NextID(context.Background())
+		require.NoError(t, err)
+	}
+	require.NoError(t, fileStorage.Shutdown(context.Background()))
+
+	fileStorage, err = storage.NewURLFileStorage(filePath)
+	require.NoError(t, err)
+	allocator = NewIDAllocator(storage.NewURLStorage(fileStorage), 100)
+	id, err := allocator.NextID(context.Background())
+	require.NoError(t, err)
+	require.Greater(t, id, lastID+97, "unused part of the leased block was reused")
+}
+
+func TestEncodeBase62(t *testing.T) {
+	tests := []struct {
+		value    uint64
+		expected string
+	}{
+		{value: 0, expected: "0"},
+		{value: 61, expected: "z"},
+		{value: 62, expected: "10"},
+		{value: 3843, expected: "zz"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, encodeBase62(tt.value))
+	}
+}
+
+// TestSaveDataWithIDAllocator в режиме счетчика одинаковые ссылки получают разные идентификаторы
+func TestSaveDataWithIDAllocator(t *testing.T) {
+	db := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(db, config.BaseURL, WithIDAllocator(NewIDAllocator(db, 10)))
+
+	first, err := shortener.SaveData(context.Background(), "user", "https://github.com")
+	require.NoError(t, err)
+	second, err := shortener.SaveData(context.Background(), "user", "https://github.com")
+	require.NoError(t, err)
+	require.Equal(t, config.BaseURL+"/1/", first)
+	require.Equal(t, config.BaseURL+"/2/", second)
+}
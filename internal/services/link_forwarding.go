@@ -0,0 +1,67 @@
+package services
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// Что делать с параметром запроса, который уже есть в адресе ссылки
+const (
+	// QueryConflictKeep остается значение из адреса ссылки, используется по умолчанию
+	QueryConflictKeep = "keep"
+	// QueryConflictOverride значение из запроса заменяет значение из адреса
+	QueryConflictOverride = "override"
+	// QueryConflictAppend сохраняются оба значения
+	QueryConflictAppend = "append"
+)
+
+func validateForwarding(opts LinkOptions) error {
+	switch opts.QueryConflict {
+	case "", QueryConflictKeep, QueryConflictOverride, QueryConflictAppend:
+		return nil
+	}
+	return LinkValidationError{Reason: "query_conflict must be keep, override or append"}
+}
+
+// forwardRequest дописывает к адресу перехода путь после идентификатора ссылки и параметры
+// запроса, если ссылка это разрешает
+func forwardRequest(destination string, settings storage.LinkSettings, request RedirectRequest) (string, error) {
+	forwardPath := settings.ForwardPath && request.Path != ""
+	forwardQuery := settings.ForwardQuery && len(request.Query) > 0
+	if !forwardPath && !forwardQuery {
+		return destination, nil
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	if forwardPath {
+		// Clean от корня не дает выйти из пути адреса через ".."
+		suffix := path.Clean("/" + request.Path)
+		if strings.HasSuffix(request.Path, "/") && suffix != "/" {
+			suffix += "/"
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + suffix
+		u.RawPath = ""
+	}
+	if forwardQuery {
+		u.RawQuery = mergeQuery(u.Query(), request.Query, settings.QueryConflict).Encode()
+	}
+	return u.String(), nil
+}
+
+func mergeQuery(query, incoming url.Values, conflict string) url.Values {
+	for key, values := range incoming {
+		_, exists := query[key]
+		switch {
+		case !exists, conflict == QueryConflictOverride:
+			query[key] = values
+		case conflict == QueryConflictAppend:
+			query[key] = append(query[key], values...)
+		}
+	}
+	return query
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestForwardRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		settings    storage.LinkSettings
+		path        string
+		query       string
+		want        string
+	}{
+		{
+			name:        "Forwarding disabled",
+			destination: "https://docs.example.com/guide",
+			query:       "utm_source=mail",
+			want:        "https://docs.example.com/guide",
+		},
+		{
+			name:        "Path",
+			destination: "https://docs.example.com/guide/",
+			settings:    storage.LinkSettings{ForwardPath: true},
+			path:        "docs/x",
+			want:        "https://docs.example.com/guide/docs/x",
+		},
+		{
+			name:        "Path keeps trailing slash and destination query",
+			destination: "https://docs.example.com/guide?lang=en",
+			settings:    storage.LinkSettings{ForwardPath: true},
+			path:        "docs/",
+			want:        "https://docs.example.com/guide/docs/?lang=en",
+		},
+		{
+			name:        "Path can not leave destination",
+			destination: "https://docs.example.com/guide",
+			settings:    storage.LinkSettings{ForwardPath: true},
+			path:        "../../admin",
+			want:        "https://docs.example.com/guide/admin",
+		},
+		{
+			name:        "Path is escaped",
+			destination: "https://docs.example.com",
+			settings:    storage.LinkSettings{ForwardPath: true},
+			path:        "a b",
+			want:        "https://docs.example.com/a%20b",
+		},
+		{
+			name:        "Query keeps destination values",
+			destination: "https://example.com/?ref=link",
+			settings:    storage.LinkSettings{ForwardQuery: true},
+			query:       "ref=mail&page=2",
+			want:        "https://example.com/?page=2&ref=link",
+		},
+		{
+			name:        "Query overrides destination values",
+			destination: "https://example.com/?ref=link",
+			settings:    storage.LinkSettings{ForwardQuery: true, QueryConflict: QueryConflictOverride},
+			query:       "ref=mail&page=2",
+			want:        "https://example.com/?page=2&ref=mail",
+		},
+		{
+			name:        "Query appends values",
+			destination: "https://example.com/?tag=a",
+			settings:    storage.LinkSettings{ForwardQuery: true, QueryConflict: QueryConflictAppend},
+			query:       "tag=b",
+			want:        "https://example.com/?tag=a&tag=b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			got, err := forwardRequest(tt.destination, tt.settings, RedirectRequest{Path: tt.path, Query: query})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLinkPathWithoutForwarding(t *testing.T) {
+	ctx := context.Background()
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	shortURL, err := shortener.SaveData(ctx, "user", "https://docs.example.com")
+	require.NoError(t, err)
+
+	_, err = shortener.GetRedirect(ctx, shortURL, RedirectRequest{Path: "docs"})
+	require.ErrorAs(t, err, &OriginalURLNotFound{})
+	_, err = shortener.CreateLink(ctx, "user", "https://docs.example.org", LinkOptions{ForwardQuery: true, QueryConflict: "merge"})
+	require.ErrorAs(t, err, &LinkValidationError{})
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/maxsnegir/url-shortener/internal/ratelimit"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// По умолчанию после linkPasswordAttempts неверных паролей ссылка блокируется на linkPasswordLockout
+const (
+	linkPasswordAttempts = 10
+	linkPasswordLockout  = 5 * time.Minute
+)
+
+// WithLinkPasswordAttempts сколько неверных паролей к одной ссылке принимается за lockout,
+// прежде чем попытки блокируются на тот же срок
+func WithLinkPasswordAttempts(maxAttempts int, lockout time.Duration) Option {
+	return func(s *shortener) {
+		s.passwordGuard = newPasswordGuard(maxAttempts, lockout)
+	}
+}
+
+func newPasswordGuard(maxAttempts int, lockout time.Duration) *ratelimit.Guard {
+	return ratelimit.NewGuard(ratelimit.GuardConfig{Window: lockout, BlockAfter: maxAttempts, BlockFor: lockout})
+}
+
+func hashLinkPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkLinkPassword пароль проверяется только до блокировки: подбор упирается в лимит
+// попыток, а не в скорость bcrypt
+func (s *shortener) checkLinkPassword(settings storage.LinkSettings, password string) error {
+	if settings.PasswordHash == "" {
+		return nil
+	}
+	if password == "" {
+		return LinkPasswordRequiredError{URLID: settings.ShortURL}
+	}
+	if _, blockedFor := s.passwordGuard.Check(settings.ShortURL); blockedFor > 0 {
+		return LinkLockedError{URLID: settings.ShortURL, RetryAfter: blockedFor}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(settings.PasswordHash), []byte(password)) != nil {
+		s.passwordGuard.Fail(settings.ShortURL)
+		return WrongLinkPasswordError{URLID: settings.ShortURL}
+	}
+	return nil
+}
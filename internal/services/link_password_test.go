@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestLinkPassword(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(DB, config.BaseURL, WithLinkPasswordAttempts(2, time.Minute))
+
+	shortURL, err := shortener.CreateLink(ctx, "user", "https://docs.example.com", LinkOptions{Password: "secret"})
+	require.NoError(t, err)
+	settings, err := DB.GetLinkSettings(ctx, shortURL)
+	require.NoError(t, err)
+	require.NotEmpty(t, settings.PasswordHash)
+	require.NotContains(t, settings.PasswordHash, "secret")
+
+	_, err = shortener.GetOriginalURL(ctx, shortURL)
+	require.ErrorAs(t, err, &LinkPasswordRequiredError{})
+	redirect, err := shortener.GetRedirect(ctx, shortURL, RedirectRequest{Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, Redirect{URL: "https://docs.example.com", StatusCode: 307, NoStore: true}, redirect)
+
+	_, err = shortener.GetRedirect(ctx, shortURL, RedirectRequest{Password: "guess"})
+	require.ErrorAs(t, err, &WrongLinkPasswordError{})
+	_, err = shortener.GetRedirect(ctx, shortURL, RedirectRequest{Password: "guess"})
+	require.ErrorAs(t, err, &WrongLinkPasswordError{})
+	// После блокировки не принимается и верный пароль
+	_, err = shortener.GetRedirect(ctx, shortURL, RedirectRequest{Password: "secret"})
+	var lockedErr LinkLockedError
+	require.ErrorAs(t, err, &lockedErr)
+	require.Equal(t, time.Minute, lockedErr.RetryAfter.Round(time.Second))
+
+	_, err = shortener.CreateLink(ctx, "user", "https://docs.example.com/2", LinkOptions{Password: string(make([]byte, 73))})
+	require.ErrorAs(t, err, &LinkValidationError{})
+}
+
+// TestPasswordLinkForShortenedURL ссылка с паролем на уже сокращенный URL получает свой
+// идентификатор, а прежняя ссылка остается без пароля
+func TestPasswordLinkForShortenedURL(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(DB, config.BaseURL)
+
+	plainURL, err := shortener.SaveData(ctx, "user", "https://docs.example.com")
+	require.NoError(t, err)
+	protectedURL, err := shortener.CreateLink(ctx, "user", "https://docs.example.com", LinkOptions{Password: "secret"})
+	require.NoError(t, err)
+	require.NotEqual(t, plainURL, protectedURL)
+	require.Len(t, protectedURL, len(plainURL))
+
+	_, err = shortener.GetOriginalURL(ctx, protectedURL)
+	require.ErrorAs(t, err, &LinkPasswordRequiredError{})
+	originalURL, err := shortener.GetOriginalURL(ctx, plainURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://docs.example.com", originalURL)
+}
+
+// settingsFailStorage хранилище, которое не может сохранить настройки ссылки
+type settingsFailStorage struct {
+	storage.ShortenerStorage
+}
+
+func (s settingsFailStorage) SaveLinkSettings(ctx context.Context, settings storage.LinkSettings) error {
+	return errors.New("settings are not saved")
+}
+
+// TestLinkWithoutSavedSettingsIsDeleted ссылка с паролем не остается доступной без пароля,
+// если ее настройки не сохранились
+func TestLinkWithoutSavedSettingsIsDeleted(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(settingsFailStorage{DB}, config.BaseURL)
+
+	_, err := shortener.CreateLink(ctx, "user", "https://docs.example.com", LinkOptions{Password: "secret"})
+	require.Error(t, err)
+	urls, err := DB.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	require.Empty(t, urls)
+}
+
+// unavailableStorage основное хранилище, до которого нельзя достучаться при переходе по ссылке
+type unavailableStorage struct {
+	storage.ShortenerStorage
+}
+
+func (s unavailableStorage) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	return "", storage.CircuitOpenError
+}
+
+func (s unavailableStorage) GetLinkSettings(ctx context.Context, shortURL string) (storage.LinkSettings, error) {
+	return storage.LinkSettings{}, storage.CircuitOpenError
+}
+
+func (s unavailableStorage) GetCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	return storage.Campaign{}, storage.CircuitOpenError
+}
+
+func (s unavailableStorage) GetLinkPatterns(ctx context.Context) ([]storage.LinkPattern, error) {
+	return nil, storage.CircuitOpenError
+}
+
+// TestLinkSettingsInDegradedMode пока база недоступна, отключенная ссылка и ссылка
+// с паролем из снимка работают так же, как с базой
+func TestLinkSettingsInDegradedMode(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(DB, config.BaseURL)
+
+	disabledURL, err := shortener.CreateLink(ctx, "user", "https://disabled.example.com", LinkOptions{})
+	require.NoError(t, err)
+	require.NoError(t, DB.SaveLinkSettings(ctx, storage.LinkSettings{ShortURL: disabledURL, Disabled: true}))
+	protectedURL, err := shortener.CreateLink(ctx, "user", "https://docs.example.com", LinkOptions{Password: "secret"})
+	require.NoError(t, err)
+	plainURL, err := shortener.CreateLink(ctx, "user", "https://github.com", LinkOptions{})
+	require.NoError(t, err)
+
+	fallback, err := storage.NewFallbackStorage(unavailableStorage{DB}, DB, filepath.Join(t.TempDir(), "snapshot"), time.Hour)
+	require.NoError(t, err)
+	defer fallback.Shutdown(ctx)
+	degraded := NewShortener(fallback, config.BaseURL)
+
+	_, err = degraded.GetRedirect(ctx, disabledURL, RedirectRequest{})
+	require.ErrorAs(t, err, &LinkDisabledError{})
+	_, err = degraded.GetRedirect(ctx, protectedURL, RedirectRequest{})
+	require.ErrorAs(t, err, &LinkPasswordRequiredError{})
+	_, err = degraded.GetRedirect(ctx, protectedURL, RedirectRequest{Password: "guess"})
+	require.ErrorAs(t, err, &WrongLinkPasswordError{})
+	redirect, err := degraded.GetRedirect(ctx, protectedURL, RedirectRequest{Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, "https://docs.example.com", redirect.URL)
+	redirect, err = degraded.GetRedirect(ctx, plainURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com", redirect.URL)
+}
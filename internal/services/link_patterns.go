@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// maxPatternSegments ограничение на длину пути ссылки-шаблона
+const maxPatternSegments = 10
+
+// patternCacheTTL через сколько разобранные шаблоны перечитываются из хранилища: шаблоны,
+// созданные или удаленные на других экземплярах сервиса, начинают действовать с этой задержкой
+const patternCacheTTL = 30 * time.Second
+
+// reservedPatternPrefixes первые сегменты, которые заняты маршрутами сервиса
+var reservedPatternPrefixes = map[string]bool{"api": true, "ping": true}
+
+var placeholderName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// templatePlaceholder параметр в адресе шаблона, имя проверяется при создании
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// patternSegment сегмент пути шаблона: постоянный текст или параметр
+type patternSegment struct {
+	literal     string
+	placeholder string
+}
+
+// parsedPattern шаблон, разобранный для сравнения с путем перехода
+type parsedPattern struct {
+	segments []patternSegment
+	template string
+}
+
+// patternCache разобранные шаблоны, чтобы не читать и не разбирать их при каждом переходе.
+// generation увеличивается при сбросе, и загрузка, начатая до сброса, кеш не заполняет.
+type patternCache struct {
+	mu         sync.Mutex
+	patterns   []parsedPattern
+	loadedAt   time.Time
+	loaded     bool
+	generation int
+}
+
+// parsePattern разбирает путь вида "gh/{user}/{repo}". Первый сегмент всегда постоянный,
+// чтобы шаблоны не перехватывали обычные ссылки, и должен быть хотя бы один параметр.
+func parsePattern(pattern string) ([]patternSegment, error) {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	if len(parts) < 2 || len(parts) > maxPatternSegments {
+		return nil, LinkValidationError{Reason: "Pattern must have from 2 to 10 segments"}
+	}
+	segments := make([]patternSegment, 0, len(parts))
+	names := make(map[string]bool)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name := part[1 : len(part)-1]
+			if !placeholderName.MatchString(name) {
+				return nil, LinkValidationError{Reason: "Placeholder name must be a letter or _ followed by letters, digits or _"}
+			}
+			if i == 0 {
+				return nil, LinkValidationError{Reason: "Pattern must start with a literal segment"}
+			}
+			if names[name] {
+				return nil, LinkValidationError{Reason: "Placeholder {" + name + "} is used twice"}
+			}
+			names[name] = true
+			segments = append(segments, patternSegment{placeholder: name})
+			continue
+		}
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, "{}?#") {
+			return nil, LinkValidationError{Reason: "Pattern segment " + part + " is not valid"}
+		}
+		segments = append(segments, patternSegment{literal: part})
+	}
+	if reservedPatternPrefixes[segments[0].literal] {
+		return nil, LinkValidationError{Reason: "Pattern prefix " + segments[0].literal + " is reserved"}
+	}
+	if len(names) == 0 {
+		return nil, LinkValidationError{Reason: "Pattern must have at least one placeholder"}
+	}
+	return segments, nil
+}
+
+// patternShape путь без имен параметров: шаблоны "gh/{user}" и "gh/{name}" совпадают
+// с одними и теми же адресами, поэтому одновременно существовать не могут
+func patternShape(segments []patternSegment) string {
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if segment.placeholder != "" {
+			parts = append(parts, "{}")
+			continue
+		}
+		parts = append(parts, segment.literal)
+	}
+	return strings.Join(parts, "/")
+}
+
+// validateTemplate адрес должен быть допустимым, а параметры - заданы в пути шаблона
+// и стоять в пути, запросе или фрагменте: подставлять значения в схему и хост нельзя
+func (s *shortener) validateTemplate(template string, segments []patternSegment) error {
+	names := make(map[string]bool)
+	for _, segment := range segments {
+		if segment.placeholder != "" {
+			names[segment.placeholder] = true
+		}
+	}
+	for _, match := range templatePlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		name := template[match[2]:match[3]]
+		if !names[name] {
+			return LinkValidationError{Reason: "Placeholder {" + name + "} is not defined in the pattern"}
+		}
+		if match[0] < authorityEnd(template) {
+			return LinkValidationError{Reason: "Placeholders are not allowed in the scheme or host"}
+		}
+	}
+	return s.IsURLValid(templatePlaceholder.ReplaceAllString(template, "x"))
+}
+
+// authorityEnd позиция, с которой в адресе начинается путь, запрос или фрагмент
+func authorityEnd(template string) int {
+	start := strings.Index(template, "://")
+	if start < 0 {
+		return len(template)
+	}
+	start += len("://")
+	if end := strings.IndexAny(template[start:], "/?#"); end >= 0 {
+		return start + end
+	}
+	return len(template)
+}
+
+// CreateLinkPattern создает ссылку-шаблон, доступно только администраторам
+func (s *shortener) CreateLinkPattern(ctx context.Context, userToken, pattern, template string) (storage.LinkPattern, error) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		return storage.LinkPattern{}, err
+	}
+	if err := s.validateTemplate(template, segments); err != nil {
+		return storage.LinkPattern{}, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return storage.LinkPattern{}, err
+	}
+	linkPattern := storage.LinkPattern{
+		ID:        id,
+		Pattern:   "/" + strings.Trim(pattern, "/"),
+		Shape:     patternShape(segments),
+		Template:  template,
+		CreatedBy: userToken,
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.storage.SaveLinkPattern(ctx, linkPattern); err != nil {
+		if errors.Is(err, storage.ExistsError) {
+			return storage.LinkPattern{}, LinkPatternExistsError{Pattern: linkPattern.Pattern}
+		}
+		return storage.LinkPattern{}, err
+	}
+	s.resetPatterns()
+	return linkPattern, nil
+}
+
+func (s *shortener) GetLinkPatterns(ctx context.Context) ([]storage.LinkPattern, error) {
+	patterns, err := s.storage.GetLinkPatterns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].CreatedAt.Before(patterns[j].CreatedAt)
+	})
+	return patterns, nil
+}
+
+func (s *shortener) DeleteLinkPattern(ctx context.Context, id string) error {
+	err := s.storage.DeleteLinkPattern(ctx, id)
+	if errors.Is(err, storage.KeyError) {
+		return LinkPatternNotFoundError{ID: id}
+	}
+	if err == nil {
+		s.resetPatterns()
+	}
+	return err
+}
+
+func (s *shortener) resetPatterns() {
+	s.patterns.mu.Lock()
+	defer s.patterns.mu.Unlock()
+	s.patterns.patterns, s.patterns.loaded = nil, false
+	s.patterns.generation++
+}
+
+// parsedPatterns разобранные шаблоны из кеша, устаревший кеш перечитывается из хранилища
+func (s *shortener) parsedPatterns(ctx context.Context) ([]parsedPattern, error) {
+	cache := &s.patterns
+	cache.mu.Lock()
+	if cache.loaded && s.now().Sub(cache.loadedAt) < patternCacheTTL {
+		patterns := cache.patterns
+		cache.mu.Unlock()
+		return patterns, nil
+	}
+	generation := cache.generation
+	cache.mu.Unlock()
+
+	linkPatterns, err := s.storage.GetLinkPatterns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	patterns := make([]parsedPattern, 0, len(linkPatterns))
+	for _, linkPattern := range linkPatterns {
+		segments, err := parsePattern(linkPattern.Pattern)
+		if err != nil {
+			continue
+		}
+		patterns = append(patterns, parsedPattern{segments: segments, template: linkPattern.Template})
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.generation == generation {
+		cache.patterns, cache.loadedAt, cache.loaded = patterns, s.now(), true
+	}
+	return patterns, nil
+}
+
+// MatchLinkPattern ищет шаблон для пути перехода без начального "/". Из подходящих
+// шаблонов выбирается самый конкретный: сегменты сравниваются слева направо, и при первом
+// различии постоянный сегмент побеждает параметр, так "gh/new/{repo}" важнее "gh/{user}/{repo}".
+func (s *shortener) MatchLinkPattern(ctx context.Context, requestPath string) (Redirect, bool, error) {
+	parts := strings.Split(strings.Trim(requestPath, "/"), "/")
+	if len(parts) < 2 || len(parts) > maxPatternSegments {
+		return Redirect{}, false, nil
+	}
+	patterns, err := s.parsedPatterns(ctx)
+	if err != nil {
+		return Redirect{}, false, err
+	}
+	var best []patternSegment
+	var bestTemplate string
+	for _, pattern := range patterns {
+		if !matchSegments(pattern.segments, parts) {
+			continue
+		}
+		if best == nil || moreSpecific(pattern.segments, best) {
+			best, bestTemplate = pattern.segments, pattern.template
+		}
+	}
+	if best == nil {
+		return Redirect{}, false, nil
+	}
+	values := make(map[string]string)
+	for i, segment := range best {
+		if segment.placeholder != "" {
+			values[segment.placeholder] = parts[i]
+		}
+	}
+	return Redirect{URL: expandTemplate(bestTemplate, values), StatusCode: s.redirectCode}, true, nil
+}
+
+func matchSegments(segments []patternSegment, parts []string) bool {
+	if len(segments) != len(parts) {
+		return false
+	}
+	for i, segment := range segments {
+		if segment.placeholder == "" && segment.literal != parts[i] {
+			return false
+		}
+		// Пустые значения и переходы по каталогам в адрес не подставляются
+		if segment.placeholder != "" && (parts[i] == "" || parts[i] == "." || parts[i] == "..") {
+			return false
+		}
+	}
+	return true
+}
+
+func moreSpecific(segments, than []patternSegment) bool {
+	for i := range segments {
+		isLiteral, thanLiteral := segments[i].placeholder == "", than[i].placeholder == ""
+		if isLiteral != thanLiteral {
+			return isLiteral
+		}
+	}
+	return false
+}
+
+// expandTemplate подставляет значения параметров с экранированием по месту в адресе,
+// поэтому значение не может добавить в адрес сегменты пути, параметры запроса или фрагмент
+func expandTemplate(template string, values map[string]string) string {
+	queryStart, fragmentStart := len(template), len(template)
+	// Параметры не содержат "?" и "#", поэтому их позиции в шаблоне однозначны
+	if i := strings.IndexByte(template, '#'); i >= 0 {
+		fragmentStart = i
+	}
+	if i := strings.IndexByte(template[:fragmentStart], '?'); i >= 0 {
+		queryStart = i
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range templatePlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		b.WriteString(template[last:match[0]])
+		value := values[template[match[2]:match[3]]]
+		if match[0] >= queryStart && match[0] < fragmentStart {
+			b.WriteString(url.QueryEscape(value))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+		last = match[1]
+	}
+	b.WriteString(template[last:])
+	return b.String()
+}
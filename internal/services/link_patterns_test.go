@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestCreateLinkPatternValidation(t *testing.T) {
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	tests := []struct {
+		name     string
+		pattern  string
+		template string
+	}{
+		{name: "No placeholders", pattern: "/gh/user", template: "https://github.com/user"},
+		{name: "Single segment", pattern: "/{user}", template: "https://github.com/{user}"},
+		{name: "Starts with placeholder", pattern: "/{org}/{user}", template: "https://github.com/{user}"},
+		{name: "Reserved prefix", pattern: "/api/{user}", template: "https://github.com/{user}"},
+		{name: "Bad placeholder name", pattern: "/gh/{user-name}", template: "https://github.com/x"},
+		{name: "Duplicate placeholder", pattern: "/gh/{user}/{user}", template: "https://github.com/{user}"},
+		{name: "Undefined placeholder", pattern: "/gh/{user}", template: "https://github.com/{repo}"},
+		{name: "Placeholder in host", pattern: "/gh/{user}", template: "https://{user}.github.io"},
+		{name: "Invalid URL", pattern: "/gh/{user}", template: "github.com/{user}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := shortener.CreateLinkPattern(context.Background(), "admin", tt.pattern, tt.template)
+			require.ErrorAs(t, err, new(LinkValidationError))
+		})
+	}
+}
+
+func TestMatchLinkPattern(t *testing.T) {
+	ctx := context.Background()
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	for pattern, template := range map[string]string{
+		"/gh/{user}":          "https://github.com/{user}",
+		"/gh/{user}/{repo}":   "https://github.com/{user}/{repo}",
+		"/gh/new/{repo}":      "https://github.com/new?name={repo}",
+		"/jira/{ticket}":      "https://jira.corp/browse/{ticket}#{ticket}",
+		"/search/{q}/{where}": "https://example.com/{where}?q={q}",
+	} {
+		_, err := shortener.CreateLinkPattern(ctx, "admin", pattern, template)
+		require.NoError(t, err)
+	}
+	_, err := shortener.CreateLinkPattern(ctx, "admin", "/gh/{name}", "https://gitlab.com/{name}")
+	require.ErrorAs(t, err, new(LinkPatternExistsError))
+
+	tests := []struct {
+		path    string
+		want    string
+		matched bool
+	}{
+		{path: "gh/octocat", want: "https://github.com/octocat", matched: true},
+		{path: "gh/octocat/hello", want: "https://github.com/octocat/hello", matched: true},
+		{path: "gh/new/hello", want: "https://github.com/new?name=hello", matched: true},
+		{path: "jira/OPS-1/", want: "https://jira.corp/browse/OPS-1#OPS-1", matched: true},
+		{path: "search/a&b=c d/docs", want: "https://example.com/docs?q=a%26b%3Dc+d", matched: true},
+		{path: "search/x/..", matched: false},
+		{path: "gh/a/b/c", matched: false},
+		{path: "gitlab/octocat", matched: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			redirect, matched, err := shortener.MatchLinkPattern(ctx, tt.path)
+			require.NoError(t, err)
+			require.Equal(t, tt.matched, matched)
+			require.Equal(t, tt.want, redirect.URL)
+		})
+	}
+}
+
+// TestLinkPatternsInDegradedMode пока база недоступна, шаблоны берутся из снимка
+func TestLinkPatternsInDegradedMode(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	_, err := NewShortener(DB, config.BaseURL).CreateLinkPattern(ctx, "admin", "/gh/{user}", "https://github.com/{user}")
+	require.NoError(t, err)
+
+	fallback, err := storage.NewFallbackStorage(unavailableStorage{DB}, DB, filepath.Join(t.TempDir(), "snapshot"), time.Hour)
+	require.NoError(t, err)
+	defer fallback.Shutdown(ctx)
+	redirect, matched, err := NewShortener(fallback, config.BaseURL).MatchLinkPattern(ctx, "gh/octocat")
+	require.NoError(t, err)
+	require.True(t, matched)
+	require.Equal(t, "https://github.com/octocat", redirect.URL)
+}
+
+// countingPatterns считает чтения шаблонов из хранилища
+type countingPatterns struct {
+	storage.ShortenerStorage
+	loads int
+}
+
+func (s *countingPatterns) GetLinkPatterns(ctx context.Context) ([]storage.LinkPattern, error) {
+	s.loads++
+	return s.ShortenerStorage.GetLinkPatterns(ctx)
+}
+
+// TestLinkPatternCache шаблоны не читаются из хранилища при каждом переходе; свои изменения
+// видны сразу, а изменения другого экземпляра сервиса - после patternCacheTTL
+func TestLinkPatternCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	DB := &countingPatterns{ShortenerStorage: storage.NewURLStorage(storage.NewMapStorage())}
+	clock := WithClock(func() time.Time {
+		return now
+	})
+	shortener, other := NewShortener(DB, config.BaseURL, clock), NewShortener(DB, config.BaseURL, clock)
+
+	match := func(path string) bool {
+		_, matched, err := shortener.MatchLinkPattern(ctx, path)
+		require.NoError(t, err)
+		return matched
+	}
+	linkPattern, err := shortener.CreateLinkPattern(ctx, "admin", "/gh/{user}", "https://github.com/{user}")
+	require.NoError(t, err)
+	require.True(t, match("gh/octocat"))
+	require.True(t, match("gh/hubot"))
+	require.Equal(t, 1, DB.loads)
+
+	require.NoError(t, shortener.DeleteLinkPattern(ctx, linkPattern.ID))
+	require.False(t, match("gh/octocat"), "own changes must apply at once")
+
+	_, err = other.CreateLinkPattern(ctx, "admin", "/gl/{user}", "https://gitlab.com/{user}")
+	require.NoError(t, err)
+	require.False(t, match("gl/octocat"))
+	now = now.Add(patternCacheTTL)
+	require.True(t, match("gl/octocat"), "cache must be reloaded after its ttl")
+}
+
+func TestExpandTemplateEscaping(t *testing.T) {
+	template := "https://example.com/u/{v}?q={v}#{v}"
+	require.Equal(t, "https://example.com/u/a%3Fb=c%23d?q=a%3Fb%3Dc%23d#a%3Fb=c%23d",
+		expandTemplate(template, map[string]string{"v": "a?b=c#d"}))
+	require.Equal(t, "https://example.com/u/..%2Fadmin?q=..%2Fadmin#..%2Fadmin",
+		expandTemplate(template, map[string]string{"v": "../admin"}))
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// maxNotActiveMessageLength ограничение на текст, который ссылка показывает до активации
+const maxNotActiveMessageLength = 1024
+
+// maxScheduleEntries ограничение на число смен адреса одной ссылки, расписание просматривается при каждом переходе
+const maxScheduleEntries = 50
+
+// validateSchedule время активации и расписание смены адреса новой ссылки
+func (s *shortener) validateSchedule(opts LinkOptions) error {
+	if len(opts.NotActiveMessage) > maxNotActiveMessageLength {
+		return LinkValidationError{Reason: "not_active_message must be at most 1024 characters long"}
+	}
+	if len(opts.Schedule) > maxScheduleEntries {
+		return LinkValidationError{Reason: "A link can have at most 50 scheduled destinations"}
+	}
+	for _, destination := range opts.Schedule {
+		if destination.At.IsZero() {
+			return LinkValidationError{Reason: "Scheduled destination must have a time"}
+		}
+		if err := s.IsURLValid(destination.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSchedule копия расписания в UTC, упорядоченная по времени
+func newSchedule(schedule []storage.ScheduledDestination) []storage.ScheduledDestination {
+	if len(schedule) == 0 {
+		return nil
+	}
+	sorted := make([]storage.ScheduledDestination, 0, len(schedule))
+	for _, destination := range schedule {
+		sorted = append(sorted, storage.ScheduledDestination{At: destination.At.UTC(), URL: destination.URL})
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].At.Before(sorted[j].At)
+	})
+	return sorted
+}
+
+// checkNotBefore ссылка с временем активации до него не перенаправляет
+func checkNotBefore(settings storage.LinkSettings, now time.Time) error {
+	if settings.NotBefore == nil || !now.Before(*settings.NotBefore) {
+		return nil
+	}
+	return LinkNotActiveError{
+		URLID:      settings.ShortURL,
+		Message:    settings.NotActiveMessage,
+		RetryAfter: settings.NotBefore.Sub(now),
+	}
+}
+
+// scheduledDestination адрес ссылки в момент now: последний из наступивших по расписанию
+// или исходный URL. pending - впереди есть еще смены адреса.
+func scheduledDestination(originalURL string, schedule []storage.ScheduledDestination, now time.Time) (url string, pending bool) {
+	url = originalURL
+	for _, destination := range schedule {
+		if now.Before(destination.At) {
+			return url, true
+		}
+		url = destination.URL
+	}
+	return url, false
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestLinkSchedule(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	launch := now.Add(24 * time.Hour)
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL, WithClock(func() time.Time {
+		return now
+	}))
+
+	// Тизер до запуска, страница продукта после него; расписание можно передать в любом порядке
+	shortURL, err := shortener.CreateLink(ctx, "user", "https://example.com/teaser", LinkOptions{
+		Schedule: []storage.ScheduledDestination{
+			{At: launch.Add(24 * time.Hour), URL: "https://example.com/sale"},
+			{At: launch, URL: "https://example.com/product"},
+		},
+	})
+	require.NoError(t, err)
+	redirect, err := shortener.GetRedirect(ctx, shortURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, Redirect{URL: "https://example.com/teaser", StatusCode: 307, NoStore: true}, redirect)
+
+	now = launch
+	originalURL, err := shortener.GetOriginalURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/product", originalURL)
+
+	now = launch.Add(48 * time.Hour)
+	redirect, err = shortener.GetRedirect(ctx, shortURL, RedirectRequest{})
+	require.NoError(t, err)
+	require.Equal(t, Redirect{URL: "https://example.com/sale", StatusCode: 307}, redirect)
+
+	_, err = shortener.CreateLink(ctx, "user", "https://example.com/teaser", LinkOptions{
+		Schedule: []storage.ScheduledDestination{{At: launch, URL: "product"}},
+	})
+	require.ErrorAs(t, err, &URLIsNotValidError{})
+
+	schedule := make([]storage.ScheduledDestination, maxScheduleEntries+1)
+	for i := range schedule {
+		schedule[i] = storage.ScheduledDestination{At: launch.Add(time.Duration(i) * time.Hour), URL: "https://example.com/product"}
+	}
+	_, err = shortener.CreateLink(ctx, "user", "https://example.com/teaser", LinkOptions{Schedule: schedule})
+	require.ErrorAs(t, err, &LinkValidationError{})
+	_, err = shortener.CreateLink(ctx, "user", "https://example.com/teaser", LinkOptions{Schedule: schedule[:maxScheduleEntries]})
+	require.NoError(t, err)
+}
+
+func TestLinkNotBefore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL, WithClock(func() time.Time {
+		return now
+	}))
+
+	shortURL, err := shortener.CreateLink(ctx, "user", "https://example.com/product", LinkOptions{
+		NotBefore:        now.Add(time.Hour),
+		NotActiveMessage: "Coming soon",
+		MaxClicks:        1,
+	})
+	require.NoError(t, err)
+	_, err = shortener.GetOriginalURL(ctx, shortURL)
+	var notActiveErr LinkNotActiveError
+	require.ErrorAs(t, err, &notActiveErr)
+	require.Equal(t, "Coming soon", notActiveErr.Error())
+	require.Equal(t, time.Hour, notActiveErr.RetryAfter)
+
+	// Переходы до активации не расходуют лимит
+	now = now.Add(time.Hour)
+	originalURL, err := shortener.GetOriginalURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/product", originalURL)
+}
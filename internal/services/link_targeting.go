@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// Платформы устройств, которые различают правила таргетинга
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+)
+
+// maxTargetingRules ограничение на число правил одной ссылки, все они проверяются при каждом переходе
+const maxTargetingRules = 50
+
+func (s *shortener) validateTargeting(rules []storage.TargetingRule) error {
+	if len(rules) > maxTargetingRules {
+		return LinkValidationError{Reason: "A link can have at most 50 targeting rules"}
+	}
+	for _, rule := range rules {
+		switch rule.Platform {
+		case "", PlatformIOS, PlatformAndroid, PlatformDesktop:
+		default:
+			return LinkValidationError{Reason: "Targeting platform must be ios, android or desktop"}
+		}
+		if rule.Platform == "" && rule.Language == "" && rule.Country == "" {
+			return LinkValidationError{Reason: "Targeting rule must have a platform, language or country"}
+		}
+		if err := s.IsURLValid(rule.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTargeting копия правил, коды стран хранятся в верхнем регистре
+func newTargeting(rules []storage.TargetingRule) []storage.TargetingRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	targeting := make([]storage.TargetingRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Country = strings.ToUpper(rule.Country)
+		targeting = append(targeting, rule)
+	}
+	return targeting
+}
+
+// matchTargeting адрес первого правила, все условия которого выполнены для перехода request
+func matchTargeting(rules []storage.TargetingRule, request RedirectRequest) (string, bool) {
+	for _, rule := range rules {
+		if rule.Platform != "" && rule.Platform != request.Platform {
+			continue
+		}
+		if rule.Language != "" && !matchLanguage(rule.Language, request.Language) {
+			continue
+		}
+		if rule.Country != "" && !strings.EqualFold(rule.Country, request.Country) {
+			continue
+		}
+		return rule.URL, true
+	}
+	return "", false
+}
+
+// matchLanguage язык без региона подходит для всех его регионов: "de" совпадает с "de-AT",
+// а "pt-BR" только с "pt-BR"
+func matchLanguage(ruleLanguage, language string) bool {
+	if len(language) > len(ruleLanguage) && language[len(ruleLanguage)] == '-' {
+		language = language[:len(ruleLanguage)]
+	}
+	return strings.EqualFold(ruleLanguage, language)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// maxLinkVariants ограничение на число адресов A/B-ссылки
+const maxLinkVariants = 10
+
+// variantRand выбор варианта не требует криптостойкости, но rand.Rand не потокобезопасен
+var variantRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func randomIntn(n int) int {
+	variantRand.Lock()
+	defer variantRand.Unlock()
+	return variantRand.Intn(n)
+}
+
+// LinkStats статистика переходов по ссылке
+type LinkStats struct {
+	ShortURL string `json:"short_url"`
+	// Clicks переходы, учтенные по вариантам
+	Clicks   int64          `json:"clicks"`
+	Variants []VariantStats `json:"variants,omitempty"`
+}
+
+// VariantStats переходы на один адрес A/B-ссылки, варианты нумеруются с единицы
+type VariantStats struct {
+	Variant int    `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Clicks  int64  `json:"clicks"`
+}
+
+func (s *shortener) validateVariants(variants []storage.LinkVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) < 2 || len(variants) > maxLinkVariants {
+		return LinkValidationError{Reason: "A/B link must have from 2 to 10 variants"}
+	}
+	for _, variant := range variants {
+		if variant.Weight <= 0 || variant.Weight > 1000 {
+			return LinkValidationError{Reason: "Variant weight must be from 1 to 1000"}
+		}
+		if err := s.IsURLValid(variant.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pickVariant номер варианта перехода. Вариант из cookie сохраняется, пока такой номер есть
+// у ссылки, иначе выбирается новый пропорционально весам.
+func (s *shortener) pickVariant(variants []storage.LinkVariant, sticky int) int {
+	if sticky >= 1 && sticky <= len(variants) {
+		return sticky
+	}
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	n := s.randIntn(total)
+	for i, variant := range variants {
+		if n < variant.Weight {
+			return i + 1
+		}
+		n -= variant.Weight
+	}
+	return len(variants)
+}
+
+// countVariantClick статистика не должна мешать переходу, поэтому ошибка счетчика не возвращается
+func (s *shortener) countVariantClick(ctx context.Context, shortURL string, variant int) {
+	_ = s.storage.AddVariantClick(ctx, shortURL, variant)
+}
+
+func (s *shortener) GetLinkStats(ctx context.Context, userToken, workspaceID, urlID string) (LinkStats, error) {
+	shortURL, err := s.ownedShortURL(ctx, userToken, workspaceID, urlID)
+	if err != nil {
+		return LinkStats{}, err
+	}
+	stats := LinkStats{ShortURL: shortURL}
+	settings, err := s.storage.GetLinkSettings(ctx, shortURL)
+	if err != nil || len(settings.Variants) == 0 {
+		return stats, err
+	}
+	clicks, err := s.storage.GetVariantClicks(ctx, shortURL)
+	if err != nil {
+		return stats, err
+	}
+	for i, variant := range settings.Variants {
+		stats.Variants = append(stats.Variants, VariantStats{
+			Variant: i + 1,
+			URL:     variant.URL,
+			Weight:  variant.Weight,
+			Clicks:  clicks[i+1],
+		})
+		stats.Clicks += clicks[i+1]
+	}
+	return stats, nil
+}
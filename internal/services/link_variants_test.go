@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestLinkVariants(t *testing.T) {
+	ctx := context.Background()
+	s := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL).(*shortener)
+	var n int
+	s.randIntn = func(total int) int {
+		require.Equal(t, 100, total)
+		return n
+	}
+
+	_, err := s.CreateLink(ctx, "user", "https://example.com", LinkOptions{
+		Variants: []storage.LinkVariant{{URL: "https://example.com/a", Weight: 100}},
+	})
+	require.ErrorAs(t, err, &LinkValidationError{})
+	shortURL, err := s.CreateLink(ctx, "user", "https://example.com", LinkOptions{
+		Variants: []storage.LinkVariant{{URL: "https://example.com/a", Weight: 70}, {URL: "https://example.com/b", Weight: 30}},
+	})
+	require.NoError(t, err)
+	urlID := shortURL[len(config.BaseURL)+1 : len(shortURL)-1]
+	variantURLs := []string{"https://example.com/a", "https://example.com/b"}
+
+	for _, tt := range []struct {
+		n       int
+		sticky  int
+		variant int
+	}{
+		{n: 0, variant: 1},
+		{n: 69, variant: 1},
+		{n: 70, variant: 2},
+		{n: 99, variant: 2},
+		// Вариант из cookie сохраняется, несуществующий выбирается заново
+		{n: 0, sticky: 2, variant: 2},
+		{n: 99, sticky: 3, variant: 2},
+	} {
+		n = tt.n
+		redirect, err := s.GetRedirect(ctx, shortURL, RedirectRequest{Variant: tt.sticky})
+		require.NoError(t, err)
+		require.Equal(t, tt.variant, redirect.Variant)
+		require.Equal(t, variantURLs[tt.variant-1], redirect.URL)
+		require.True(t, redirect.NoStore)
+	}
+
+	stats, err := s.GetLinkStats(ctx, "user", "", urlID)
+	require.NoError(t, err)
+	require.Equal(t, LinkStats{
+		ShortURL: shortURL,
+		Clicks:   6,
+		Variants: []VariantStats{
+			{Variant: 1, URL: "https://example.com/a", Weight: 70, Clicks: 2},
+			{Variant: 2, URL: "https://example.com/b", Weight: 30, Clicks: 4},
+		},
+	}, stats)
+	_, err = s.GetLinkStats(ctx, "other", "", urlID)
+	require.ErrorAs(t, err, &OriginalURLNotFound{})
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// legacyRedirectCode код ссылок без сохраненного кода: так отвечали все ссылки до появления настройки
+const legacyRedirectCode = http.StatusTemporaryRedirect
+
+// LinkOptions параметры новой ссылки сверх исходного URL
+type LinkOptions struct {
+	// WorkspaceID ссылка создается в пространстве, нужна роль editor
+	WorkspaceID string
+	// Private длинный случайный идентификатор, доступен в режиме приватных ссылок
+	Private bool
+	// RedirectCode код ответа при переходе, ноль - код сервиса по умолчанию
+	RedirectCode int
+	// Password переход выполняется только после ввода пароля
+	Password string
+	// MaxClicks число переходов, после которого ссылка отвечает 410, ноль - без ограничения.
+	// Ссылка с MaxClicks = 1 одноразовая.
+	MaxClicks int64
+	// NotBefore до этого времени вместо перехода показывается NotActiveMessage
+	NotBefore        time.Time
+	NotActiveMessage string
+	// Schedule с указанного времени ссылка ведет на другой адрес
+	Schedule []storage.ScheduledDestination
+	// Targeting адреса для отдельных устройств, языков и стран; первое подходящее правило
+	// заменяет исходный URL
+	Targeting []storage.TargetingRule
+	// Variants адреса A/B-теста с весами, заменяют исходный URL
+	Variants []storage.LinkVariant
+	// ForwardPath путь после идентификатора ссылки дописывается к адресу
+	ForwardPath bool
+	// ForwardQuery параметры запроса переносятся в адрес; QueryConflict - keep, override или append
+	ForwardQuery  bool
+	QueryConflict string
+	// CampaignID переходы получают UTM-метки кампании того же владельца
+	CampaignID string
+}
+
+// customized заданы параметры ссылки сверх исходного URL и пространства
+func (opts LinkOptions) customized() bool {
+	opts.WorkspaceID = ""
+	return !reflect.DeepEqual(opts, LinkOptions{})
+}
+
+// RedirectRequest данные перехода, от которых зависит его результат
+type RedirectRequest struct {
+	// Password пароль защищенной ссылки
+	Password string
+	// Platform платформа устройства по User-Agent, пустая - не удалось определить
+	Platform string
+	// Language самый предпочтительный язык из Accept-Language
+	Language string
+	// Country код страны, который передал прокси или CDN
+	Country string
+	// Variant номер варианта A/B-ссылки, на который посетитель уже переходил, ноль - нет
+	Variant int
+	// Path путь после идентификатора ссылки, без начального "/"
+	Path string
+	// Query параметры запроса перехода
+	Query url.Values
+	// Head запрос HEAD: переход не засчитывается ни в лимит, ни в статистику вариантов.
+	// Ссылка с лимитом переходов на него не раскрывает адрес: исчерпанная отвечает
+	// LinkExhaustedError, остальные - ответом 204 без адреса.
+	Head bool
+}
+
+// Redirect куда и с каким кодом перенаправить переход по ссылке.
+// Пустой URL - ответ без перенаправления и заголовка Location.
+type Redirect struct {
+	URL        string
+	StatusCode int
+	// NoStore ответ нельзя кешировать: ссылка защищена паролем, ограничена числом
+	// переходов, ее адрес сменится по расписанию или получает метки кампании,
+	// которую могут изменить в любой момент
+	NoStore bool
+	// Variant выбранный вариант A/B-ссылки, ноль - ссылка без вариантов
+	Variant int
+}
+
+// IsRedirectCodeValid ссылка может отвечать только кодами перенаправления с заголовком Location
+func IsRedirectCodeValid(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// WithRedirectCode код ответа новых ссылок, для которых код не задан при создании.
+// Уже созданные ссылки без сохраненного кода по-прежнему отвечают 307.
+func WithRedirectCode(code int) Option {
+	return func(s *shortener) {
+		s.redirectCode = code
+	}
+}
+
+func (s *shortener) CreateLink(ctx context.Context, userToken, url string, opts LinkOptions) (string, error) {
+	if opts.Private && !s.privateLinks {
+		return "", PrivateLinksDisabledError{}
+	}
+	if opts.RedirectCode != 0 && !IsRedirectCodeValid(opts.RedirectCode) {
+		return "", RedirectCodeNotValidError{Code: opts.RedirectCode}
+	}
+	if len(opts.Password) > maxPasswordLength {
+		return "", LinkValidationError{Reason: "Password must be at most 72 characters long"}
+	}
+	if opts.MaxClicks < 0 {
+		return "", LinkValidationError{Reason: "max_clicks must not be negative"}
+	}
+	if err := s.validateSchedule(opts); err != nil {
+		return "", err
+	}
+	if err := s.validateTargeting(opts.Targeting); err != nil {
+		return "", err
+	}
+	if err := s.validateVariants(opts.Variants); err != nil {
+		return "", err
+	}
+	if err := validateForwarding(opts); err != nil {
+		return "", err
+	}
+	owner, err := s.owner(ctx, userToken, opts.WorkspaceID, WorkspaceEditor)
+	if err != nil {
+		return "", err
+	}
+	if opts.CampaignID != "" {
+		if _, err := s.ownedCampaign(ctx, owner, opts.CampaignID); err != nil {
+			return "", err
+		}
+	}
+	return s.saveData(ctx, userToken, owner, url, opts)
+}
+
+// newLinkSettings настройки новой ссылки и признак того, что их нужно сохранить
+func (s *shortener) newLinkSettings(shortURL string, opts LinkOptions) (storage.LinkSettings, bool, error) {
+	settings := storage.LinkSettings{
+		ShortURL:     shortURL,
+		Private:      opts.Private,
+		RedirectCode: opts.RedirectCode,
+		MaxClicks:    opts.MaxClicks,
+		Schedule:     newSchedule(opts.Schedule),
+		Targeting:    newTargeting(opts.Targeting),
+		Variants:     opts.Variants,
+		ForwardPath:  opts.ForwardPath,
+		ForwardQuery: opts.ForwardQuery,
+		CampaignID:   opts.CampaignID,
+	}
+	if opts.ForwardQuery && opts.QueryConflict != QueryConflictKeep {
+		settings.QueryConflict = opts.QueryConflict
+	}
+	if settings.RedirectCode == 0 {
+		settings.RedirectCode = s.redirectCode
+	}
+	// 307 подразумевается для ссылок без настроек, хранить его не нужно
+	if settings.RedirectCode == legacyRedirectCode {
+		settings.RedirectCode = 0
+	}
+	if opts.Password != "" {
+		passwordHash, err := hashLinkPassword(opts.Password)
+		if err != nil {
+			return settings, false, err
+		}
+		settings.PasswordHash = passwordHash
+	}
+	// NotActiveMessage без времени активации не показывается, хранить его не нужно
+	if !opts.NotBefore.IsZero() {
+		notBefore := opts.NotBefore.UTC()
+		settings.NotBefore = &notBefore
+		settings.NotActiveMessage = opts.NotActiveMessage
+	}
+	return settings, !reflect.DeepEqual(settings, storage.LinkSettings{ShortURL: shortURL}), nil
+}
+
+func (s *shortener) GetRedirect(ctx context.Context, shortURL string, request RedirectRequest) (Redirect, error) {
+	originalURL, err := s.storage.GetOriginalURL(ctx, shortURL)
+	if errors.Is(err, storage.KeyError) {
+		return Redirect{}, OriginalURLNotFound{shortURL}
+	}
+	if err != nil {
+		return Redirect{}, err
+	}
+	settings, err := s.storage.GetLinkSettings(ctx, shortURL)
+	if err != nil {
+		return Redirect{}, err
+	}
+	// Без переноса пути ссылка доступна только по точному адресу, как и раньше
+	if request.Path != "" && !settings.ForwardPath {
+		return Redirect{}, OriginalURLNotFound{shortURL}
+	}
+	if settings.Disabled {
+		return Redirect{}, LinkDisabledError{URLID: shortURL}
+	}
+	now := s.now()
+	if err := checkNotBefore(settings, now); err != nil {
+		return Redirect{}, err
+	}
+	if err := s.checkLinkPassword(settings, request.Password); err != nil {
+		return Redirect{}, err
+	}
+	// Переход засчитывается последним, чтобы неверный пароль не расходовал лимит
+	if request.Head && settings.MaxClicks > 0 {
+		return s.checkClicks(ctx, settings)
+	}
+	if !request.Head {
+		if err := s.consumeClick(ctx, settings); err != nil {
+			return Redirect{}, err
+		}
+	}
+	// Правила таргетинга важнее A/B-теста, а тот важнее расписания
+	destination, pending := scheduledDestination(originalURL, settings.Schedule, now)
+	variant := 0
+	if targetURL, ok := matchTargeting(settings.Targeting, request); ok {
+		destination = targetURL
+	} else if len(settings.Variants) > 0 {
+		variant = s.pickVariant(settings.Variants, request.Variant)
+		destination = settings.Variants[variant-1].URL
+		if !request.Head {
+			s.countVariantClick(ctx, shortURL, variant)
+		}
+	}
+	if destination, err = forwardRequest(destination, settings, request); err != nil {
+		return Redirect{}, err
+	}
+	if destination, err = s.tagDestination(ctx, destination, settings); err != nil {
+		return Redirect{}, err
+	}
+	redirect := Redirect{
+		URL:        destination,
+		StatusCode: settings.RedirectCode,
+		// Ответ ссылки с таргетингом или вариантами зависит от запроса, общий кеш его не различит
+		NoStore: settings.PasswordHash != "" || settings.MaxClicks > 0 || pending ||
+			len(settings.Targeting) > 0 || len(settings.Variants) > 0 || settings.CampaignID != "",
+		Variant: variant,
+	}
+	if redirect.StatusCode == 0 {
+		redirect.StatusCode = legacyRedirectCode
+	}
+	return redirect, nil
+}
+
+// consumeClick учитывает переход по ссылке с ограниченным числом переходов
+func (s *shortener) consumeClick(ctx context.Context, settings storage.LinkSettings) error {
+	if settings.MaxClicks <= 0 {
+		return nil
+	}
+	_, ok, err := s.storage.ConsumeClick(ctx, settings.ShortURL, settings.MaxClicks)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return LinkExhaustedError{URLID: settings.ShortURL, MaxClicks: settings.MaxClicks}
+	}
+	return nil
+}
+
+// checkClicks отвечает на HEAD к ссылке с лимитом переходов: переход не расходуется,
+// поэтому и адрес не раскрывается, иначе его можно было бы узнать сколько угодно раз
+func (s *shortener) checkClicks(ctx context.Context, settings storage.LinkSettings) (Redirect, error) {
+	clicks, err := s.storage.GetClicks(ctx, settings.ShortURL)
+	if err != nil {
+		return Redirect{}, err
+	}
+	if clicks >= settings.MaxClicks {
+		return Redirect{}, LinkExhaustedError{URLID: settings.ShortURL, MaxClicks: settings.MaxClicks}
+	}
+	return Redirect{StatusCode: http.StatusNoContent, NoStore: true}, nil
+}
+
+func (s *shortener) SetRedirectCode(ctx context.Context, userToken, workspaceID, urlID string, code int) error {
+	if !IsRedirectCodeValid(code) {
+		return RedirectCodeNotValidError{Code: code}
+	}
+	shortURL, err := s.ownedShortURL(ctx, userToken, workspaceID, urlID)
+	if err != nil {
+		return err
+	}
+	settings, err := s.storage.GetLinkSettings(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	settings.RedirectCode = code
+	return s.storage.SaveLinkSettings(ctx, settings)
+}
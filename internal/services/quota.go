@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+const quotaDayLayout = "2006-01-02"
+
+// Quota ограничения на создание ссылок одним пользователем, ноль - без ограничения.
+// Дневная квота восстанавливается в полночь UTC.
+type Quota struct {
+	DailyLinks   int64
+	TotalLinks   int64
+	MaxBatchSize int
+}
+
+func (q Quota) limits() storage.QuotaLimits {
+	return storage.QuotaLimits{Daily: q.DailyLinks, Total: q.TotalLinks}
+}
+
+// WithQuota квоты на создание ссылок
+func WithQuota(quota Quota) Option {
+	return func(s *shortener) {
+		s.quota = quota
+	}
+}
+
+// consumeQuota учитывает n новых ссылок пользователя или возвращает QuotaExceededError
+func (s *shortener) consumeQuota(ctx context.Context, userToken string, n int) error {
+	if s.quota.DailyLinks <= 0 && s.quota.TotalLinks <= 0 {
+		return nil
+	}
+	now := s.now().UTC()
+	usage, ok, err := s.storage.ConsumeQuota(ctx, userToken, now.Format(quotaDayLayout), int64(n), s.quota.limits())
+	if err != nil || ok {
+		return err
+	}
+	if s.quota.TotalLinks > 0 && usage.Total+int64(n) > s.quota.TotalLinks {
+		return QuotaExceededError{Limit: s.quota.TotalLinks, Remaining: remaining(s.quota.TotalLinks, usage.Total)}
+	}
+	year, month, day := now.Date()
+	return QuotaExceededError{
+		Limit:      s.quota.DailyLinks,
+		Remaining:  remaining(s.quota.DailyLinks, usage.DayCount),
+		RetryAfter: time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC).Sub(now),
+	}
+}
+
+// refundQuota возвращает в квоту ссылки, которые не удалось сохранить. Ошибка не
+// возвращается: пользователь получит ошибку сохранения, а квота просто останется учтенной.
+func (s *shortener) refundQuota(ctx context.Context, userToken string, n int) {
+	if s.quota.DailyLinks <= 0 && s.quota.TotalLinks <= 0 {
+		return
+	}
+	day := s.now().UTC().Format(quotaDayLayout)
+	_, _, _ = s.storage.ConsumeQuota(ctx, userToken, day, -int64(n), s.quota.limits())
+}
+
+func remaining(limit, used int64) int64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestShortenerQuota(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 18, 0, 0, 0, time.UTC)
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(DB, config.BaseURL,
+		WithQuota(Quota{DailyLinks: 2, TotalLinks: 3, MaxBatchSize: 2}),
+		WithClock(func() time.Time { return now }),
+	)
+
+	_, err := shortener.SaveData(ctx, "user", "https://github.com")
+	require.NoError(t, err)
+	// Неудачное сохранение возвращает ссылку в квоту
+	_, err = shortener.SaveData(ctx, "user", "https://github.com")
+	require.ErrorAs(t, err, new(*storage.DuplicateURLErr))
+	_, err = shortener.SaveData(ctx, "user", "https://go.dev")
+	require.NoError(t, err)
+
+	_, err = shortener.SaveData(ctx, "user", "https://example.com")
+	var quotaErr QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, QuotaExceededError{Limit: 2, RetryAfter: 6 * time.Hour}, quotaErr)
+	_, err = shortener.SaveData(ctx, "other", "https://example.com")
+	require.NoError(t, err)
+
+	_, err = shortener.SaveDataBatch(ctx, "user", []URLDataBatchRequest{
+		{OriginalURL: "https://a.example.com"}, {OriginalURL: "https://b.example.com"}, {OriginalURL: "https://c.example.com"},
+	})
+	require.ErrorAs(t, err, &BatchTooLargeError{})
+
+	now = now.Add(6 * time.Hour)
+	_, err = shortener.SaveDataBatch(ctx, "user", []URLDataBatchRequest{
+		{OriginalURL: "https://a.example.com"}, {OriginalURL: "https://b.example.com"},
+	})
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, QuotaExceededError{Limit: 3, Remaining: 1}, quotaErr)
+	_, err = shortener.SaveData(ctx, "user", "https://a.example.com")
+	require.NoError(t, err)
+}
@@ -187,3 +187,29 @@ func TestSaveDataBatch(t *testing.T) {
 		}
 	})
 }
+
+func TestCreatePrivateLink(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	_, err := NewShortener(DB, config.BaseURL).CreateLink(ctx, "user", "https://github.com", LinkOptions{Private: true})
+	require.ErrorAs(t, err, &PrivateLinksDisabledError{})
+
+	shortener := NewShortener(DB, config.BaseURL, WithPrivateLinks())
+	publicURL, err := shortener.SaveData(ctx, "user", "https://github.com")
+	require.NoError(t, err)
+	// Приватная ссылка на тот же URL не совпадает с публичной и не выводится из него
+	privateURL, err := shortener.CreateLink(ctx, "user", "https://github.com", LinkOptions{Private: true})
+	require.NoError(t, err)
+	otherURL, err := shortener.CreateLink(ctx, "user", "https://github.com", LinkOptions{Private: true})
+	require.NoError(t, err)
+	require.NotEqual(t, privateURL, otherURL)
+	// 22 символа случайного идентификатора вместо 8 символов хеша
+	require.Len(t, privateURL, len(publicURL)-8+22)
+
+	settings, err := DB.GetLinkSettings(ctx, privateURL)
+	require.NoError(t, err)
+	require.True(t, settings.Private)
+	originalURL, err := shortener.GetOriginalURL(ctx, privateURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com", originalURL)
+}
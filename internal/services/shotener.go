@@ -4,25 +4,108 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/url"
+	"time"
 
+	"github.com/maxsnegir/url-shortener/internal/ratelimit"
 	"github.com/maxsnegir/url-shortener/internal/storage"
 )
 
 type URLService interface {
 	SaveData(ctx context.Context, userToken, shortURL string) (string, error)
+	// CreateLink создает ссылку с дополнительными параметрами
+	CreateLink(ctx context.Context, userToken, url string, opts LinkOptions) (string, error)
 	SaveDataBatch(ctx context.Context, userToken string, originalURLs []URLDataBatchRequest) ([]URLDataBatchResponse, error)
 	GetOriginalURL(ctx context.Context, shortURLID string) (string, error)
+	// GetRedirect куда и с каким кодом перенаправить переход по ссылке
+	GetRedirect(ctx context.Context, shortURL string, request RedirectRequest) (Redirect, error)
 	GetUserURLs(ctx context.Context, userToken string) ([]storage.URLData, error)
+	// SaveWorkspaceData создает ссылку в пространстве, нужна роль editor
+	SaveWorkspaceData(ctx context.Context, userToken, workspaceID, url string) (string, error)
+	// GetWorkspaceURLs ссылки пространства, нужна роль viewer
+	GetWorkspaceURLs(ctx context.Context, userToken, workspaceID string) ([]storage.URLData, error)
+	// UpdateURL меняет исходный URL ссылки пользователя или, если задан workspaceID, ссылки пространства
+	UpdateURL(ctx context.Context, userToken, workspaceID, urlID, originalURL string) error
+	// GetURLHistory версии исходного URL ссылки, последняя - текущая
+	GetURLHistory(ctx context.Context, userToken, workspaceID, urlID string) ([]storage.URLVersion, error)
+	// RollbackURL возвращает ссылке исходный URL версии version и возвращает его
+	RollbackURL(ctx context.Context, userToken, workspaceID, urlID string, version int64) (string, error)
+	// GetLinkStats статистика переходов по ссылке, в том числе по вариантам A/B-ссылки
+	GetLinkStats(ctx context.Context, userToken, workspaceID, urlID string) (LinkStats, error)
+	// CreateCampaign создает кампанию с UTM-метками пользователя или, если задан workspaceID, пространства
+	CreateCampaign(ctx context.Context, userToken, workspaceID string, params CampaignParams) (storage.Campaign, error)
+	GetCampaigns(ctx context.Context, userToken, workspaceID string) ([]storage.Campaign, error)
+	UpdateCampaign(ctx context.Context, userToken, workspaceID, id string, params CampaignParams) (storage.Campaign, error)
+	DeleteCampaign(ctx context.Context, userToken, workspaceID, id string) error
+	// GetCampaignURLs ссылки, созданные в кампании
+	GetCampaignURLs(ctx context.Context, userToken, workspaceID, id string) ([]storage.URLData, error)
+	// CreateLinkPattern создает ссылку-шаблон вида "/gh/{user}" -> "https://github.com/{user}"
+	CreateLinkPattern(ctx context.Context, userToken, pattern, template string) (storage.LinkPattern, error)
+	GetLinkPatterns(ctx context.Context) ([]storage.LinkPattern, error)
+	DeleteLinkPattern(ctx context.Context, id string) error
+	// MatchLinkPattern адрес перехода по самому конкретному подходящему шаблону
+	MatchLinkPattern(ctx context.Context, requestPath string) (Redirect, bool, error)
+	// SetRedirectCode меняет код ответа при переходе по ссылке
+	SetRedirectCode(ctx context.Context, userToken, workspaceID, urlID string, code int) error
+	// DeleteURL удаляет ссылку пользователя или, если задан workspaceID, ссылку пространства
+	DeleteURL(ctx context.Context, userToken, workspaceID, urlID string) error
 	GetHostURL() string
 	IsURLValid(url string) error
 	Ping(ctx context.Context) error
 }
 
+// privateIDBytes случайных байт в идентификаторе приватной ссылки: 22 символа вместо 8
+const privateIDBytes = 16
+
+// settingsIDBytes случайных байт в идентификаторе ссылки с параметрами: 8 символов, как у хеша
+const settingsIDBytes = 6
+
+// maxRandomIDAttempts сколько раз выбирается случайный идентификатор, если он уже занят
+const maxRandomIDAttempts = 3
+
 type shortener struct {
-	storage storage.ShortenerStorage
-	hostURL string
+	storage     storage.LinkStorage
+	hostURL     string
+	idAllocator *IDAllocator
+	quota       Quota
+	now         func() time.Time
+	// privateLinks разрешено создавать приватные ссылки
+	privateLinks bool
+	// redirectCode код ответа при переходе по новым ссылкам, если он не задан при создании
+	redirectCode int
+	// passwordGuard ограничивает неверные пароли к каждой ссылке
+	passwordGuard *ratelimit.Guard
+	// randIntn случайное число из [0, n) для выбора варианта A/B-ссылки
+	randIntn func(n int) int
+	patterns patternCache
+}
+
+// Option дополнительная настройка shortener
+type Option func(s *shortener)
+
+// WithIDAllocator короткие идентификаторы выдаются по счетчику в base62
+// вместо хеша от исходной ссылки
+func WithIDAllocator(allocator *IDAllocator) Option {
+	return func(s *shortener) {
+		s.idAllocator = allocator
+	}
+}
+
+// WithClock источник текущего времени для квот, сроков действия и расписания ссылок,
+// используется в тестах
+func WithClock(now func() time.Time) Option {
+	return func(s *shortener) {
+		s.now = now
+	}
+}
+
+// WithPrivateLinks разрешает создавать приватные ссылки с длинными случайными идентификаторами
+func WithPrivateLinks() Option {
+	return func(s *shortener) {
+		s.privateLinks = true
+	}
 }
 
 type URLDataBatchRequest struct {
@@ -36,22 +119,92 @@ type URLDataBatchResponse struct {
 }
 
 func (s *shortener) SaveData(ctx context.Context, userToken string, url string) (string, error) {
+	return s.saveData(ctx, userToken, userToken, url, LinkOptions{})
+}
+
+// saveData создает ссылку владельца owner, квота списывается с создавшего ее пользователя
+func (s *shortener) saveData(ctx context.Context, userToken, owner, url string, opts LinkOptions) (string, error) {
 	if err := s.IsURLValid(url); err != nil {
 		return "", err
 	}
-	urlHash := s.getURLHash(url)
-
-	urlData := storage.URLData{
-		ShortURL:    fmt.Sprintf("%s/%s/", s.GetHostURL(), urlHash),
-		OriginalURL: url,
+	if err := s.consumeQuota(ctx, userToken, 1); err != nil {
+		return "", err
+	}
+	shortURL, err := s.createURL(ctx, owner, url, opts)
+	if err != nil {
+		s.refundQuota(ctx, userToken, 1)
 	}
-	if err := s.storage.SaveData(ctx, userToken, urlData); err != nil {
+	return shortURL, err
+}
+
+// createURL ссылка с параметрами при хеш-идентификаторах получает случайный идентификатор:
+// иначе она совпала бы с уже созданной ссылкой на тот же URL, у которой параметров нет
+func (s *shortener) createURL(ctx context.Context, owner, url string, opts LinkOptions) (string, error) {
+	settings, hasSettings, err := s.newLinkSettings("", opts)
+	if err != nil {
 		return "", err
 	}
-	return urlData.ShortURL, nil
+	randomID := opts.Private || (s.idAllocator == nil && opts.customized())
+	for attempt := 1; ; attempt++ {
+		var urlID string
+		switch {
+		case opts.Private:
+			urlID, err = randomString(privateIDBytes)
+		case randomID:
+			urlID, err = randomString(settingsIDBytes)
+		default:
+			urlID, err = s.generateID(ctx, url)
+		}
+		if err != nil {
+			return "", err
+		}
+		urlData := storage.URLData{
+			ShortURL:    fmt.Sprintf("%s/%s/", s.GetHostURL(), urlID),
+			OriginalURL: url,
+		}
+		err = s.storage.SaveData(ctx, owner, urlData)
+		var duplicateErr *storage.DuplicateURLErr
+		if randomID && errors.As(err, &duplicateErr) && attempt < maxRandomIDAttempts {
+			continue
+		}
+		if !randomID && s.idAllocator == nil && errors.As(err, &duplicateErr) {
+			edited, editErr := s.hashIDEdited(ctx, urlData)
+			if editErr != nil {
+				return "", editErr
+			}
+			if edited {
+				randomID, attempt = true, 0
+				continue
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		if hasSettings {
+			settings.ShortURL = urlData.ShortURL
+			if err := s.saveNewLinkSettings(ctx, settings); err != nil {
+				return "", err
+			}
+		}
+		return urlData.ShortURL, nil
+	}
+}
+
+// saveNewLinkSettings без настроек новая ссылка работала бы без пароля и ограничений,
+// поэтому если их не удалось сохранить, ссылка удаляется. Ее идентификатор еще никому
+// не выдан, так что удаление не ломает переходы.
+func (s *shortener) saveNewLinkSettings(ctx context.Context, settings storage.LinkSettings) error {
+	err := s.storage.SaveLinkSettings(ctx, settings)
+	if err != nil {
+		_ = s.storage.DeleteURLData(ctx, settings.ShortURL)
+	}
+	return err
 }
 
 func (s *shortener) SaveDataBatch(ctx context.Context, userToken string, originalURLs []URLDataBatchRequest) ([]URLDataBatchResponse, error) {
+	if s.quota.MaxBatchSize > 0 && len(originalURLs) > s.quota.MaxBatchSize {
+		return nil, BatchTooLargeError{Size: len(originalURLs), MaxSize: s.quota.MaxBatchSize}
+	}
 	urlDataList := make([]storage.URLData, 0, len(originalURLs))
 	urlDataResponse := make([]URLDataBatchResponse, 0, len(originalURLs))
 
@@ -60,20 +213,55 @@ func (s *shortener) SaveDataBatch(ctx context.Context, userToken string, origina
 		if err := s.IsURLValid(originalURL.OriginalURL); err != nil {
 			return urlDataResponse, err
 		}
-		urlHash := s.getURLHash(originalURL.OriginalURL)
+		urlID, err := s.generateID(ctx, originalURL.OriginalURL)
+		if err != nil {
+			return urlDataResponse, err
+		}
 
 		urlData := storage.URLData{
-			ShortURL:    fmt.Sprintf("%s/%s/", s.GetHostURL(), urlHash),
+			ShortURL:    fmt.Sprintf("%s/%s/", s.GetHostURL(), urlID),
 			OriginalURL: originalURL.OriginalURL,
 		}
+		if s.idAllocator == nil {
+			edited, err := s.hashIDEdited(ctx, urlData)
+			if err != nil {
+				return urlDataResponse, err
+			}
+			if edited {
+				if urlID, err = randomString(settingsIDBytes); err != nil {
+					return urlDataResponse, err
+				}
+				urlData.ShortURL = fmt.Sprintf("%s/%s/", s.GetHostURL(), urlID)
+			}
+		}
 		urlDataList = append(urlDataList, urlData)
 		urlDataResponse = append(urlDataResponse, URLDataBatchResponse{
 			CorrelationID: originalURL.CorrelationID,
 			ShortURL:      urlData.ShortURL,
 		})
 	}
-	err := s.storage.SaveDataBatch(ctx, userToken, urlDataList)
-	return urlDataResponse, err
+	if err := s.consumeQuota(ctx, userToken, len(urlDataList)); err != nil {
+		return nil, err
+	}
+	if err := s.storage.SaveDataBatch(ctx, userToken, urlDataList); err != nil {
+		s.refundQuota(ctx, userToken, len(urlDataList))
+		return urlDataResponse, err
+	}
+	for _, urlData := range urlDataList {
+		settings, hasSettings, err := s.newLinkSettings(urlData.ShortURL, LinkOptions{})
+		if err == nil && hasSettings {
+			err = s.storage.SaveLinkSettings(ctx, settings)
+		}
+		if err != nil {
+			// Пакет не должен остаться сохраненным частично
+			for _, saved := range urlDataList {
+				_ = s.storage.DeleteURLData(ctx, saved.ShortURL)
+			}
+			s.refundQuota(ctx, userToken, len(urlDataList))
+			return nil, err
+		}
+	}
+	return urlDataResponse, nil
 }
 
 func (s *shortener) IsURLValid(URL string) error {
@@ -88,6 +276,31 @@ func (s *shortener) GetHostURL() string {
 	return s.hostURL
 }
 
+func (s *shortener) generateID(ctx context.Context, URL string) (string, error) {
+	if s.idAllocator == nil {
+		return s.getURLHash(URL), nil
+	}
+	id, err := s.idAllocator.NextID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return encodeBase62(id), nil
+}
+
+// hashIDEdited идентификатор-хеш занят ссылкой, исходный URL которой изменили, пока такие
+// изменения были разрешены. Такая ссылка ведет на другой адрес, поэтому новая ссылка
+// получает случайный идентификатор вместо конфликта с ней.
+func (s *shortener) hashIDEdited(ctx context.Context, urlData storage.URLData) (bool, error) {
+	originalURL, err := s.storage.GetOriginalURL(ctx, urlData.ShortURL)
+	if errors.Is(err, storage.KeyError) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return originalURL != urlData.OriginalURL, nil
+}
+
 func (s *shortener) getURLHash(URL string) string {
 	hasher := sha1.New()
 	hasher.Write([]byte(URL))
@@ -96,24 +309,110 @@ func (s *shortener) getURLHash(URL string) string {
 }
 
 func (s *shortener) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
-	originalURL, err := s.storage.GetOriginalURL(ctx, shortURL)
-	if err != nil {
-		return "", OriginalURLNotFound{shortURL}
-	}
-	return originalURL, nil
+	redirect, err := s.GetRedirect(ctx, shortURL, RedirectRequest{})
+	return redirect.URL, err
 }
 
 func (s *shortener) GetUserURLs(ctx context.Context, userToken string) ([]storage.URLData, error) {
 	return s.storage.GetUserURLs(ctx, userToken)
 }
 
+func (s *shortener) SaveWorkspaceData(ctx context.Context, userToken, workspaceID, url string) (string, error) {
+	return s.CreateLink(ctx, userToken, url, LinkOptions{WorkspaceID: workspaceID})
+}
+
+func (s *shortener) GetWorkspaceURLs(ctx context.Context, userToken, workspaceID string) ([]storage.URLData, error) {
+	owner, err := s.owner(ctx, userToken, workspaceID, WorkspaceViewer)
+	if err != nil {
+		return nil, err
+	}
+	return s.storage.GetUserURLs(ctx, owner)
+}
+
+// UpdateURL при хеш-идентификаторах менять можно только ссылки со случайным идентификатором:
+// ссылку с хешем получает каждый, кто сокращает тот же URL, и владелец не должен менять
+// адрес ссылки, которую распространяют другие
+func (s *shortener) UpdateURL(ctx context.Context, userToken, workspaceID, urlID, originalURL string) error {
+	if err := s.IsURLValid(originalURL); err != nil {
+		return err
+	}
+	shortURL, err := s.ownedShortURL(ctx, userToken, workspaceID, urlID)
+	if err != nil {
+		return err
+	}
+	if s.idAllocator == nil {
+		currentURL, err := s.storage.GetOriginalURL(ctx, shortURL)
+		if errors.Is(err, storage.KeyError) {
+			return OriginalURLNotFound{URLID: shortURL}
+		}
+		if err != nil {
+			return err
+		}
+		if urlID == s.getURLHash(currentURL) {
+			return URLNotEditableError{URLID: shortURL}
+		}
+	}
+	err = s.storage.UpdateOriginalURL(ctx, shortURL, originalURL, s.now().UTC())
+	if errors.Is(err, storage.KeyError) {
+		return OriginalURLNotFound{URLID: shortURL}
+	}
+	return err
+}
+
+func (s *shortener) DeleteURL(ctx context.Context, userToken, workspaceID, urlID string) error {
+	shortURL, err := s.ownedShortURL(ctx, userToken, workspaceID, urlID)
+	if err != nil {
+		return err
+	}
+	return s.storage.DeleteURLData(ctx, shortURL)
+}
+
+// owner владелец ссылок: сам пользователь или пространство, в котором у него есть роль role
+func (s *shortener) owner(ctx context.Context, userToken, workspaceID string, role WorkspaceRole) (string, error) {
+	if workspaceID == "" {
+		return userToken, nil
+	}
+	if _, err := authorizeWorkspace(ctx, s.storage, userToken, workspaceID, role); err != nil {
+		return "", err
+	}
+	return workspaceID, nil
+}
+
+// ownedShortURL короткий URL ссылки urlID, если ее можно менять пользователю. Чужие ссылки
+// не отличаются от несуществующих.
+func (s *shortener) ownedShortURL(ctx context.Context, userToken, workspaceID, urlID string) (string, error) {
+	owner, err := s.owner(ctx, userToken, workspaceID, WorkspaceEditor)
+	if err != nil {
+		return "", err
+	}
+	shortURL := fmt.Sprintf("%s/%s/", s.GetHostURL(), urlID)
+	ownerURLs, err := s.storage.GetUserURLs(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+	for _, urlData := range ownerURLs {
+		if urlData.ShortURL == shortURL {
+			return shortURL, nil
+		}
+	}
+	return "", OriginalURLNotFound{URLID: shortURL}
+}
+
 func (s *shortener) Ping(ctx context.Context) error {
 	return s.storage.Ping(ctx)
 }
 
-func NewShortener(urlStorage storage.ShortenerStorage, hostURL string) URLService {
-	return &shortener{
-		storage: urlStorage,
-		hostURL: hostURL,
+func NewShortener(urlStorage storage.LinkStorage, hostURL string, opts ...Option) URLService {
+	s := &shortener{
+		storage:       urlStorage,
+		hostURL:       hostURL,
+		now:           time.Now,
+		redirectCode:  legacyRedirectCode,
+		passwordGuard: newPasswordGuard(linkPasswordAttempts, linkPasswordLockout),
+		randIntn:      randomIntn,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/maxsnegir/url-shortener/internal/auth"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+const ssoSecretSize = 32
+
+// SSOLogin секреты одного входа через провайдер; хранятся у клиента до возврата от провайдера
+type SSOLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type SSOService interface {
+	// Start возвращает адрес провайдера для входа и секреты, которые нужно сохранить до Finish
+	Start(ctx context.Context) (string, SSOLogin, error)
+	// Finish обменивает код на токен пользователя и передает ему ссылки anonymousUserToken
+	Finish(ctx context.Context, anonymousUserToken string, login SSOLogin, code string) (string, error)
+}
+
+type ssoService struct {
+	provider *auth.OIDCProvider
+	storage  storage.AccountStorage
+}
+
+func (s *ssoService) Start(ctx context.Context) (string, SSOLogin, error) {
+	var login SSOLogin
+	for _, secret := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		value, err := randomString(ssoSecretSize)
+		if err != nil {
+			return "", SSOLogin{}, err
+		}
+		*secret = value
+	}
+	authURL, err := s.provider.AuthCodeURL(ctx, login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		return "", SSOLogin{}, err
+	}
+	return authURL, login, nil
+}
+
+func (s *ssoService) Finish(ctx context.Context, anonymousUserToken string, login SSOLogin, code string) (string, error) {
+	identity, err := s.provider.Exchange(ctx, code, login.Verifier, login.Nonce)
+	if err != nil {
+		return "", SSOLoginError{Reason: err.Error()}
+	}
+	userToken := identity.UserToken()
+	// Ссылки другого пользователя провайдера, входившего в этом браузере, не переносятся
+	if anonymousUserToken != "" && !auth.IsIdentityToken(anonymousUserToken) {
+		if err := s.storage.MergeUserURLs(ctx, anonymousUserToken, userToken); err != nil {
+			return "", fmt.Errorf("sso: merge user urls: %w", err)
+		}
+	}
+	return userToken, nil
+}
+
+func NewSSOService(provider *auth.OIDCProvider, accountStorage storage.AccountStorage) SSOService {
+	return &ssoService{provider: provider, storage: accountStorage}
+}
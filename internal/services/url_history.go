@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// GetURLHistory к прежним версиям из хранилища добавляется текущий URL с нулевым ReplacedAt
+func (s *shortener) GetURLHistory(ctx context.Context, userToken, workspaceID, urlID string) ([]storage.URLVersion, error) {
+	shortURL, err := s.ownedShortURL(ctx, userToken, workspaceID, urlID)
+	if err != nil {
+		return nil, err
+	}
+	return s.urlHistory(ctx, shortURL)
+}
+
+func (s *shortener) urlHistory(ctx context.Context, shortURL string) ([]storage.URLVersion, error) {
+	history, err := s.storage.GetURLHistory(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	originalURL, err := s.storage.GetOriginalURL(ctx, shortURL)
+	if errors.Is(err, storage.KeyError) {
+		return nil, OriginalURLNotFound{URLID: shortURL}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(history, storage.URLVersion{
+		ShortURL:    shortURL,
+		Version:     nextVersion(history),
+		OriginalURL: originalURL,
+	}), nil
+}
+
+// RollbackURL откат - обычное изменение исходного URL: текущий URL попадает в историю,
+// поэтому откат тоже можно откатить
+func (s *shortener) RollbackURL(ctx context.Context, userToken, workspaceID, urlID string, version int64) (string, error) {
+	shortURL, err := s.ownedShortURL(ctx, userToken, workspaceID, urlID)
+	if err != nil {
+		return "", err
+	}
+	history, err := s.urlHistory(ctx, shortURL)
+	if err != nil {
+		return "", err
+	}
+	for _, urlVersion := range history {
+		if urlVersion.Version != version {
+			continue
+		}
+		err = s.storage.UpdateOriginalURL(ctx, shortURL, urlVersion.OriginalURL, s.now().UTC())
+		if errors.Is(err, storage.KeyError) {
+			return "", OriginalURLNotFound{URLID: shortURL}
+		}
+		return urlVersion.OriginalURL, err
+	}
+	return "", URLVersionNotFoundError{Version: version}
+}
+
+func nextVersion(history []storage.URLVersion) int64 {
+	if len(history) == 0 {
+		return 1
+	}
+	return history[len(history)-1].Version + 1
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestURLHistory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(DB, config.BaseURL, WithIDAllocator(NewIDAllocator(DB, 10)), WithClock(func() time.Time {
+		return now
+	}))
+	shortURL, err := shortener.SaveData(ctx, "user", "https://example.com/v1")
+	require.NoError(t, err)
+	urlID := shortURL[len(config.BaseURL)+1 : len(shortURL)-1]
+
+	history, err := shortener.GetURLHistory(ctx, "user", "", urlID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.URLVersion{{ShortURL: shortURL, Version: 1, OriginalURL: "https://example.com/v1"}}, history)
+
+	require.NoError(t, shortener.UpdateURL(ctx, "user", "", urlID, "https://example.com/v2"))
+	// Тот же URL не создает новую версию
+	require.NoError(t, shortener.UpdateURL(ctx, "user", "", urlID, "https://example.com/v2"))
+	now = now.Add(time.Hour)
+	originalURL, err := shortener.RollbackURL(ctx, "user", "", urlID, 1)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/v1", originalURL)
+
+	history, err = shortener.GetURLHistory(ctx, "user", "", urlID)
+	require.NoError(t, err)
+	require.Equal(t, []storage.URLVersion{
+		{ShortURL: shortURL, Version: 1, OriginalURL: "https://example.com/v1", ReplacedAt: now.Add(-time.Hour)},
+		{ShortURL: shortURL, Version: 2, OriginalURL: "https://example.com/v2", ReplacedAt: now},
+		{ShortURL: shortURL, Version: 3, OriginalURL: "https://example.com/v1"},
+	}, history)
+
+	_, err = shortener.RollbackURL(ctx, "user", "", urlID, 4)
+	require.ErrorAs(t, err, &URLVersionNotFoundError{})
+	_, err = shortener.RollbackURL(ctx, "other", "", urlID, 1)
+	require.ErrorAs(t, err, &OriginalURLNotFound{})
+}
+
+// TestEditHashLink ссылку с идентификатором-хешем получает каждый, кто сокращает ее URL,
+// поэтому ее адрес менять нельзя
+func TestEditHashLink(t *testing.T) {
+	ctx := context.Background()
+	shortener := NewShortener(storage.NewURLStorage(storage.NewMapStorage()), config.BaseURL)
+	shortURL, err := shortener.SaveData(ctx, "alice", "https://example.com")
+	require.NoError(t, err)
+	urlID := shortURL[len(config.BaseURL)+1 : len(shortURL)-1]
+	_, err = shortener.SaveData(ctx, "bob", "https://example.com")
+	require.ErrorAs(t, err, new(*storage.DuplicateURLErr))
+
+	require.ErrorAs(t, shortener.UpdateURL(ctx, "alice", "", urlID, "https://evil.com"), new(URLNotEditableError))
+	originalURL, err := shortener.GetOriginalURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", originalURL)
+
+	// Ссылку со случайным идентификатором менять можно
+	customURL, err := shortener.CreateLink(ctx, "alice", "https://example.com", LinkOptions{RedirectCode: 302})
+	require.NoError(t, err)
+	require.NoError(t, shortener.UpdateURL(ctx, "alice", "", customURL[len(config.BaseURL)+1:len(customURL)-1], "https://example.org"))
+}
+
+// TestShortenEditedURL идентификатор-хеш ссылки, измененной до запрета таких изменений,
+// занят ссылкой на другой адрес, поэтому новая ссылка на прежний URL получает свой
+// идентификатор, а не конфликт
+func TestShortenEditedURL(t *testing.T) {
+	ctx := context.Background()
+	DB := storage.NewURLStorage(storage.NewMapStorage())
+	shortener := NewShortener(DB, config.BaseURL)
+	editedURL, err := shortener.SaveData(ctx, "user", "https://example.com/v1")
+	require.NoError(t, err)
+	require.NoError(t, DB.UpdateOriginalURL(ctx, editedURL, "https://example.com/v2", time.Now()))
+
+	shortURL, err := shortener.SaveData(ctx, "user", "https://example.com/v1")
+	require.NoError(t, err)
+	require.NotEqual(t, editedURL, shortURL)
+	originalURL, err := shortener.GetOriginalURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/v1", originalURL)
+
+	batch, err := shortener.SaveDataBatch(ctx, "other", []URLDataBatchRequest{{CorrelationID: "1", OriginalURL: "https://example.com/v1"}})
+	require.NoError(t, err)
+	require.NotEqual(t, editedURL, batch[0].ShortURL)
+	originalURL, err = shortener.GetOriginalURL(ctx, batch[0].ShortURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/v1", originalURL)
+}
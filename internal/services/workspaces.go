@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+// WorkspaceRole роль участника пространства, каждая следующая включает права предыдущих
+type WorkspaceRole string
+
+const (
+	// WorkspaceViewer видит ссылки пространства и его участников
+	WorkspaceViewer WorkspaceRole = "viewer"
+	// WorkspaceEditor создает, меняет и удаляет ссылки пространства
+	WorkspaceEditor WorkspaceRole = "editor"
+	// WorkspaceOwner управляет участниками и приглашениями
+	WorkspaceOwner WorkspaceRole = "owner"
+)
+
+const (
+	workspaceInviteTTL     = 7 * 24 * time.Hour
+	workspaceInviteSize    = 32
+	maxWorkspaceNameLength = 255
+)
+
+var workspaceRoleLevels = map[WorkspaceRole]int{WorkspaceViewer: 1, WorkspaceEditor: 2, WorkspaceOwner: 3}
+
+func (r WorkspaceRole) Includes(other WorkspaceRole) bool {
+	return workspaceRoleLevels[r] >= workspaceRoleLevels[other]
+}
+
+func (r WorkspaceRole) IsValid() bool {
+	_, ok := workspaceRoleLevels[r]
+	return ok
+}
+
+// WorkspaceInfo пространство с ролью текущего пользователя в нем
+type WorkspaceInfo struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Role      WorkspaceRole `json:"role"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type WorkspaceService interface {
+	CreateWorkspace(ctx context.Context, userToken, name string) (WorkspaceInfo, error)
+	GetUserWorkspaces(ctx context.Context, userToken string) ([]WorkspaceInfo, error)
+	GetMembers(ctx context.Context, userToken, workspaceID string) ([]storage.WorkspaceMember, error)
+	// CreateInvite возвращает токен приглашения; сохраняется только его хеш
+	CreateInvite(ctx context.Context, userToken, workspaceID string, role WorkspaceRole) (string, time.Time, error)
+	// AcceptInvite добавляет пользователя в пространство; приглашение одноразовое
+	AcceptInvite(ctx context.Context, userToken, inviteToken string) (WorkspaceInfo, error)
+	SetMemberRole(ctx context.Context, userToken, workspaceID, memberToken string, role WorkspaceRole) error
+	// RemoveMember удалить участника может владелец, а выйти из пространства - любой участник
+	RemoveMember(ctx context.Context, userToken, workspaceID, memberToken string) error
+}
+
+type workspaceService struct {
+	storage storage.WorkspaceStorage
+	now     func() time.Time
+}
+
+func (s *workspaceService) CreateWorkspace(ctx context.Context, userToken, name string) (WorkspaceInfo, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWorkspaceNameLength {
+		return WorkspaceInfo{}, WorkspaceValidationError{Reason: "Workspace name must be 1-255 characters long"}
+	}
+	now := s.now().UTC()
+	workspace := storage.Workspace{ID: uuid.New().String(), Name: name, CreatedAt: now}
+	owner := storage.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserToken:   userToken,
+		Role:        string(WorkspaceOwner),
+		JoinedAt:    now,
+	}
+	if err := s.storage.CreateWorkspace(ctx, workspace, owner); err != nil {
+		return WorkspaceInfo{}, err
+	}
+	return newWorkspaceInfo(workspace, owner), nil
+}
+
+func (s *workspaceService) GetUserWorkspaces(ctx context.Context, userToken string) ([]WorkspaceInfo, error) {
+	memberships, err := s.storage.GetUserWorkspaces(ctx, userToken)
+	if err != nil {
+		return nil, err
+	}
+	workspaces := make([]WorkspaceInfo, 0, len(memberships))
+	for _, member := range memberships {
+		workspace, err := s.storage.GetWorkspace(ctx, member.WorkspaceID)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, newWorkspaceInfo(workspace, member))
+	}
+	return workspaces, nil
+}
+
+func (s *workspaceService) GetMembers(ctx context.Context, userToken, workspaceID string) ([]storage.WorkspaceMember, error) {
+	if _, err := authorizeWorkspace(ctx, s.storage, userToken, workspaceID, WorkspaceViewer); err != nil {
+		return nil, err
+	}
+	return s.storage.GetWorkspaceMembers(ctx, workspaceID)
+}
+
+func (s *workspaceService) CreateInvite(ctx context.Context, userToken, workspaceID string, role WorkspaceRole) (string, time.Time, error) {
+	if !role.IsValid() {
+		return "", time.Time{}, WorkspaceValidationError{Reason: "Role must be viewer, editor or owner"}
+	}
+	if _, err := authorizeWorkspace(ctx, s.storage, userToken, workspaceID, WorkspaceOwner); err != nil {
+		return "", time.Time{}, err
+	}
+	token, err := randomString(workspaceInviteSize)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := s.now().UTC()
+	invite := storage.WorkspaceInvite{
+		TokenHash:   hashToken(token),
+		WorkspaceID: workspaceID,
+		Role:        string(role),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(workspaceInviteTTL),
+	}
+	if err := s.storage.SaveWorkspaceInvite(ctx, invite); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, invite.ExpiresAt, nil
+}
+
+func (s *workspaceService) AcceptInvite(ctx context.Context, userToken, inviteToken string) (WorkspaceInfo, error) {
+	invite, err := s.storage.TakeWorkspaceInvite(ctx, hashToken(inviteToken))
+	if errors.Is(err, storage.KeyError) {
+		return WorkspaceInfo{}, InvalidInviteError{}
+	}
+	if err != nil {
+		return WorkspaceInfo{}, err
+	}
+	if !s.now().Before(invite.ExpiresAt) {
+		return WorkspaceInfo{}, InvalidInviteError{}
+	}
+	workspace, err := s.storage.GetWorkspace(ctx, invite.WorkspaceID)
+	if err != nil {
+		return WorkspaceInfo{}, err
+	}
+	member, err := s.storage.GetWorkspaceMember(ctx, invite.WorkspaceID, userToken)
+	switch {
+	case errors.Is(err, storage.KeyError):
+		member = storage.WorkspaceMember{WorkspaceID: invite.WorkspaceID, UserToken: userToken, JoinedAt: s.now().UTC()}
+	case err != nil:
+		return WorkspaceInfo{}, err
+	case WorkspaceRole(member.Role).Includes(WorkspaceRole(invite.Role)):
+		// Приглашение не понижает роль участника
+		return newWorkspaceInfo(workspace, member), nil
+	}
+	member.Role = invite.Role
+	if err := s.storage.SaveWorkspaceMember(ctx, member); err != nil {
+		return WorkspaceInfo{}, err
+	}
+	return newWorkspaceInfo(workspace, member), nil
+}
+
+func (s *workspaceService) SetMemberRole(ctx context.Context, userToken, workspaceID, memberToken string, role WorkspaceRole) error {
+	if !role.IsValid() {
+		return WorkspaceValidationError{Reason: "Role must be viewer, editor or owner"}
+	}
+	if _, err := authorizeWorkspace(ctx, s.storage, userToken, workspaceID, WorkspaceOwner); err != nil {
+		return err
+	}
+	member, err := s.getMember(ctx, workspaceID, memberToken)
+	if err != nil {
+		return err
+	}
+	if role != WorkspaceOwner {
+		if err := s.checkNotLastOwner(ctx, member); err != nil {
+			return err
+		}
+	}
+	member.Role = string(role)
+	return s.storage.SaveWorkspaceMember(ctx, member)
+}
+
+func (s *workspaceService) RemoveMember(ctx context.Context, userToken, workspaceID, memberToken string) error {
+	requiredRole := WorkspaceOwner
+	if memberToken == userToken {
+		requiredRole = WorkspaceViewer
+	}
+	if _, err := authorizeWorkspace(ctx, s.storage, userToken, workspaceID, requiredRole); err != nil {
+		return err
+	}
+	member, err := s.getMember(ctx, workspaceID, memberToken)
+	if err != nil {
+		return err
+	}
+	if err := s.checkNotLastOwner(ctx, member); err != nil {
+		return err
+	}
+	err = s.storage.DeleteWorkspaceMember(ctx, workspaceID, memberToken)
+	if errors.Is(err, storage.KeyError) {
+		return WorkspaceMemberNotFoundError{UserToken: memberToken}
+	}
+	return err
+}
+
+func (s *workspaceService) getMember(ctx context.Context, workspaceID, memberToken string) (storage.WorkspaceMember, error) {
+	member, err := s.storage.GetWorkspaceMember(ctx, workspaceID, memberToken)
+	if errors.Is(err, storage.KeyError) {
+		return member, WorkspaceMemberNotFoundError{UserToken: memberToken}
+	}
+	return member, err
+}
+
+// checkNotLastOwner у пространства всегда должен оставаться владелец
+func (s *workspaceService) checkNotLastOwner(ctx context.Context, member storage.WorkspaceMember) error {
+	if WorkspaceRole(member.Role) != WorkspaceOwner {
+		return nil
+	}
+	members, err := s.storage.GetWorkspaceMembers(ctx, member.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	for _, other := range members {
+		if other.UserToken != member.UserToken && WorkspaceRole(other.Role) == WorkspaceOwner {
+			return nil
+		}
+	}
+	return LastWorkspaceOwnerError{}
+}
+
+// authorizeWorkspace проверяет, что у пользователя есть роль role в пространстве. Тем, кто
+// в пространстве не состоит, оно не показывается: для них возвращается WorkspaceNotFoundError.
+func authorizeWorkspace(ctx context.Context, workspaces storage.WorkspaceStorage, userToken, workspaceID string, role WorkspaceRole) (storage.WorkspaceMember, error) {
+	member, err := workspaces.GetWorkspaceMember(ctx, workspaceID, userToken)
+	if errors.Is(err, storage.KeyError) {
+		return member, WorkspaceNotFoundError{ID: workspaceID}
+	}
+	if err != nil {
+		return member, err
+	}
+	if !WorkspaceRole(member.Role).Includes(role) {
+		return member, WorkspaceForbiddenError{Role: role}
+	}
+	return member, nil
+}
+
+func newWorkspaceInfo(workspace storage.Workspace, member storage.WorkspaceMember) WorkspaceInfo {
+	return WorkspaceInfo{
+		ID:        workspace.ID,
+		Name:      workspace.Name,
+		Role:      WorkspaceRole(member.Role),
+		CreatedAt: workspace.CreatedAt,
+	}
+}
+
+func NewWorkspaceService(workspaceStorage storage.WorkspaceStorage) WorkspaceService {
+	return &workspaceService{storage: workspaceStorage, now: time.Now}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+func TestWorkspaceMembership(t *testing.T) {
+	ctx := context.Background()
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	workspaces := NewWorkspaceService(urlStorage)
+
+	workspace, err := workspaces.CreateWorkspace(ctx, "alice", "Marketing")
+	require.NoError(t, err)
+	require.Equal(t, WorkspaceOwner, workspace.Role)
+	_, err = workspaces.CreateWorkspace(ctx, "alice", " ")
+	require.ErrorAs(t, err, &WorkspaceValidationError{})
+
+	// Посторонний не видит пространство и не может приглашать
+	_, err = workspaces.GetMembers(ctx, "mallory", workspace.ID)
+	require.ErrorAs(t, err, &WorkspaceNotFoundError{})
+	_, _, err = workspaces.CreateInvite(ctx, "mallory", workspace.ID, WorkspaceOwner)
+	require.ErrorAs(t, err, &WorkspaceNotFoundError{})
+
+	token, _, err := workspaces.CreateInvite(ctx, "alice", workspace.ID, WorkspaceEditor)
+	require.NoError(t, err)
+	joined, err := workspaces.AcceptInvite(ctx, "bob", token)
+	require.NoError(t, err)
+	require.Equal(t, WorkspaceEditor, joined.Role)
+	_, err = workspaces.AcceptInvite(ctx, "mallory", token)
+	require.ErrorAs(t, err, &InvalidInviteError{})
+
+	// Редактор не управляет участниками
+	_, _, err = workspaces.CreateInvite(ctx, "bob", workspace.ID, WorkspaceViewer)
+	require.ErrorAs(t, err, &WorkspaceForbiddenError{})
+	require.ErrorAs(t, workspaces.SetMemberRole(ctx, "bob", workspace.ID, "bob", WorkspaceOwner), &WorkspaceForbiddenError{})
+
+	// Последний владелец не может уйти или понизить себя
+	require.ErrorAs(t, workspaces.RemoveMember(ctx, "alice", workspace.ID, "alice"), &LastWorkspaceOwnerError{})
+	require.ErrorAs(t, workspaces.SetMemberRole(ctx, "alice", workspace.ID, "alice", WorkspaceViewer), &LastWorkspaceOwnerError{})
+	require.NoError(t, workspaces.SetMemberRole(ctx, "alice", workspace.ID, "bob", WorkspaceOwner))
+	require.NoError(t, workspaces.RemoveMember(ctx, "alice", workspace.ID, "alice"))
+
+	members, err := workspaces.GetMembers(ctx, "bob", workspace.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	userWorkspaces, err := workspaces.GetUserWorkspaces(ctx, "alice")
+	require.NoError(t, err)
+	require.Empty(t, userWorkspaces)
+}
+
+func TestWorkspaceInviteExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	workspaces := &workspaceService{storage: storage.NewURLStorage(storage.NewMapStorage()), now: func() time.Time { return now }}
+
+	workspace, err := workspaces.CreateWorkspace(ctx, "alice", "Marketing")
+	require.NoError(t, err)
+	token, expiresAt, err := workspaces.CreateInvite(ctx, "alice", workspace.ID, WorkspaceViewer)
+	require.NoError(t, err)
+	now = expiresAt
+	_, err = workspaces.AcceptInvite(ctx, "bob", token)
+	require.ErrorAs(t, err, &InvalidInviteError{})
+}
+
+func TestWorkspaceURLs(t *testing.T) {
+	ctx := context.Background()
+	urlStorage := storage.NewURLStorage(storage.NewMapStorage())
+	workspaces := NewWorkspaceService(urlStorage)
+	shortener := NewShortener(urlStorage, config.BaseURL, WithIDAllocator(NewIDAllocator(urlStorage, 10)))
+
+	workspace, err := workspaces.CreateWorkspace(ctx, "alice", "Marketing")
+	require.NoError(t, err)
+	token, _, err := workspaces.CreateInvite(ctx, "alice", workspace.ID, WorkspaceViewer)
+	require.NoError(t, err)
+	_, err = workspaces.AcceptInvite(ctx, "bob", token)
+	require.NoError(t, err)
+
+	shortURL, err := shortener.SaveWorkspaceData(ctx, "alice", workspace.ID, "https://github.com/1")
+	require.NoError(t, err)
+	urlID := shortURL[len(config.BaseURL)+1 : len(shortURL)-1]
+	_, err = shortener.SaveWorkspaceData(ctx, "bob", workspace.ID, "https://github.com/2")
+	require.ErrorAs(t, err, &WorkspaceForbiddenError{})
+
+	bobURLs, err := shortener.GetWorkspaceURLs(ctx, "bob", workspace.ID)
+	require.NoError(t, err)
+	require.Len(t, bobURLs, 1)
+	personalURLs, err := shortener.GetUserURLs(ctx, "alice")
+	require.NoError(t, err)
+	require.Empty(t, personalURLs)
+
+	require.ErrorAs(t, shortener.UpdateURL(ctx, "bob", workspace.ID, urlID, "https://github.com/3"), &WorkspaceForbiddenError{})
+	// Ссылка пространства не принадлежит лично пользователю
+	require.ErrorAs(t, shortener.UpdateURL(ctx, "alice", "", urlID, "https://github.com/3"), &OriginalURLNotFound{})
+	require.NoError(t, shortener.UpdateURL(ctx, "alice", workspace.ID, urlID, "https://github.com/3"))
+	originalURL, err := shortener.GetOriginalURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com/3", originalURL)
+
+	require.NoError(t, shortener.DeleteURL(ctx, "alice", workspace.ID, urlID))
+	_, err = shortener.GetOriginalURL(ctx, shortURL)
+	require.ErrorAs(t, err, &OriginalURLNotFound{})
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker размыкает цепь после серии временных ошибок подряд и
+// не пускает запросы в базу, пока не истечет OpenTimeout. После таймаута
+// пропускается один пробный запрос: успех замыкает цепь, ошибка снова размыкает.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	state            circuitState
+	failures         int
+	openedAt         time.Time
+	failureThreshold int
+	openTimeout      time.Duration
+	now              func() time.Time
+}
+
+// Allow можно ли сейчас обращаться к хранилищу. Пока цепь разомкнута, возвращает
+// RetryAfterError с CircuitOpenError и временем до пробного запроса.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if left := b.retryAfter(); left > 0 {
+			return RetryAfterError{Err: CircuitOpenError, RetryAfter: left}
+		}
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// Пробный запрос уже выполняется, его результат будет известен не позже чем через секунду
+		return RetryAfterError{Err: CircuitOpenError, RetryAfter: time.Second}
+	default:
+		return nil
+	}
+}
+
+// Success запрос выполнен, цепь замыкается
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = circuitClosed
+	b.failures = 0
+}
+
+// Failure временная ошибка хранилища
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.failureThreshold {
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Release пробный запрос завершился без ответа от базы (например, отменен контекст)
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+// RetryAfter через сколько цепь попробует замкнуться
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != circuitOpen {
+		return 0
+	}
+	return b.retryAfter()
+}
+
+func (b *CircuitBreaker) retryAfter() time.Duration {
+	left := b.openTimeout - b.now().Sub(b.openedAt)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+	}
+}
@@ -1,8 +1,14 @@
 package storage
 
 import (
+	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/lib/pq"
@@ -10,12 +16,41 @@ import (
 
 const KeyError = DBKeyError("Key does not exist")
 
+// ExistsError запись с таким ключом уже есть (ключ API, имя пользователя)
+const ExistsError = DBKeyError("Key already exists")
+
+const CircuitOpenError = DBUnavailableError("Storage is temporarily unavailable: circuit breaker is open")
+
+const ReadOnlyModeError = DBUnavailableError("Primary storage is unavailable, service is in read-only mode")
+
 type DBKeyError string
 
 func (e DBKeyError) Error() string {
 	return string(e)
 }
 
+// DBUnavailableError хранилище временно недоступно, запрос стоит повторить позже
+type DBUnavailableError string
+
+func (e DBUnavailableError) Error() string {
+	return string(e)
+}
+
+// RetryAfterError недоступность хранилища, для которой известно, когда оно снова начнет
+// принимать запросы. errors.As находит за ней исходную ошибку, например DBUnavailableError.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
 type LoadingDumbDataError struct {
 	err error
 }
@@ -29,6 +64,38 @@ func isDuplicateErr(err error) bool {
 	return errors.As(err, &pqErr) && pqErr.Code == pgerrcode.UniqueViolation
 }
 
+// isTransientErr ошибка временная и операцию можно безопасно повторить
+// (обрыв соединения, рестарт базы, конфликт сериализации, дедлок)
+func isTransientErr(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		if pgerrcode.IsConnectionException(code) {
+			return true
+		}
+		switch code {
+		case pgerrcode.SerializationFailure, pgerrcode.DeadlockDetected,
+			pgerrcode.AdminShutdown, pgerrcode.CrashShutdown, pgerrcode.CannotConnectNow,
+			pgerrcode.TooManyConnections:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
 type DuplicateURLErr struct {
 	URL string
 }
@@ -0,0 +1,404 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotSettingsKey отметка о том, что в снимке есть настройки ссылок. Из снимков
+// старого формата без настроек ссылки не обслуживаются, иначе, например, отключенная
+// ссылка снова начала бы работать.
+const snapshotSettingsKey = "snapshot:settings"
+
+// FallbackStorage держит на диске периодически обновляемый снимок соответствия
+// коротких ссылок исходным вместе с их настройками, кампаниями и ссылками-шаблонами.
+// Пока основное хранилище недоступно, редиректы обслуживаются из снимка, а запись
+// отклоняется с ReadOnlyModeError.
+type FallbackStorage struct {
+	ShortenerStorage
+	exporter     URLExporter
+	snapshotPath string
+	interval     time.Duration
+
+	mu       sync.RWMutex
+	snapshot Storage
+	degraded bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (s *FallbackStorage) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	originalURL, err := s.ShortenerStorage.GetOriginalURL(ctx, shortURL)
+	if !s.checkPrimary(err) {
+		return originalURL, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	encodedURL, snapshotErr := s.snapshot.Get(shortURL)
+	if snapshotErr != nil {
+		return "", err
+	}
+	return string(encodedURL), nil
+}
+
+// GetLinkSettings пока основное хранилище недоступно, настройки берутся из снимка.
+// Настройки по умолчанию получает только ссылка, которая есть в снимке без настроек.
+func (s *FallbackStorage) GetLinkSettings(ctx context.Context, shortURL string) (LinkSettings, error) {
+	settings, err := s.ShortenerStorage.GetLinkSettings(ctx, shortURL)
+	if !s.checkPrimary(err) {
+		return settings, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, snapshotErr := s.snapshot.Get(snapshotSettingsKey); snapshotErr != nil {
+		return LinkSettings{}, readOnlyError(err)
+	}
+	encodedSettings, snapshotErr := s.snapshot.Get(linkSettingsPrefix + shortURL)
+	if snapshotErr == nil {
+		settings = LinkSettings{ShortURL: shortURL}
+		return settings, json.Unmarshal(encodedSettings, &settings)
+	}
+	if _, snapshotErr := s.snapshot.Get(shortURL); snapshotErr != nil {
+		return LinkSettings{}, readOnlyError(err)
+	}
+	return LinkSettings{ShortURL: shortURL}, nil
+}
+
+func (s *FallbackStorage) SaveLinkSettings(ctx context.Context, settings LinkSettings) error {
+	err := s.ShortenerStorage.SaveLinkSettings(ctx, settings)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) SaveData(ctx context.Context, userToken string, urlData URLData) error {
+	err := s.ShortenerStorage.SaveData(ctx, userToken, urlData)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) SaveDataBatch(ctx context.Context, userToken string, urlData []URLData) error {
+	err := s.ShortenerStorage.SaveDataBatch(ctx, userToken, urlData)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) ImportLink(ctx context.Context, record LinkRecord) error {
+	err := s.ShortenerStorage.ImportLink(ctx, record)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) UpdateOriginalURL(ctx context.Context, shortURL, originalURL string, changedAt time.Time) error {
+	err := s.ShortenerStorage.UpdateOriginalURL(ctx, shortURL, originalURL, changedAt)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) ConsumeQuota(ctx context.Context, userToken, day string, n int64, limits QuotaLimits) (QuotaUsage, bool, error) {
+	usage, ok, err := s.ShortenerStorage.ConsumeQuota(ctx, userToken, day, n, limits)
+	if s.checkPrimary(err) {
+		return usage, false, readOnlyError(err)
+	}
+	return usage, ok, err
+}
+
+func (s *FallbackStorage) ConsumeClick(ctx context.Context, shortURL string, maxClicks int64) (int64, bool, error) {
+	clicks, ok, err := s.ShortenerStorage.ConsumeClick(ctx, shortURL, maxClicks)
+	if s.checkPrimary(err) {
+		return clicks, false, readOnlyError(err)
+	}
+	return clicks, ok, err
+}
+
+func (s *FallbackStorage) AddVariantClick(ctx context.Context, shortURL string, variant int) error {
+	err := s.ShortenerStorage.AddVariantClick(ctx, shortURL, variant)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) SaveLinkPattern(ctx context.Context, pattern LinkPattern) error {
+	err := s.ShortenerStorage.SaveLinkPattern(ctx, pattern)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+// GetLinkPatterns пока основное хранилище недоступно, шаблоны берутся из снимка
+func (s *FallbackStorage) GetLinkPatterns(ctx context.Context) ([]LinkPattern, error) {
+	patterns, err := s.ShortenerStorage.GetLinkPatterns(ctx)
+	if !s.checkPrimary(err) {
+		return patterns, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	patterns = nil
+	var decodeErr error
+	rangeErr := s.snapshot.Range(func(key string, value []byte) bool {
+		if !strings.HasPrefix(key, patternPrefix) {
+			return true
+		}
+		var pattern LinkPattern
+		if decodeErr = json.Unmarshal(value, &pattern); decodeErr != nil {
+			return false
+		}
+		patterns = append(patterns, pattern)
+		return true
+	})
+	if rangeErr != nil {
+		return nil, rangeErr
+	}
+	return patterns, decodeErr
+}
+
+func (s *FallbackStorage) DeleteLinkPattern(ctx context.Context, id string) error {
+	err := s.ShortenerStorage.DeleteLinkPattern(ctx, id)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) SaveCampaign(ctx context.Context, campaign Campaign) error {
+	err := s.ShortenerStorage.SaveCampaign(ctx, campaign)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+// GetCampaign пока основное хранилище недоступно, кампания берется из снимка.
+// В снимке есть только кампании, к которым привязаны ссылки.
+func (s *FallbackStorage) GetCampaign(ctx context.Context, id string) (Campaign, error) {
+	campaign, err := s.ShortenerStorage.GetCampaign(ctx, id)
+	if !s.checkPrimary(err) {
+		return campaign, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	encodedCampaign, snapshotErr := s.snapshot.Get(campaignPrefix + id)
+	if snapshotErr != nil {
+		return Campaign{}, snapshotErr
+	}
+	return campaign, json.Unmarshal(encodedCampaign, &campaign)
+}
+
+func (s *FallbackStorage) DeleteCampaign(ctx context.Context, id string) error {
+	err := s.ShortenerStorage.DeleteCampaign(ctx, id)
+	if s.checkPrimary(err) {
+		return readOnlyError(err)
+	}
+	return err
+}
+
+func (s *FallbackStorage) LeaseRange(ctx context.Context, size uint64) (uint64, error) {
+	start, err := s.ShortenerStorage.LeaseRange(ctx, size)
+	if s.checkPrimary(err) {
+		return 0, readOnlyError(err)
+	}
+	return start, err
+}
+
+func (s *FallbackStorage) GetUserURLs(ctx context.Context, userToken string) ([]URLData, error) {
+	userURLs, err := s.ShortenerStorage.GetUserURLs(ctx, userToken)
+	if s.checkPrimary(err) {
+		return nil, readOnlyError(err)
+	}
+	return userURLs, err
+}
+
+func (s *FallbackStorage) Ping(ctx context.Context) error {
+	err := s.ShortenerStorage.Ping(ctx)
+	if s.checkPrimary(err) {
+		return fmt.Errorf("%w: %s", readOnlyError(err), err)
+	}
+	return err
+}
+
+// Degraded работает ли сервис сейчас из снимка
+func (s *FallbackStorage) Degraded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.degraded
+}
+
+// Refresh выгружает все ссылки, их настройки и кампании, а также шаблоны из основного
+// хранилища и атомарно заменяет снимок на диске и в памяти
+func (s *FallbackStorage) Refresh(ctx context.Context) error {
+	urls, err := s.exporter.GetAllURLs(ctx)
+	s.checkPrimary(err)
+	if err != nil {
+		return err
+	}
+	allSettings, err := s.exporter.GetAllLinkSettings(ctx)
+	s.checkPrimary(err)
+	if err != nil {
+		return err
+	}
+	patterns, err := s.exporter.GetLinkPatterns(ctx)
+	s.checkPrimary(err)
+	if err != nil {
+		return err
+	}
+	records := make([]FileData, 0, len(urls)+len(allSettings)+len(patterns)+1)
+	campaigns := make(map[string]bool)
+	for _, urlData := range urls {
+		records = append(records, FileData{Key: urlData.ShortURL, Value: []byte(urlData.OriginalURL)})
+	}
+	for _, settings := range allSettings {
+		encodedSettings, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		records = append(records, FileData{Key: linkSettingsPrefix + settings.ShortURL, Value: encodedSettings})
+		if settings.CampaignID == "" || campaigns[settings.CampaignID] {
+			continue
+		}
+		campaigns[settings.CampaignID] = true
+		campaign, err := s.exporter.GetCampaign(ctx, settings.CampaignID)
+		s.checkPrimary(err)
+		if errors.Is(err, KeyError) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		encodedCampaign, err := json.Marshal(campaign)
+		if err != nil {
+			return err
+		}
+		records = append(records, FileData{Key: campaignPrefix + campaign.ID, Value: encodedCampaign})
+	}
+	for _, pattern := range patterns {
+		encodedPattern, err := json.Marshal(pattern)
+		if err != nil {
+			return err
+		}
+		records = append(records, FileData{Key: patternPrefix + pattern.ID, Value: encodedPattern})
+	}
+	records = append(records, FileData{Key: snapshotSettingsKey, Value: []byte("1")})
+
+	tmpPath := s.snapshotPath + ".tmp"
+	_ = os.Remove(tmpPath)
+	tmpStorage, err := NewURLFileStorage(tmpPath)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := tmpStorage.Set(record.Key, record.Value); err != nil {
+			_ = tmpStorage.Shutdown(ctx)
+			return err
+		}
+	}
+	if err := tmpStorage.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.snapshotPath); err != nil {
+		return err
+	}
+	snapshot := NewMapStorage()
+	for _, record := range records {
+		_ = snapshot.Set(record.Key, record.Value)
+	}
+	s.mu.Lock()
+	s.snapshot = snapshot
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FallbackStorage) Shutdown(ctx context.Context) error {
+	close(s.done)
+	s.wg.Wait()
+	return s.ShortenerStorage.Shutdown(ctx)
+}
+
+// readOnlyError ReadOnlyModeError со временем, через которое основное хранилище
+// снова начнет принимать запросы, если оно известно из его ошибки err
+func readOnlyError(err error) error {
+	var retryErr RetryAfterError
+	if errors.As(err, &retryErr) {
+		return RetryAfterError{Err: ReadOnlyModeError, RetryAfter: retryErr.RetryAfter}
+	}
+	return ReadOnlyModeError
+}
+
+// checkPrimary обновляет признак деградации по результату обращения
+// к основному хранилищу и возвращает true, если оно недоступно
+func (s *FallbackStorage) checkPrimary(err error) bool {
+	var unavailableErr DBUnavailableError
+	unavailable := isTransientErr(err) || errors.As(err, &unavailableErr)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if unavailable {
+		s.degraded = true
+	} else if err == nil || errors.Is(err, KeyError) {
+		s.degraded = false
+	}
+	return unavailable
+}
+
+func (s *FallbackStorage) refreshLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+			_ = s.Refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// NewFallbackStorage загружает последний снимок с диска и запускает его
+// периодическое обновление из exporter
+func NewFallbackStorage(primary ShortenerStorage, exporter URLExporter, snapshotPath string, interval time.Duration) (*FallbackStorage, error) {
+	// Битый снимок не мешает запуску: он будет перезаписан при обновлении
+	snapshot, err := NewURLFileStorage(snapshotPath)
+	var loadingErr LoadingDumbDataError
+	if err != nil && !errors.As(err, &loadingErr) {
+		return nil, err
+	}
+	// Снимок нужен только для чтения, файл держать открытым незачем
+	if err := snapshot.Shutdown(context.Background()); err != nil {
+		return nil, err
+	}
+	s := &FallbackStorage{
+		ShortenerStorage: primary,
+		exporter:         exporter,
+		snapshotPath:     snapshotPath,
+		interval:         interval,
+		snapshot:         snapshot,
+		done:             make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	_ = s.Refresh(ctx)
+
+	s.wg.Add(1)
+	go s.refreshLoop()
+	return s, nil
+}
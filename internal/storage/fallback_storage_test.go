@@ -0,0 +1,139 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/internal/mocks"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+type staticExporter struct {
+	urls     []storage.URLData
+	settings []storage.LinkSettings
+	patterns []storage.LinkPattern
+	err      error
+}
+
+func (e *staticExporter) GetAllURLs(ctx context.Context) ([]storage.URLData, error) {
+	return e.urls, e.err
+}
+
+func (e *staticExporter) GetAllLinkSettings(ctx context.Context) ([]storage.LinkSettings, error) {
+	return e.settings, e.err
+}
+
+func (e *staticExporter) GetLinkPatterns(ctx context.Context) ([]storage.LinkPattern, error) {
+	return e.patterns, e.err
+}
+
+func (e *staticExporter) GetCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	return storage.Campaign{}, storage.KeyError
+}
+
+// TestFallbackStorageDegradedMode при недоступной базе ссылки отдаются из снимка,
+// а запись отклоняется, пока база не вернется
+func TestFallbackStorageDegradedMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mocks.NewMockShortenerStorage(ctrl)
+	exporter := &staticExporter{urls: []storage.URLData{
+		{ShortURL: "http://localhost:8080/short/", OriginalURL: "https://github.com"},
+	}}
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot")
+
+	fs, err := storage.NewFallbackStorage(primary, exporter, snapshotPath, time.Hour)
+	require.NoError(t, err)
+	defer func() {
+		primary.EXPECT().Shutdown(gomock.Any()).Return(nil)
+		require.NoError(t, fs.Shutdown(context.Background()))
+	}()
+	require.False(t, fs.Degraded())
+
+	primary.EXPECT().GetOriginalURL(gomock.Any(), "http://localhost:8080/short/").Return("", driver.ErrBadConn)
+	originalURL, err := fs.GetOriginalURL(context.Background(), "http://localhost:8080/short/")
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com", originalURL)
+	require.True(t, fs.Degraded())
+
+	primary.EXPECT().GetOriginalURL(gomock.Any(), "http://localhost:8080/missing/").Return("", driver.ErrBadConn)
+	_, err = fs.GetOriginalURL(context.Background(), "http://localhost:8080/missing/")
+	require.ErrorIs(t, err, driver.ErrBadConn)
+
+	primary.EXPECT().SaveData(gomock.Any(), "user", gomock.Any()).
+		Return(storage.RetryAfterError{Err: storage.CircuitOpenError, RetryAfter: time.Minute})
+	err = fs.SaveData(context.Background(), "user", storage.URLData{ShortURL: "new", OriginalURL: "https://gitlab.com"})
+	require.ErrorIs(t, err, storage.ReadOnlyModeError)
+	var retryErr storage.RetryAfterError
+	require.ErrorAs(t, err, &retryErr)
+	require.Equal(t, time.Minute, retryErr.RetryAfter)
+
+	primary.EXPECT().Ping(gomock.Any()).Return(syscall.ECONNREFUSED)
+	require.ErrorIs(t, fs.Ping(context.Background()), storage.ReadOnlyModeError)
+
+	// База вернулась
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+	require.NoError(t, fs.Ping(context.Background()))
+	require.False(t, fs.Degraded())
+}
+
+// TestFallbackSnapshotSurvivesRestart снимок читается с диска при старте,
+// даже если база уже недоступна
+func TestFallbackSnapshotSurvivesRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mocks.NewMockShortenerStorage(ctrl)
+	primary.EXPECT().Shutdown(gomock.Any()).Return(nil).Times(2)
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot")
+
+	exporter := &staticExporter{urls: []storage.URLData{
+		{ShortURL: "http://localhost:8080/short/", OriginalURL: "https://github.com"},
+	}}
+	fs, err := storage.NewFallbackStorage(primary, exporter, snapshotPath, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, fs.Shutdown(context.Background()))
+
+	fs, err = storage.NewFallbackStorage(primary, &staticExporter{err: syscall.ECONNREFUSED}, snapshotPath, time.Hour)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, fs.Shutdown(context.Background()))
+	}()
+	require.True(t, fs.Degraded())
+
+	primary.EXPECT().GetOriginalURL(gomock.Any(), "http://localhost:8080/short/").Return("", syscall.ECONNREFUSED)
+	originalURL, err := fs.GetOriginalURL(context.Background(), "http://localhost:8080/short/")
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com", originalURL)
+}
+
+// TestFallbackOldSnapshotHasNoSettings в снимке старого формата нет настроек ссылок,
+// поэтому настройки из него не выдаются за настройки по умолчанию
+func TestFallbackOldSnapshotHasNoSettings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mocks.NewMockShortenerStorage(ctrl)
+	primary.EXPECT().Shutdown(gomock.Any()).Return(nil)
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot")
+
+	oldSnapshot, err := storage.NewURLFileStorage(snapshotPath)
+	require.NoError(t, err)
+	require.NoError(t, oldSnapshot.Set("http://localhost:8080/short/", []byte("https://github.com")))
+	require.NoError(t, oldSnapshot.Shutdown(context.Background()))
+
+	fs, err := storage.NewFallbackStorage(primary, &staticExporter{err: syscall.ECONNREFUSED}, snapshotPath, time.Hour)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, fs.Shutdown(context.Background()))
+	}()
+
+	primary.EXPECT().GetLinkSettings(gomock.Any(), "http://localhost:8080/short/").Return(storage.LinkSettings{}, syscall.ECONNREFUSED)
+	_, err = fs.GetLinkSettings(context.Background(), "http://localhost:8080/short/")
+	require.ErrorIs(t, err, storage.ReadOnlyModeError)
+}
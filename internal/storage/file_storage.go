@@ -3,13 +3,15 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"sync"
 
 	"github.com/maxsnegir/url-shortener/internal/utils"
 )
 
 type FileData struct {
-	Key   string
-	Value []byte
+	Key     string
+	Value   []byte
+	Deleted bool `json:",omitempty"`
 }
 
 type FileStorage struct {
@@ -17,6 +19,9 @@ type FileStorage struct {
 	FileWriter *utils.FileWriter
 	FileReader *utils.FileReader
 	Storage    Storage // In-memory storage
+	// mu записи в память и в файл идут в одном порядке, иначе после перезапуска
+	// могло бы восстановиться не последнее значение ключа
+	mu sync.Mutex
 }
 
 func (s *FileStorage) Get(key string) ([]byte, error) {
@@ -24,6 +29,8 @@ func (s *FileStorage) Get(key string) ([]byte, error) {
 }
 
 func (s *FileStorage) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if err := s.Storage.Set(key, value); err != nil {
 		return nil
 	}
@@ -38,6 +45,39 @@ func (s *FileStorage) Set(key string, value []byte) error {
 	return s.FileWriter.Write(encodedData)
 }
 
+// Delete дописывает в файл отметку об удалении ключа
+func (s *FileStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Storage.Delete(key); err != nil {
+		return err
+	}
+	encodedData, err := json.Marshal(&FileData{Key: key, Deleted: true})
+	if err != nil {
+		return err
+	}
+	return s.FileWriter.Write(encodedData)
+}
+
+// CompareAndSwap сравнение и замена выполняются в памяти, в файл попадает только новое значение
+func (s *FileStorage) CompareAndSwap(key string, old, value []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	swapped, err := s.Storage.CompareAndSwap(key, old, value)
+	if err != nil || !swapped {
+		return swapped, err
+	}
+	encodedData, err := json.Marshal(&FileData{Key: key, Value: value})
+	if err != nil {
+		return true, err
+	}
+	return true, s.FileWriter.Write(encodedData)
+}
+
+func (s *FileStorage) Range(fn func(key string, value []byte) bool) error {
+	return s.Storage.Range(fn)
+}
+
 func (s *FileStorage) loadDumpFromFile() error {
 	for {
 		fileData := &FileData{}
@@ -51,6 +91,12 @@ func (s *FileStorage) loadDumpFromFile() error {
 		if err := json.Unmarshal(encodedData, &fileData); err != nil {
 			return err
 		}
+		if fileData.Deleted {
+			if err := s.Storage.Delete(fileData.Key); err != nil {
+				return err
+			}
+			continue
+		}
 		if err := s.Storage.Set(fileData.Key, fileData.Value); err != nil {
 			return nil
 		}
@@ -111,3 +111,23 @@ func TestStorageIsPersistent(t *testing.T) {
 		})
 	}
 }
+
+func TestFileStorageDeleteIsPersistent(t *testing.T) {
+	filePath := "temp"
+	defer func() {
+		if err := utils.RemoveFile(filePath); err != nil {
+			t.Error(err)
+		}
+	}()
+	firstStorage, _ := NewURLFileStorage(filePath)
+	require.NoError(t, firstStorage.Set("Key 1", []byte("value")))
+	require.NoError(t, firstStorage.Set("Key 2", []byte("value 2")))
+	require.NoError(t, firstStorage.Delete("Key 1"))
+
+	secondStorage, _ := NewURLFileStorage(filePath)
+	_, err := secondStorage.Get("Key 1")
+	require.ErrorIs(t, err, KeyError, "Deleted key exists in second storage.")
+	value, err := secondStorage.Get("Key 2")
+	require.NoError(t, err, "Error while getting value from second storage.")
+	require.Equal(t, "value 2", string(value), "Data in second storage is wrong.")
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// virtualNodes число точек на кольце для каждого шарда, сглаживает распределение ключей
+const virtualNodes = 128
+
+// hashRing кольцо консистентного хеширования. Шард определяется по номеру,
+// поэтому новые шарды нужно добавлять в конец списка: тогда на новый шард
+// переезжает только часть ключей, а остальные остаются на месте.
+type hashRing struct {
+	points []uint32
+	shards map[uint32]int
+}
+
+// Shard номер шарда, которому принадлежит ключ
+func (r *hashRing) Shard(key string) int {
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.shards[r.points[i]]
+}
+
+func newHashRing(shardCount int) *hashRing {
+	ring := &hashRing{
+		points: make([]uint32, 0, shardCount*virtualNodes),
+		shards: make(map[uint32]int, shardCount*virtualNodes),
+	}
+	for shard := 0; shard < shardCount; shard++ {
+		for node := 0; node < virtualNodes; node++ {
+			point := crc32.ChecksumIEEE([]byte(fmt.Sprintf("shard-%d-%d", shard, node)))
+			if _, ok := ring.shards[point]; ok {
+				continue
+			}
+			ring.shards[point] = shard
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i] < ring.points[j]
+	})
+	return ring
+}
@@ -1,29 +1,75 @@
 package storage
 
-import "context"
+import (
+	"bytes"
+	"context"
+	"sync"
+)
 
 // MapStorage In-Memory хранилище
-type MapStorage map[string][]byte
+type MapStorage struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
 
-func (db MapStorage) Set(key string, value []byte) error {
-	db[key] = value
+func (db *MapStorage) Set(key string, value []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.data[key] = value
 	return nil
 }
 
-func (db MapStorage) Get(key string) ([]byte, error) {
-	value, ok := db[key]
+func (db *MapStorage) Get(key string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	value, ok := db.data[key]
 	if !ok {
 		return nil, KeyError
 	}
 	return value, nil
 }
 
-func (db MapStorage) Shutdown(ctx context.Context) error {
+func (db *MapStorage) Delete(key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.data, key)
+	return nil
+}
+
+// Range обходит копию данных, поэтому fn может менять хранилище
+func (db *MapStorage) Range(fn func(key string, value []byte) bool) error {
+	db.mu.RLock()
+	data := make(map[string][]byte, len(db.data))
+	for key, value := range db.data {
+		data[key] = value
+	}
+	db.mu.RUnlock()
+
+	for key, value := range data {
+		if !fn(key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+func (db *MapStorage) CompareAndSwap(key string, old, value []byte) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	current, ok := db.data[key]
+	if ok != (old != nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+	db.data[key] = value
+	return true, nil
+}
+
+func (db *MapStorage) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-func configureMapStorage() MapStorage {
-	return make(MapStorage)
+func configureMapStorage() *MapStorage {
+	return &MapStorage{data: make(map[string][]byte)}
 }
 
 func NewMapStorage() Storage {
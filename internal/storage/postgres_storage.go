@@ -2,6 +2,10 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -14,64 +18,52 @@ func (ps *PostgresStorage) GetOriginalURL(ctx context.Context, shortURL string)
 	const query = "SELECT original_url FROM url_data ud WHERE ud.short_url=$1;"
 	var originalURL string
 	err := ps.db.GetContext(ctx, &originalURL, query, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", KeyError
+	}
 	return originalURL, err
 }
 
+// SaveData ссылка и ее владелец записываются в одной транзакции
 func (ps *PostgresStorage) SaveData(ctx context.Context, userToken string, urlData URLData) (err error) {
-	tx, err := ps.db.BeginTx(ctx, nil)
+	tx, err := ps.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	urlDataID, err := ps.CreateURLData(ctx, urlData)
-	if err != nil {
-		if isDuplicateErr(err) {
-			return NewDuplicateError(urlData.ShortURL)
-		}
-		return err
-	}
-	if err := ps.CreateUserURL(ctx, userToken, urlDataID); err != nil {
+	if err := createUserURLData(ctx, tx, userToken, urlData); err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
-func (ps *PostgresStorage) CreateURLData(ctx context.Context, urlData URLData) (int, error) {
-	const query = `
+// createUserURLData создает ссылку и запись о ее владельце в транзакции tx
+func createUserURLData(ctx context.Context, tx *sqlx.Tx, userToken string, urlData URLData) error {
+	const urlDataQuery = `
 		INSERT INTO url_data(short_url, original_url)  
-		VALUES (:short_url, :original_url) 
+		VALUES ($1, $2) 
 		RETURNING url_data_id;`
+	const userURLQuery = `INSERT INTO user_url VALUES ($1, $2);`
 	var urlDataID int
-	stmt, err := ps.db.PrepareNamedContext(ctx, query)
-	if err != nil {
-		return urlDataID, err
+	if err := tx.GetContext(ctx, &urlDataID, urlDataQuery, urlData.ShortURL, urlData.OriginalURL); err != nil {
+		if isDuplicateErr(err) {
+			return NewDuplicateError(urlData.ShortURL)
+		}
+		return err
 	}
-	err = stmt.Get(&urlDataID, urlData)
-	return urlDataID, err
-}
-
-func (ps *PostgresStorage) CreateUserURL(ctx context.Context, userToken string, urlDataID int) error {
-	const query = `INSERT INTO user_url VALUES ($1, $2);`
-	_, err := ps.db.ExecContext(ctx, query, userToken, urlDataID)
+	_, err := tx.ExecContext(ctx, userURLQuery, userToken, urlDataID)
 	return err
 }
 
 func (ps *PostgresStorage) SaveDataBatch(ctx context.Context, userToken string, urlData []URLData) (err error) {
-	tx, err := ps.db.BeginTx(ctx, nil)
+	tx, err := ps.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	for _, url := range urlData {
-		urlDataID, err := ps.CreateURLData(ctx, url)
-		if err != nil {
-			if isDuplicateErr(err) {
-				return NewDuplicateError(url.ShortURL)
-			}
-			return err
-		}
-		if err := ps.CreateUserURL(ctx, userToken, urlDataID); err != nil {
+		if err := createUserURLData(ctx, tx, userToken, url); err != nil {
 			return err
 		}
 	}
@@ -92,6 +84,662 @@ func (ps *PostgresStorage) GetUserURLs(ctx context.Context, userToken string) ([
 	return userURLs, err
 }
 
+// LeaseRange атомарно сдвигает счетчик в таблице id_counter на size значений
+func (ps *PostgresStorage) LeaseRange(ctx context.Context, size uint64) (uint64, error) {
+	const query = `
+		INSERT INTO id_counter(name, value)
+		VALUES ('url_id', $1)
+		ON CONFLICT (name) DO UPDATE SET value = id_counter.value + EXCLUDED.value
+		RETURNING value;`
+	var last int64
+	if err := ps.db.GetContext(ctx, &last, query, int64(size)); err != nil {
+		return 0, err
+	}
+	return uint64(last) - size + 1, nil
+}
+
+func (ps *PostgresStorage) GetAllURLs(ctx context.Context) ([]URLData, error) {
+	const query = "SELECT short_url, original_url FROM url_data;"
+	var urls []URLData
+	err := ps.db.SelectContext(ctx, &urls, query)
+	return urls, err
+}
+
+func (ps *PostgresStorage) GetAllLinkSettings(ctx context.Context) ([]LinkSettings, error) {
+	const query = "SELECT short_url, settings FROM link_settings;"
+	var rows []struct {
+		ShortURL string `db:"short_url"`
+		Settings []byte `db:"settings"`
+	}
+	if err := ps.db.SelectContext(ctx, &rows, query); err != nil {
+		return nil, err
+	}
+	allSettings := make([]LinkSettings, 0, len(rows))
+	for _, row := range rows {
+		settings := LinkSettings{ShortURL: row.ShortURL}
+		if err := json.Unmarshal(row.Settings, &settings); err != nil {
+			return nil, err
+		}
+		allSettings = append(allSettings, settings)
+	}
+	return allSettings, nil
+}
+
+func (ps *PostgresStorage) GetAllUserURLs(ctx context.Context) ([]UserURLData, error) {
+	const query = `
+		SELECT uu.user_token, ud.short_url, ud.original_url
+		FROM url_data ud
+		JOIN user_url uu ON uu.url_data_id = ud.url_data_id;`
+	var userURLs []UserURLData
+	err := ps.db.SelectContext(ctx, &userURLs, query)
+	return userURLs, err
+}
+
+func (ps *PostgresStorage) DeleteURLData(ctx context.Context, shortURL string) error {
+	const deleteUserURLQuery = `
+		DELETE FROM user_url uu
+		USING url_data ud
+		WHERE uu.url_data_id = ud.url_data_id AND ud.short_url = $1;`
+	const deleteURLDataQuery = `DELETE FROM url_data WHERE short_url = $1;`
+	const deleteHistoryQuery = `DELETE FROM url_history WHERE short_url = $1;`
+	const deleteSettingsQuery = `DELETE FROM link_settings WHERE short_url = $1;`
+	const deleteClicksQuery = `DELETE FROM link_clicks WHERE short_url = $1;`
+	const deleteVariantClicksQuery = `DELETE FROM link_variant_clicks WHERE short_url = $1;`
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		deleteUserURLQuery, deleteURLDataQuery, deleteHistoryQuery,
+		deleteSettingsQuery, deleteClicksQuery, deleteVariantClicksQuery,
+	} {
+		if _, err := tx.ExecContext(ctx, query, shortURL); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ExportLink данные ссылки читаются из одного снимка базы
+func (ps *PostgresStorage) ExportLink(ctx context.Context, shortURL string) (LinkRecord, error) {
+	const urlDataQuery = "SELECT short_url, original_url FROM url_data WHERE short_url = $1;"
+	const ownersQuery = `
+		SELECT uu.user_token
+		FROM user_url uu
+		JOIN url_data ud ON ud.url_data_id = uu.url_data_id
+		WHERE ud.short_url = $1;`
+	const settingsQuery = "SELECT settings FROM link_settings WHERE short_url = $1;"
+	const clicksQuery = "SELECT clicks FROM link_clicks WHERE short_url = $1;"
+	const variantClicksQuery = "SELECT variant, clicks FROM link_variant_clicks WHERE short_url = $1;"
+	const historyQuery = `
+		SELECT short_url, version, original_url, replaced_at FROM url_history
+		WHERE short_url = $1 ORDER BY version;`
+
+	tx, err := ps.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return LinkRecord{}, err
+	}
+	defer tx.Rollback()
+
+	var record LinkRecord
+	if err := tx.GetContext(ctx, &record.URLData, urlDataQuery, shortURL); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LinkRecord{}, KeyError
+		}
+		return LinkRecord{}, err
+	}
+	if err := tx.SelectContext(ctx, &record.Owners, ownersQuery, shortURL); err != nil {
+		return LinkRecord{}, err
+	}
+	var encodedSettings []byte
+	err = tx.GetContext(ctx, &encodedSettings, settingsQuery, shortURL)
+	if err == nil {
+		record.Settings = &LinkSettings{}
+		err = json.Unmarshal(encodedSettings, record.Settings)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return LinkRecord{}, err
+	}
+	if err := tx.GetContext(ctx, &record.Clicks, clicksQuery, shortURL); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return LinkRecord{}, err
+	}
+	var variantClicks []struct {
+		Variant int   `db:"variant"`
+		Clicks  int64 `db:"clicks"`
+	}
+	if err := tx.SelectContext(ctx, &variantClicks, variantClicksQuery, shortURL); err != nil {
+		return LinkRecord{}, err
+	}
+	record.VariantClicks = make(map[int]int64, len(variantClicks))
+	for _, row := range variantClicks {
+		record.VariantClicks[row.Variant] = row.Clicks
+	}
+	if err := tx.SelectContext(ctx, &record.History, historyQuery, shortURL); err != nil {
+		return LinkRecord{}, err
+	}
+	return record, nil
+}
+
+func (ps *PostgresStorage) ImportLink(ctx context.Context, record LinkRecord) error {
+	const urlDataQuery = `
+		INSERT INTO url_data(short_url, original_url)
+		VALUES ($1, $2)
+		ON CONFLICT (short_url) DO UPDATE SET original_url = EXCLUDED.original_url
+		RETURNING url_data_id;`
+	const ownerQuery = `INSERT INTO user_url(user_token, url_data_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+	const deleteSettingsQuery = `DELETE FROM link_settings WHERE short_url = $1;`
+	const settingsQuery = `INSERT INTO link_settings(short_url, settings) VALUES ($1, $2);`
+	const clicksQuery = `
+		INSERT INTO link_clicks(short_url, clicks)
+		VALUES ($1, $2)
+		ON CONFLICT (short_url) DO UPDATE SET clicks = EXCLUDED.clicks;`
+	const deleteVariantClicksQuery = `DELETE FROM link_variant_clicks WHERE short_url = $1;`
+	const variantClicksQuery = `INSERT INTO link_variant_clicks(short_url, variant, clicks) VALUES ($1, $2, $3);`
+	const deleteHistoryQuery = `DELETE FROM url_history WHERE short_url = $1;`
+	const historyQuery = `
+		INSERT INTO url_history(short_url, version, original_url, replaced_at)
+		VALUES (:short_url, :version, :original_url, :replaced_at);`
+
+	shortURL := record.ShortURL
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var urlDataID int
+	if err := tx.GetContext(ctx, &urlDataID, urlDataQuery, shortURL, record.OriginalURL); err != nil {
+		return err
+	}
+	for _, userToken := range record.Owners {
+		if _, err := tx.ExecContext(ctx, ownerQuery, userToken, urlDataID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, deleteSettingsQuery, shortURL); err != nil {
+		return err
+	}
+	if record.Settings != nil {
+		encodedSettings, err := json.Marshal(record.Settings)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, settingsQuery, shortURL, encodedSettings); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, clicksQuery, shortURL, record.Clicks); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, deleteVariantClicksQuery, shortURL); err != nil {
+		return err
+	}
+	for variant, clicks := range record.VariantClicks {
+		if _, err := tx.ExecContext(ctx, variantClicksQuery, shortURL, variant, clicks); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, deleteHistoryQuery, shortURL); err != nil {
+		return err
+	}
+	for _, version := range record.History {
+		if _, err := tx.NamedExecContext(ctx, historyQuery, version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (ps *PostgresStorage) SaveAPIKey(ctx context.Context, apiKey APIKey) error {
+	const query = `
+		INSERT INTO api_key(id, user_token, name, key_hash, created_at)
+		VALUES (:id, :user_token, :name, :key_hash, :created_at);`
+	_, err := ps.db.NamedExecContext(ctx, query, apiKey)
+	if isDuplicateErr(err) {
+		return ExistsError
+	}
+	return err
+}
+
+func (ps *PostgresStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	const query = "SELECT id, user_token, name, key_hash, created_at, revoked_at FROM api_key WHERE key_hash = $1;"
+	var apiKey APIKey
+	err := ps.db.GetContext(ctx, &apiKey, query, keyHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apiKey, KeyError
+	}
+	return apiKey, err
+}
+
+func (ps *PostgresStorage) GetUserAPIKeys(ctx context.Context, userToken string) ([]APIKey, error) {
+	const query = `
+		SELECT id, user_token, name, key_hash, created_at, revoked_at
+		FROM api_key
+		WHERE user_token = $1
+		ORDER BY created_at;`
+	var apiKeys []APIKey
+	err := ps.db.SelectContext(ctx, &apiKeys, query, userToken)
+	return apiKeys, err
+}
+
+func (ps *PostgresStorage) RevokeAPIKey(ctx context.Context, userToken, id string, revokedAt time.Time) error {
+	const query = `
+		UPDATE api_key SET revoked_at = COALESCE(revoked_at, $3)
+		WHERE user_token = $1 AND id = $2;`
+	return ps.execAffecting(ctx, query, userToken, id, revokedAt)
+}
+
+func (ps *PostgresStorage) CreateAccount(ctx context.Context, account Account) error {
+	const query = `
+		INSERT INTO account(user_token, username, password_hash, created_at)
+		VALUES (:user_token, :username, :password_hash, :created_at);`
+	_, err := ps.db.NamedExecContext(ctx, query, account)
+	if isDuplicateErr(err) {
+		return ExistsError
+	}
+	return err
+}
+
+func (ps *PostgresStorage) GetAccount(ctx context.Context, username string) (Account, error) {
+	const query = "SELECT user_token, username, password_hash, created_at FROM account WHERE username = $1;"
+	var account Account
+	err := ps.db.GetContext(ctx, &account, query, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account, KeyError
+	}
+	return account, err
+}
+
+func (ps *PostgresStorage) SaveSession(ctx context.Context, session Session) error {
+	const query = `
+		INSERT INTO session(token_hash, user_token, created_at, expires_at)
+		VALUES (:token_hash, :user_token, :created_at, :expires_at);`
+	_, err := ps.db.NamedExecContext(ctx, query, session)
+	return err
+}
+
+func (ps *PostgresStorage) GetSession(ctx context.Context, tokenHash string) (Session, error) {
+	const query = "SELECT token_hash, user_token, created_at, expires_at FROM session WHERE token_hash = $1;"
+	var session Session
+	err := ps.db.GetContext(ctx, &session, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, KeyError
+	}
+	return session, err
+}
+
+func (ps *PostgresStorage) DeleteSession(ctx context.Context, tokenHash string) error {
+	const query = "DELETE FROM session WHERE token_hash = $1;"
+	_, err := ps.db.ExecContext(ctx, query, tokenHash)
+	return err
+}
+
+// MergeUserURLs ссылки, которые уже есть у toUserToken, не дублируются
+func (ps *PostgresStorage) MergeUserURLs(ctx context.Context, fromUserToken, toUserToken string) error {
+	const mergeQuery = `
+		INSERT INTO user_url(user_token, url_data_id)
+		SELECT $2, url_data_id FROM user_url WHERE user_token = $1
+		ON CONFLICT DO NOTHING;`
+	const deleteQuery = `DELETE FROM user_url WHERE user_token = $1;`
+	if fromUserToken == toUserToken {
+		return nil
+	}
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, mergeQuery, fromUserToken, toUserToken); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, deleteQuery, fromUserToken); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetLinkSettings настройки хранятся целиком в JSON, чтобы новые поля не требовали миграций
+func (ps *PostgresStorage) GetLinkSettings(ctx context.Context, shortURL string) (LinkSettings, error) {
+	const query = "SELECT settings FROM link_settings WHERE short_url = $1;"
+	settings := LinkSettings{ShortURL: shortURL}
+	var encodedSettings []byte
+	err := ps.db.GetContext(ctx, &encodedSettings, query, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	err = json.Unmarshal(encodedSettings, &settings)
+	return settings, err
+}
+
+func (ps *PostgresStorage) SaveLinkSettings(ctx context.Context, settings LinkSettings) error {
+	const query = `
+		INSERT INTO link_settings(short_url, settings)
+		VALUES ($1, $2)
+		ON CONFLICT (short_url) DO UPDATE SET settings = EXCLUDED.settings;`
+	encodedSettings, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = ps.db.ExecContext(ctx, query, settings.ShortURL, encodedSettings)
+	return err
+}
+
+// UpdateOriginalURL строка ссылки блокируется до конца транзакции, поэтому параллельные
+// изменения не получат одинаковый номер версии
+func (ps *PostgresStorage) UpdateOriginalURL(ctx context.Context, shortURL, originalURL string, changedAt time.Time) error {
+	const selectQuery = "SELECT original_url FROM url_data WHERE short_url = $1 FOR UPDATE;"
+	const historyQuery = `
+		INSERT INTO url_history(short_url, version, original_url, replaced_at)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3 FROM url_history WHERE short_url = $1;`
+	const updateQuery = "UPDATE url_data SET original_url = $2 WHERE short_url = $1;"
+
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var currentURL string
+	err = tx.GetContext(ctx, &currentURL, selectQuery, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return KeyError
+	}
+	if err != nil {
+		return err
+	}
+	if currentURL == originalURL {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, historyQuery, shortURL, currentURL, changedAt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, updateQuery, shortURL, originalURL); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ps *PostgresStorage) GetURLHistory(ctx context.Context, shortURL string) ([]URLVersion, error) {
+	const query = `
+		SELECT short_url, version, original_url, replaced_at FROM url_history
+		WHERE short_url = $1 ORDER BY version;`
+	var history []URLVersion
+	err := ps.db.SelectContext(ctx, &history, query, shortURL)
+	return history, err
+}
+
+func (ps *PostgresStorage) CreateWorkspace(ctx context.Context, workspace Workspace, owner WorkspaceMember) error {
+	const workspaceQuery = `
+		INSERT INTO workspace(id, name, created_at)
+		VALUES (:id, :name, :created_at);`
+	const memberQuery = `
+		INSERT INTO workspace_member(workspace_id, user_token, role, joined_at)
+		VALUES (:workspace_id, :user_token, :role, :joined_at);`
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.NamedExecContext(ctx, workspaceQuery, workspace); err != nil {
+		if isDuplicateErr(err) {
+			return ExistsError
+		}
+		return err
+	}
+	if _, err := tx.NamedExecContext(ctx, memberQuery, owner); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ps *PostgresStorage) GetWorkspace(ctx context.Context, id string) (Workspace, error) {
+	const query = "SELECT id, name, created_at FROM workspace WHERE id = $1;"
+	var workspace Workspace
+	err := ps.db.GetContext(ctx, &workspace, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return workspace, KeyError
+	}
+	return workspace, err
+}
+
+func (ps *PostgresStorage) GetWorkspaceMember(ctx context.Context, workspaceID, userToken string) (WorkspaceMember, error) {
+	const query = `
+		SELECT workspace_id, user_token, role, joined_at
+		FROM workspace_member
+		WHERE workspace_id = $1 AND user_token = $2;`
+	var member WorkspaceMember
+	err := ps.db.GetContext(ctx, &member, query, workspaceID, userToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return member, KeyError
+	}
+	return member, err
+}
+
+func (ps *PostgresStorage) GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]WorkspaceMember, error) {
+	const query = `
+		SELECT workspace_id, user_token, role, joined_at
+		FROM workspace_member
+		WHERE workspace_id = $1
+		ORDER BY joined_at;`
+	var members []WorkspaceMember
+	err := ps.db.SelectContext(ctx, &members, query, workspaceID)
+	return members, err
+}
+
+func (ps *PostgresStorage) GetUserWorkspaces(ctx context.Context, userToken string) ([]WorkspaceMember, error) {
+	const query = `
+		SELECT workspace_id, user_token, role, joined_at
+		FROM workspace_member
+		WHERE user_token = $1
+		ORDER BY joined_at;`
+	var members []WorkspaceMember
+	err := ps.db.SelectContext(ctx, &members, query, userToken)
+	return members, err
+}
+
+func (ps *PostgresStorage) SaveWorkspaceMember(ctx context.Context, member WorkspaceMember) error {
+	const query = `
+		INSERT INTO workspace_member(workspace_id, user_token, role, joined_at)
+		VALUES (:workspace_id, :user_token, :role, :joined_at)
+		ON CONFLICT (workspace_id, user_token) DO UPDATE SET role = EXCLUDED.role;`
+	_, err := ps.db.NamedExecContext(ctx, query, member)
+	return err
+}
+
+func (ps *PostgresStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID, userToken string) error {
+	const query = "DELETE FROM workspace_member WHERE workspace_id = $1 AND user_token = $2;"
+	return ps.execAffecting(ctx, query, workspaceID, userToken)
+}
+
+func (ps *PostgresStorage) SaveWorkspaceInvite(ctx context.Context, invite WorkspaceInvite) error {
+	const query = `
+		INSERT INTO workspace_invite(token_hash, workspace_id, role, created_at, expires_at)
+		VALUES (:token_hash, :workspace_id, :role, :created_at, :expires_at);`
+	_, err := ps.db.NamedExecContext(ctx, query, invite)
+	return err
+}
+
+func (ps *PostgresStorage) TakeWorkspaceInvite(ctx context.Context, tokenHash string) (WorkspaceInvite, error) {
+	const query = `
+		DELETE FROM workspace_invite WHERE token_hash = $1
+		RETURNING token_hash, workspace_id, role, created_at, expires_at;`
+	var invite WorkspaceInvite
+	err := ps.db.GetContext(ctx, &invite, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return invite, KeyError
+	}
+	return invite, err
+}
+
+// ConsumeQuota проверка лимитов и обновление счетчиков выполняются одним upsert,
+// поэтому параллельные запросы не могут вместе превысить квоту
+func (ps *PostgresStorage) ConsumeQuota(ctx context.Context, userToken, day string, n int64, limits QuotaLimits) (QuotaUsage, bool, error) {
+	const consumeQuery = `
+		INSERT INTO user_quota AS q (user_token, day, day_count, total)
+		VALUES ($1, $2, GREATEST($3::BIGINT, 0), GREATEST($3::BIGINT, 0))
+		ON CONFLICT (user_token) DO UPDATE SET
+		    day = EXCLUDED.day,
+		    day_count = GREATEST(CASE WHEN q.day = EXCLUDED.day THEN q.day_count ELSE 0 END + $3::BIGINT, 0),
+		    total = GREATEST(q.total + $3::BIGINT, 0)
+		WHERE $3::BIGINT <= 0
+		   OR (($4::BIGINT = 0 OR CASE WHEN q.day = EXCLUDED.day THEN q.day_count ELSE 0 END + $3::BIGINT <= $4::BIGINT)
+		   AND ($5::BIGINT = 0 OR q.total + $3::BIGINT <= $5::BIGINT))
+		RETURNING day, day_count, total;`
+	const selectQuery = "SELECT day, day_count, total FROM user_quota WHERE user_token = $1;"
+
+	var usage QuotaUsage
+	// Первая запись вставляется без проверки лимитов, поэтому n сверяется с ними заранее
+	if _, ok := usage.add(day, n, limits); !ok {
+		return usage, false, nil
+	}
+	err := ps.db.GetContext(ctx, &usage, consumeQuery, userToken, day, n, limits.Daily, limits.Total)
+	if err == nil {
+		return usage, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return usage, false, err
+	}
+	err = ps.db.GetContext(ctx, &usage, selectQuery, userToken)
+	if usage.Day != day {
+		usage.Day, usage.DayCount = day, 0
+	}
+	return usage, false, err
+}
+
+// ConsumeClick счетчик увеличивается условным upsert: при исчерпанном лимите
+// строка не обновляется и запрос ничего не возвращает
+func (ps *PostgresStorage) ConsumeClick(ctx context.Context, shortURL string, maxClicks int64) (int64, bool, error) {
+	const consumeQuery = `
+		INSERT INTO link_clicks AS c (short_url, clicks)
+		VALUES ($1, 1)
+		ON CONFLICT (short_url) DO UPDATE SET clicks = c.clicks + 1
+		WHERE $2::BIGINT = 0 OR c.clicks < $2::BIGINT
+		RETURNING clicks;`
+	const selectQuery = "SELECT clicks FROM link_clicks WHERE short_url = $1;"
+
+	var clicks int64
+	err := ps.db.GetContext(ctx, &clicks, consumeQuery, shortURL, maxClicks)
+	if err == nil {
+		return clicks, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+	err = ps.db.GetContext(ctx, &clicks, selectQuery, shortURL)
+	return clicks, false, err
+}
+
+func (ps *PostgresStorage) GetClicks(ctx context.Context, shortURL string) (int64, error) {
+	const query = "SELECT clicks FROM link_clicks WHERE short_url = $1;"
+	var clicks int64
+	err := ps.db.GetContext(ctx, &clicks, query, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return clicks, err
+}
+
+func (ps *PostgresStorage) AddVariantClick(ctx context.Context, shortURL string, variant int) error {
+	const query = `
+		INSERT INTO link_variant_clicks AS c (short_url, variant, clicks)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (short_url, variant) DO UPDATE SET clicks = c.clicks + 1;`
+	_, err := ps.db.ExecContext(ctx, query, shortURL, variant)
+	return err
+}
+
+func (ps *PostgresStorage) GetVariantClicks(ctx context.Context, shortURL string) (map[int]int64, error) {
+	const query = "SELECT variant, clicks FROM link_variant_clicks WHERE short_url = $1;"
+	var rows []struct {
+		Variant int   `db:"variant"`
+		Clicks  int64 `db:"clicks"`
+	}
+	if err := ps.db.SelectContext(ctx, &rows, query, shortURL); err != nil {
+		return nil, err
+	}
+	clicks := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		clicks[row.Variant] = row.Clicks
+	}
+	return clicks, nil
+}
+
+func (ps *PostgresStorage) SaveLinkPattern(ctx context.Context, pattern LinkPattern) error {
+	const query = `
+		INSERT INTO link_pattern(id, pattern, shape, template, created_by, created_at)
+		VALUES (:id, :pattern, :shape, :template, :created_by, :created_at);`
+	_, err := ps.db.NamedExecContext(ctx, query, pattern)
+	if isDuplicateErr(err) {
+		return ExistsError
+	}
+	return err
+}
+
+func (ps *PostgresStorage) GetLinkPatterns(ctx context.Context) ([]LinkPattern, error) {
+	const query = "SELECT id, pattern, shape, template, created_by, created_at FROM link_pattern ORDER BY created_at;"
+	var patterns []LinkPattern
+	err := ps.db.SelectContext(ctx, &patterns, query)
+	return patterns, err
+}
+
+func (ps *PostgresStorage) DeleteLinkPattern(ctx context.Context, id string) error {
+	return ps.execAffecting(ctx, "DELETE FROM link_pattern WHERE id = $1;", id)
+}
+
+func (ps *PostgresStorage) SaveCampaign(ctx context.Context, campaign Campaign) error {
+	const query = `
+		INSERT INTO campaign(id, owner, name, utm_source, utm_medium, utm_campaign, created_at)
+		VALUES (:id, :owner, :name, :utm_source, :utm_medium, :utm_campaign, :created_at)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, utm_source = EXCLUDED.utm_source,
+		    utm_medium = EXCLUDED.utm_medium, utm_campaign = EXCLUDED.utm_campaign;`
+	_, err := ps.db.NamedExecContext(ctx, query, campaign)
+	return err
+}
+
+func (ps *PostgresStorage) GetCampaign(ctx context.Context, id string) (Campaign, error) {
+	const query = "SELECT id, owner, name, utm_source, utm_medium, utm_campaign, created_at FROM campaign WHERE id = $1;"
+	var campaign Campaign
+	err := ps.db.GetContext(ctx, &campaign, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return campaign, KeyError
+	}
+	return campaign, err
+}
+
+func (ps *PostgresStorage) GetCampaigns(ctx context.Context, owner string) ([]Campaign, error) {
+	const query = `
+		SELECT id, owner, name, utm_source, utm_medium, utm_campaign, created_at
+		FROM campaign
+		WHERE owner = $1
+		ORDER BY created_at;`
+	var campaigns []Campaign
+	err := ps.db.SelectContext(ctx, &campaigns, query, owner)
+	return campaigns, err
+}
+
+func (ps *PostgresStorage) DeleteCampaign(ctx context.Context, id string) error {
+	return ps.execAffecting(ctx, "DELETE FROM campaign WHERE id = $1;", id)
+}
+
+// execAffecting выполняет изменение и возвращает KeyError, если не затронуто ни одной строки
+func (ps *PostgresStorage) execAffecting(ctx context.Context, query string, args ...interface{}) error {
+	result, err := ps.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return KeyError
+	}
+	return nil
+}
+
 func (ps *PostgresStorage) Ping(ctx context.Context) error {
 	return ps.db.PingContext(ctx)
 }
@@ -114,11 +762,101 @@ func (ps *PostgresStorage) initPostgresStorage(ctx context.Context) {
 		);
 		CREATE UNIQUE INDEX IF NOT EXISTS user_url_data ON user_url (user_token, url_data_id);
 		CREATE INDEX IF NOT EXISTS user_token ON user_url (user_token);
+		CREATE TABLE IF NOT EXISTS id_counter (
+		    name VARCHAR(64) PRIMARY KEY,
+		    value BIGINT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS api_key (
+		    id VARCHAR(32) PRIMARY KEY,
+		    user_token VARCHAR(36) NOT NULL,
+		    name VARCHAR(255) NOT NULL,
+		    key_hash VARCHAR(64) NOT NULL UNIQUE,
+		    created_at TIMESTAMPTZ NOT NULL,
+		    revoked_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS api_key_user_token ON api_key (user_token);
+		CREATE TABLE IF NOT EXISTS account (
+		    user_token VARCHAR(36) PRIMARY KEY,
+		    username VARCHAR(64) NOT NULL UNIQUE,
+		    password_hash VARCHAR(255) NOT NULL,
+		    created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS session (
+		    token_hash VARCHAR(64) PRIMARY KEY,
+		    user_token VARCHAR(36) NOT NULL,
+		    created_at TIMESTAMPTZ NOT NULL,
+		    expires_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS link_settings (
+		    short_url VARCHAR(255) PRIMARY KEY,
+		    settings JSONB NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS workspace (
+		    id VARCHAR(36) PRIMARY KEY,
+		    name VARCHAR(255) NOT NULL,
+		    created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS workspace_member (
+		    workspace_id VARCHAR(36) NOT NULL REFERENCES workspace(id),
+		    user_token VARCHAR(36) NOT NULL,
+		    role VARCHAR(16) NOT NULL,
+		    joined_at TIMESTAMPTZ NOT NULL,
+		    PRIMARY KEY (workspace_id, user_token)
+		);
+		CREATE INDEX IF NOT EXISTS workspace_member_user_token ON workspace_member (user_token);
+		CREATE TABLE IF NOT EXISTS workspace_invite (
+		    token_hash VARCHAR(64) PRIMARY KEY,
+		    workspace_id VARCHAR(36) NOT NULL REFERENCES workspace(id),
+		    role VARCHAR(16) NOT NULL,
+		    created_at TIMESTAMPTZ NOT NULL,
+		    expires_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS user_quota (
+		    user_token VARCHAR(36) PRIMARY KEY,
+		    day VARCHAR(10) NOT NULL,
+		    day_count BIGINT NOT NULL,
+		    total BIGINT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS url_history (
+		    short_url VARCHAR(255) NOT NULL,
+		    version BIGINT NOT NULL,
+		    original_url VARCHAR(255) NOT NULL,
+		    replaced_at TIMESTAMPTZ NOT NULL,
+		    PRIMARY KEY (short_url, version)
+		);
+		CREATE TABLE IF NOT EXISTS link_clicks (
+		    short_url VARCHAR(255) PRIMARY KEY,
+		    clicks BIGINT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS campaign (
+		    id VARCHAR(32) PRIMARY KEY,
+		    owner VARCHAR(36) NOT NULL,
+		    name VARCHAR(100) NOT NULL,
+		    utm_source VARCHAR(255) NOT NULL,
+		    utm_medium VARCHAR(255) NOT NULL,
+		    utm_campaign VARCHAR(255) NOT NULL,
+		    created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS campaign_owner_idx ON campaign(owner);
+		CREATE TABLE IF NOT EXISTS link_pattern (
+		    id VARCHAR(32) PRIMARY KEY,
+		    pattern VARCHAR(255) NOT NULL,
+		    shape VARCHAR(255) NOT NULL UNIQUE,
+		    template VARCHAR(2048) NOT NULL,
+		    created_by VARCHAR(36) NOT NULL,
+		    created_at TIMESTAMPTZ NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS link_variant_clicks (
+		    short_url VARCHAR(255) NOT NULL,
+		    variant INTEGER NOT NULL,
+		    clicks BIGINT NOT NULL,
+		    PRIMARY KEY (short_url, variant)
+		);
 	`
 	ps.db.MustExecContext(ctx, schema)
 }
 
-func NewPostgresStorage(ctx context.Context, dsn string) (ShortenerStorage, error) {
+func NewPostgresStorage(ctx context.Context, dsn string) (*PostgresStorage, error) {
 	db, err := sqlx.Connect("postgres", dsn)
 	if err != nil {
 		return nil, err
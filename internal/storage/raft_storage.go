@@ -0,0 +1,667 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/raft"
+)
+
+const ClusterUnavailableError = DBUnavailableError("Storage is temporarily unavailable: cluster has no leader")
+
+// proposeTimeout сколько ждать коммита одной записи в журнал Raft
+const proposeTimeout = 3 * time.Second
+
+const (
+	raftURLPrefix     = "url/"
+	raftUserURLPrefix = "user/"
+)
+
+// kvStateMachine реплицируемое состояние: команды журнала - записи FileData,
+// как в файловом хранилище, а снимок - те же записи построчно
+type kvStateMachine struct {
+	state *MapStorage
+}
+
+// raftCommand команда журнала: одна запись FileData или, если задан Writes,
+// несколько записей одной операции, которые применяются вместе
+type raftCommand struct {
+	FileData
+	Writes []FileData `json:",omitempty"`
+}
+
+func (m *kvStateMachine) Apply(command []byte) {
+	decoded := &raftCommand{}
+	if err := json.Unmarshal(command, decoded); err != nil {
+		return
+	}
+	writes := decoded.Writes
+	if len(writes) == 0 {
+		writes = []FileData{decoded.FileData}
+	}
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	for _, fileData := range writes {
+		if fileData.Deleted {
+			delete(m.state.data, fileData.Key)
+			continue
+		}
+		m.state.data[fileData.Key] = fileData.Value
+	}
+}
+
+func (m *kvStateMachine) Snapshot() ([]byte, error) {
+	var buf bytes.Buffer
+	var encodeErr error
+	err := m.state.Range(func(key string, value []byte) bool {
+		var encodedData []byte
+		encodedData, encodeErr = json.Marshal(&FileData{Key: key, Value: value})
+		if encodeErr != nil {
+			return false
+		}
+		buf.Write(encodedData)
+		buf.WriteByte('\n')
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encodeErr
+}
+
+func (m *kvStateMachine) Restore(snapshot []byte) error {
+	data := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(snapshot))
+	scanner.Buffer(nil, len(snapshot)+1)
+	for scanner.Scan() {
+		fileData := &FileData{}
+		if err := json.Unmarshal(scanner.Bytes(), fileData); err != nil {
+			return err
+		}
+		data[fileData.Key] = fileData.Value
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	m.state.data = data
+	return nil
+}
+
+// replicatedStorage Storage поверх реплицируемого состояния. Чтение локальное,
+// запись проходит через журнал Raft и возможна только на лидере.
+type replicatedStorage struct {
+	node   *raft.Node
+	state  *MapStorage
+	prefix string
+}
+
+func (s *replicatedStorage) Get(key string) ([]byte, error) {
+	return s.state.Get(s.prefix + key)
+}
+
+func (s *replicatedStorage) Set(key string, value []byte) error {
+	return s.propose(&FileData{Key: s.prefix + key, Value: value})
+}
+
+func (s *replicatedStorage) Delete(key string) error {
+	return s.propose(&FileData{Key: s.prefix + key, Deleted: true})
+}
+
+func (s *replicatedStorage) Range(fn func(key string, value []byte) bool) error {
+	return s.state.Range(func(key string, value []byte) bool {
+		if len(key) < len(s.prefix) || key[:len(s.prefix)] != s.prefix {
+			return true
+		}
+		return fn(key[len(s.prefix):], value)
+	})
+}
+
+// CompareAndSwap записи на лидере выполняются по одной после Barrier, поэтому
+// локальное состояние актуально и сравнение с ним не пропустит чужую запись
+func (s *replicatedStorage) CompareAndSwap(key string, old, value []byte) (bool, error) {
+	current, err := s.state.Get(s.prefix + key)
+	if err != nil && !errors.Is(err, KeyError) {
+		return false, err
+	}
+	if (err == nil) != (old != nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+	return true, s.Set(key, value)
+}
+
+func (s *replicatedStorage) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *replicatedStorage) propose(fileData *FileData) error {
+	return propose(s.node, fileData)
+}
+
+// propose предлагает команду в журнал и ждет ее коммита
+func propose(node *raft.Node, command interface{}) error {
+	encodedCommand, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), proposeTimeout)
+	defer cancel()
+	return node.Propose(ctx, encodedCommand)
+}
+
+// raftCall операция записи, которую выполняет лидер
+type raftCall struct {
+	Method string
+	Args   json.RawMessage
+}
+
+type raftResult struct {
+	Result json.RawMessage `json:",omitempty"`
+	Error  *raftError      `json:",omitempty"`
+}
+
+// raftError ошибка хранилища, переданная с лидера с сохранением типа
+type raftError struct {
+	Code    string
+	Message string
+	URL     string `json:",omitempty"`
+}
+
+func encodeRaftError(err error) *raftError {
+	if err == nil {
+		return nil
+	}
+	var duplicateErr *DuplicateURLErr
+	var unavailableErr DBUnavailableError
+	switch {
+	case errors.As(err, &duplicateErr):
+		return &raftError{Code: "duplicate", URL: duplicateErr.URL}
+	case errors.Is(err, KeyError):
+		return &raftError{Code: "not_found"}
+	case errors.Is(err, ExistsError):
+		return &raftError{Code: "exists"}
+	case errors.As(err, &unavailableErr):
+		return &raftError{Code: "unavailable", Message: err.Error()}
+	default:
+		return &raftError{Code: "internal", Message: err.Error()}
+	}
+}
+
+func (e *raftError) decode() error {
+	switch e.Code {
+	case "duplicate":
+		return NewDuplicateError(e.URL)
+	case "not_found":
+		return KeyError
+	case "exists":
+		return ExistsError
+	case "unavailable":
+		return DBUnavailableError(e.Message)
+	default:
+		return errors.New(e.Message)
+	}
+}
+
+type raftHandler func(ctx context.Context, args json.RawMessage) (interface{}, error)
+
+// handle декодирует аргументы операции в A
+func handle[A any](fn func(ctx context.Context, args A) (interface{}, error)) raftHandler {
+	return func(ctx context.Context, encodedArgs json.RawMessage) (interface{}, error) {
+		var args A
+		if err := json.Unmarshal(encodedArgs, &args); err != nil {
+			return nil, err
+		}
+		return fn(ctx, args)
+	}
+}
+
+type saveDataArgs struct {
+	UserToken string
+	URLData   []URLData
+}
+
+type leaseRangeArgs struct {
+	Size uint64
+}
+
+type deleteURLDataArgs struct {
+	ShortURL string
+}
+
+type tokenHashArgs struct {
+	TokenHash string
+}
+
+type mergeUserURLsArgs struct {
+	FromUserToken string
+	ToUserToken   string
+}
+
+type updateOriginalURLArgs struct {
+	ShortURL    string
+	OriginalURL string
+	ChangedAt   time.Time
+}
+
+type createWorkspaceArgs struct {
+	Workspace Workspace
+	Owner     WorkspaceMember
+}
+
+type workspaceMemberArgs struct {
+	WorkspaceID string
+	UserToken   string
+}
+
+type revokeAPIKeyArgs struct {
+	UserToken string
+	ID        string
+	RevokedAt time.Time
+}
+
+type consumeQuotaArgs struct {
+	UserToken string
+	Day       string
+	N         int64
+	Limits    QuotaLimits
+}
+
+type consumeQuotaResult struct {
+	Usage    QuotaUsage
+	Consumed bool
+}
+
+type consumeClickArgs struct {
+	ShortURL  string
+	MaxClicks int64
+}
+
+type consumeClickResult struct {
+	Clicks   int64
+	Consumed bool
+}
+
+type campaignIDArgs struct {
+	ID string
+}
+
+type linkPatternIDArgs struct {
+	ID string
+}
+
+type addVariantClickArgs struct {
+	ShortURL string
+	Variant  int
+}
+
+// raftReads чтения, которые узел обслуживает из своей копии данных без обращения к лидеру.
+// RaftStorage встраивает только их, а не всю копию: запись, которую забыли провести
+// через журнал, не скомпилируется, вместо того чтобы попасть в копию одного узла.
+type raftReads interface {
+	GetOriginalURL(ctx context.Context, shortURL string) (string, error)
+	GetUserURLs(ctx context.Context, userToken string) ([]URLData, error)
+	GetAllURLs(ctx context.Context) ([]URLData, error)
+	GetAllLinkSettings(ctx context.Context) ([]LinkSettings, error)
+	GetAllUserURLs(ctx context.Context) ([]UserURLData, error)
+	ExportLink(ctx context.Context, shortURL string) (LinkRecord, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userToken string) ([]APIKey, error)
+	GetLinkSettings(ctx context.Context, shortURL string) (LinkSettings, error)
+	GetURLHistory(ctx context.Context, shortURL string) ([]URLVersion, error)
+	GetWorkspace(ctx context.Context, id string) (Workspace, error)
+	GetWorkspaceMember(ctx context.Context, workspaceID, userToken string) (WorkspaceMember, error)
+	GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]WorkspaceMember, error)
+	GetUserWorkspaces(ctx context.Context, userToken string) ([]WorkspaceMember, error)
+	GetClicks(ctx context.Context, shortURL string) (int64, error)
+	GetVariantClicks(ctx context.Context, shortURL string) (map[int]int64, error)
+	GetLinkPatterns(ctx context.Context) ([]LinkPattern, error)
+	GetCampaign(ctx context.Context, id string) (Campaign, error)
+	GetCampaigns(ctx context.Context, owner string) ([]Campaign, error)
+	GetAccount(ctx context.Context, username string) (Account, error)
+	GetSession(ctx context.Context, tokenHash string) (Session, error)
+}
+
+// RaftStorage кластерное хранилище без внешней базы. Записи выполняются
+// на лидере (остальные узлы пересылают их ему) и реплицируются журналом Raft,
+// чтения обслуживаются локальной копией узла и могут немного отставать от лидера.
+type RaftStorage struct {
+	raftReads
+	node     *raft.Node
+	local    *URLStorage
+	handlers map[string]raftHandler
+	// writeMu лидер выполняет записи по одной, поэтому чтение-изменение-запись атомарно
+	writeMu sync.Mutex
+	server  *http.Server
+}
+
+// SaveData ссылка и запись о владельце реплицируются одной командой журнала,
+// поэтому смена лидера между ними не оставит ссылку без владельца
+func (s *RaftStorage) SaveData(ctx context.Context, userToken string, urlData URLData) error {
+	return s.execute(ctx, "SaveData", saveDataArgs{UserToken: userToken, URLData: []URLData{urlData}}, nil)
+}
+
+// SaveDataBatch пакет, как и в PostgresStorage, сохраняется целиком или не сохраняется вовсе
+func (s *RaftStorage) SaveDataBatch(ctx context.Context, userToken string, urlData []URLData) error {
+	return s.execute(ctx, "SaveDataBatch", saveDataArgs{UserToken: userToken, URLData: urlData}, nil)
+}
+
+func (s *RaftStorage) LeaseRange(ctx context.Context, size uint64) (uint64, error) {
+	var start uint64
+	err := s.execute(ctx, "LeaseRange", leaseRangeArgs{Size: size}, &start)
+	return start, err
+}
+
+func (s *RaftStorage) DeleteURLData(ctx context.Context, shortURL string) error {
+	return s.execute(ctx, "DeleteURLData", deleteURLDataArgs{ShortURL: shortURL}, nil)
+}
+
+func (s *RaftStorage) ImportLink(ctx context.Context, record LinkRecord) error {
+	return s.execute(ctx, "ImportLink", record, nil)
+}
+
+func (s *RaftStorage) SaveAPIKey(ctx context.Context, apiKey APIKey) error {
+	return s.execute(ctx, "SaveAPIKey", apiKey, nil)
+}
+
+func (s *RaftStorage) RevokeAPIKey(ctx context.Context, userToken, id string, revokedAt time.Time) error {
+	return s.execute(ctx, "RevokeAPIKey", revokeAPIKeyArgs{UserToken: userToken, ID: id, RevokedAt: revokedAt}, nil)
+}
+
+func (s *RaftStorage) CreateAccount(ctx context.Context, account Account) error {
+	return s.execute(ctx, "CreateAccount", account, nil)
+}
+
+func (s *RaftStorage) SaveLinkSettings(ctx context.Context, settings LinkSettings) error {
+	return s.execute(ctx, "SaveLinkSettings", settings, nil)
+}
+
+func (s *RaftStorage) UpdateOriginalURL(ctx context.Context, shortURL, originalURL string, changedAt time.Time) error {
+	args := updateOriginalURLArgs{ShortURL: shortURL, OriginalURL: originalURL, ChangedAt: changedAt}
+	return s.execute(ctx, "UpdateOriginalURL", args, nil)
+}
+
+func (s *RaftStorage) CreateWorkspace(ctx context.Context, workspace Workspace, owner WorkspaceMember) error {
+	return s.execute(ctx, "CreateWorkspace", createWorkspaceArgs{Workspace: workspace, Owner: owner}, nil)
+}
+
+func (s *RaftStorage) SaveWorkspaceMember(ctx context.Context, member WorkspaceMember) error {
+	return s.execute(ctx, "SaveWorkspaceMember", member, nil)
+}
+
+func (s *RaftStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID, userToken string) error {
+	return s.execute(ctx, "DeleteWorkspaceMember", workspaceMemberArgs{WorkspaceID: workspaceID, UserToken: userToken}, nil)
+}
+
+func (s *RaftStorage) SaveWorkspaceInvite(ctx context.Context, invite WorkspaceInvite) error {
+	return s.execute(ctx, "SaveWorkspaceInvite", invite, nil)
+}
+
+func (s *RaftStorage) TakeWorkspaceInvite(ctx context.Context, tokenHash string) (WorkspaceInvite, error) {
+	var invite WorkspaceInvite
+	err := s.execute(ctx, "TakeWorkspaceInvite", tokenHashArgs{TokenHash: tokenHash}, &invite)
+	return invite, err
+}
+
+func (s *RaftStorage) ConsumeQuota(ctx context.Context, userToken, day string, n int64, limits QuotaLimits) (QuotaUsage, bool, error) {
+	var result consumeQuotaResult
+	args := consumeQuotaArgs{UserToken: userToken, Day: day, N: n, Limits: limits}
+	err := s.execute(ctx, "ConsumeQuota", args, &result)
+	return result.Usage, result.Consumed, err
+}
+
+func (s *RaftStorage) ConsumeClick(ctx context.Context, shortURL string, maxClicks int64) (int64, bool, error) {
+	var result consumeClickResult
+	err := s.execute(ctx, "ConsumeClick", consumeClickArgs{ShortURL: shortURL, MaxClicks: maxClicks}, &result)
+	return result.Clicks, result.Consumed, err
+}
+
+func (s *RaftStorage) AddVariantClick(ctx context.Context, shortURL string, variant int) error {
+	return s.execute(ctx, "AddVariantClick", addVariantClickArgs{ShortURL: shortURL, Variant: variant}, nil)
+}
+
+func (s *RaftStorage) SaveLinkPattern(ctx context.Context, pattern LinkPattern) error {
+	return s.execute(ctx, "SaveLinkPattern", pattern, nil)
+}
+
+func (s *RaftStorage) DeleteLinkPattern(ctx context.Context, id string) error {
+	return s.execute(ctx, "DeleteLinkPattern", linkPatternIDArgs{ID: id}, nil)
+}
+
+func (s *RaftStorage) SaveCampaign(ctx context.Context, campaign Campaign) error {
+	return s.execute(ctx, "SaveCampaign", campaign, nil)
+}
+
+func (s *RaftStorage) DeleteCampaign(ctx context.Context, id string) error {
+	return s.execute(ctx, "DeleteCampaign", campaignIDArgs{ID: id}, nil)
+}
+
+func (s *RaftStorage) SaveSession(ctx context.Context, session Session) error {
+	return s.execute(ctx, "SaveSession", session, nil)
+}
+
+func (s *RaftStorage) DeleteSession(ctx context.Context, tokenHash string) error {
+	return s.execute(ctx, "DeleteSession", tokenHashArgs{TokenHash: tokenHash}, nil)
+}
+
+func (s *RaftStorage) MergeUserURLs(ctx context.Context, fromUserToken, toUserToken string) error {
+	return s.execute(ctx, "MergeUserURLs", mergeUserURLsArgs{FromUserToken: fromUserToken, ToUserToken: toUserToken}, nil)
+}
+
+func (s *RaftStorage) Ping(ctx context.Context) error {
+	if s.node.Leader() == "" {
+		return ClusterUnavailableError
+	}
+	return nil
+}
+
+func (s *RaftStorage) Shutdown(ctx context.Context) error {
+	if s.server != nil {
+		if err := s.server.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return s.node.Stop()
+}
+
+// execute выполняет операцию записи на лидере и раскладывает ее результат в result
+func (s *RaftStorage) execute(ctx context.Context, method string, args interface{}, result interface{}) error {
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(&raftCall{Method: method, Args: encodedArgs})
+	if err != nil {
+		return err
+	}
+	encodedResult, err := s.node.Forward(ctx, payload)
+	if errors.Is(err, raft.ErrNoLeader) || errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrPeerUnreachable) {
+		return ClusterUnavailableError
+	}
+	if err != nil {
+		return err
+	}
+	response := &raftResult{}
+	if err := json.Unmarshal(encodedResult, response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error.decode()
+	}
+	if result == nil || response.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// saveData выполняется на лидере: ссылки и обновленный список ссылок владельца
+// предлагаются в журнал одной командой
+func (s *RaftStorage) saveData(ctx context.Context, userToken string, urlData []URLData) error {
+	if len(urlData) == 0 {
+		return nil
+	}
+	shortURLs, err := s.local.getUserShortURLs(userToken)
+	if err != nil {
+		return err
+	}
+	owned := make(map[string]bool, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		owned[shortURL] = true
+	}
+	writes := make([]FileData, 0, len(urlData)+1)
+	saved := make(map[string]bool, len(urlData))
+	for _, url := range urlData {
+		_, err := s.local.GetOriginalURL(ctx, url.ShortURL)
+		if err == nil || saved[url.ShortURL] {
+			return NewDuplicateError(url.ShortURL)
+		}
+		if !errors.Is(err, KeyError) {
+			return err
+		}
+		saved[url.ShortURL] = true
+		writes = append(writes, FileData{Key: raftURLPrefix + url.ShortURL, Value: []byte(url.OriginalURL)})
+		if !owned[url.ShortURL] {
+			owned[url.ShortURL] = true
+			shortURLs = append(shortURLs, url.ShortURL)
+		}
+	}
+	encodedURLs, err := json.Marshal(shortURLs)
+	if err != nil {
+		return err
+	}
+	writes = append(writes, FileData{Key: raftUserURLPrefix + userToken, Value: encodedURLs})
+	return propose(s.node, &raftCommand{Writes: writes})
+}
+
+// handleCall выполняет операцию записи на лидере
+func (s *RaftStorage) handleCall(ctx context.Context, payload []byte) ([]byte, error) {
+	call := &raftCall{}
+	if err := json.Unmarshal(payload, call); err != nil {
+		return nil, err
+	}
+	handler, ok := s.handlers[call.Method]
+	if !ok {
+		return json.Marshal(&raftResult{Error: &raftError{Code: "internal", Message: "unknown method " + call.Method}})
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.node.Barrier(ctx); err != nil {
+		return nil, err
+	}
+	result, err := handler(ctx, call.Args)
+	if errors.Is(err, raft.ErrNotLeader) {
+		return nil, err
+	}
+	response := &raftResult{Error: encodeRaftError(err)}
+	if err == nil && result != nil {
+		if response.Result, err = json.Marshal(result); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(response)
+}
+
+// NewRaftStorage создает узел кластера с реплицируемым хранилищем ссылок
+func NewRaftStorage(cfg raft.Config, transport raft.Transport) (*RaftStorage, error) {
+	state := configureMapStorage()
+	node, err := raft.NewNode(cfg, transport, &kvStateMachine{state: state})
+	if err != nil {
+		return nil, err
+	}
+	local := newURLStorage(
+		&replicatedStorage{node: node, state: state, prefix: raftURLPrefix},
+		&replicatedStorage{node: node, state: state, prefix: raftUserURLPrefix},
+	)
+	s := &RaftStorage{raftReads: local, node: node, local: local}
+	s.handlers = map[string]raftHandler{
+		"SaveData": handle(func(ctx context.Context, args saveDataArgs) (interface{}, error) {
+			if len(args.URLData) != 1 {
+				return nil, errors.New("SaveData expects exactly one url")
+			}
+			return nil, s.saveData(ctx, args.UserToken, args.URLData)
+		}),
+		"SaveDataBatch": handle(func(ctx context.Context, args saveDataArgs) (interface{}, error) {
+			return nil, s.saveData(ctx, args.UserToken, args.URLData)
+		}),
+		"LeaseRange": handle(func(ctx context.Context, args leaseRangeArgs) (interface{}, error) {
+			return s.local.LeaseRange(ctx, args.Size)
+		}),
+		"DeleteURLData": handle(func(ctx context.Context, args deleteURLDataArgs) (interface{}, error) {
+			return nil, s.local.DeleteURLData(ctx, args.ShortURL)
+		}),
+		"ImportLink": handle(func(ctx context.Context, record LinkRecord) (interface{}, error) {
+			return nil, s.local.ImportLink(ctx, record)
+		}),
+		"SaveAPIKey": handle(func(ctx context.Context, apiKey APIKey) (interface{}, error) {
+			return nil, s.local.SaveAPIKey(ctx, apiKey)
+		}),
+		"CreateAccount": handle(func(ctx context.Context, account Account) (interface{}, error) {
+			return nil, s.local.CreateAccount(ctx, account)
+		}),
+		"SaveSession": handle(func(ctx context.Context, session Session) (interface{}, error) {
+			return nil, s.local.SaveSession(ctx, session)
+		}),
+		"DeleteSession": handle(func(ctx context.Context, args tokenHashArgs) (interface{}, error) {
+			return nil, s.local.DeleteSession(ctx, args.TokenHash)
+		}),
+		"MergeUserURLs": handle(func(ctx context.Context, args mergeUserURLsArgs) (interface{}, error) {
+			return nil, s.local.MergeUserURLs(ctx, args.FromUserToken, args.ToUserToken)
+		}),
+		"RevokeAPIKey": handle(func(ctx context.Context, args revokeAPIKeyArgs) (interface{}, error) {
+			return nil, s.local.RevokeAPIKey(ctx, args.UserToken, args.ID, args.RevokedAt)
+		}),
+		"UpdateOriginalURL": handle(func(ctx context.Context, args updateOriginalURLArgs) (interface{}, error) {
+			return nil, s.local.UpdateOriginalURL(ctx, args.ShortURL, args.OriginalURL, args.ChangedAt)
+		}),
+		"CreateWorkspace": handle(func(ctx context.Context, args createWorkspaceArgs) (interface{}, error) {
+			return nil, s.local.CreateWorkspace(ctx, args.Workspace, args.Owner)
+		}),
+		"SaveWorkspaceMember": handle(func(ctx context.Context, member WorkspaceMember) (interface{}, error) {
+			return nil, s.local.SaveWorkspaceMember(ctx, member)
+		}),
+		"DeleteWorkspaceMember": handle(func(ctx context.Context, args workspaceMemberArgs) (interface{}, error) {
+			return nil, s.local.DeleteWorkspaceMember(ctx, args.WorkspaceID, args.UserToken)
+		}),
+		"SaveWorkspaceInvite": handle(func(ctx context.Context, invite WorkspaceInvite) (interface{}, error) {
+			return nil, s.local.SaveWorkspaceInvite(ctx, invite)
+		}),
+		"TakeWorkspaceInvite": handle(func(ctx context.Context, args tokenHashArgs) (interface{}, error) {
+			return s.local.TakeWorkspaceInvite(ctx, args.TokenHash)
+		}),
+		"SaveLinkSettings": handle(func(ctx context.Context, settings LinkSettings) (interface{}, error) {
+			return nil, s.local.SaveLinkSettings(ctx, settings)
+		}),
+		"ConsumeQuota": handle(func(ctx context.Context, args consumeQuotaArgs) (interface{}, error) {
+			usage, consumed, err := s.local.ConsumeQuota(ctx, args.UserToken, args.Day, args.N, args.Limits)
+			return consumeQuotaResult{Usage: usage, Consumed: consumed}, err
+		}),
+		"ConsumeClick": handle(func(ctx context.Context, args consumeClickArgs) (interface{}, error) {
+			clicks, consumed, err := s.local.ConsumeClick(ctx, args.ShortURL, args.MaxClicks)
+			return consumeClickResult{Clicks: clicks, Consumed: consumed}, err
+		}),
+		"SaveCampaign": handle(func(ctx context.Context, campaign Campaign) (interface{}, error) {
+			return nil, s.local.SaveCampaign(ctx, campaign)
+		}),
+		"DeleteCampaign": handle(func(ctx context.Context, args campaignIDArgs) (interface{}, error) {
+			return nil, s.local.DeleteCampaign(ctx, args.ID)
+		}),
+		"SaveLinkPattern": handle(func(ctx context.Context, pattern LinkPattern) (interface{}, error) {
+			return nil, s.local.SaveLinkPattern(ctx, pattern)
+		}),
+		"DeleteLinkPattern": handle(func(ctx context.Context, args linkPatternIDArgs) (interface{}, error) {
+			return nil, s.local.DeleteLinkPattern(ctx, args.ID)
+		}),
+		"AddVariantClick": handle(func(ctx context.Context, args addVariantClickArgs) (interface{}, error) {
+			return nil, s.local.AddVariantClick(ctx, args.ShortURL, args.Variant)
+		}),
+	}
+	node.SetForwardHandler(s.handleCall)
+	return s, nil
+}
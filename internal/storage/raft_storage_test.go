@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/maxsnegir/url-shortener/internal/raft"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testElectionTimeout = 50 * time.Millisecond
+	testWaitTimeout     = 5 * time.Second
+	testWaitTick        = 10 * time.Millisecond
+)
+
+type testCluster struct {
+	network *raft.InmemNetwork
+	nodes   map[string]*RaftStorage
+}
+
+func newTestCluster(t *testing.T, size int, snapshotThreshold uint64) *testCluster {
+	cluster := &testCluster{network: raft.NewInmemNetwork(), nodes: make(map[string]*RaftStorage)}
+	ids := make([]string, 0, size)
+	for i := 0; i < size; i++ {
+		ids = append(ids, fmt.Sprintf("node%d", i))
+	}
+	for _, id := range ids {
+		peers := make([]string, 0, size-1)
+		for _, peer := range ids {
+			if peer != id {
+				peers = append(peers, peer)
+			}
+		}
+		s, err := NewRaftStorage(raft.Config{
+			ID:                id,
+			Peers:             peers,
+			ElectionTimeout:   testElectionTimeout,
+			HeartbeatInterval: testElectionTimeout / 5,
+			SnapshotThreshold: snapshotThreshold,
+		}, cluster.network.Transport(id))
+		require.NoError(t, err)
+		cluster.network.Register(s.node)
+		cluster.nodes[id] = s
+	}
+	t.Cleanup(func() {
+		for _, s := range cluster.nodes {
+			_ = s.Shutdown(context.Background())
+		}
+	})
+	return cluster
+}
+
+// leader ждет, пока среди подключенных узлов except не появится лидер
+func (c *testCluster) leader(t *testing.T, except string) *RaftStorage {
+	var leader *RaftStorage
+	require.Eventually(t, func() bool {
+		for id, s := range c.nodes {
+			if id != except && s.node.IsLeader() {
+				leader = s
+				return true
+			}
+		}
+		return false
+	}, testWaitTimeout, testWaitTick)
+	return leader
+}
+
+// follower возвращает узел, который уже знает о лидере и может пересылать ему записи
+func (c *testCluster) follower(t *testing.T, leader *RaftStorage, except string) *RaftStorage {
+	for id, s := range c.nodes {
+		if s != leader && id != except {
+			require.Eventually(t, func() bool {
+				return s.node.Leader() == leader.node.ID()
+			}, testWaitTimeout, testWaitTick)
+			return s
+		}
+	}
+	return nil
+}
+
+// requireReplicated ждет, пока ссылка появится на узле
+func requireReplicated(t *testing.T, s *RaftStorage, urlData URLData) {
+	require.Eventually(t, func() bool {
+		originalURL, err := s.GetOriginalURL(context.Background(), urlData.ShortURL)
+		return err == nil && originalURL == urlData.OriginalURL
+	}, testWaitTimeout, testWaitTick)
+}
+
+func testURLData(i int) URLData {
+	return URLData{ShortURL: testShortURL(i), OriginalURL: fmt.Sprintf("https://github.com/%d", i)}
+}
+
+// TestRaftStorageSurvivesLeaderLoss записи, подтвержденные кластером, не теряются
+// при отключении лидера, а новый лидер продолжает принимать записи
+func TestRaftStorageSurvivesLeaderLoss(t *testing.T) {
+	ctx := context.Background()
+	cluster := newTestCluster(t, 3, 0)
+
+	leader := cluster.leader(t, "")
+	follower := cluster.follower(t, leader, "")
+	require.NoError(t, leader.SaveData(ctx, "user", testURLData(1)))
+	// Запись через follower пересылается лидеру
+	require.NoError(t, follower.SaveData(ctx, "user", testURLData(2)))
+	var duplicateErr *DuplicateURLErr
+	require.ErrorAs(t, follower.SaveData(ctx, "user", testURLData(2)), &duplicateErr)
+	require.Equal(t, testURLData(2).ShortURL, duplicateErr.URL)
+
+	oldLeaderID := leader.node.ID()
+	cluster.network.Disconnect(oldLeaderID)
+	newLeader := cluster.leader(t, oldLeaderID)
+	follower = cluster.follower(t, newLeader, oldLeaderID)
+
+	for _, s := range []*RaftStorage{newLeader, follower} {
+		requireReplicated(t, s, testURLData(1))
+		requireReplicated(t, s, testURLData(2))
+	}
+	require.NoError(t, follower.SaveData(ctx, "user", testURLData(3)))
+	requireReplicated(t, newLeader, testURLData(3))
+
+	userURLs, err := newLeader.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, userURLs, 3)
+
+	// Вернувшийся узел догоняет кластер
+	cluster.network.Reconnect(oldLeaderID)
+	requireReplicated(t, cluster.nodes[oldLeaderID], testURLData(3))
+}
+
+func TestRaftStorageWithoutQuorum(t *testing.T) {
+	cluster := newTestCluster(t, 3, 0)
+	leader := cluster.leader(t, "")
+	for id := range cluster.nodes {
+		if id != leader.node.ID() {
+			cluster.network.Disconnect(id)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.Error(t, leader.SaveData(ctx, "user", testURLData(1)))
+}
+
+// TestRaftStorageSnapshotInstall отставший узел получает снимок, если нужные
+// ему записи журнала уже сжаты
+func TestRaftStorageSnapshotInstall(t *testing.T) {
+	ctx := context.Background()
+	cluster := newTestCluster(t, 3, 5)
+	leader := cluster.leader(t, "")
+	lagging := cluster.follower(t, leader, "")
+	cluster.network.Disconnect(lagging.node.ID())
+
+	const urlCount = 20
+	for i := 0; i < urlCount; i++ {
+		require.NoError(t, leader.SaveData(ctx, "user", testURLData(i)))
+	}
+	start, err := leader.LeaseRange(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), start)
+
+	cluster.network.Reconnect(lagging.node.ID())
+	for i := 0; i < urlCount; i++ {
+		requireReplicated(t, lagging, testURLData(i))
+	}
+	require.Eventually(t, func() bool {
+		urls, err := lagging.GetAllURLs(ctx)
+		return err == nil && len(urls) == urlCount
+	}, testWaitTimeout, testWaitTick)
+}
+
+// TestRaftStorageSaveDataBatchIsAtomic пакет реплицируется одной командой: при дубликате
+// в пакете не сохраняется ни одна ссылка, а сохраненные ссылки сразу видны у владельца
+func TestRaftStorageSaveDataBatchIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	cluster := newTestCluster(t, 3, 0)
+	leader := cluster.leader(t, "")
+	require.NoError(t, leader.SaveDataBatch(ctx, "user", []URLData{testURLData(1), testURLData(2)}))
+
+	err := leader.SaveDataBatch(ctx, "user", []URLData{testURLData(3), testURLData(1)})
+	require.ErrorAs(t, err, new(*DuplicateURLErr))
+	_, err = leader.GetOriginalURL(ctx, testURLData(3).ShortURL)
+	require.ErrorIs(t, err, KeyError, "batch must not be saved partially")
+
+	userURLs, err := leader.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []URLData{testURLData(1), testURLData(2)}, userURLs)
+}
+
+// TestKVStateMachineApply команда из нескольких записей применяется целиком, а записи
+// старого формата по одной продолжают читаться из журнала
+func TestKVStateMachineApply(t *testing.T) {
+	m := &kvStateMachine{state: configureMapStorage()}
+	m.Apply([]byte(`{"Key":"url/a","Value":"b2xk"}`))
+	m.Apply([]byte(`{"Writes":[{"Key":"url/b","Value":"Yg=="},{"Key":"url/a","Deleted":true}]}`))
+
+	_, err := m.state.Get("url/a")
+	require.ErrorIs(t, err, KeyError)
+	value, err := m.state.Get("url/b")
+	require.NoError(t, err)
+	require.Equal(t, "b", string(value))
+}
@@ -0,0 +1,447 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy настройки повторов при временных ошибках хранилища
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// ResilientStorage повторяет операции хранилища при временных ошибках
+// с экспоненциальной задержкой и джиттером, а при длительной недоступности
+// базы сразу отвечает ошибкой через CircuitBreaker.
+//
+// Через CircuitBreaker проходит каждое обращение к базе: хранилище не встраивается,
+// поэтому новый метод ShortenerStorage без обертки здесь не скомпилируется.
+// Повторяются только чтения и записи, которые можно безопасно выполнить дважды.
+// Ссылка и ее владелец сохраняются одной транзакцией, поэтому частичной записи не
+// остается, а повтор SaveData после закоммиченной, но не подтвержденной записи получает
+// DuplicateURLErr. Если такая ссылка с тем же URL уже есть у пользователя, повтор
+// считается успешным. Счетчики, удаления и создание записей с уникальным ключом
+// не повторяются: повтор после неоднозначной ошибки учел бы переход дважды или
+// вернул бы KeyError и ExistsError на успешную операцию.
+type ResilientStorage struct {
+	storage ShortenerStorage
+	policy  RetryPolicy
+	breaker *CircuitBreaker
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// retryValue выполняет чтение op с повторами
+func retryValue[T any](ctx context.Context, s *ResilientStorage, op func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := s.do(ctx, func(ctx context.Context) (err error) {
+		result, err = op(ctx)
+		return err
+	})
+	return result, err
+}
+
+// callValue выполняет op через CircuitBreaker без повторов
+func callValue[T any](ctx context.Context, s *ResilientStorage, op func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := s.call(ctx, func(ctx context.Context) (err error) {
+		result, err = op(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (s *ResilientStorage) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (string, error) {
+		return s.storage.GetOriginalURL(ctx, shortURL)
+	})
+}
+
+func (s *ResilientStorage) SaveData(ctx context.Context, userToken string, urlData URLData) error {
+	retry := false
+	return s.do(ctx, func(ctx context.Context) error {
+		err := s.storage.SaveData(ctx, userToken, urlData)
+		if retry {
+			return s.savedBefore(ctx, err, userToken, []URLData{urlData})
+		}
+		retry = true
+		return err
+	})
+}
+
+func (s *ResilientStorage) SaveDataBatch(ctx context.Context, userToken string, urlData []URLData) error {
+	retry := false
+	return s.do(ctx, func(ctx context.Context) error {
+		err := s.storage.SaveDataBatch(ctx, userToken, urlData)
+		if retry {
+			return s.savedBefore(ctx, err, userToken, urlData)
+		}
+		retry = true
+		return err
+	})
+}
+
+// savedBefore DuplicateURLErr при повторе записи означает, что предыдущая попытка могла
+// закоммитить ссылки, но не дождалась ответа. Если все ссылки уже есть у пользователя
+// с теми же URL, запись выполнена, иначе возвращается исходная ошибка err.
+func (s *ResilientStorage) savedBefore(ctx context.Context, err error, userToken string, urlData []URLData) error {
+	var duplicateErr *DuplicateURLErr
+	if !errors.As(err, &duplicateErr) {
+		return err
+	}
+	userURLs, checkErr := s.storage.GetUserURLs(ctx, userToken)
+	if checkErr != nil {
+		return err
+	}
+	saved := make(map[string]string, len(userURLs))
+	for _, userURL := range userURLs {
+		saved[userURL.ShortURL] = userURL.OriginalURL
+	}
+	for _, url := range urlData {
+		if originalURL, ok := saved[url.ShortURL]; !ok || originalURL != url.OriginalURL {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ResilientStorage) GetUserURLs(ctx context.Context, userToken string) ([]URLData, error) {
+	return retryValue(ctx, s, func(ctx context.Context) ([]URLData, error) {
+		return s.storage.GetUserURLs(ctx, userToken)
+	})
+}
+
+func (s *ResilientStorage) GetAllURLs(ctx context.Context) ([]URLData, error) {
+	return retryValue(ctx, s, s.storage.GetAllURLs)
+}
+
+func (s *ResilientStorage) GetAllLinkSettings(ctx context.Context) ([]LinkSettings, error) {
+	return retryValue(ctx, s, s.storage.GetAllLinkSettings)
+}
+
+func (s *ResilientStorage) GetAllUserURLs(ctx context.Context) ([]UserURLData, error) {
+	return retryValue(ctx, s, s.storage.GetAllUserURLs)
+}
+
+func (s *ResilientStorage) DeleteURLData(ctx context.Context, shortURL string) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.DeleteURLData(ctx, shortURL)
+	})
+}
+
+func (s *ResilientStorage) ExportLink(ctx context.Context, shortURL string) (LinkRecord, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (LinkRecord, error) {
+		return s.storage.ExportLink(ctx, shortURL)
+	})
+}
+
+// ImportLink заменяет данные ссылки целиком, поэтому повтор безопасен
+func (s *ResilientStorage) ImportLink(ctx context.Context, record LinkRecord) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.storage.ImportLink(ctx, record)
+	})
+}
+
+func (s *ResilientStorage) UpdateOriginalURL(ctx context.Context, shortURL, originalURL string, changedAt time.Time) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.UpdateOriginalURL(ctx, shortURL, originalURL, changedAt)
+	})
+}
+
+func (s *ResilientStorage) GetURLHistory(ctx context.Context, shortURL string) ([]URLVersion, error) {
+	return retryValue(ctx, s, func(ctx context.Context) ([]URLVersion, error) {
+		return s.storage.GetURLHistory(ctx, shortURL)
+	})
+}
+
+// LeaseRange при повторе после неоднозначной ошибки блок может потеряться,
+// но выдан дважды не будет
+func (s *ResilientStorage) LeaseRange(ctx context.Context, size uint64) (uint64, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (uint64, error) {
+		return s.storage.LeaseRange(ctx, size)
+	})
+}
+
+func (s *ResilientStorage) SaveAPIKey(ctx context.Context, apiKey APIKey) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.SaveAPIKey(ctx, apiKey)
+	})
+}
+
+func (s *ResilientStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (APIKey, error) {
+		return s.storage.GetAPIKeyByHash(ctx, keyHash)
+	})
+}
+
+func (s *ResilientStorage) GetUserAPIKeys(ctx context.Context, userToken string) ([]APIKey, error) {
+	return retryValue(ctx, s, func(ctx context.Context) ([]APIKey, error) {
+		return s.storage.GetUserAPIKeys(ctx, userToken)
+	})
+}
+
+func (s *ResilientStorage) RevokeAPIKey(ctx context.Context, userToken, id string, revokedAt time.Time) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.RevokeAPIKey(ctx, userToken, id, revokedAt)
+	})
+}
+
+func (s *ResilientStorage) CreateAccount(ctx context.Context, account Account) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.CreateAccount(ctx, account)
+	})
+}
+
+func (s *ResilientStorage) GetAccount(ctx context.Context, username string) (Account, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (Account, error) {
+		return s.storage.GetAccount(ctx, username)
+	})
+}
+
+func (s *ResilientStorage) SaveSession(ctx context.Context, session Session) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.SaveSession(ctx, session)
+	})
+}
+
+func (s *ResilientStorage) GetSession(ctx context.Context, tokenHash string) (Session, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (Session, error) {
+		return s.storage.GetSession(ctx, tokenHash)
+	})
+}
+
+func (s *ResilientStorage) DeleteSession(ctx context.Context, tokenHash string) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.DeleteSession(ctx, tokenHash)
+	})
+}
+
+// MergeUserURLs повторяется: ссылки, уже переданные toUserToken, повтор не меняет
+func (s *ResilientStorage) MergeUserURLs(ctx context.Context, fromUserToken, toUserToken string) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.storage.MergeUserURLs(ctx, fromUserToken, toUserToken)
+	})
+}
+
+func (s *ResilientStorage) GetLinkSettings(ctx context.Context, shortURL string) (LinkSettings, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (LinkSettings, error) {
+		return s.storage.GetLinkSettings(ctx, shortURL)
+	})
+}
+
+// SaveLinkSettings заменяет настройки целиком, поэтому повторяется
+func (s *ResilientStorage) SaveLinkSettings(ctx context.Context, settings LinkSettings) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.storage.SaveLinkSettings(ctx, settings)
+	})
+}
+
+func (s *ResilientStorage) CreateWorkspace(ctx context.Context, workspace Workspace, owner WorkspaceMember) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.CreateWorkspace(ctx, workspace, owner)
+	})
+}
+
+func (s *ResilientStorage) GetWorkspace(ctx context.Context, id string) (Workspace, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (Workspace, error) {
+		return s.storage.GetWorkspace(ctx, id)
+	})
+}
+
+func (s *ResilientStorage) GetWorkspaceMember(ctx context.Context, workspaceID, userToken string) (WorkspaceMember, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (WorkspaceMember, error) {
+		return s.storage.GetWorkspaceMember(ctx, workspaceID, userToken)
+	})
+}
+
+func (s *ResilientStorage) GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]WorkspaceMember, error) {
+	return retryValue(ctx, s, func(ctx context.Context) ([]WorkspaceMember, error) {
+		return s.storage.GetWorkspaceMembers(ctx, workspaceID)
+	})
+}
+
+func (s *ResilientStorage) GetUserWorkspaces(ctx context.Context, userToken string) ([]WorkspaceMember, error) {
+	return retryValue(ctx, s, func(ctx context.Context) ([]WorkspaceMember, error) {
+		return s.storage.GetUserWorkspaces(ctx, userToken)
+	})
+}
+
+func (s *ResilientStorage) SaveWorkspaceMember(ctx context.Context, member WorkspaceMember) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.storage.SaveWorkspaceMember(ctx, member)
+	})
+}
+
+func (s *ResilientStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID, userToken string) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.DeleteWorkspaceMember(ctx, workspaceID, userToken)
+	})
+}
+
+func (s *ResilientStorage) SaveWorkspaceInvite(ctx context.Context, invite WorkspaceInvite) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.SaveWorkspaceInvite(ctx, invite)
+	})
+}
+
+func (s *ResilientStorage) TakeWorkspaceInvite(ctx context.Context, tokenHash string) (WorkspaceInvite, error) {
+	return callValue(ctx, s, func(ctx context.Context) (WorkspaceInvite, error) {
+		return s.storage.TakeWorkspaceInvite(ctx, tokenHash)
+	})
+}
+
+func (s *ResilientStorage) ConsumeQuota(ctx context.Context, userToken, day string, n int64, limits QuotaLimits) (QuotaUsage, bool, error) {
+	var ok bool
+	usage, err := callValue(ctx, s, func(ctx context.Context) (usage QuotaUsage, err error) {
+		usage, ok, err = s.storage.ConsumeQuota(ctx, userToken, day, n, limits)
+		return usage, err
+	})
+	return usage, ok, err
+}
+
+func (s *ResilientStorage) ConsumeClick(ctx context.Context, shortURL string, maxClicks int64) (int64, bool, error) {
+	var ok bool
+	clicks, err := callValue(ctx, s, func(ctx context.Context) (clicks int64, err error) {
+		clicks, ok, err = s.storage.ConsumeClick(ctx, shortURL, maxClicks)
+		return clicks, err
+	})
+	return clicks, ok, err
+}
+
+func (s *ResilientStorage) GetClicks(ctx context.Context, shortURL string) (int64, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (int64, error) {
+		return s.storage.GetClicks(ctx, shortURL)
+	})
+}
+
+func (s *ResilientStorage) AddVariantClick(ctx context.Context, shortURL string, variant int) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.AddVariantClick(ctx, shortURL, variant)
+	})
+}
+
+func (s *ResilientStorage) GetVariantClicks(ctx context.Context, shortURL string) (map[int]int64, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (map[int]int64, error) {
+		return s.storage.GetVariantClicks(ctx, shortURL)
+	})
+}
+
+func (s *ResilientStorage) SaveLinkPattern(ctx context.Context, pattern LinkPattern) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.SaveLinkPattern(ctx, pattern)
+	})
+}
+
+func (s *ResilientStorage) GetLinkPatterns(ctx context.Context) ([]LinkPattern, error) {
+	return retryValue(ctx, s, s.storage.GetLinkPatterns)
+}
+
+func (s *ResilientStorage) DeleteLinkPattern(ctx context.Context, id string) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.DeleteLinkPattern(ctx, id)
+	})
+}
+
+func (s *ResilientStorage) SaveCampaign(ctx context.Context, campaign Campaign) error {
+	return s.do(ctx, func(ctx context.Context) error {
+		return s.storage.SaveCampaign(ctx, campaign)
+	})
+}
+
+func (s *ResilientStorage) GetCampaign(ctx context.Context, id string) (Campaign, error) {
+	return retryValue(ctx, s, func(ctx context.Context) (Campaign, error) {
+		return s.storage.GetCampaign(ctx, id)
+	})
+}
+
+func (s *ResilientStorage) GetCampaigns(ctx context.Context, owner string) ([]Campaign, error) {
+	return retryValue(ctx, s, func(ctx context.Context) ([]Campaign, error) {
+		return s.storage.GetCampaigns(ctx, owner)
+	})
+}
+
+func (s *ResilientStorage) DeleteCampaign(ctx context.Context, id string) error {
+	return s.call(ctx, func(ctx context.Context) error {
+		return s.storage.DeleteCampaign(ctx, id)
+	})
+}
+
+// Shutdown закрывает соединение с базой и не зависит от состояния CircuitBreaker
+func (s *ResilientStorage) Shutdown(ctx context.Context) error {
+	return s.storage.Shutdown(ctx)
+}
+
+// Ping проходит через CircuitBreaker, но не повторяется: он должен показывать
+// текущее состояние базы
+func (s *ResilientStorage) Ping(ctx context.Context) error {
+	return s.call(ctx, s.storage.Ping)
+}
+
+func (s *ResilientStorage) do(ctx context.Context, op func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < s.policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(s.backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+		err = s.call(ctx, op)
+		if !isTransientErr(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *ResilientStorage) call(ctx context.Context, op func(ctx context.Context) error) error {
+	if err := s.breaker.Allow(); err != nil {
+		return err
+	}
+	err := op(ctx)
+	switch {
+	case isTransientErr(err):
+		s.breaker.Failure()
+	case err != nil && ctx.Err() != nil:
+		s.breaker.Release()
+	default:
+		s.breaker.Success()
+	}
+	return err
+}
+
+// backoff задержка перед попыткой attempt: случайное значение
+// от 0 до min(MaxDelay, BaseDelay*2^(attempt-1))
+func (s *ResilientStorage) backoff(attempt int) time.Duration {
+	delay := s.policy.BaseDelay << (attempt - 1)
+	if delay > s.policy.MaxDelay || delay <= 0 {
+		delay = s.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+	return time.Duration(s.rand.Int63n(int64(delay) + 1))
+}
+
+func NewResilientStorage(storage ShortenerStorage, policy RetryPolicy, breaker *CircuitBreaker) *ResilientStorage {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &ResilientStorage{
+		storage: storage,
+		policy:  policy,
+		breaker: breaker,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
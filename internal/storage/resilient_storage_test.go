@@ -0,0 +1,198 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgerrcode"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+
+	"github.com/maxsnegir/url-shortener/internal/mocks"
+	"github.com/maxsnegir/url-shortener/internal/storage"
+)
+
+var testRetryPolicy = storage.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    5 * time.Millisecond,
+}
+
+// TestRetryErrorClassification временные ошибки повторяются, постоянные - нет
+func TestRetryErrorClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "Connection reset", err: syscall.ECONNRESET, wantCalls: 3},
+		{name: "Wrapped connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), wantCalls: 3},
+		{name: "Bad connection", err: driver.ErrBadConn, wantCalls: 3},
+		{name: "Serialization failure", err: &pq.Error{Code: pgerrcode.SerializationFailure}, wantCalls: 3},
+		{name: "Deadlock", err: &pq.Error{Code: pgerrcode.DeadlockDetected}, wantCalls: 3},
+		{name: "Admin shutdown", err: &pq.Error{Code: pgerrcode.AdminShutdown}, wantCalls: 3},
+		{name: "Connection failure", err: &pq.Error{Code: pgerrcode.ConnectionFailure}, wantCalls: 3},
+		{name: "Unique violation", err: &pq.Error{Code: pgerrcode.UniqueViolation}, wantCalls: 1},
+		{name: "Syntax error", err: &pq.Error{Code: pgerrcode.SyntaxError}, wantCalls: 1},
+		{name: "Key not found", err: storage.KeyError, wantCalls: 1},
+		{name: "Context canceled", err: context.Canceled, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockShortenerStorage(ctrl)
+			s.EXPECT().GetOriginalURL(gomock.Any(), "short").Return("", tt.err).Times(tt.wantCalls)
+
+			rs := storage.NewResilientStorage(s, testRetryPolicy, storage.NewCircuitBreaker(100, time.Minute))
+			_, err := rs.GetOriginalURL(context.Background(), "short")
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+// TestRetryRecoversAfterTransientError запись проходит после обрыва соединения
+func TestRetryRecoversAfterTransientError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockShortenerStorage(ctrl)
+	urlData := storage.URLData{ShortURL: "short", OriginalURL: "https://github.com"}
+	gomock.InOrder(
+		s.EXPECT().SaveData(gomock.Any(), "user", urlData).Return(&pq.Error{Code: pgerrcode.AdminShutdown}),
+		s.EXPECT().SaveData(gomock.Any(), "user", urlData).Return(syscall.ECONNRESET),
+		s.EXPECT().SaveData(gomock.Any(), "user", urlData).Return(nil),
+	)
+
+	rs := storage.NewResilientStorage(s, testRetryPolicy, storage.NewCircuitBreaker(100, time.Minute))
+	require.NoError(t, rs.SaveData(context.Background(), "user", urlData))
+}
+
+// TestRetryAfterCommittedWrite повтор записи, которая закоммитилась без ответа,
+// не превращается в конфликт; чужая ссылка с тем же идентификатором - по-прежнему конфликт
+func TestRetryAfterCommittedWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockShortenerStorage(ctrl)
+	urlData := storage.URLData{ShortURL: "short", OriginalURL: "https://github.com"}
+	gomock.InOrder(
+		s.EXPECT().SaveData(gomock.Any(), "user", urlData).Return(driver.ErrBadConn),
+		s.EXPECT().SaveData(gomock.Any(), "user", urlData).Return(storage.NewDuplicateError("short")),
+		s.EXPECT().GetUserURLs(gomock.Any(), "user").Return([]storage.URLData{urlData}, nil),
+	)
+	rs := storage.NewResilientStorage(s, testRetryPolicy, storage.NewCircuitBreaker(100, time.Minute))
+	require.NoError(t, rs.SaveData(context.Background(), "user", urlData))
+
+	gomock.InOrder(
+		s.EXPECT().SaveData(gomock.Any(), "other", urlData).Return(driver.ErrBadConn),
+		s.EXPECT().SaveData(gomock.Any(), "other", urlData).Return(storage.NewDuplicateError("short")),
+		s.EXPECT().GetUserURLs(gomock.Any(), "other").Return(nil, nil),
+	)
+	err := rs.SaveData(context.Background(), "other", urlData)
+	require.ErrorAs(t, err, new(*storage.DuplicateURLErr))
+
+	// Без повтора конфликт возвращается сразу
+	s.EXPECT().SaveData(gomock.Any(), "user", urlData).Return(storage.NewDuplicateError("short"))
+	err = rs.SaveData(context.Background(), "user", urlData)
+	require.ErrorAs(t, err, new(*storage.DuplicateURLErr))
+}
+
+// TestRetryStopsOnContextDone повторы не выходят за пределы контекста запроса
+func TestRetryStopsOnContextDone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockShortenerStorage(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.EXPECT().GetUserURLs(gomock.Any(), "user").DoAndReturn(func(context.Context, string) ([]storage.URLData, error) {
+		cancel()
+		return nil, driver.ErrBadConn
+	}).Times(1)
+
+	policy := storage.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Second}
+	rs := storage.NewResilientStorage(s, policy, storage.NewCircuitBreaker(100, time.Minute))
+	_, err := rs.GetUserURLs(ctx, "user")
+	require.ErrorIs(t, err, driver.ErrBadConn)
+}
+
+// TestCircuitBreaker после серии ошибок запросы не доходят до базы,
+// а по истечении таймаута пробный запрос замыкает цепь
+func TestCircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockShortenerStorage(ctrl)
+
+	const openTimeout = 50 * time.Millisecond
+	policy := storage.RetryPolicy{MaxAttempts: 1}
+	breaker := storage.NewCircuitBreaker(2, openTimeout)
+	rs := storage.NewResilientStorage(s, policy, breaker)
+
+	s.EXPECT().Ping(gomock.Any()).Return(syscall.ECONNREFUSED).Times(2)
+	require.Error(t, rs.Ping(context.Background()))
+	require.Error(t, rs.Ping(context.Background()))
+
+	// Цепь разомкнута: в базу не ходим
+	err := rs.Ping(context.Background())
+	require.ErrorIs(t, err, storage.CircuitOpenError)
+	var unavailableErr storage.DBUnavailableError
+	require.True(t, errors.As(err, &unavailableErr))
+	// Ошибка сообщает, сколько цепь еще будет разомкнута
+	var retryErr storage.RetryAfterError
+	require.True(t, errors.As(err, &retryErr))
+	require.Greater(t, retryErr.RetryAfter, time.Duration(0))
+	require.LessOrEqual(t, retryErr.RetryAfter, openTimeout)
+	require.Greater(t, breaker.RetryAfter(), time.Duration(0))
+
+	time.Sleep(openTimeout)
+	s.EXPECT().Ping(gomock.Any()).Return(nil).Times(1)
+	require.NoError(t, rs.Ping(context.Background()))
+
+	s.EXPECT().Ping(gomock.Any()).Return(nil).Times(1)
+	require.NoError(t, rs.Ping(context.Background()))
+	require.Equal(t, time.Duration(0), breaker.RetryAfter())
+}
+
+// TestCircuitBreakerHalfOpenFailure неудачный пробный запрос снова размыкает цепь
+func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockShortenerStorage(ctrl)
+
+	const openTimeout = 50 * time.Millisecond
+	rs := storage.NewResilientStorage(s, storage.RetryPolicy{MaxAttempts: 1}, storage.NewCircuitBreaker(1, openTimeout))
+
+	s.EXPECT().GetOriginalURL(gomock.Any(), "short").Return("", driver.ErrBadConn).Times(2)
+	_, err := rs.GetOriginalURL(context.Background(), "short")
+	require.ErrorIs(t, err, driver.ErrBadConn)
+
+	time.Sleep(openTimeout)
+	_, err = rs.GetOriginalURL(context.Background(), "short")
+	require.ErrorIs(t, err, driver.ErrBadConn)
+
+	_, err = rs.GetOriginalURL(context.Background(), "short")
+	require.ErrorIs(t, err, storage.CircuitOpenError)
+}
+
+// TestCircuitBreakerCoversRedirectPath при разомкнутой цепи настройки, счетчики переходов
+// и квоты тоже не идут в базу, а счетчики не повторяются после ошибки
+func TestCircuitBreakerCoversRedirectPath(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s := mocks.NewMockShortenerStorage(ctrl)
+	rs := storage.NewResilientStorage(s, testRetryPolicy, storage.NewCircuitBreaker(1, time.Minute))
+
+	s.EXPECT().ConsumeClick(gomock.Any(), "short", int64(1)).Return(int64(0), false, syscall.ECONNRESET).Times(1)
+	_, _, err := rs.ConsumeClick(context.Background(), "short", 1)
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+
+	_, err = rs.GetLinkSettings(context.Background(), "short")
+	require.ErrorIs(t, err, storage.CircuitOpenError)
+	_, _, err = rs.ConsumeQuota(context.Background(), "user", "2022-03-01", 1, storage.QuotaLimits{})
+	require.ErrorIs(t, err, storage.CircuitOpenError)
+	require.ErrorIs(t, rs.AddVariantClick(context.Background(), "short", 1), storage.CircuitOpenError)
+}
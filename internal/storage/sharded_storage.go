@@ -0,0 +1,408 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ShardedStorage распределяет ссылки по нескольким хранилищам консистентным
+// хешированием короткой ссылки.
+//
+// Записи о владельцах ссылок (user_url), настройки и счетчики переходов живут на том
+// же шарде, что и сама ссылка, поэтому связь остается локальной для шарда, а GetUserURLs
+// опрашивает все шарды и объединяет результат. Счетчик идентификаторов и данные, не
+// привязанные к ссылке, хранятся на первом шарде. Ссылки пространств распределяются
+// по шардам как обычные ссылки.
+type ShardedStorage struct {
+	firstShardData
+	shards []ShortenerStorage
+	ring   *hashRing
+}
+
+// firstShardData данные, которые целиком хранятся на первом шарде: ключи API, учетные записи
+// и сессии, пространства, квоты, ссылки-шаблоны и кампании. MergeUserURLs переопределен,
+// потому что записи о владельцах лежат рядом со ссылками.
+type firstShardData interface {
+	RangeLeaser
+	APIKeyStorage
+	AccountStorage
+	WorkspaceStorage
+	QuotaStorage
+	LinkPatternStorage
+	CampaignStorage
+}
+
+func (s *ShardedStorage) shardFor(shortURL string) ShortenerStorage {
+	return s.shards[s.ring.Shard(shortURL)]
+}
+
+// GetOriginalURL если ссылки нет на ее шарде, она ищется на остальных:
+// во время ребалансировки ссылка может быть еще не перенесена
+func (s *ShardedStorage) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
+	owner := s.ring.Shard(shortURL)
+	originalURL, err := s.shards[owner].GetOriginalURL(ctx, shortURL)
+	if !errors.Is(err, KeyError) {
+		return originalURL, err
+	}
+	for i, shard := range s.shards {
+		if i == owner {
+			continue
+		}
+		if originalURL, shardErr := shard.GetOriginalURL(ctx, shortURL); shardErr == nil {
+			return originalURL, nil
+		}
+	}
+	return "", err
+}
+
+func (s *ShardedStorage) SaveData(ctx context.Context, userToken string, urlData URLData) error {
+	return s.shardFor(urlData.ShortURL).SaveData(ctx, userToken, urlData)
+}
+
+// UpdateOriginalURL ссылка может быть еще не перенесена на свой шард, как и в GetOriginalURL.
+// История пишется на тот шард, где ссылка находится в момент изменения.
+func (s *ShardedStorage) UpdateOriginalURL(ctx context.Context, shortURL, originalURL string, changedAt time.Time) error {
+	owner := s.ring.Shard(shortURL)
+	err := s.shards[owner].UpdateOriginalURL(ctx, shortURL, originalURL, changedAt)
+	if !errors.Is(err, KeyError) {
+		return err
+	}
+	for i, shard := range s.shards {
+		if i == owner {
+			continue
+		}
+		if shardErr := shard.UpdateOriginalURL(ctx, shortURL, originalURL, changedAt); !errors.Is(shardErr, KeyError) {
+			return shardErr
+		}
+	}
+	return err
+}
+
+// GetURLHistory история, как и настройки, хранится на шарде ссылки и переносится вместе с ней
+func (s *ShardedStorage) GetURLHistory(ctx context.Context, shortURL string) ([]URLVersion, error) {
+	shard, err := s.linkShard(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	return shard.GetURLHistory(ctx, shortURL)
+}
+
+// SaveDataBatch атомарна только в пределах одного шарда
+func (s *ShardedStorage) SaveDataBatch(ctx context.Context, userToken string, urlData []URLData) error {
+	batches := make(map[int][]URLData)
+	for _, url := range urlData {
+		shard := s.ring.Shard(url.ShortURL)
+		batches[shard] = append(batches[shard], url)
+	}
+	return s.forEachShard(func(i int, shard ShortenerStorage) error {
+		if len(batches[i]) == 0 {
+			return nil
+		}
+		return shard.SaveDataBatch(ctx, userToken, batches[i])
+	})
+}
+
+func (s *ShardedStorage) GetUserURLs(ctx context.Context, userToken string) ([]URLData, error) {
+	var mu sync.Mutex
+	var userURLs []URLData
+	err := s.forEachShard(func(i int, shard ShortenerStorage) error {
+		shardURLs, err := shard.GetUserURLs(ctx, userToken)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		userURLs = append(userURLs, shardURLs...)
+		mu.Unlock()
+		return nil
+	})
+	return userURLs, err
+}
+
+func (s *ShardedStorage) GetAllURLs(ctx context.Context) ([]URLData, error) {
+	var mu sync.Mutex
+	var urls []URLData
+	err := s.forEachShard(func(i int, shard ShortenerStorage) error {
+		shardURLs, err := shard.GetAllURLs(ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		urls = append(urls, shardURLs...)
+		mu.Unlock()
+		return nil
+	})
+	return urls, err
+}
+
+func (s *ShardedStorage) GetAllLinkSettings(ctx context.Context) ([]LinkSettings, error) {
+	var mu sync.Mutex
+	var allSettings []LinkSettings
+	err := s.forEachShard(func(i int, shard ShortenerStorage) error {
+		shardSettings, err := shard.GetAllLinkSettings(ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		allSettings = append(allSettings, shardSettings...)
+		mu.Unlock()
+		return nil
+	})
+	return allSettings, err
+}
+
+func (s *ShardedStorage) GetAllUserURLs(ctx context.Context) ([]UserURLData, error) {
+	var mu sync.Mutex
+	var userURLs []UserURLData
+	err := s.forEachShard(func(i int, shard ShortenerStorage) error {
+		shardURLs, err := shard.GetAllUserURLs(ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		userURLs = append(userURLs, shardURLs...)
+		mu.Unlock()
+		return nil
+	})
+	return userURLs, err
+}
+
+func (s *ShardedStorage) DeleteURLData(ctx context.Context, shortURL string) error {
+	return s.forEachShard(func(i int, shard ShortenerStorage) error {
+		return shard.DeleteURLData(ctx, shortURL)
+	})
+}
+
+// GetLinkSettings настройки читаются с шарда, где сейчас лежит ссылка: до переноса
+// на ее шард там настроек еще нет
+func (s *ShardedStorage) GetLinkSettings(ctx context.Context, shortURL string) (LinkSettings, error) {
+	shard, err := s.linkShard(ctx, shortURL)
+	if err != nil {
+		return LinkSettings{}, err
+	}
+	return shard.GetLinkSettings(ctx, shortURL)
+}
+
+func (s *ShardedStorage) SaveLinkSettings(ctx context.Context, settings LinkSettings) error {
+	shard, err := s.linkShard(ctx, settings.ShortURL)
+	if err != nil {
+		return err
+	}
+	return shard.SaveLinkSettings(ctx, settings)
+}
+
+func (s *ShardedStorage) ExportLink(ctx context.Context, shortURL string) (LinkRecord, error) {
+	shard, err := s.linkShard(ctx, shortURL)
+	if err != nil {
+		return LinkRecord{}, err
+	}
+	return shard.ExportLink(ctx, shortURL)
+}
+
+func (s *ShardedStorage) ImportLink(ctx context.Context, record LinkRecord) error {
+	return s.shardFor(record.ShortURL).ImportLink(ctx, record)
+}
+
+// ConsumeClick счетчики переходов, как и настройки, лежат рядом со ссылкой
+func (s *ShardedStorage) ConsumeClick(ctx context.Context, shortURL string, maxClicks int64) (int64, bool, error) {
+	shard, err := s.linkShard(ctx, shortURL)
+	if err != nil {
+		return 0, false, err
+	}
+	return shard.ConsumeClick(ctx, shortURL, maxClicks)
+}
+
+func (s *ShardedStorage) GetClicks(ctx context.Context, shortURL string) (int64, error) {
+	shard, err := s.linkShard(ctx, shortURL)
+	if err != nil {
+		return 0, err
+	}
+	return shard.GetClicks(ctx, shortURL)
+}
+
+func (s *ShardedStorage) AddVariantClick(ctx context.Context, shortURL string, variant int) error {
+	shard, err := s.linkShard(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	return shard.AddVariantClick(ctx, shortURL, variant)
+}
+
+func (s *ShardedStorage) GetVariantClicks(ctx context.Context, shortURL string) (map[int]int64, error) {
+	shard, err := s.linkShard(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	return shard.GetVariantClicks(ctx, shortURL)
+}
+
+// MergeUserURLs записи о владельцах лежат рядом со ссылками, поэтому слияние идет на каждом шарде
+func (s *ShardedStorage) MergeUserURLs(ctx context.Context, fromUserToken, toUserToken string) error {
+	return s.forEachShard(func(i int, shard ShortenerStorage) error {
+		return shard.MergeUserURLs(ctx, fromUserToken, toUserToken)
+	})
+}
+
+func (s *ShardedStorage) Ping(ctx context.Context) error {
+	return s.forEachShard(func(i int, shard ShortenerStorage) error {
+		return shard.Ping(ctx)
+	})
+}
+
+func (s *ShardedStorage) Shutdown(ctx context.Context) error {
+	var firstErr error
+	for _, shard := range s.shards {
+		if err := shard.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Rebalance переносит ссылки вместе со всеми владельцами, настройками и счетчиками
+// на шарды, которым они принадлежат по текущему кольцу. Ссылка сначала копируется,
+// потом удаляется со старого шарда, поэтому прерванную ребалансировку можно просто
+// запустить еще раз.
+func (s *ShardedStorage) Rebalance(ctx context.Context) (int, error) {
+	moved := 0
+	for i, shard := range s.shards {
+		urls, err := shard.GetAllURLs(ctx)
+		if err != nil {
+			return moved, err
+		}
+		for _, urlData := range urls {
+			target := s.ring.Shard(urlData.ShortURL)
+			if target == i {
+				continue
+			}
+			if err := s.moveLink(ctx, shard, s.shards[target], urlData.ShortURL); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// frozenClicks счетчик копии ссылки с лимитом переходов, пока он не сверен со старым шардом
+const frozenClicks = math.MaxInt64
+
+// moveLink удаляет ссылку со старого шарда только после сверки счетчиков переходов.
+// Если ссылка уже скопирована прерванной ребалансировкой, копия не заменяется:
+// после копирования переходы учитываются на новом шарде
+func (s *ShardedStorage) moveLink(ctx context.Context, from, to ShortenerStorage, shortURL string) error {
+	_, err := to.GetOriginalURL(ctx, shortURL)
+	if errors.Is(err, KeyError) {
+		err = copyLink(ctx, from, to, shortURL)
+	}
+	if err != nil {
+		return err
+	}
+	if err := syncClicks(ctx, from, to, shortURL); err != nil {
+		return err
+	}
+	return from.DeleteURLData(ctx, shortURL)
+}
+
+// copyLink копирует ссылку на новый шард. Переход, начатый до копирования, еще может
+// учесться на старом шарде, поэтому копия ссылки с лимитом переходов не открывается,
+// пока syncClicks не перенесет окончательный счетчик: иначе одноразовую ссылку можно
+// было бы открыть на обоих шардах. Ссылкам без лимита недосчитанные переходы
+// добавляются сразу после копирования.
+func copyLink(ctx context.Context, from, to ShortenerStorage, shortURL string) error {
+	record, err := from.ExportLink(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	limited := record.Settings != nil && record.Settings.MaxClicks > 0
+	copied := record
+	if limited {
+		copied.Clicks = frozenClicks
+	}
+	if err := to.ImportLink(ctx, copied); err != nil || limited {
+		return err
+	}
+
+	current, err := from.ExportLink(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	for clicks := record.Clicks; clicks < current.Clicks; clicks++ {
+		if _, _, err := to.ConsumeClick(ctx, shortURL, 0); err != nil {
+			return err
+		}
+	}
+	for variant, variantClicks := range current.VariantClicks {
+		for clicks := record.VariantClicks[variant]; clicks < variantClicks; clicks++ {
+			if err := to.AddVariantClick(ctx, shortURL, variant); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncClicks переносит счетчики со старого шарда в еще закрытую копию ссылки. После
+// копирования новые переходы идут на новый шард, так что счетчики старого окончательные.
+func syncClicks(ctx context.Context, from, to ShortenerStorage, shortURL string) error {
+	copied, err := to.ExportLink(ctx, shortURL)
+	if err != nil || copied.Clicks != frozenClicks {
+		return err
+	}
+	record, err := from.ExportLink(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	copied.Clicks = record.Clicks
+	copied.VariantClicks = record.VariantClicks
+	return to.ImportLink(ctx, copied)
+}
+
+// linkShard шард, на котором сейчас лежит ссылка, как в GetOriginalURL. Если ссылки
+// нет нигде, это ее шард по кольцу.
+func (s *ShardedStorage) linkShard(ctx context.Context, shortURL string) (ShortenerStorage, error) {
+	owner := s.ring.Shard(shortURL)
+	_, err := s.shards[owner].GetOriginalURL(ctx, shortURL)
+	if !errors.Is(err, KeyError) {
+		return s.shards[owner], err
+	}
+	for i, shard := range s.shards {
+		if i == owner {
+			continue
+		}
+		if _, shardErr := shard.GetOriginalURL(ctx, shortURL); shardErr == nil {
+			return shard, nil
+		}
+	}
+	return s.shards[owner], nil
+}
+
+// forEachShard выполняет fn параллельно на всех шардах и возвращает первую ошибку
+func (s *ShardedStorage) forEachShard(fn func(i int, shard ShortenerStorage) error) error {
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func(i int, shard ShortenerStorage) {
+			defer wg.Done()
+			errs[i] = fn(i, shard)
+		}(i, shard)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewShardedStorage(shards []ShortenerStorage) *ShardedStorage {
+	return &ShardedStorage{
+		firstShardData: shards[0],
+		shards:         shards,
+		ring:           newHashRing(len(shards)),
+	}
+}
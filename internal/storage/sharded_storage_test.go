@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestShards(count int) []ShortenerStorage {
+	shards := make([]ShortenerStorage, 0, count)
+	for i := 0; i < count; i++ {
+		shards = append(shards, NewURLStorage(NewMapStorage()))
+	}
+	return shards
+}
+
+func testShortURL(i int) string {
+	return fmt.Sprintf("http://localhost:8080/id%d/", i)
+}
+
+// TestShardedStorageOwnershipLivesWithLinks запись о владельце хранится на том же
+// шарде, что и ссылка; глобального индекса владельцев нет, поэтому GetUserURLs
+// опрашивает все шарды
+func TestShardedStorageOwnershipLivesWithLinks(t *testing.T) {
+	ctx := context.Background()
+	shards := newTestShards(3)
+	s := NewShardedStorage(shards)
+
+	const urlCount = 60
+	for i := 0; i < urlCount; i++ {
+		err := s.SaveData(ctx, "user", URLData{ShortURL: testShortURL(i), OriginalURL: fmt.Sprintf("https://github.com/%d", i)})
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < urlCount; i++ {
+		owner := s.ring.Shard(testShortURL(i))
+		for shardIndex, shard := range shards {
+			_, err := shard.GetOriginalURL(ctx, testShortURL(i))
+			if shardIndex == owner {
+				require.NoError(t, err, "url must be stored on its shard")
+			} else {
+				require.ErrorIs(t, err, KeyError, "url must be stored only on its shard")
+			}
+		}
+		originalURL, err := s.GetOriginalURL(ctx, testShortURL(i))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("https://github.com/%d", i), originalURL)
+	}
+
+	total := 0
+	for _, shard := range shards {
+		shardURLs, err := shard.GetUserURLs(ctx, "user")
+		require.NoError(t, err)
+		require.NotEmpty(t, shardURLs, "links should be spread over all shards")
+		total += len(shardURLs)
+	}
+	require.Equal(t, urlCount, total)
+
+	userURLs, err := s.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, userURLs, urlCount)
+}
+
+func TestShardedStorageSaveDataBatch(t *testing.T) {
+	ctx := context.Background()
+	s := NewShardedStorage(newTestShards(2))
+	batch := []URLData{
+		{ShortURL: testShortURL(1), OriginalURL: "https://github.com"},
+		{ShortURL: testShortURL(2), OriginalURL: "https://gitlab.com"},
+		{ShortURL: testShortURL(3), OriginalURL: "https://bitbucket.org"},
+	}
+	require.NoError(t, s.SaveDataBatch(ctx, "user", batch))
+
+	userURLs, err := s.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	require.ElementsMatch(t, batch, userURLs)
+
+	err = s.SaveData(ctx, "user", batch[0])
+	require.ErrorAs(t, err, new(*DuplicateURLErr))
+}
+
+// TestShardedStorageRebalance после добавления шарда переезжает только часть
+// ссылок, владельцы переезжают вместе с ними, а чтение работает и до ребалансировки
+func TestShardedStorageRebalance(t *testing.T) {
+	ctx := context.Background()
+	shards := newTestShards(2)
+	before := NewShardedStorage(shards)
+
+	const urlCount = 200
+	for i := 0; i < urlCount; i++ {
+		userToken := fmt.Sprintf("user%d", i%5)
+		err := before.SaveData(ctx, userToken, URLData{ShortURL: testShortURL(i), OriginalURL: fmt.Sprintf("https://github.com/%d", i)})
+		require.NoError(t, err)
+	}
+
+	after := NewShardedStorage(append(shards, NewURLStorage(NewMapStorage())))
+	expectedMoves := 0
+	for i := 0; i < urlCount; i++ {
+		oldShard, newShard := before.ring.Shard(testShortURL(i)), after.ring.Shard(testShortURL(i))
+		if oldShard != newShard {
+			require.Equal(t, 2, newShard, "keys may move only to the new shard")
+			expectedMoves++
+		}
+		_, err := after.GetOriginalURL(ctx, testShortURL(i))
+		require.NoError(t, err, "url must be readable before rebalancing")
+	}
+	require.Greater(t, expectedMoves, 0)
+	require.Less(t, expectedMoves, urlCount/2)
+
+	moved, err := after.Rebalance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, expectedMoves, moved)
+
+	moved, err = after.Rebalance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, moved, "second rebalancing must be a no-op")
+
+	userURLs, err := after.GetAllUserURLs(ctx)
+	require.NoError(t, err)
+	require.Len(t, userURLs, urlCount)
+	for _, userURL := range userURLs {
+		var i int
+		_, err := fmt.Sscanf(userURL.OriginalURL, "https://github.com/%d", &i)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("user%d", i%5), userURL.UserToken, "owner must move with its url")
+
+		owner := after.shards[after.ring.Shard(userURL.ShortURL)]
+		_, err = owner.GetOriginalURL(ctx, userURL.ShortURL)
+		require.NoError(t, err, "url must be on its shard after rebalancing")
+	}
+}
+
+// TestShardedStorageRebalanceMovesLinkData вместе со ссылкой переезжают все ее владельцы,
+// настройки и счетчики, а ссылки без владельцев тоже переносятся
+func TestShardedStorageRebalanceMovesLinkData(t *testing.T) {
+	ctx := context.Background()
+	shards := newTestShards(2)
+	before := NewShardedStorage(shards)
+	after := NewShardedStorage(append(shards, NewURLStorage(NewMapStorage())))
+
+	var movingURLs []string
+	for i := 0; len(movingURLs) < 2; i++ {
+		if before.ring.Shard(testShortURL(i)) != after.ring.Shard(testShortURL(i)) {
+			movingURLs = append(movingURLs, testShortURL(i))
+		}
+	}
+	shared, ownerless := movingURLs[0], movingURLs[1]
+
+	require.NoError(t, before.SaveData(ctx, "alice", URLData{ShortURL: shared, OriginalURL: "https://github.com"}))
+	sharedShard := shards[before.ring.Shard(shared)].(*URLStorage)
+	require.NoError(t, sharedShard.SetUserURL("bob", shared))
+	settings := LinkSettings{ShortURL: shared, Disabled: true}
+	require.NoError(t, before.SaveLinkSettings(ctx, settings))
+	_, _, err := before.ConsumeClick(ctx, shared, 0)
+	require.NoError(t, err)
+	require.NoError(t, before.AddVariantClick(ctx, shared, 1))
+
+	ownerlessShard := shards[before.ring.Shard(ownerless)].(*URLStorage)
+	require.NoError(t, ownerlessShard.SetShortURL(URLData{ShortURL: ownerless, OriginalURL: "https://bitbucket.org"}))
+	changedAt := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, before.UpdateOriginalURL(ctx, ownerless, "https://gitlab.com", changedAt))
+
+	// До ребалансировки настройки читаются со старого шарда
+	got, err := after.GetLinkSettings(ctx, shared)
+	require.NoError(t, err)
+	require.True(t, got.Disabled)
+
+	moved, err := after.Rebalance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, moved)
+
+	newShard := after.shards[2]
+	for _, userToken := range []string{"alice", "bob"} {
+		userURLs, err := newShard.GetUserURLs(ctx, userToken)
+		require.NoError(t, err)
+		require.Equal(t, []URLData{{ShortURL: shared, OriginalURL: "https://github.com"}}, userURLs, "every owner must move with the url")
+	}
+	got, err = newShard.GetLinkSettings(ctx, shared)
+	require.NoError(t, err)
+	require.Equal(t, settings, got)
+	clicks, _, err := newShard.ConsumeClick(ctx, shared, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), clicks)
+	variantClicks, err := newShard.GetVariantClicks(ctx, shared)
+	require.NoError(t, err)
+	require.Equal(t, map[int]int64{1: 1}, variantClicks)
+
+	originalURL, err := newShard.GetOriginalURL(ctx, ownerless)
+	require.NoError(t, err)
+	require.Equal(t, "https://gitlab.com", originalURL)
+	history, err := after.GetURLHistory(ctx, ownerless)
+	require.NoError(t, err)
+	require.Equal(t, []URLVersion{{ShortURL: ownerless, Version: 1, OriginalURL: "https://bitbucket.org", ReplacedAt: changedAt}}, history)
+
+	for _, shard := range shards {
+		for _, shortURL := range movingURLs {
+			_, err := shard.GetOriginalURL(ctx, shortURL)
+			require.ErrorIs(t, err, KeyError, "url must be deleted from its old shard")
+		}
+		_, err := shard.ExportLink(ctx, shared)
+		require.ErrorIs(t, err, KeyError)
+		got, err := shard.GetLinkSettings(ctx, shared)
+		require.NoError(t, err)
+		require.False(t, got.Disabled, "settings must be deleted from the old shard")
+	}
+}
+
+// clickDuringExport засчитывает переход на шарде сразу после первой выгрузки ссылки,
+// как запрос, начатый до ее копирования на новый шард
+type clickDuringExport struct {
+	ShortenerStorage
+	clicked map[string]bool
+}
+
+func (s *clickDuringExport) ExportLink(ctx context.Context, shortURL string) (LinkRecord, error) {
+	record, err := s.ShortenerStorage.ExportLink(ctx, shortURL)
+	if err == nil && !s.clicked[shortURL] {
+		s.clicked[shortURL] = true
+		_, _, err = s.ShortenerStorage.ConsumeClick(ctx, shortURL, record.Settings.MaxClicks)
+	}
+	return record, err
+}
+
+// TestShardedStorageRebalanceKeepsClicksDuringMove переход, засчитанный на старом шарде
+// во время копирования, не теряется: одноразовую ссылку нельзя открыть второй раз
+func TestShardedStorageRebalanceKeepsClicksDuringMove(t *testing.T) {
+	ctx := context.Background()
+	shards := newTestShards(2)
+	before := NewShardedStorage(shards)
+	wrapped := make([]ShortenerStorage, 0, len(shards)+1)
+	for _, shard := range shards {
+		wrapped = append(wrapped, &clickDuringExport{ShortenerStorage: shard, clicked: map[string]bool{}})
+	}
+	after := NewShardedStorage(append(wrapped, NewURLStorage(NewMapStorage())))
+
+	var movingURLs []string
+	for i := 0; len(movingURLs) < 2; i++ {
+		if before.ring.Shard(testShortURL(i)) != after.ring.Shard(testShortURL(i)) {
+			movingURLs = append(movingURLs, testShortURL(i))
+		}
+	}
+	oneTime, unlimited := movingURLs[0], movingURLs[1]
+	for _, shortURL := range movingURLs {
+		require.NoError(t, before.SaveData(ctx, "alice", URLData{ShortURL: shortURL, OriginalURL: "https://github.com"}))
+	}
+	require.NoError(t, before.SaveLinkSettings(ctx, LinkSettings{ShortURL: oneTime, MaxClicks: 1}))
+	require.NoError(t, before.SaveLinkSettings(ctx, LinkSettings{ShortURL: unlimited}))
+
+	moved, err := after.Rebalance(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, moved)
+
+	newShard := after.shards[2]
+	clicks, allowed, err := newShard.ConsumeClick(ctx, oneTime, 1)
+	require.NoError(t, err)
+	require.False(t, allowed, "one-time link must stay consumed after the move")
+	require.Equal(t, int64(1), clicks)
+	clicks, err = newShard.GetClicks(ctx, unlimited)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), clicks)
+}
+
+// TestShardedStorageCopiedLinkWaitsForClicks копия ссылки с лимитом переходов закрыта,
+// пока счетчик не сверен со старым шардом, в том числе после прерванной ребалансировки
+func TestShardedStorageCopiedLinkWaitsForClicks(t *testing.T) {
+	ctx := context.Background()
+	from, to := NewURLStorage(NewMapStorage()), NewURLStorage(NewMapStorage())
+	shortURL := testShortURL(0)
+	require.NoError(t, from.SaveData(ctx, "alice", URLData{ShortURL: shortURL, OriginalURL: "https://github.com"}))
+	require.NoError(t, from.SaveLinkSettings(ctx, LinkSettings{ShortURL: shortURL, MaxClicks: 2}))
+
+	require.NoError(t, copyLink(ctx, from, to, shortURL))
+	_, allowed, err := to.ConsumeClick(ctx, shortURL, 2)
+	require.NoError(t, err)
+	require.False(t, allowed, "copy must stay closed until clicks are synced")
+	_, allowed, err = from.ConsumeClick(ctx, shortURL, 2)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	s := NewShardedStorage([]ShortenerStorage{from})
+	require.NoError(t, s.moveLink(ctx, from, to, shortURL))
+	clicks, allowed, err := to.ConsumeClick(ctx, shortURL, 2)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.Equal(t, int64(2), clicks)
+}
@@ -2,8 +2,14 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/maxsnegir/url-shortener/cmd/config"
+	"github.com/maxsnegir/url-shortener/internal/raft"
 )
 
 type URLData struct {
@@ -12,34 +18,439 @@ type URLData struct {
 	OriginalURL string `json:"original_url" db:"original_url"`
 }
 
+// UserURLData ссылка вместе с ее владельцем
+type UserURLData struct {
+	UserToken string `db:"user_token"`
+	URLData
+}
+
 type Storage interface {
 	Set(key string, value []byte) error
 	Get(key string) ([]byte, error)
+	Delete(key string) error
+	// Range вызывает fn для каждой пары ключ-значение, пока fn возвращает true
+	Range(fn func(key string, value []byte) bool) error
+	// CompareAndSwap записывает value, только если текущее значение ключа равно old.
+	// old == nil означает, что ключа еще нет.
+	CompareAndSwap(key string, old, value []byte) (bool, error)
 	Shutdown(ctx context.Context) error
 }
 
-type ShortenerStorage interface {
+// RangeLeaser выдает блоки значений счетчика идентификаторов. Выданный блок
+// больше никому не достанется, в том числе после перезапуска.
+type RangeLeaser interface {
+	// LeaseRange возвращает первое значение блока [start, start+size)
+	LeaseRange(ctx context.Context, size uint64) (uint64, error)
+}
+
+// URLExporter хранилище, которое умеет выгрузить все ссылки
+type URLExporter interface {
+	GetAllURLs(ctx context.Context) ([]URLData, error)
+	// GetAllLinkSettings все сохраненные настройки ссылок
+	GetAllLinkSettings(ctx context.Context) ([]LinkSettings, error)
+	GetLinkPatterns(ctx context.Context) ([]LinkPattern, error)
+	GetCampaign(ctx context.Context, id string) (Campaign, error)
+}
+
+// APIKey ключ доступа к API. Сам ключ не хранится, только его хеш.
+type APIKey struct {
+	ID        string     `json:"id" db:"id"`
+	UserToken string     `json:"user_token" db:"user_token"`
+	Name      string     `json:"name" db:"name"`
+	KeyHash   string     `json:"key_hash" db:"key_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+type APIKeyStorage interface {
+	SaveAPIKey(ctx context.Context, apiKey APIKey) error
+	// GetAPIKeyByHash возвращает KeyError, если ключа нет; отозванные ключи тоже возвращаются
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userToken string) ([]APIKey, error)
+	// RevokeAPIKey возвращает KeyError, если у пользователя нет такого ключа
+	RevokeAPIKey(ctx context.Context, userToken, id string, revokedAt time.Time) error
+}
+
+// Account именованная учетная запись. UserToken - постоянный идентификатор
+// владельца ссылок, который не зависит от устройства.
+type Account struct {
+	UserToken    string    `json:"user_token" db:"user_token"`
+	Username     string    `json:"username" db:"username"`
+	PasswordHash string    `json:"password_hash" db:"password_hash"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Session сессия входа в учетную запись, токен сессии хранится в виде хеша
+type Session struct {
+	TokenHash string    `json:"token_hash" db:"token_hash"`
+	UserToken string    `json:"user_token" db:"user_token"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+}
+
+type AccountStorage interface {
+	// CreateAccount возвращает ExistsError, если имя пользователя занято
+	CreateAccount(ctx context.Context, account Account) error
+	GetAccount(ctx context.Context, username string) (Account, error)
+	SaveSession(ctx context.Context, session Session) error
+	GetSession(ctx context.Context, tokenHash string) (Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	// MergeUserURLs передает ссылки пользователя fromUserToken пользователю toUserToken
+	MergeUserURLs(ctx context.Context, fromUserToken, toUserToken string) error
+}
+
+// LinkSettings настройки ссылки сверх исходного URL. Ссылки без сохраненных
+// настроек работают с нулевым значением.
+type LinkSettings struct {
+	ShortURL string `json:"short_url"`
+	// Disabled ссылка отключена администратором
+	Disabled bool `json:"disabled"`
+	// Private у ссылки длинный случайный идентификатор, который нельзя подобрать перебором
+	Private bool `json:"private"`
+	// RedirectCode код ответа при переходе, ноль - 307
+	RedirectCode int `json:"redirect_code"`
+	// PasswordHash bcrypt-хеш пароля, без которого переход не выполняется
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks после стольких переходов ссылка перестает работать, ноль - без ограничения
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// NotBefore до этого времени ссылка не перенаправляет, а отвечает NotActiveMessage
+	NotBefore        *time.Time `json:"not_before,omitempty"`
+	NotActiveMessage string     `json:"not_active_message,omitempty"`
+	// Schedule запланированные смены исходного URL, упорядочены по времени
+	Schedule []ScheduledDestination `json:"schedule,omitempty"`
+	// Targeting правила выбора адреса по устройству, языку и стране, проверяются по порядку
+	Targeting []TargetingRule `json:"targeting,omitempty"`
+	// Variants адреса A/B-теста: каждый переход выбирает один из них пропорционально весу
+	Variants []LinkVariant `json:"variants,omitempty"`
+	// ForwardPath путь после идентификатора дописывается к адресу: /abc/docs/x ведет на <адрес>/docs/x
+	ForwardPath bool `json:"forward_path,omitempty"`
+	// ForwardQuery параметры запроса переносятся в адрес, QueryConflict - правило для совпадающих
+	ForwardQuery  bool   `json:"forward_query,omitempty"`
+	QueryConflict string `json:"query_conflict,omitempty"`
+	// CampaignID UTM-метки кампании добавляются к адресу при каждом переходе
+	CampaignID string `json:"campaign_id,omitempty"`
+}
+
+// LinkVariant адрес A/B-ссылки и его относительный вес
+type LinkVariant struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// TargetingRule ссылка ведет на URL, если выполнены все заданные условия
+type TargetingRule struct {
+	// Platform ios, android или desktop
+	Platform string `json:"platform,omitempty"`
+	// Language язык ("de") или язык с регионом ("pt-BR")
+	Language string `json:"language,omitempty"`
+	// Country код страны ISO 3166-1 alpha-2
+	Country string `json:"country,omitempty"`
+	URL     string `json:"url"`
+}
+
+// ScheduledDestination с момента At ссылка ведет на URL
+type ScheduledDestination struct {
+	At  time.Time `json:"at"`
+	URL string    `json:"url"`
+}
+
+type LinkSettingsStorage interface {
+	// GetLinkSettings возвращает нулевые настройки, если они не сохранялись
+	GetLinkSettings(ctx context.Context, shortURL string) (LinkSettings, error)
+	SaveLinkSettings(ctx context.Context, settings LinkSettings) error
+}
+
+// Workspace общее пространство команды. Ссылки пространства хранятся как ссылки
+// пользователя с токеном, равным ID пространства.
+type Workspace struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceID string    `json:"workspace_id" db:"workspace_id"`
+	UserToken   string    `json:"user_token" db:"user_token"`
+	Role        string    `json:"role" db:"role"`
+	JoinedAt    time.Time `json:"joined_at" db:"joined_at"`
+}
+
+// WorkspaceInvite одноразовое приглашение в пространство, токен хранится в виде хеша
+type WorkspaceInvite struct {
+	TokenHash   string    `json:"token_hash" db:"token_hash"`
+	WorkspaceID string    `json:"workspace_id" db:"workspace_id"`
+	Role        string    `json:"role" db:"role"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+}
+
+type WorkspaceStorage interface {
+	// CreateWorkspace создает пространство вместе с его первым участником
+	CreateWorkspace(ctx context.Context, workspace Workspace, owner WorkspaceMember) error
+	GetWorkspace(ctx context.Context, id string) (Workspace, error)
+	// GetWorkspaceMember возвращает KeyError, если пользователь не состоит в пространстве
+	GetWorkspaceMember(ctx context.Context, workspaceID, userToken string) (WorkspaceMember, error)
+	GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]WorkspaceMember, error)
+	// GetUserWorkspaces членство пользователя во всех пространствах
+	GetUserWorkspaces(ctx context.Context, userToken string) ([]WorkspaceMember, error)
+	// SaveWorkspaceMember добавляет участника или меняет его роль
+	SaveWorkspaceMember(ctx context.Context, member WorkspaceMember) error
+	DeleteWorkspaceMember(ctx context.Context, workspaceID, userToken string) error
+	SaveWorkspaceInvite(ctx context.Context, invite WorkspaceInvite) error
+	// TakeWorkspaceInvite удаляет приглашение и возвращает его, KeyError - если его нет
+	TakeWorkspaceInvite(ctx context.Context, tokenHash string) (WorkspaceInvite, error)
+}
+
+// QuotaUsage счетчики созданных пользователем ссылок
+type QuotaUsage struct {
+	// Day день (UTC, в формате 2006-01-02), к которому относится DayCount
+	Day      string `json:"day" db:"day"`
+	DayCount int64  `json:"day_count" db:"day_count"`
+	Total    int64  `json:"total" db:"total"`
+}
+
+// QuotaLimits ограничения на число созданных ссылок, ноль - без ограничения
+type QuotaLimits struct {
+	Daily int64
+	Total int64
+}
+
+type QuotaStorage interface {
+	// ConsumeQuota атомарно добавляет n ссылок к счетчикам пользователя за день day,
+	// если это не превысит limits. Возвращает счетчики и признак того, что ссылки учтены.
+	// Отрицательное n возвращает ссылки в квоту и выполняется всегда.
+	ConsumeQuota(ctx context.Context, userToken, day string, n int64, limits QuotaLimits) (QuotaUsage, bool, error)
+}
+
+// URLVersion прежний исходный URL ссылки и время, когда его заменили.
+// Версии нумеруются с единицы, текущий URL - следующая версия после последней в истории.
+type URLVersion struct {
+	ShortURL    string    `json:"short_url" db:"short_url"`
+	Version     int64     `json:"version" db:"version"`
+	OriginalURL string    `json:"original_url" db:"original_url"`
+	ReplacedAt  time.Time `json:"replaced_at" db:"replaced_at"`
+}
+
+type ClickStorage interface {
+	// ConsumeClick атомарно учитывает переход по ссылке, если их было меньше maxClicks.
+	// Возвращает число учтенных переходов и признак того, что этот переход учтен.
+	ConsumeClick(ctx context.Context, shortURL string, maxClicks int64) (int64, bool, error)
+	// GetClicks число учтенных переходов по ссылке, не меняя его
+	GetClicks(ctx context.Context, shortURL string) (int64, error)
+	// AddVariantClick учитывает переход на вариант variant ссылки с несколькими адресами
+	AddVariantClick(ctx context.Context, shortURL string, variant int) error
+	// GetVariantClicks число переходов по номерам вариантов, варианты без переходов отсутствуют
+	GetVariantClicks(ctx context.Context, shortURL string) (map[int]int64, error)
+}
+
+// LinkPattern ссылка-шаблон: путь с параметрами в фигурных скобках и адрес, в который
+// подставляются их значения. Shape - путь без имен параметров, двух шаблонов с одинаковым
+// Shape быть не может.
+type LinkPattern struct {
+	ID        string    `json:"id" db:"id"`
+	Pattern   string    `json:"pattern" db:"pattern"`
+	Shape     string    `json:"shape" db:"shape"`
+	Template  string    `json:"template" db:"template"`
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type LinkPatternStorage interface {
+	// SaveLinkPattern возвращает ExistsError, если шаблон с таким Shape уже есть
+	SaveLinkPattern(ctx context.Context, pattern LinkPattern) error
+	GetLinkPatterns(ctx context.Context) ([]LinkPattern, error)
+	// DeleteLinkPattern возвращает KeyError, если шаблона нет
+	DeleteLinkPattern(ctx context.Context, id string) error
+}
+
+// Campaign UTM-метки, которые получают переходы по ссылкам кампании. Owner - токен
+// пользователя или ID пространства, как у ссылок.
+type Campaign struct {
+	ID          string    `json:"id" db:"id"`
+	Owner       string    `json:"owner" db:"owner"`
+	Name        string    `json:"name" db:"name"`
+	UTMSource   string    `json:"utm_source,omitempty" db:"utm_source"`
+	UTMMedium   string    `json:"utm_medium,omitempty" db:"utm_medium"`
+	UTMCampaign string    `json:"utm_campaign,omitempty" db:"utm_campaign"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type CampaignStorage interface {
+	// SaveCampaign создает кампанию или заменяет существующую с тем же ID
+	SaveCampaign(ctx context.Context, campaign Campaign) error
+	GetCampaign(ctx context.Context, id string) (Campaign, error)
+	GetCampaigns(ctx context.Context, owner string) ([]Campaign, error)
+	DeleteCampaign(ctx context.Context, id string) error
+}
+
+// LinkRecord ссылка вместе со всеми привязанными к ней данными, нужна для переноса
+// ссылок между шардами. Settings пустые, если настройки ссылки не сохранялись.
+type LinkRecord struct {
+	URLData
+	Owners        []string      `json:"owners"`
+	Settings      *LinkSettings `json:"settings,omitempty"`
+	Clicks        int64         `json:"clicks"`
+	VariantClicks map[int]int64 `json:"variant_clicks"`
+	History       []URLVersion  `json:"history"`
+}
+
+type LinkTransfer interface {
+	// ExportLink ссылка со всеми привязанными к ней данными, KeyError - если ссылки нет
+	ExportLink(ctx context.Context, shortURL string) (LinkRecord, error)
+	// ImportLink сохраняет ссылку и привязанные к ней данные вместо прежних,
+	// повторный импорт той же записи ничего не меняет
+	ImportLink(ctx context.Context, record LinkRecord) error
+}
+
+// URLDataStorage ссылки и их владельцы
+type URLDataStorage interface {
 	SaveData(ctx context.Context, userToken string, urlData URLData) error
 	SaveDataBatch(ctx context.Context, userToken string, urlData []URLData) error
 	GetOriginalURL(ctx context.Context, shortURL string) (string, error)
 	GetUserURLs(ctx context.Context, userToken string) ([]URLData, error)
-	Shutdown(ctx context.Context) error
+	// GetAllUserURLs все ссылки вместе с владельцами, нужно для переноса между шардами
+	GetAllUserURLs(ctx context.Context) ([]UserURLData, error)
+	// UpdateOriginalURL меняет исходный URL ссылки и вместе с этим сохраняет прежний в истории,
+	// KeyError - если ссылки нет. Тот же URL ничего не меняет.
+	UpdateOriginalURL(ctx context.Context, shortURL, originalURL string, changedAt time.Time) error
+	// GetURLHistory прежние исходные URL ссылки по возрастанию версии
+	GetURLHistory(ctx context.Context, shortURL string) ([]URLVersion, error)
+	// DeleteURLData удаляет ссылку вместе с владельцами, настройками, счетчиками переходов и историей
+	DeleteURLData(ctx context.Context, shortURL string) error
+}
+
+// LinkStorage данные, с которыми работает сервис коротких ссылок
+type LinkStorage interface {
+	URLDataStorage
+	LinkSettingsStorage
+	ClickStorage
+	QuotaStorage
+	LinkPatternStorage
+	CampaignStorage
+	// WorkspaceStorage нужно для проверки прав на ссылки пространств
+	WorkspaceStorage
 	Ping(ctx context.Context) error
 }
 
+// ShortenerStorage хранилище сервиса целиком, его реализуют все бэкенды
+type ShortenerStorage interface {
+	LinkStorage
+	RangeLeaser
+	URLExporter
+	APIKeyStorage
+	AccountStorage
+	LinkTransfer
+	Shutdown(ctx context.Context) error
+}
+
+// userURLsFileSuffix суффикс файла с владельцами ссылок
+const userURLsFileSuffix = ".users"
+
 func GetURLStorage(cfg config.Config) (ShortenerStorage, error) {
+	//RaftStorage
+	if cfg.Storage.Cluster.NodeID != "" {
+		return NewClusterStorage(cfg)
+	}
+	//ShardedStorage
+	if len(cfg.Storage.DatabaseShards) > 0 {
+		return NewShardedPostgresStorage(context.Background(), cfg)
+	}
 	//PostgresStorage
 	if cfg.Storage.DatabaseDSN != "" {
-		return NewPostgresStorage(context.Background(), cfg.Storage.DatabaseDSN)
+		postgresStorage, err := newResilientPostgresStorage(context.Background(), cfg, cfg.Storage.DatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Storage.Snapshot.Path == "" {
+			return postgresStorage, nil
+		}
+		return NewFallbackStorage(postgresStorage, postgresStorage, cfg.Storage.Snapshot.Path, cfg.Storage.Snapshot.Interval)
 	}
 	//MapStorage
 	if cfg.Storage.FileStoragePath == "" {
 		return NewURLStorage(NewMapStorage()), nil
 	}
 	//FileStorage
-	fileStorage, err := NewURLFileStorage(cfg.Storage.FileStoragePath)
+	return NewURLFileStorages(cfg.Storage.FileStoragePath)
+}
+
+// NewURLFileStorages хранилище в файле filePath. Владельцы ссылок сохраняются в отдельный
+// файл рядом с ним, иначе после перезапуска у учетных записей и пространств не осталось бы ссылок.
+func NewURLFileStorages(filePath string) (*URLStorage, error) {
+	fileStorage, err := NewURLFileStorage(filePath)
+	if err != nil {
+		return nil, err
+	}
+	userURLFileStorage, err := NewURLFileStorage(filePath + userURLsFileSuffix)
+	if err != nil {
+		_ = fileStorage.Shutdown(context.Background())
+		return nil, err
+	}
+	return newURLStorage(fileStorage, userURLFileStorage), nil
+}
+
+// NewShardedPostgresStorage подключается ко всем шардам из DATABASE_SHARDS
+func NewShardedPostgresStorage(ctx context.Context, cfg config.Config) (*ShardedStorage, error) {
+	shards := make([]ShortenerStorage, 0, len(cfg.Storage.DatabaseShards))
+	for _, dsn := range cfg.Storage.DatabaseShards {
+		shard, err := newResilientPostgresStorage(ctx, cfg, dsn)
+		if err != nil {
+			for _, shard := range shards {
+				_ = shard.Shutdown(ctx)
+			}
+			return nil, err
+		}
+		shards = append(shards, shard)
+	}
+	return NewShardedStorage(shards), nil
+}
+
+func newResilientPostgresStorage(ctx context.Context, cfg config.Config, dsn string) (*ResilientStorage, error) {
+	postgresStorage, err := NewPostgresStorage(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	retryPolicy := RetryPolicy{
+		MaxAttempts: cfg.Storage.Retry.MaxAttempts,
+		BaseDelay:   cfg.Storage.Retry.BaseDelay,
+		MaxDelay:    cfg.Storage.Retry.MaxDelay,
+	}
+	breaker := NewCircuitBreaker(cfg.Storage.CircuitBreaker.FailureThreshold, cfg.Storage.CircuitBreaker.OpenTimeout)
+	return NewResilientStorage(postgresStorage, retryPolicy, breaker), nil
+}
+
+// NewClusterStorage запускает узел кластера Raft и сервер для RPC между узлами
+func NewClusterStorage(cfg config.Config) (*RaftStorage, error) {
+	clusterCfg := cfg.Storage.Cluster
+	peers := make(map[string]string, len(clusterCfg.Peers))
+	peerIDs := make([]string, 0, len(clusterCfg.Peers))
+	for _, peer := range clusterCfg.Peers {
+		id, address, ok := strings.Cut(peer, "=")
+		if !ok || id == "" || address == "" {
+			return nil, fmt.Errorf("invalid raft peer %q, expected id=host:port", peer)
+		}
+		peers[id] = address
+		peerIDs = append(peerIDs, id)
+	}
+	listener, err := net.Listen("tcp", clusterCfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	raftStorage, err := NewRaftStorage(raft.Config{
+		ID:                clusterCfg.NodeID,
+		Peers:             peerIDs,
+		ElectionTimeout:   clusterCfg.ElectionTimeout,
+		HeartbeatInterval: clusterCfg.HeartbeatInterval,
+		SnapshotThreshold: clusterCfg.SnapshotThreshold,
+		DataDir:           clusterCfg.DataDir,
+	}, raft.NewHTTPTransport(peers))
 	if err != nil {
+		_ = listener.Close()
 		return nil, err
 	}
-	return NewURLStorage(fileStorage), nil
+	raftStorage.server = &http.Server{Handler: raft.NewHTTPHandler(raftStorage.node)}
+	go func() {
+		_ = raftStorage.server.Serve(listener)
+	}()
+	return raftStorage, nil
 }
@@ -3,17 +3,56 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idCounterKey ключ счетчика идентификаторов. Не пересекается с короткими
+// ссылками, которые всегда начинаются со схемы.
+const idCounterKey = "counter:url_id"
+
+// Служебные записи: ключи API и сессии хранятся по хешу, учетные записи по имени,
+// настройки ссылок по короткому URL
+const (
+	apiKeyPrefix       = "apikey:"
+	accountPrefix      = "account:"
+	sessionPrefix      = "session:"
+	linkSettingsPrefix = "link:"
+	workspacePrefix    = "workspace:"
+	// memberPrefix участники хранятся по ключу "member:<id пространства>:<токен пользователя>"
+	memberPrefix = "member:"
+	invitePrefix = "invite:"
+	quotaPrefix  = "quota:"
+	clicksPrefix = "clicks:"
+	// variantPrefix счетчики переходов по вариантам A/B-ссылок
+	variantPrefix = "variant:"
+	patternPrefix = "pattern:"
+	// campaignPrefix кампании по ID, список кампаний владельца собирается перебором
+	campaignPrefix = "campaign:"
+	// historyPrefix прежние исходные URL ссылки хранятся одной записью
+	historyPrefix = "history:"
 )
 
 type URLStorage struct {
 	userURLStorage Storage
 	urlStorage     Storage
+	mu             sync.Mutex
+}
+
+// isShortURLKey ключи ссылок - полные короткие URL, служебные ключи имеют вид "<тип>:<id>",
+// где id тоже может быть коротким URL
+func isShortURLKey(key string) bool {
+	schemeEnd := strings.Index(key, "://")
+	return schemeEnd > 0 && !strings.Contains(key[:schemeEnd], ":")
 }
 
 func (s *URLStorage) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
 	encodedData, err := s.urlStorage.Get(shortURL)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	return string(encodedData), nil
 }
@@ -59,6 +98,12 @@ func (s *URLStorage) GetUserURLs(ctx context.Context, userToken string) ([]URLDa
 }
 
 func (s *URLStorage) SetUserURL(userToken string, shortURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setUserURL(userToken, shortURL)
+}
+
+func (s *URLStorage) setUserURL(userToken string, shortURL string) error {
 	userShortURLs, err := s.getUserShortURLs(userToken)
 	if err != nil {
 		return err
@@ -95,6 +140,676 @@ func (s *URLStorage) SaveDataBatch(ctx context.Context, userToken string, urlDat
 	return nil
 }
 
+// LeaseRange хранит последнее выданное значение счетчика рядом со ссылками,
+// поэтому в файловом режиме блоки не переиспользуются после перезапуска
+func (s *URLStorage) LeaseRange(ctx context.Context, size uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last uint64
+	if encodedValue, err := s.urlStorage.Get(idCounterKey); err == nil {
+		if last, err = strconv.ParseUint(string(encodedValue), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.urlStorage.Set(idCounterKey, []byte(strconv.FormatUint(last+size, 10))); err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+func (s *URLStorage) GetAllURLs(ctx context.Context) ([]URLData, error) {
+	var urls []URLData
+	err := s.urlStorage.Range(func(key string, value []byte) bool {
+		if isShortURLKey(key) {
+			urls = append(urls, URLData{ShortURL: key, OriginalURL: string(value)})
+		}
+		return true
+	})
+	return urls, err
+}
+
+func (s *URLStorage) GetAllLinkSettings(ctx context.Context) ([]LinkSettings, error) {
+	var allSettings []LinkSettings
+	err := s.rangeRecords(linkSettingsPrefix, func(key string, value []byte) error {
+		var settings LinkSettings
+		if err := json.Unmarshal(value, &settings); err != nil {
+			return err
+		}
+		allSettings = append(allSettings, settings)
+		return nil
+	})
+	return allSettings, err
+}
+
+func (s *URLStorage) GetAllUserURLs(ctx context.Context) ([]UserURLData, error) {
+	var userURLs []UserURLData
+	var rangeErr error
+	err := s.userURLStorage.Range(func(userToken string, encodedURLs []byte) bool {
+		var shortURLs []string
+		if rangeErr = json.Unmarshal(encodedURLs, &shortURLs); rangeErr != nil {
+			return false
+		}
+		for _, shortURL := range shortURLs {
+			originalURL, err := s.GetOriginalURL(ctx, shortURL)
+			if err != nil {
+				continue
+			}
+			userURLs = append(userURLs, UserURLData{
+				UserToken: userToken,
+				URLData:   URLData{ShortURL: shortURL, OriginalURL: originalURL},
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userURLs, rangeErr
+}
+
+func (s *URLStorage) DeleteURLData(ctx context.Context, shortURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.urlStorage.Delete(shortURL); err != nil {
+		return err
+	}
+	// История, настройки и счетчики не должны достаться ссылке, которую создадут заново
+	// с тем же идентификатором
+	for _, key := range []string{historyPrefix + shortURL, linkSettingsPrefix + shortURL, clicksPrefix + shortURL} {
+		if err := s.urlStorage.Delete(key); err != nil {
+			return err
+		}
+	}
+	if err := s.deleteVariantClicks(shortURL); err != nil {
+		return err
+	}
+	var rangeErr error
+	err := s.userURLStorage.Range(func(userToken string, encodedURLs []byte) bool {
+		var shortURLs []string
+		if rangeErr = json.Unmarshal(encodedURLs, &shortURLs); rangeErr != nil {
+			return false
+		}
+		kept := shortURLs[:0]
+		for _, url := range shortURLs {
+			if url != shortURL {
+				kept = append(kept, url)
+			}
+		}
+		if len(kept) == len(shortURLs) {
+			return true
+		}
+		if encodedURLs, rangeErr = json.Marshal(kept); rangeErr != nil {
+			return false
+		}
+		rangeErr = s.userURLStorage.Set(userToken, encodedURLs)
+		return rangeErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return rangeErr
+}
+
+func (s *URLStorage) ExportLink(ctx context.Context, shortURL string) (LinkRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	originalURL, err := s.GetOriginalURL(ctx, shortURL)
+	if err != nil {
+		return LinkRecord{}, err
+	}
+	record := LinkRecord{URLData: URLData{ShortURL: shortURL, OriginalURL: originalURL}}
+	var rangeErr error
+	err = s.userURLStorage.Range(func(userToken string, encodedURLs []byte) bool {
+		var shortURLs []string
+		if rangeErr = json.Unmarshal(encodedURLs, &shortURLs); rangeErr != nil {
+			return false
+		}
+		for _, url := range shortURLs {
+			if url == shortURL {
+				record.Owners = append(record.Owners, userToken)
+				break
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return LinkRecord{}, err
+	}
+	if rangeErr != nil {
+		return LinkRecord{}, rangeErr
+	}
+	var settings LinkSettings
+	if err := s.getRecord(linkSettingsPrefix+shortURL, &settings); err == nil {
+		record.Settings = &settings
+	} else if !errors.Is(err, KeyError) {
+		return LinkRecord{}, err
+	}
+	if record.Clicks, err = s.getCounter(clicksPrefix + shortURL); err != nil {
+		return LinkRecord{}, err
+	}
+	if record.VariantClicks, err = s.GetVariantClicks(ctx, shortURL); err != nil {
+		return LinkRecord{}, err
+	}
+	record.History, err = s.getURLHistory(shortURL)
+	return record, err
+}
+
+func (s *URLStorage) ImportLink(ctx context.Context, record LinkRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shortURL := record.ShortURL
+	if err := s.urlStorage.Set(shortURL, []byte(record.OriginalURL)); err != nil {
+		return err
+	}
+	for _, userToken := range record.Owners {
+		if err := s.setUserURL(userToken, shortURL); err != nil {
+			return err
+		}
+	}
+	var err error
+	if record.Settings != nil {
+		err = s.setRecord(linkSettingsPrefix+shortURL, record.Settings)
+	} else {
+		err = s.urlStorage.Delete(linkSettingsPrefix + shortURL)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.urlStorage.Set(clicksPrefix+shortURL, []byte(strconv.FormatInt(record.Clicks, 10))); err != nil {
+		return err
+	}
+	if err := s.deleteVariantClicks(shortURL); err != nil {
+		return err
+	}
+	for variant, clicks := range record.VariantClicks {
+		if err := s.urlStorage.Set(variantKey(shortURL, variant), []byte(strconv.FormatInt(clicks, 10))); err != nil {
+			return err
+		}
+	}
+	if len(record.History) == 0 {
+		return s.urlStorage.Delete(historyPrefix + shortURL)
+	}
+	return s.setRecord(historyPrefix+shortURL, record.History)
+}
+
+func (s *URLStorage) deleteVariantClicks(shortURL string) error {
+	var keys []string
+	err := s.rangeRecords(variantPrefix+shortURL+":", func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.urlStorage.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *URLStorage) SaveAPIKey(ctx context.Context, apiKey APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.urlStorage.Get(apiKeyPrefix + apiKey.KeyHash); err == nil {
+		return ExistsError
+	}
+	return s.setRecord(apiKeyPrefix+apiKey.KeyHash, apiKey)
+}
+
+func (s *URLStorage) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	var apiKey APIKey
+	err := s.getRecord(apiKeyPrefix+keyHash, &apiKey)
+	return apiKey, err
+}
+
+func (s *URLStorage) GetUserAPIKeys(ctx context.Context, userToken string) ([]APIKey, error) {
+	var apiKeys []APIKey
+	err := s.rangeRecords(apiKeyPrefix, func(key string, value []byte) error {
+		var apiKey APIKey
+		if err := json.Unmarshal(value, &apiKey); err != nil {
+			return err
+		}
+		if apiKey.UserToken == userToken {
+			apiKeys = append(apiKeys, apiKey)
+		}
+		return nil
+	})
+	return apiKeys, err
+}
+
+func (s *URLStorage) RevokeAPIKey(ctx context.Context, userToken, id string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apiKeys, err := s.GetUserAPIKeys(ctx, userToken)
+	if err != nil {
+		return err
+	}
+	for _, apiKey := range apiKeys {
+		if apiKey.ID != id {
+			continue
+		}
+		if apiKey.RevokedAt == nil {
+			apiKey.RevokedAt = &revokedAt
+		}
+		return s.setRecord(apiKeyPrefix+apiKey.KeyHash, apiKey)
+	}
+	return KeyError
+}
+
+func (s *URLStorage) CreateAccount(ctx context.Context, account Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.urlStorage.Get(accountPrefix + account.Username); err == nil {
+		return ExistsError
+	}
+	return s.setRecord(accountPrefix+account.Username, account)
+}
+
+func (s *URLStorage) GetAccount(ctx context.Context, username string) (Account, error) {
+	var account Account
+	err := s.getRecord(accountPrefix+username, &account)
+	return account, err
+}
+
+func (s *URLStorage) SaveSession(ctx context.Context, session Session) error {
+	return s.setRecord(sessionPrefix+session.TokenHash, session)
+}
+
+func (s *URLStorage) GetSession(ctx context.Context, tokenHash string) (Session, error) {
+	var session Session
+	err := s.getRecord(sessionPrefix+tokenHash, &session)
+	return session, err
+}
+
+func (s *URLStorage) DeleteSession(ctx context.Context, tokenHash string) error {
+	return s.urlStorage.Delete(sessionPrefix + tokenHash)
+}
+
+func (s *URLStorage) MergeUserURLs(ctx context.Context, fromUserToken, toUserToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fromURLs, err := s.getUserShortURLs(fromUserToken)
+	if err != nil || len(fromURLs) == 0 || fromUserToken == toUserToken {
+		return err
+	}
+	toURLs, err := s.getUserShortURLs(toUserToken)
+	if err != nil {
+		return err
+	}
+	owned := make(map[string]bool, len(toURLs))
+	for _, url := range toURLs {
+		owned[url] = true
+	}
+	for _, url := range fromURLs {
+		if !owned[url] {
+			toURLs = append(toURLs, url)
+		}
+	}
+	encodedURLs, err := json.Marshal(toURLs)
+	if err != nil {
+		return err
+	}
+	if err := s.userURLStorage.Set(toUserToken, encodedURLs); err != nil {
+		return err
+	}
+	return s.userURLStorage.Delete(fromUserToken)
+}
+
+func (s *URLStorage) GetLinkSettings(ctx context.Context, shortURL string) (LinkSettings, error) {
+	settings := LinkSettings{ShortURL: shortURL}
+	err := s.getRecord(linkSettingsPrefix+shortURL, &settings)
+	if errors.Is(err, KeyError) {
+		return LinkSettings{ShortURL: shortURL}, nil
+	}
+	return settings, err
+}
+
+func (s *URLStorage) SaveLinkSettings(ctx context.Context, settings LinkSettings) error {
+	return s.setRecord(linkSettingsPrefix+settings.ShortURL, settings)
+}
+
+func (s *URLStorage) UpdateOriginalURL(ctx context.Context, shortURL, originalURL string, changedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	currentURL, err := s.urlStorage.Get(shortURL)
+	if err != nil {
+		return err
+	}
+	if string(currentURL) == originalURL {
+		return nil
+	}
+	history, err := s.getURLHistory(shortURL)
+	if err != nil {
+		return err
+	}
+	history = append(history, URLVersion{
+		ShortURL:    shortURL,
+		Version:     int64(len(history) + 1),
+		OriginalURL: string(currentURL),
+		ReplacedAt:  changedAt,
+	})
+	if err := s.setRecord(historyPrefix+shortURL, history); err != nil {
+		return err
+	}
+	return s.urlStorage.Set(shortURL, []byte(originalURL))
+}
+
+func (s *URLStorage) GetURLHistory(ctx context.Context, shortURL string) ([]URLVersion, error) {
+	return s.getURLHistory(shortURL)
+}
+
+func (s *URLStorage) getURLHistory(shortURL string) ([]URLVersion, error) {
+	var history []URLVersion
+	if err := s.getRecord(historyPrefix+shortURL, &history); err != nil && !errors.Is(err, KeyError) {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (s *URLStorage) CreateWorkspace(ctx context.Context, workspace Workspace, owner WorkspaceMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.urlStorage.Get(workspacePrefix + workspace.ID); err == nil {
+		return ExistsError
+	}
+	if err := s.setRecord(workspacePrefix+workspace.ID, workspace); err != nil {
+		return err
+	}
+	return s.setRecord(memberKey(owner.WorkspaceID, owner.UserToken), owner)
+}
+
+func (s *URLStorage) GetWorkspace(ctx context.Context, id string) (Workspace, error) {
+	var workspace Workspace
+	err := s.getRecord(workspacePrefix+id, &workspace)
+	return workspace, err
+}
+
+func (s *URLStorage) GetWorkspaceMember(ctx context.Context, workspaceID, userToken string) (WorkspaceMember, error) {
+	var member WorkspaceMember
+	err := s.getRecord(memberKey(workspaceID, userToken), &member)
+	return member, err
+}
+
+func (s *URLStorage) GetWorkspaceMembers(ctx context.Context, workspaceID string) ([]WorkspaceMember, error) {
+	return s.getWorkspaceMembers(memberPrefix+workspaceID+":", func(WorkspaceMember) bool { return true })
+}
+
+func (s *URLStorage) GetUserWorkspaces(ctx context.Context, userToken string) ([]WorkspaceMember, error) {
+	return s.getWorkspaceMembers(memberPrefix, func(member WorkspaceMember) bool {
+		return member.UserToken == userToken
+	})
+}
+
+func (s *URLStorage) getWorkspaceMembers(prefix string, filter func(WorkspaceMember) bool) ([]WorkspaceMember, error) {
+	var members []WorkspaceMember
+	err := s.rangeRecords(prefix, func(key string, value []byte) error {
+		var member WorkspaceMember
+		if err := json.Unmarshal(value, &member); err != nil {
+			return err
+		}
+		if filter(member) {
+			members = append(members, member)
+		}
+		return nil
+	})
+	return members, err
+}
+
+func (s *URLStorage) SaveWorkspaceMember(ctx context.Context, member WorkspaceMember) error {
+	return s.setRecord(memberKey(member.WorkspaceID, member.UserToken), member)
+}
+
+func (s *URLStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID, userToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memberKey(workspaceID, userToken)
+	if _, err := s.urlStorage.Get(key); err != nil {
+		return err
+	}
+	return s.urlStorage.Delete(key)
+}
+
+func (s *URLStorage) SaveWorkspaceInvite(ctx context.Context, invite WorkspaceInvite) error {
+	return s.setRecord(invitePrefix+invite.TokenHash, invite)
+}
+
+func (s *URLStorage) TakeWorkspaceInvite(ctx context.Context, tokenHash string) (WorkspaceInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var invite WorkspaceInvite
+	if err := s.getRecord(invitePrefix+tokenHash, &invite); err != nil {
+		return invite, err
+	}
+	return invite, s.urlStorage.Delete(invitePrefix + tokenHash)
+}
+
+func (s *URLStorage) ConsumeQuota(ctx context.Context, userToken, day string, n int64, limits QuotaLimits) (QuotaUsage, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var usage QuotaUsage
+	if err := s.getRecord(quotaPrefix+userToken, &usage); err != nil && !errors.Is(err, KeyError) {
+		return usage, false, err
+	}
+	next, ok := usage.add(day, n, limits)
+	if !ok {
+		return usage, false, nil
+	}
+	return next, true, s.setRecord(quotaPrefix+userToken, next)
+}
+
+// add счетчики после добавления n ссылок за день day и признак того, что лимиты не превышены
+func (u QuotaUsage) add(day string, n int64, limits QuotaLimits) (QuotaUsage, bool) {
+	if u.Day != day {
+		u.Day, u.DayCount = day, 0
+	}
+	if n > 0 && (limits.Daily > 0 && u.DayCount+n > limits.Daily || limits.Total > 0 && u.Total+n > limits.Total) {
+		return u, false
+	}
+	u.DayCount = nonNegative(u.DayCount + n)
+	u.Total = nonNegative(u.Total + n)
+	return u, true
+}
+
+func nonNegative(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+func (s *URLStorage) ConsumeClick(ctx context.Context, shortURL string, maxClicks int64) (int64, bool, error) {
+	return s.incrementCounter(ctx, clicksPrefix+shortURL, maxClicks)
+}
+
+func (s *URLStorage) GetClicks(ctx context.Context, shortURL string) (int64, error) {
+	return s.getCounter(clicksPrefix + shortURL)
+}
+
+func (s *URLStorage) AddVariantClick(ctx context.Context, shortURL string, variant int) error {
+	_, _, err := s.incrementCounter(ctx, variantKey(shortURL, variant), 0)
+	return err
+}
+
+func (s *URLStorage) GetVariantClicks(ctx context.Context, shortURL string) (map[int]int64, error) {
+	clicks := make(map[int]int64)
+	err := s.rangeRecords(variantPrefix+shortURL+":", func(key string, value []byte) error {
+		variant, err := strconv.Atoi(key[strings.LastIndex(key, ":")+1:])
+		if err != nil {
+			return err
+		}
+		clicks[variant], err = strconv.ParseInt(string(value), 10, 64)
+		return err
+	})
+	return clicks, err
+}
+
+// variantKey счетчики вариантов хранятся по ключу "variant:<короткий URL>:<номер варианта>"
+func variantKey(shortURL string, variant int) string {
+	return variantPrefix + shortURL + ":" + strconv.Itoa(variant)
+}
+
+// getCounter значение счетчика, ноль - если его нет
+func (s *URLStorage) getCounter(key string) (int64, error) {
+	encodedValue, err := s.urlStorage.Get(key)
+	if errors.Is(err, KeyError) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(encodedValue), 10, 64)
+}
+
+// incrementCounter счетчик меняется через CompareAndSwap без общей блокировки, параллельный
+// переход просто повторяет попытку с новым значением. Счетчик не превышает max, если он задан.
+func (s *URLStorage) incrementCounter(ctx context.Context, key string, max int64) (int64, bool, error) {
+	for {
+		current, err := s.urlStorage.Get(key)
+		if err != nil && !errors.Is(err, KeyError) {
+			return 0, false, err
+		}
+		var value int64
+		if current != nil {
+			if value, err = strconv.ParseInt(string(current), 10, 64); err != nil {
+				return 0, false, err
+			}
+		}
+		if max > 0 && value >= max {
+			return value, false, nil
+		}
+		swapped, err := s.urlStorage.CompareAndSwap(key, current, []byte(strconv.FormatInt(value+1, 10)))
+		if err != nil {
+			return 0, false, err
+		}
+		if swapped {
+			return value + 1, true, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, false, err
+		}
+	}
+}
+
+func (s *URLStorage) SaveLinkPattern(ctx context.Context, pattern LinkPattern) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	patterns, err := s.getLinkPatterns()
+	if err != nil {
+		return err
+	}
+	for _, existing := range patterns {
+		if existing.ID == pattern.ID || existing.Shape == pattern.Shape {
+			return ExistsError
+		}
+	}
+	return s.setRecord(patternPrefix+pattern.ID, pattern)
+}
+
+func (s *URLStorage) GetLinkPatterns(ctx context.Context) ([]LinkPattern, error) {
+	return s.getLinkPatterns()
+}
+
+func (s *URLStorage) getLinkPatterns() ([]LinkPattern, error) {
+	var patterns []LinkPattern
+	err := s.rangeRecords(patternPrefix, func(key string, value []byte) error {
+		var pattern LinkPattern
+		if err := json.Unmarshal(value, &pattern); err != nil {
+			return err
+		}
+		patterns = append(patterns, pattern)
+		return nil
+	})
+	return patterns, err
+}
+
+func (s *URLStorage) DeleteLinkPattern(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.urlStorage.Get(patternPrefix + id); err != nil {
+		return err
+	}
+	return s.urlStorage.Delete(patternPrefix + id)
+}
+
+func (s *URLStorage) SaveCampaign(ctx context.Context, campaign Campaign) error {
+	return s.setRecord(campaignPrefix+campaign.ID, campaign)
+}
+
+func (s *URLStorage) GetCampaign(ctx context.Context, id string) (Campaign, error) {
+	var campaign Campaign
+	err := s.getRecord(campaignPrefix+id, &campaign)
+	return campaign, err
+}
+
+func (s *URLStorage) GetCampaigns(ctx context.Context, owner string) ([]Campaign, error) {
+	var campaigns []Campaign
+	err := s.rangeRecords(campaignPrefix, func(key string, value []byte) error {
+		var campaign Campaign
+		if err := json.Unmarshal(value, &campaign); err != nil {
+			return err
+		}
+		if campaign.Owner == owner {
+			campaigns = append(campaigns, campaign)
+		}
+		return nil
+	})
+	return campaigns, err
+}
+
+func (s *URLStorage) DeleteCampaign(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.urlStorage.Get(campaignPrefix + id); err != nil {
+		return err
+	}
+	return s.urlStorage.Delete(campaignPrefix + id)
+}
+
+func memberKey(workspaceID, userToken string) string {
+	return memberPrefix + workspaceID + ":" + userToken
+}
+
+// getRecord читает служебную запись, сохраненную в JSON
+func (s *URLStorage) getRecord(key string, record interface{}) error {
+	encodedRecord, err := s.urlStorage.Get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encodedRecord, record)
+}
+
+func (s *URLStorage) setRecord(key string, record interface{}) error {
+	encodedRecord, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.urlStorage.Set(key, encodedRecord)
+}
+
+// rangeRecords обходит служебные записи с префиксом prefix, пока fn не вернет ошибку
+func (s *URLStorage) rangeRecords(prefix string, fn func(key string, value []byte) error) error {
+	var fnErr error
+	err := s.urlStorage.Range(func(key string, value []byte) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return true
+		}
+		fnErr = fn(key, value)
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
 func (s *URLStorage) Ping(ctx context.Context) error {
 	return nil
 }
@@ -107,8 +822,12 @@ func (s *URLStorage) Shutdown(ctx context.Context) error {
 }
 
 func NewURLStorage(urlStorage Storage) *URLStorage {
+	return newURLStorage(urlStorage, NewMapStorage()) // InMemoryStorage по-дефолту
+}
+
+func newURLStorage(urlStorage Storage, userURLStorage Storage) *URLStorage {
 	return &URLStorage{
 		urlStorage:     urlStorage,
-		userURLStorage: NewMapStorage(), // InMemoryStorage по-дефолту
+		userURLStorage: userURLStorage,
 	}
 }
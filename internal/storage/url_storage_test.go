@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLStorageLinkSettings(t *testing.T) {
+	ctx := context.Background()
+	s := NewURLStorage(NewMapStorage())
+	const shortURL = "http://localhost:8080/abc/"
+	require.NoError(t, s.SaveData(ctx, "user", URLData{ShortURL: shortURL, OriginalURL: "https://github.com"}))
+
+	settings, err := s.GetLinkSettings(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, LinkSettings{ShortURL: shortURL}, settings)
+
+	settings.Disabled = true
+	require.NoError(t, s.SaveLinkSettings(ctx, settings))
+	settings, err = s.GetLinkSettings(ctx, shortURL)
+	require.NoError(t, err)
+	require.True(t, settings.Disabled)
+
+	// Запись настроек содержит короткий URL в ключе, но ссылкой не считается
+	urls, err := s.GetAllURLs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []URLData{{ShortURL: shortURL, OriginalURL: "https://github.com"}}, urls)
+}
+
+func TestURLStorageWorkspaces(t *testing.T) {
+	ctx := context.Background()
+	s := NewURLStorage(NewMapStorage())
+	workspace := Workspace{ID: "ws", Name: "Team"}
+	require.NoError(t, s.CreateWorkspace(ctx, workspace, WorkspaceMember{WorkspaceID: "ws", UserToken: "alice", Role: "owner"}))
+	require.ErrorIs(t, s.CreateWorkspace(ctx, workspace, WorkspaceMember{WorkspaceID: "ws", UserToken: "bob", Role: "owner"}), ExistsError)
+	require.NoError(t, s.SaveWorkspaceMember(ctx, WorkspaceMember{WorkspaceID: "ws2", UserToken: "alice", Role: "viewer"}))
+
+	members, err := s.GetWorkspaceMembers(ctx, "ws")
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	memberships, err := s.GetUserWorkspaces(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, memberships, 2)
+	require.ErrorIs(t, s.DeleteWorkspaceMember(ctx, "ws", "bob"), KeyError)
+
+	require.NoError(t, s.SaveWorkspaceInvite(ctx, WorkspaceInvite{TokenHash: "hash", WorkspaceID: "ws", Role: "viewer"}))
+	invite, err := s.TakeWorkspaceInvite(ctx, "hash")
+	require.NoError(t, err)
+	require.Equal(t, "ws", invite.WorkspaceID)
+	_, err = s.TakeWorkspaceInvite(ctx, "hash")
+	require.ErrorIs(t, err, KeyError)
+}
+
+func TestURLStorageConsumeQuota(t *testing.T) {
+	ctx := context.Background()
+	s := NewURLStorage(NewMapStorage())
+	limits := QuotaLimits{Daily: 3, Total: 5}
+
+	usage, ok, err := s.ConsumeQuota(ctx, "user", "2022-01-01", 3, limits)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, QuotaUsage{Day: "2022-01-01", DayCount: 3, Total: 3}, usage)
+
+	usage, ok, err = s.ConsumeQuota(ctx, "user", "2022-01-01", 1, limits)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, int64(3), usage.DayCount)
+
+	// Новый день обнуляет дневной счетчик, но не общий
+	_, ok, err = s.ConsumeQuota(ctx, "user", "2022-01-02", 3, limits)
+	require.NoError(t, err)
+	require.False(t, ok)
+	usage, ok, err = s.ConsumeQuota(ctx, "user", "2022-01-02", 2, limits)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, QuotaUsage{Day: "2022-01-02", DayCount: 2, Total: 5}, usage)
+
+	// Возврат ссылок в квоту выполняется без проверки лимитов
+	usage, ok, err = s.ConsumeQuota(ctx, "user", "2022-01-02", -1, limits)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, QuotaUsage{Day: "2022-01-02", DayCount: 1, Total: 4}, usage)
+
+	_, ok, err = s.ConsumeQuota(ctx, "other", "2022-01-02", 6, QuotaLimits{})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestURLStorageConsumeClick(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "storage")
+	fileStorage, err := NewURLFileStorage(filePath)
+	require.NoError(t, err)
+	s := NewURLStorage(fileStorage)
+	const shortURL = "http://localhost:8080/abc/"
+
+	// Параллельные переходы не могут вместе превысить лимит
+	var consumed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := s.ConsumeClick(ctx, shortURL, 10)
+			require.NoError(t, err)
+			if ok {
+				atomic.AddInt64(&consumed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(10), consumed)
+
+	// Счетчик восстанавливается из файла
+	require.NoError(t, fileStorage.Shutdown(ctx))
+	fileStorage, err = NewURLFileStorage(filePath)
+	require.NoError(t, err)
+	defer fileStorage.Shutdown(ctx)
+	clicks, ok, err := NewURLStorage(fileStorage).ConsumeClick(ctx, shortURL, 10)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, int64(10), clicks)
+}
+
+func TestURLStorageVariantClicks(t *testing.T) {
+	ctx := context.Background()
+	s := NewURLStorage(NewMapStorage())
+	const shortURL = "http://localhost:8080/abc/"
+	require.NoError(t, s.AddVariantClick(ctx, shortURL, 1))
+	require.NoError(t, s.AddVariantClick(ctx, shortURL, 2))
+	require.NoError(t, s.AddVariantClick(ctx, shortURL, 2))
+	// Счетчики другой ссылки с похожим адресом не смешиваются
+	require.NoError(t, s.AddVariantClick(ctx, "http://localhost:8080/abcd/", 1))
+
+	clicks, err := s.GetVariantClicks(ctx, shortURL)
+	require.NoError(t, err)
+	require.Equal(t, map[int]int64{1: 1, 2: 2}, clicks)
+}
+
+// TestURLFileStoragesKeepOwners после перезапуска у пользователя остаются его ссылки
+func TestURLFileStoragesKeepOwners(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "storage")
+	s, err := NewURLFileStorages(filePath)
+	require.NoError(t, err)
+	urlData := URLData{ShortURL: "http://localhost:8080/abc/", OriginalURL: "https://github.com"}
+	require.NoError(t, s.SaveData(ctx, "user", urlData))
+	require.NoError(t, s.Shutdown(ctx))
+
+	s, err = NewURLFileStorages(filePath)
+	require.NoError(t, err)
+	defer s.Shutdown(ctx)
+	userURLs, err := s.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, []URLData{urlData}, userURLs)
+}